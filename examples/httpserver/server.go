@@ -38,9 +38,8 @@ var gozlibCompressorPool = sync.Pool{
 	},
 }
 
-func bufferedCopyAll(body io.Reader, w io.Writer) {
-	buffer := bufPool.Acquire(requestBufferSize)
-	defer bufPool.Return(buffer)
+func bufferedCopyAll(arena *gozlib.Arena, body io.Reader, w io.Writer) {
+	buffer := arena.Alloc(requestBufferSize)
 
 	for {
 		n, err := body.Read(buffer[len(buffer):cap(buffer)])
@@ -79,12 +78,16 @@ func gozlibCompress(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
+	// every buffer used by the request is returned to the pool at once
+	arena := gozlib.NewArena(bufPool)
+	defer arena.Release()
+
 	compressor := gozlibCompressorPool.Get().(io.WriteCloser)
 	defer gozlibCompressorPool.Put(compressor)
 
 	gozlib.ResetCompressor(w, compressor)
 
-	bufferedCopyAll(r.Body, compressor)
+	bufferedCopyAll(arena, r.Body, compressor)
 
 	ferr := gozlib.Flush(compressor)
 
@@ -104,7 +107,10 @@ func stdgzipCompress(w http.ResponseWriter, r *http.Request) {
 	compressor, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
 	defer compressor.Close()
 
-	bufferedCopyAll(r.Body, compressor)
+	arena := gozlib.NewArena(bufPool)
+	defer arena.Release()
+
+	bufferedCopyAll(arena, r.Body, compressor)
 
 	ferr := compressor.Flush()
 	if ferr != nil {
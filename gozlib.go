@@ -4,8 +4,9 @@
 // Using this package requires cgo and a gnu compiler (clang or gcc), as well as the development version of zlib installed
 // By default, it expect the zlib header and so files to be in the standard include and library path. If not, you can override it
 // by setting the appropriate paths in the environment variables CGO_CFLAGS and CGO_LDFLAGS
-// Internally gozlib utilizes an off-heap memory pool to maximize memory usage. At this moment, allocated memory is never
-// returned to the system so gozlib is best used when gzip operations are frequent and constant.
+// Internally gozlib utilizes an off-heap memory pool to maximize memory usage. Allocated memory is kept in the pool
+// rather than returned to the system so gozlib is best used when gzip operations are frequent and constant.
+// Transformers can bypass the pool when that's not the case, see TransformerOptions and SetNativePoolBypass.
 // This pool is also available for use in the Go code as a way to allocate and reuse byte slices.
 // See NativeSlicePool for details
 package gozlib
@@ -14,14 +15,16 @@ package gozlib
 #cgo CFLAGS: -Wall -Wno-unused-variable -Werror -O3 -g0 -DGOZLIB_GO_INTEROP -DNDEBUG
 #cgo LDFLAGS: -lz
 #include "zwrapper/gozlib.h"
-#include "zwrapper/gozlib.c"
+#include "zwrapper/gozlib_interop.h"
 */
 import "C"
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"sync"
 	"unsafe"
 )
 
@@ -39,26 +42,53 @@ for information pertaining to memory usage between Go and C, see also see https:
 type CompressionLevel int
 type TransformMode int
 
+// Any level from CompressionLevelNone to CompressionLevelBestCompression can be used, as well as CompressionLevelDefault,
+// higher levels trading CPU for a better compression ratio like the levels of compress/gzip
 const (
-	CompressionLevelBestCompression CompressionLevel = C.Z_BEST_COMPRESSION
+	CompressionLevelDefault         CompressionLevel = C.Z_DEFAULT_COMPRESSION
+	CompressionLevelNone            CompressionLevel = C.Z_NO_COMPRESSION
 	CompressionLevelBestSpeed       CompressionLevel = C.Z_BEST_SPEED
+	CompressionLevelBestCompression CompressionLevel = C.Z_BEST_COMPRESSION
 )
 
 const (
 	TransformModeZLib       TransformMode = 0
 	TransformModeGZip       TransformMode = 1
 	TransformModeUncompress TransformMode = 2
+	// raw deflate data has no zlib or gzip wrapper, header or checksum
+	TransformModeRawDeflate    TransformMode = 3
+	TransformModeRawUncompress TransformMode = 4
 )
 
 const (
 	wrapErrorFormat = "%w ZLib error code %d"
 )
 
+// validate returns CompressionLevelError if the level isn't supported by zlib
+func (cl CompressionLevel) validate() error {
+	if cl != CompressionLevelDefault && (cl < CompressionLevelNone || cl > CompressionLevelBestCompression) {
+		return fmt.Errorf("%w: %d", CompressionLevelError, cl)
+	}
+	return nil
+}
+
+// writes smaller than smallWriteBufferSize are coalesced in native memory before being compressed,
+// saving one cgo call per write for callers emitting only a few bytes at a time
+const smallWriteBufferSize = 512
+
+// reads smaller than smallReadBufferSize are served from a native read ahead buffer
+// so that callers consuming a few bytes at a time don't pay for one cgo call per read
+const smallReadBufferSize = 512
+
 var (
+	CompressionLevelError = errors.New("invalid compression level")
+
 	// transformer
 	TransformerUncompressionError  = errors.New("error uncompressing data")
 	TransformerInitializationError = errors.New("error initializing transformer")
 	TransformerCompressionError    = errors.New("error compressing data")
+	PeekSizeError                  = errors.New("peek size is negative or larger than the read ahead buffer")
+	BufferSizeError                = errors.New("invalid buffer size")
 
 	// streaming
 	StreamCompressError   = errors.New("error streaming compressed data")
@@ -83,19 +113,87 @@ type goZLibTransformer struct {
 	output      io.Writer
 	transformer *C.GoZLibTransformer
 	twh         *transformerWriterHandler
+	// unpooled transformers allocate their native memory without the internal pools
+	unpooled bool
+	// strategy is the deflate strategy compression transformers are initialized with
+	strategy CompressionStrategy
+	// initWindowBits are the zlib window bits compression transformers are initialized with, which select the format
+	initWindowBits int
+}
+
+// Compressor is implemented by all compressors created by this package, which are returned as io.WriteCloser
+// The flush methods cover distinct needs: SyncFlush makes everything written so far available to the receiver,
+// FullFlush also allows uncompression to restart from that point and Finish ends the stream, for example to
+// complete a gzip member, without releasing the compressor.
+type Compressor interface {
+	io.WriteCloser
+	Flush() error
+	SyncFlush() error
+	FullFlush() error
+	Finish() (uint64, error)
 }
 
 type goGZipCompressor struct {
 	goZLibTransformer
+	level      CompressionLevel
+	pending    []byte
+	pendingPtr unsafe.Pointer
+	// emptyWriteMode controls what a Write call without data does
+	emptyWriteMode EmptyWriteMode
+	// writeChunking controls how large writes are split into separate native calls
+	writeChunking WriteChunkOptions
+	// windowBits is the size of the deflate sliding window, as a power of 2
+	windowBits int
+	// gzHeaderPtr is the native copy of the gzip header set with TransformerOptions.Header, nil for the default header
+	gzHeaderPtr unsafe.Pointer
+	// gzHeaderFieldsLen is the size of the optional fields of the gzip header, see FlushOverhead
+	gzHeaderFieldsLen int
+	// flushAccounting tracks the output spent on flush markers since the compressor was created or reset
+	flushAccounting flushAccounting
 }
 
 // NewGoGZipCompressor creates a new gzip compressor
 // The compressor writes compressed data to the provided output Writer.
-// The level parameter specifies the compression level. It can be set to CompressionLevelBestCompression or CompressionLevelBestSpeed
+// The level parameter specifies the compression level, from CompressionLevelNone to CompressionLevelBestCompression or CompressionLevelDefault
 // The bufferSize parameter specifies the size of the buffer used by the compressor. For best performance, set it to a size that's power 2,
 // large enough for the expected input.
 // Returns an io.WriteCloser for writing compressed data and an error, if any.
-func NewGoGZipCompressor(output io.Writer, level CompressionLevel, bufferSize uint32) (io.WriteCloser, error) {
+func NewGoGZipCompressor(output io.Writer, level CompressionLevel, bufferSize uint32) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewGoGZipCompressor", &err)
+
+	goComp, err := newGoCompressor(output, TransformModeGZip, level, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return goComp, nil
+}
+
+// NewGoZLibCompressor creates a new zlib compressor, producing the format of RFC 1950 like compress/zlib
+// The parameters and the returned compressor are the same as the ones of NewGoGZipCompressor.
+func NewGoZLibCompressor(output io.Writer, level CompressionLevel, bufferSize uint32) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewGoZLibCompressor", &err)
+
+	goComp, err := newGoCompressor(output, TransformModeZLib, level, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return goComp, nil
+}
+
+// newGoCompressor creates a compressor producing data in the format given by mode
+func newGoCompressor(output io.Writer, mode TransformMode, level CompressionLevel, bufferSize uint32) (*goGZipCompressor, error) {
+	return newGoCompressorWithInit(output, level, func(goTransformer *goZLibTransformer) error {
+		return initTransformer(goTransformer, mode, level, bufferSize)
+	})
+}
+
+// newGoCompressorWithInit creates a compressor whose native transformer is initialized by the init function
+func newGoCompressorWithInit(output io.Writer, level CompressionLevel, init func(goTransformer *goZLibTransformer) error) (*goGZipCompressor, error) {
+	lerr := level.validate()
+	if lerr != nil {
+		return nil, lerr
+	}
+
 	twh := &transformerWriterHandler{
 		writtenBytes:     0,
 		eventHandlers:    nil,
@@ -103,33 +201,119 @@ func NewGoGZipCompressor(output io.Writer, level CompressionLevel, bufferSize ui
 	}
 
 	goComp := &goGZipCompressor{
-		goZLibTransformer{
+		goZLibTransformer: goZLibTransformer{
 			input:       nil,
 			output:      output,
 			transformer: nil,
 			twh:         twh,
+			unpooled:    nativePoolBypass.Load(),
 		},
+		level:      level,
+		pending:    nil,
+		pendingPtr: nil,
+		windowBits: C.MAX_WBITS,
 	}
 
-	err := initTransformer(&goComp.goZLibTransformer, TransformModeGZip, level, bufferSize)
+	err := init(&goComp.goZLibTransformer)
+	if err != nil {
+		return nil, err
+	}
+	goComp.pendingPtr = goComp.nativeAlloc(smallWriteBufferSize)
+	goComp.pending = nativeSlice(goComp.pendingPtr, 0, smallWriteBufferSize)
 
 	twh.eventHandlers.onWrite = func(compressed []byte) uint32 {
 		written, werr := goComp.output.Write(compressed)
+		if werr == nil && written < len(compressed) {
+			werr = io.ErrShortWrite
+		}
 		if werr != nil {
+			twh.eventHandlers.setErr(werr)
 			return 0
 		}
 		return uint32(written)
 	}
 
-	if err != nil {
-		return nil, err
-	}
 	return goComp, nil
 }
 
 // Write compresses and writes the given data to the output stream. Returns the
 // number of uncompressed bytes written, and any error that occurred.
-func (comp *goGZipCompressor) Write(data []byte) (int, error) {
+// Small writes are buffered internally and only compressed once enough data is accumulated or the compressor is flushed.
+// Writes without data do nothing unless the compressor is set to flush on them, see SetEmptyWriteMode.
+// Large writes are compressed by a single native call unless write chunking is set, see SetWriteChunking.
+func (comp *goGZipCompressor) Write(data []byte) (n int, err error) {
+	defer recoverPanic("Write", &err)
+
+	dataLen := len(data)
+
+	if dataLen == 0 {
+		if comp.emptyWriteMode == EmptyWriteFlush {
+			return 0, comp.Flush()
+		}
+		return 0, nil
+	}
+
+	if len(comp.pending)+dataLen <= cap(comp.pending) {
+		pendingLen := len(comp.pending)
+		comp.pending = comp.pending[:pendingLen+dataLen]
+		// data serialized into the slice from AvailableBuffer is already in place
+		if &data[0] != &comp.pending[pendingLen] {
+			copy(comp.pending[pendingLen:], data)
+		}
+		return dataLen, nil
+	}
+
+	perr := comp.compressPending()
+	if perr != nil {
+		return 0, perr
+	}
+
+	if dataLen < cap(comp.pending) {
+		comp.pending = append(comp.pending, data...)
+		return dataLen, nil
+	}
+
+	if comp.writeChunking.ChunkSize > 0 && dataLen > comp.writeChunking.ChunkSize {
+		return comp.compressChunks(data)
+	}
+
+	return comp.compress(data)
+}
+
+// WriteByte writes a single byte to the compressor, buffering it internally so that no cgo call is made per byte.
+func (comp *goGZipCompressor) WriteByte(c byte) (err error) {
+	defer recoverPanic("WriteByte", &err)
+
+	if len(comp.pending) == cap(comp.pending) {
+		perr := comp.compressPending()
+		if perr != nil {
+			return perr
+		}
+	}
+
+	comp.pending = append(comp.pending, c)
+	return nil
+}
+
+// AvailableBuffer returns an empty slice backed by the spare capacity of the internal buffer holding small writes,
+// like bufio.Writer does. Data appended to it and passed to the immediately following Write isn't copied again.
+// The buffer is only valid until the next write operation.
+func (comp *goGZipCompressor) AvailableBuffer() []byte {
+	return comp.pending[len(comp.pending):len(comp.pending)]
+}
+
+func (comp *goGZipCompressor) compressPending() error {
+	if len(comp.pending) == 0 {
+		return nil
+	}
+
+	_, cerr := comp.compress(comp.pending)
+	comp.pending = comp.pending[:0]
+
+	return cerr
+}
+
+func (comp *goGZipCompressor) compress(data []byte) (int, error) {
 	dataLen := len(data)
 	uncompressedLen := C.uInt(dataLen)
 
@@ -138,39 +322,177 @@ func (comp *goGZipCompressor) Write(data []byte) (int, error) {
 		uncompressed = unsafe.Pointer(&data[0])
 	}
 
-	transformCode := C.go_transformer_compress_to_outstream(comp.transformer, uncompressed, uncompressedLen)
+	nativeWork.enter()
+	start := startNativeCall()
+	var transformCode C.int
+	if direct, ok := comp.output.(availableBufferWriter); ok {
+		flush := C.int(C.Z_NO_FLUSH)
+		if dataLen == 0 {
+			flush = C.Z_FINISH
+		}
+		transformCode = comp.deflateDirect(direct, data, flush)
+	} else {
+		transformCode = C.go_transformer_compress_to_outstream(comp.transformer, uncompressed, uncompressedLen)
+	}
+	endNativeCall(NativeCompress, start)
+	nativeWork.end()
 
 	if transformCode < C.Z_OK {
-		return 0, fmt.Errorf(wrapErrorFormat, TransformerCompressionError, transformCode)
+		return 0, comp.transformError(transformCode)
 	}
 
 	return dataLen, nil
 }
 
-// Flush flushes the compressor by invoking Write with a zero input. If there is
+// Flush compresses all data written so far and ends the compressed stream. If there is
 // any error during writing, it will be returned.
-func (comp *goGZipCompressor) Flush() error {
-	// flush by invoking write with zero input
-	_, ferr := comp.Write(nil)
+// To make everything written so far available to the receiver without ending the stream, use SyncFlush.
+func (comp *goGZipCompressor) Flush() (err error) {
+	defer recoverPanic("Flush", &err)
+
+	perr := comp.compressPending()
+	if perr != nil {
+		return perr
+	}
+
+	// compressing no input finishes the stream
+	_, ferr := comp.compress(nil)
+	comp.flushAccounting.finished = ferr == nil
 
 	return ferr
 }
 
+// Finish flushes the compressor, ending the compressed stream, and returns the total number of compressed bytes
+// written to the output since the compressor was created or last reset.
+// Finish doesn't release any resources and Close must still be invoked once the compressor is no longer needed.
+func (comp *goGZipCompressor) Finish() (compressedLen uint64, err error) {
+	defer recoverPanic("Finish", &err)
+
+	ferr := comp.Flush()
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	return uint64(comp.transformer.zs.total_out), nil
+}
+
+// SyncFlush compresses all data written so far and aligns the output to a byte boundary without ending the stream,
+// so that the receiving end can uncompress everything written up to this point
+func (comp *goGZipCompressor) SyncFlush() (err error) {
+	defer recoverPanic("SyncFlush", &err)
+
+	return comp.flushWithMode(C.Z_SYNC_FLUSH)
+}
+
+// FullFlush is like SyncFlush but also resets the compression state, so that uncompression can restart from this point.
+// Flushing this way often degrades compression, which is why it's best used sparingly, for example at the boundaries of rsyncable output.
+func (comp *goGZipCompressor) FullFlush() (err error) {
+	defer recoverPanic("FullFlush", &err)
+
+	return comp.flushWithMode(C.Z_FULL_FLUSH)
+}
+
+func (comp *goGZipCompressor) flushWithMode(flush C.int) error {
+	perr := comp.compressPending()
+	if perr != nil {
+		return perr
+	}
+
+	nativeWork.enter()
+	start := startNativeCall()
+	var transformCode C.int
+	if comp.flushAccounting.enabled {
+		transformCode = comp.completeBlock()
+		if transformCode >= C.Z_OK {
+			dataEnd := comp.outputBits()
+			transformCode = comp.deflateFlush(flush)
+			comp.recordFlush(dataEnd)
+		}
+	} else {
+		transformCode = comp.deflateFlush(flush)
+	}
+	endNativeCall(NativeFlush, start)
+	nativeWork.end()
+	if transformCode < C.Z_OK {
+		return comp.transformError(transformCode)
+	}
+
+	return nil
+}
+
+// deflateFlush compresses everything written so far with the given flush mode
+func (comp *goGZipCompressor) deflateFlush(flush C.int) C.int {
+	if direct, ok := comp.output.(availableBufferWriter); ok {
+		transformCode := comp.deflateDirect(direct, nil, flush)
+		// flushing twice without new input can't make progress, which isn't an error here
+		if transformCode == C.Z_BUF_ERROR {
+			return C.Z_OK
+		}
+		return transformCode
+	}
+	return C.go_transformer_compress_flush(comp.transformer, flush)
+}
+
+// transformError returns the error raised by the output writer during a native call, if any, or an error with the
+// zlib result code otherwise
+func (comp *goGZipCompressor) transformError(transformCode C.int) error {
+	if comp.twh.eventHandlers.err != nil {
+		return comp.twh.eventHandlers.err
+	}
+
+	return fmt.Errorf(wrapErrorFormat, TransformerCompressionError, transformCode)
+}
+
 // Close releases the resources used by the compressor. It first flushes the compressor,
 // then releases all interenal resources. If there
 // is any error during flushing or releasing, it will be returned.
 // Not calling Close will result in a resource leak
-func (comp *goGZipCompressor) Close() error {
+func (comp *goGZipCompressor) Close() (err error) {
+	defer recoverPanic("Close", &err)
+
 	ferr := comp.Flush()
 	C.release_compression_transformer(comp.transformer)
 	unregisterStreamEventHandler(comp.twh.eventHandlersPtr)
 	C.pool_free(comp.twh.eventHandlersPtr)
+	C.pool_free(comp.pendingPtr)
+	if comp.gzHeaderPtr != nil {
+		C.pool_free(comp.gzHeaderPtr)
+	}
 	return ferr
 }
 
 type goUncompressor struct {
 	goZLibTransformer
 	hasMoreData bool
+	// uncompressed data not yet consumed is kept in readAhead[readAheadPos:]
+	// the read ahead buffer is only allocated once small reads are requested
+	readAhead    []byte
+	readAheadPos int
+	readAheadPtr unsafe.Pointer
+	// atInput is the input of uncompressors reading from an io.ReaderAt, kept here so resets don't allocate
+	atInput offsetReader
+	// buffersInput is the input of uncompressors reading from a list of buffers, kept here for the same reason
+	buffersInput buffersReader
+	// trailingMode controls what happens with input after the end of the compressed stream
+	trailingMode TrailingDataMode
+	ended        bool
+	trailing     []byte
+	// integrityMode controls how checksum and length mismatches and truncated input are reported
+	integrityMode IntegrityMode
+	// windowBits are the zlib window bits the transformer was initialized with
+	windowBits C.int
+	// releaseWindow frees the inflate window on reset
+	releaseWindow bool
+	// dictionaryResolver provides the preset dictionary of zlib streams that need one
+	dictionaryResolver DictionaryResolver
+	// resumed is uncompressed data restored from a ReadPosition, served before any data uncompressed from the input
+	resumed []byte
+	// gzHeaderPtr is the native gzip header filled by zlib once Header was called, nil otherwise
+	gzHeaderPtr unsafe.Pointer
+	// maxOutput is the maximum number of bytes uncompressed from the input, zero if there's no limit
+	maxOutput int64
+	// uncompressedLen is the number of bytes uncompressed from the input since the uncompressor was created or reset
+	uncompressedLen int64
 }
 
 // NewGoZLibUncompressor creates a new uncompressor that supports zlib or gzip inputs
@@ -178,7 +500,23 @@ type goUncompressor struct {
 // and the bufferSize parameter is the size of the buffer to use in the internal compression transformer.
 // For best performance, set it to a size that's power 2,
 // large enough for the expected input.
-func NewGoZLibUncompressor(input io.Reader, bufferSize uint32) (io.ReadCloser, error) {
+func NewGoZLibUncompressor(input io.Reader, bufferSize uint32) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewGoZLibUncompressor", &err)
+
+	goUncomp, err := newGoUncompressor(input, TransformModeUncompress, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return goUncomp, nil
+}
+
+// newGoUncompressor creates an uncompressor consuming data in the format given by mode
+func newGoUncompressor(input io.Reader, mode TransformMode, bufferSize uint32) (*goUncompressor, error) {
+	return newGoUncompressorWithOptions(input, mode, bufferSize, TransformerOptions{})
+}
+
+// newGoUncompressorWithOptions creates an uncompressor consuming data in the format given by mode, set up with options
+func newGoUncompressorWithOptions(input io.Reader, mode TransformMode, bufferSize uint32, options TransformerOptions) (*goUncompressor, error) {
 	twh := &transformerWriterHandler{
 		writtenBytes:     0,
 		eventHandlers:    nil,
@@ -191,12 +529,23 @@ func NewGoZLibUncompressor(input io.Reader, bufferSize uint32) (io.ReadCloser, e
 			input:       input,
 			transformer: nil,
 			twh:         twh,
+			unpooled:    options.BypassNativePool || nativePoolBypass.Load(),
 		},
-		hasMoreData: false,
+		hasMoreData:  false,
+		readAhead:    nil,
+		readAheadPos: 0,
+		readAheadPtr: nil,
+		windowBits:   C.UNCOMPRESS_ANY_WINDOW_BITS,
+	}
+	if mode == TransformModeRawUncompress {
+		goUncomp.windowBits = C.RAW_DEFLATE_WINDOW_BITS
 	}
 
 	// no need for level when uncompressing so we set it to zero
-	err := initTransformer(&goUncomp.goZLibTransformer, TransformModeUncompress, 0, bufferSize)
+	err := initTransformer(&goUncomp.goZLibTransformer, mode, 0, bufferSize)
+	if err != nil {
+		return nil, err
+	}
 
 	// we want to write directly into the output buffer
 	// so this handler only tracks the amount written, the actual content
@@ -206,22 +555,274 @@ func NewGoZLibUncompressor(input io.Reader, bufferSize uint32) (io.ReadCloser, e
 		return uint32(twh.writtenBytes)
 	}
 
-	if err != nil {
-		return nil, err
-	}
 	return goUncomp, nil
 }
 
 // Read reads uncompressed data from the input stream and writes it to the output buffer.
 // The function returns the number of bytes read into the output buffer and any error encountered.
 // If there is no more data to be read, Read returns io.EOF.
-func (unc *goUncompressor) Read(output []byte) (int, error) {
+// Reads into buffers smaller than 512 bytes are served from an internal read ahead buffer.
+func (unc *goUncompressor) Read(output []byte) (n int, err error) {
+	defer recoverPanic("Read", &err)
+
+	if len(output) == 0 {
+		return 0, nil
+	}
+
+	if unc.readAheadPos == len(unc.readAhead) && len(output) >= smallReadBufferSize {
+		return unc.readDirect(output)
+	}
+
+	for unc.readAheadPos == len(unc.readAhead) {
+		ferr := unc.fillReadAhead()
+		if ferr != nil {
+			return 0, ferr
+		}
+	}
+
+	readLen := copy(output, unc.readAhead[unc.readAheadPos:])
+	unc.readAheadPos += readLen
+
+	return readLen, nil
+}
+
+// ReadByte reads and returns the next uncompressed byte. If there is no more data to be read, ReadByte returns io.EOF.
+func (unc *goUncompressor) ReadByte() (value byte, err error) {
+	defer recoverPanic("ReadByte", &err)
+
+	for unc.readAheadPos == len(unc.readAhead) {
+		ferr := unc.fillReadAhead()
+		if ferr != nil {
+			return 0, ferr
+		}
+	}
+
+	c := unc.readAhead[unc.readAheadPos]
+	unc.readAheadPos++
+
+	return c, nil
+}
+
+// Peek returns the next n uncompressed bytes without consuming them. If fewer than n bytes are returned,
+// an error explaining why is returned as well, io.EOF if the end of the data was reached.
+// Peeked data is kept in the native read ahead buffer, which is at least 512 bytes or the size of the work buffer, whichever is larger.
+// Requesting more than that returns PeekSizeError. The returned slice is only valid until the next read.
+func (unc *goUncompressor) Peek(n int) (peeked []byte, err error) {
+	defer recoverPanic("Peek", &err)
+
+	if n < 0 {
+		return nil, PeekSizeError
+	}
+
+	var peekErr error
+	for peekErr == nil && len(unc.readAhead)-unc.readAheadPos < n {
+		if unc.readAheadPtr != nil && len(unc.readAhead)-unc.readAheadPos == cap(unc.readAhead) {
+			peekErr = PeekSizeError
+			break
+		}
+		peekErr = unc.fillReadAhead()
+	}
+
+	available := unc.readAhead[unc.readAheadPos:]
+	if len(available) > n {
+		available = available[:n]
+	}
+
+	return available, peekErr
+}
+
+// readDirect uncompresses directly into output, retrying until at least one byte is produced or an error occurs
+func (unc *goUncompressor) readDirect(output []byte) (int, error) {
+	for {
+		readLen, readErr := unc.uncompressStep(output)
+		if readLen > 0 || readErr != nil {
+			return readLen, readErr
+		}
+	}
+}
+
+// Skip uncompresses and discards the next n bytes. Discarded data is never copied into Go memory.
+// It returns the number of bytes skipped, which is less than n only if an error occurred, io.EOF if the end of the data was reached.
+func (unc *goUncompressor) Skip(n int64) (skippedLen int64, err error) {
+	defer recoverPanic("Skip", &err)
+
+	if n <= 0 {
+		return 0, nil
+	}
+
+	buffered := int64(len(unc.readAhead) - unc.readAheadPos)
+	if buffered >= n {
+		unc.readAheadPos += int(n)
+		return n, nil
+	}
+
+	// the read ahead buffer only holds data within the output limit
+	if unc.maxOutput > 0 && unc.uncompressedLen > unc.maxOutput {
+		unc.readAheadPos = len(unc.readAhead)
+		return buffered, DecompressedSizeLimitError
+	}
+
+	skipped := buffered
+	unc.ensureReadAhead()
+	unc.readAhead = unc.readAhead[:0]
+	unc.readAheadPos = 0
+
+	resumedLen := int64(len(unc.resumed))
+	if resumedLen > n-skipped {
+		resumedLen = n - skipped
+	}
+	unc.resumed = unc.resumed[resumedLen:]
+	skipped += resumedLen
+	unc.uncompressedLen += resumedLen
+
+	// skipped data counts towards the output limit, skipping one byte past it tells if it's exceeded
+	if unc.maxOutput > 0 {
+		left := unc.maxOutput - unc.uncompressedLen + 1
+		if left < 0 {
+			left = 0
+		}
+		if n-skipped > left {
+			n = skipped + left
+		}
+	}
+
+	skipped, err = unc.skipUncompressed(skipped, n)
+	if unc.maxOutput > 0 && unc.uncompressedLen > unc.maxOutput {
+		return skipped - (unc.uncompressedLen - unc.maxOutput), DecompressedSizeLimitError
+	}
+
+	return skipped, err
+}
+
+// skipUncompressed uncompresses and discards data until n bytes were skipped, counting the ones already skipped
+func (unc *goUncompressor) skipUncompressed(skipped int64, n int64) (int64, error) {
+	for skipped < n {
+		if unc.ended {
+			return skipped, unc.trailingDataError()
+		}
+
+		if !unc.hasMoreData {
+			readLen, readError := unc.readIntoWorkBuffer()
+			if readError != nil {
+				return skipped, unc.inputError(readError)
+			}
+
+			if readLen == 0 {
+				continue
+			}
+
+			C.go_assign_uncompress_input(unc.transformer, C.uInt(readLen))
+		}
+
+		// the read ahead buffer is empty so it can be used as scratch space
+		var discarded C.uLong
+		nativeWork.enter()
+		start := startNativeCall()
+		transformCode := C.go_uncompress_discard_step(unc.transformer, unc.readAheadPtr, C.uInt(cap(unc.readAhead)), C.uLong(n-skipped), &discarded)
+		endNativeCall(NativeSkip, start)
+		nativeWork.end()
+		skipped += int64(discarded)
+		unc.uncompressedLen += int64(discarded)
+
+		if transformCode == C.Z_NEED_DICT {
+			derr := unc.setPresetDictionary()
+			if derr != nil {
+				return skipped, derr
+			}
+			continue
+		}
+
+		if transformCode < C.Z_OK {
+			uerr := unc.uncompressionError(transformCode)
+			if uerr != nil {
+				return skipped, uerr
+			}
+			continue
+		}
+
+		if transformCode == C.Z_STREAM_END {
+			unc.endStream()
+			continue
+		}
+
+		unc.hasMoreData = transformCode == C.GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA
+	}
+
+	return skipped, nil
+}
+
+func (unc *goUncompressor) ensureReadAhead() {
+	if unc.readAheadPtr != nil {
+		return
+	}
+
+	readAheadCap := int(unc.transformer.work_buffer_cap)
+	if readAheadCap < smallReadBufferSize {
+		readAheadCap = smallReadBufferSize
+	}
+	unc.readAheadPtr = unc.nativeAlloc(C.size_t(readAheadCap))
+	unc.readAhead = nativeSlice(unc.readAheadPtr, 0, readAheadCap)
+}
+
+// fillReadAhead uncompresses more data into the read ahead buffer, preserving any data not yet consumed
+func (unc *goUncompressor) fillReadAhead() error {
+	unc.ensureReadAhead()
+
+	if unc.readAheadPos > 0 {
+		remaining := copy(unc.readAhead, unc.readAhead[unc.readAheadPos:])
+		unc.readAhead = unc.readAhead[:remaining]
+		unc.readAheadPos = 0
+	}
+
+	readAheadLen := len(unc.readAhead)
+	readLen, readErr := unc.readDirect(unc.readAhead[readAheadLen:cap(unc.readAhead)])
+	unc.readAhead = unc.readAhead[:readAheadLen+readLen]
+
+	return readErr
+}
+
+// uncompressStep performs a single uncompression step into output, reading more input if needed.
+// It may produce no data without returning an error
+func (unc *goUncompressor) uncompressStep(output []byte) (int, error) {
+	if unc.maxOutput > 0 {
+		if unc.uncompressedLen > unc.maxOutput {
+			return 0, DecompressedSizeLimitError
+		}
+
+		// uncompress one byte past the limit to tell a stream that ends exactly at the limit from one that exceeds it
+		if left := unc.maxOutput - unc.uncompressedLen + 1; int64(len(output)) > left {
+			output = output[:left]
+		}
+	}
+
+	produced, err := unc.inflateStep(output)
+	unc.uncompressedLen += int64(produced)
+	if unc.maxOutput > 0 && unc.uncompressedLen > unc.maxOutput {
+		// the data up to the limit is returned first, the next step fails
+		return produced - int(unc.uncompressedLen-unc.maxOutput), nil
+	}
+
+	return produced, err
+}
+
+// inflateStep is uncompressStep without the output limit
+func (unc *goUncompressor) inflateStep(output []byte) (int, error) {
 	unc.twh.writtenBytes = 0
+	if len(unc.resumed) > 0 {
+		resumedLen := copy(output, unc.resumed)
+		unc.resumed = unc.resumed[resumedLen:]
+		return resumedLen, nil
+	}
+
+	if unc.ended {
+		return 0, unc.trailingDataError()
+	}
+
 	// if there's still data from the previous call to be read
 	if !unc.hasMoreData {
 		readLen, readError := unc.readIntoWorkBuffer()
 		if readError != nil { // this could be EOF
-			return 0, readError
+			return 0, unc.inputError(readError)
 		}
 
 		if readLen == 0 {
@@ -234,13 +835,24 @@ func (unc *goUncompressor) Read(output []byte) (int, error) {
 
 	// pass the pointer to the output slice so the C code can write directly to it
 	outputSliceHdr := (*reflect.SliceHeader)(unsafe.Pointer(&output))
+	nativeWork.enter()
+	start := startNativeCall()
 	transformCode := C.go_uncompress_to_outstream_step(unc.transformer, unsafe.Pointer(outputSliceHdr.Data), C.uInt(outputSliceHdr.Len))
+	endNativeCall(NativeUncompress, start)
+	nativeWork.end()
+
+	if transformCode == C.Z_NEED_DICT {
+		return 0, unc.setPresetDictionary()
+	}
 
 	if transformCode < C.Z_OK {
-		return 0, fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, transformCode)
+		// data uncompressed before a failed trailer check is in output but wasn't reported by the output handler
+		produced := len(output) - int(unc.transformer.zs.avail_out)
+		return produced, unc.uncompressionError(transformCode)
 	}
 
 	if transformCode == C.Z_STREAM_END {
+		unc.endStream()
 		return unc.twh.writtenBytes, nil
 	}
 
@@ -249,9 +861,51 @@ func (unc *goUncompressor) Read(output []byte) (int, error) {
 	return unc.twh.writtenBytes, nil
 }
 
+// endStream records the end of the compressed stream, keeping the input not consumed by it when trailing data is exposed
+func (unc *goUncompressor) endStream() {
+	unc.ended = true
+	unc.hasMoreData = false
+	if unc.trailingMode == TrailingDataExpose {
+		unc.trailing = C.GoBytes(unsafe.Pointer(unc.transformer.zs.next_in), C.int(unc.transformer.zs.avail_in))
+	} else if unc.trailingMode == TrailingDataReject && unc.transformer.zs.avail_in > 0 {
+		unc.trailing = []byte{}
+	}
+}
+
+// trailingDataError returns the error reading past the end of the compressed stream, discarding the remaining
+// input unless trailing data is exposed
+func (unc *goUncompressor) trailingDataError() error {
+	if unc.trailingMode == TrailingDataExpose {
+		return io.EOF
+	}
+
+	if unc.trailing != nil {
+		return TrailingDataError
+	}
+
+	for {
+		readLen, readErr := unc.readIntoWorkBuffer()
+		if readLen > 0 && unc.trailingMode == TrailingDataReject {
+			unc.trailing = []byte{}
+			return TrailingDataError
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
 // Close closes the uncompressor and releases internal resources
 // Not calling Close will result in a resource leak
-func (unc *goUncompressor) Close() error {
+func (unc *goUncompressor) Close() (err error) {
+	defer recoverPanic("Close", &err)
+
+	if unc.readAheadPtr != nil {
+		C.pool_free(unc.readAheadPtr)
+	}
+	if unc.gzHeaderPtr != nil {
+		C.pool_free(unc.gzHeaderPtr)
+	}
 	C.release_uncompression_transformer(unc.transformer)
 	unregisterStreamEventHandler(unc.twh.eventHandlersPtr)
 	C.pool_free(unc.twh.eventHandlersPtr)
@@ -260,25 +914,145 @@ func (unc *goUncompressor) Close() error {
 
 // Transform utility functions
 
+// flushingCompressor has the flush methods of the compressors, which the compressors wrapping another one override
+// to flush their own output too
+type flushingCompressor interface {
+	Flush() error
+	SyncFlush() error
+	FullFlush() error
+	Finish() (uint64, error)
+}
+
+// wrappedCompressor is implemented by the compressors and, through embedding, the compressors wrapping one,
+// so that the helper functions can reach the native compressor behind them
+type wrappedCompressor interface {
+	unwrapCompressor() *goGZipCompressor
+}
+
+func (comp *goGZipCompressor) unwrapCompressor() *goGZipCompressor {
+	return comp
+}
+
+// goCompressorOf returns the native compressor behind a compressor, panicking if it isn't one
+func goCompressorOf(compressor io.Writer) *goGZipCompressor {
+	return compressor.(wrappedCompressor).unwrapCompressor()
+}
+
 // Flush is a helper function to flush a compressor given an interface
-func Flush(compressor io.WriteCloser) error {
-	return compressor.(*goGZipCompressor).Flush()
+func Flush(compressor io.WriteCloser) (err error) {
+	defer recoverPanic("Flush", &err)
+
+	return compressor.(flushingCompressor).Flush()
+}
+
+// SyncFlush is a helper function to compress all data written so far to a compressor given an interface, aligning
+// the output to a byte boundary without ending the stream, so the receiver can uncompress everything written up to this point
+func SyncFlush(compressor io.WriteCloser) (err error) {
+	defer recoverPanic("SyncFlush", &err)
+
+	return compressor.(flushingCompressor).SyncFlush()
+}
+
+// FullFlush is a helper function to flush a compressor given an interface like SyncFlush, also resetting the
+// compression state so that uncompression can restart from this point of the output
+func FullFlush(compressor io.WriteCloser) (err error) {
+	defer recoverPanic("FullFlush", &err)
+
+	return compressor.(flushingCompressor).FullFlush()
+}
+
+// Finish is a helper function to end the compressed stream of a compressor given an interface
+// It returns the total number of compressed bytes written to the output, which can be used, for example, to set
+// the Content-Length of a buffered response without counting the bytes written to the output
+func Finish(compressor io.WriteCloser) (compressedLen uint64, err error) {
+	defer recoverPanic("Finish", &err)
+
+	return compressor.(flushingCompressor).Finish()
+}
+
+// resettableCompressor is implemented by the compressors and overridden by the compressors wrapping one that keep
+// state of their own
+type resettableCompressor interface {
+	resetOutput(output io.Writer)
 }
 
 // ResetCompressor is a helper function that can be used when pooling compressors
-// The compressor will use the given output to write data to
+// The compressor will use the given output to write data to. Compressors created by NewPNGCompressor write each chunk
+// to output with a single Write instead of handing it to their chunk handler.
 func ResetCompressor(output io.Writer, compressor io.WriteCloser) {
-	goComp := compressor.(*goGZipCompressor)
-	goComp.output = output
-	C.reset_compression_transformer(goComp.transformer)
+	compressor.(resettableCompressor).resetOutput(output)
+}
+
+func (comp *goGZipCompressor) resetOutput(output io.Writer) {
+	comp.output = output
+	// anything not yet compressed belongs to the previous stream
+	comp.pending = comp.pending[:0]
+	comp.twh.eventHandlers.err = nil
+	C.reset_compression_transformer(comp.transformer)
+	comp.flushAccounting = flushAccounting{enabled: comp.flushAccounting.enabled}
+	// the header was validated when set and the stream was just reset, so this can't fail
+	_ = comp.applyNativeGZipHeader()
+}
+
+// LastCallbackError returns the first error raised by the Go writer or handlers called from native code since the
+// compressor or uncompressor was created or reset, nil if there was none
+func LastCallbackError(transformer io.Closer) (err error) {
+	defer recoverPanic("LastCallbackError", &err)
+
+	switch t := transformer.(type) {
+	case wrappedCompressor:
+		return t.unwrapCompressor().twh.eventHandlers.err
+	case *goUncompressor:
+		return t.twh.eventHandlers.err
+	default:
+		return nil
+	}
+}
+
+// Peek is a helper function returning up to n uncompressed bytes from an uncompressor given an interface, without consuming them
+// This is useful to inspect the uncompressed content, for example with http.DetectContentType, before passing the uncompressor onwards
+func Peek(uncompressor io.ReadCloser, n int) (peeked []byte, err error) {
+	defer recoverPanic("Peek", &err)
+
+	return uncompressor.(*goUncompressor).Peek(n)
+}
+
+// Skip is a helper function to uncompress and discard the next n bytes of an uncompressor given an interface
+func Skip(uncompressor io.ReadCloser, n int64) (skipped int64, err error) {
+	defer recoverPanic("Skip", &err)
+
+	return uncompressor.(*goUncompressor).Skip(n)
+}
+
+// resettableUncompressor is implemented by the uncompressors, whichever backend they run on
+type resettableUncompressor interface {
+	resetInput(input io.Reader)
 }
 
 // ResetUncompressor is a helper function that can be used when pooling uncompressors
 // the uncompressor will use the given input to read data from
 func ResetUncompressor(input io.Reader, uncompressor io.ReadCloser) {
-	goUncomp := uncompressor.(*goUncompressor)
-	goUncomp.input = input
-	C.reset_uncompression_transformer(goUncomp.transformer)
+	uncompressor.(resettableUncompressor).resetInput(input)
+}
+
+func (unc *goUncompressor) resetInput(input io.Reader) {
+	unc.input = input
+	unc.hasMoreData = false
+	unc.readAhead = unc.readAhead[:0]
+	unc.readAheadPos = 0
+	unc.twh.eventHandlers.err = nil
+	unc.ended = false
+	unc.trailing = nil
+	unc.resumed = nil
+	unc.uncompressedLen = 0
+	if unc.releaseWindow {
+		// the window bits are the ones the stream was initialized with, so this can't fail
+		C.reset_uncompression_transformer_releasing_window(unc.transformer, unc.windowBits)
+	} else {
+		C.reset_uncompression_transformer(unc.transformer)
+	}
+	// zlib forgets the header on reset
+	unc.registerNativeGZipHeader()
 }
 
 func (unc *goUncompressor) readIntoWorkBuffer() (uint32, error) {
@@ -297,36 +1071,149 @@ func (unc *goUncompressor) readIntoWorkBuffer() (uint32, error) {
 	return uint32(readLen), readError
 }
 
-func initTransformer(goTransformer *goZLibTransformer, mode TransformMode, level CompressionLevel, bufferSize uint32) error {
+// nativeSlice creates a byte slice backed by native memory
+func nativeSlice(data unsafe.Pointer, length int, capacity int) []byte {
+	var slice []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&slice))
 
-	var errorCode C.int = 0
-	if mode == TransformModeGZip {
-		// the result of acquire_gzip_compression_transformer won't be nil even on error
-		// and the result needs to be released on close
-		goTransformer.transformer = C.acquire_gzip_compression_transformer(C.int(level), C.uInt(bufferSize), &errorCode)
-	} else if mode == TransformModeUncompress {
-		goTransformer.transformer = C.acquire_uncompression_transformer(C.uInt(bufferSize), &errorCode)
-	} else {
+	hdr.Data = uintptr(data)
+	hdr.Len = length
+	hdr.Cap = capacity
+
+	return slice
+}
+
+// allocNativeBuffer allocates a native work buffer of size bytes from the global pool, to be released with pool_free
+// Sizes above the largest pool block are rejected with BufferSizeError.
+func allocNativeBuffer(size uint64) (unsafe.Pointer, error) {
+	if size > nativePoolMaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d supported", BufferSizeError, size, nativePoolMaxSize)
+	}
+
+	data := C.pool_alloc(C.size_t(size))
+	if data == nil {
+		return nil, fmt.Errorf("%w: can't allocate %d bytes", BufferSizeError, size)
+	}
+
+	return data, nil
+}
+
+// ensureSpareCapacity returns dst with room for at least n more bytes past its length, growing it if needed
+func ensureSpareCapacity(dst []byte, n int) []byte {
+	dstLen := len(dst)
+	if cap(dst)-dstLen >= n {
+		return dst
+	}
+
+	grown := make([]byte, dstLen, dstLen+n+cap(dst)/2)
+	copy(grown, dst)
+	return grown
+}
+
+// readAppend reads exactly n bytes from input and appends them to dst, returning io.ErrUnexpectedEOF if input ends first
+// dst grows as data is received, so a length read from untrusted input can't cause an allocation larger than the data sent.
+func readAppend(dst []byte, input io.Reader, n int64) ([]byte, error) {
+	buffer := bytes.NewBuffer(dst)
+	_, err := io.CopyN(buffer, input, n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return buffer.Bytes(), err
+}
+
+// bytesPointer returns the address of the first element of data or nil if data is empty
+func bytesPointer(data []byte) unsafe.Pointer {
+	if len(data) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&data[0])
+}
+
+func initTransformer(goTransformer *goZLibTransformer, mode TransformMode, level CompressionLevel, bufferSize uint32) error {
+	switch mode {
+	case TransformModeGZip:
+		return initCompressionTransformer(goTransformer, level, C.COMPRESS_GZIP_WINDOW_BITS, int(goTransformer.strategy), bufferSize)
+	case TransformModeZLib:
+		return initCompressionTransformer(goTransformer, level, C.MAX_WBITS, int(goTransformer.strategy), bufferSize)
+	case TransformModeRawDeflate:
+		return initCompressionTransformer(goTransformer, level, C.RAW_DEFLATE_WINDOW_BITS, int(goTransformer.strategy), bufferSize)
+	case TransformModeUncompress:
+		return initUncompressionTransformer(goTransformer, C.UNCOMPRESS_ANY_WINDOW_BITS, bufferSize)
+	case TransformModeRawUncompress:
+		return initUncompressionTransformer(goTransformer, C.RAW_DEFLATE_WINDOW_BITS, bufferSize)
+	default:
 		return fmt.Errorf("mode %v not supported", mode)
 	}
+}
+
+// initCompressionTransformer initializes a compression transformer with explicit zlib window bits and strategy
+func initCompressionTransformer(goTransformer *goZLibTransformer, level CompressionLevel, windowBits int, strategy int, bufferSize uint32) error {
+	werr := nativeWork.start()
+	if werr != nil {
+		return werr
+	}
+	defer nativeWork.end()
+
+	// the transformer won't be nil even on error and needs to be released on close
+	goTransformer.transformer = C.alloc_transformer(C.uInt(bufferSize), C.bool(!goTransformer.unpooled))
+	goTransformer.initWindowBits = windowBits
+	errorCode := C.init_compression_transformer(goTransformer.transformer, C.int(level), C.int(windowBits), C.int(strategy))
+
+	if errorCode != C.Z_OK {
+		return newNativeError(TransformerInitializationError, errorCode)
+	}
+
+	registerTransformerHandlers(goTransformer)
+	return nil
+}
+
+// initUncompressionTransformer initializes an uncompression transformer with explicit zlib window bits
+func initUncompressionTransformer(goTransformer *goZLibTransformer, windowBits int, bufferSize uint32) error {
+	werr := nativeWork.start()
+	if werr != nil {
+		return werr
+	}
+	defer nativeWork.end()
+
+	goTransformer.transformer = C.alloc_transformer(C.uInt(bufferSize), C.bool(!goTransformer.unpooled))
+	errorCode := C.init_uncompression_transformer(goTransformer.transformer, C.int(windowBits))
 
 	if errorCode != C.Z_OK {
-		return fmt.Errorf(wrapErrorFormat, TransformerInitializationError, errorCode)
+		return newNativeError(TransformerInitializationError, errorCode)
 	}
 
+	registerTransformerHandlers(goTransformer)
+	return nil
+}
+
+// nativeAlloc allocates native memory for the transformer, from the internal pools unless it's unpooled
+// The memory must be released with pool_free.
+func (goTransformer *goZLibTransformer) nativeAlloc(size C.size_t) unsafe.Pointer {
+	if goTransformer.unpooled {
+		return C.unpooled_alloc(size)
+	}
+	return C.pool_alloc(size)
+}
+
+func registerTransformerHandlers(goTransformer *goZLibTransformer) {
 	eventHandlers := &streamEventHandlers{}
 	goTransformer.twh.eventHandlers = eventHandlers
 
-	goTransformer.twh.eventHandlersPtr = C.pool_alloc(uintptrSize)
+	goTransformer.twh.eventHandlersPtr = goTransformer.nativeAlloc(uintptrSize)
 	// use the address of the C allocated pointer itself as ID
 	goTransformer.transformer.state.data_handler = goTransformer.twh.eventHandlersPtr
 	registerStreamEventHandler(goTransformer.twh.eventHandlersPtr, eventHandlers)
-	return nil
 }
 
 // Streaming
 
 func goCompressOrUncompressStream(compress bool, level CompressionLevel, inputBufferSize uint32, outputBufferSize uint32, inputReader DataStreamEventHandler, outputWriter DataStreamEventHandler) (uint64, error) {
+	werr := nativeWork.start()
+	if werr != nil {
+		return 0, werr
+	}
+	defer nativeWork.end()
+
 	zState := C.pool_acquire_zstream_state()
 	defer C.pool_release_zstream_state(zState)
 
@@ -345,11 +1232,17 @@ func goCompressOrUncompressStream(compress bool, level CompressionLevel, inputBu
 	var outLen C.ulong
 	if compress {
 		outLen = C.go_gzip_compress_stream(zState, C.int(level), C.uInt(inputBufferSize), C.uInt(outputBufferSize), &errorCode)
+		if handlers.err != nil {
+			return 0, handlers.err
+		}
 		if errorCode != C.Z_OK {
 			return 0, fmt.Errorf(wrapErrorFormat, StreamCompressError, errorCode)
 		}
 	} else {
 		outLen = C.go_uncompress_stream(zState, C.uInt(inputBufferSize), C.uInt(outputBufferSize), &errorCode)
+		if handlers.err != nil {
+			return 0, handlers.err
+		}
 		if errorCode != C.Z_OK {
 			return 0, fmt.Errorf(wrapErrorFormat, StreamUncompressError, errorCode)
 		}
@@ -359,12 +1252,19 @@ func goCompressOrUncompressStream(compress bool, level CompressionLevel, inputBu
 }
 
 // GoGZipCompressStream compresses a stream of data
-// The compression level can be CompressionLevelBestCompression or CompressionLevelBestSpeed
+// The compression level can be any level from CompressionLevelNone to CompressionLevelBestCompression or CompressionLevelDefault
 // `inputReader` is a function used to read uncompressed data
 // `outputWriter` is a function that takes the compressed data
 // `inputBufferSize` and `outputBufferSize` are the sizes of the internal work buffers. For best performance, use large enough power of 2 sizes
 // The function returns the number of bytes written to the output stream and an error, if any.
-func GoGZipCompressStream(level CompressionLevel, inputBufferSize uint32, outputBufferSize uint32, inputReader DataStreamEventHandler, outputWriter DataStreamEventHandler) (uint64, error) {
+func GoGZipCompressStream(level CompressionLevel, inputBufferSize uint32, outputBufferSize uint32, inputReader DataStreamEventHandler, outputWriter DataStreamEventHandler) (compressedLen uint64, err error) {
+	defer recoverPanic("GoGZipCompressStream", &err)
+
+	lerr := level.validate()
+	if lerr != nil {
+		return 0, lerr
+	}
+
 	return goCompressOrUncompressStream(true, level, inputBufferSize, outputBufferSize, inputReader, outputWriter)
 }
 
@@ -373,15 +1273,67 @@ func GoGZipCompressStream(level CompressionLevel, inputBufferSize uint32, output
 // `outputWriter` is a function that takes the uncompressed data
 // `inputBufferSize` and `outputBufferSize` are the sizes of the internal work buffers. For best performance, use large enough power of 2 sizes
 // The function returns the number of bytes written to the output stream and an error, if any.
-func GoUncompressStream(inputBufferSize uint32, outputBufferSize uint32, inputReader DataStreamEventHandler, outputWriter DataStreamEventHandler) (uint64, error) {
+func GoUncompressStream(inputBufferSize uint32, outputBufferSize uint32, inputReader DataStreamEventHandler, outputWriter DataStreamEventHandler) (uncompressedLen uint64, err error) {
+	defer recoverPanic("GoUncompressStream", &err)
+
 	return goCompressOrUncompressStream(false, 0, inputBufferSize, outputBufferSize, inputReader, outputWriter)
 }
 
+// GoValidateStream uncompresses a stream of data in gzip or standard zlib format only to verify its integrity,
+// discarding the uncompressed data without calling any output handler
+// `inputReader` is a function used to read compressed data
+// `inputBufferSize` is the size of the internal input work buffer, the output is written to a small native scratch buffer
+// The function returns the number of uncompressed bytes and an error, if any. Input ending before the end of the
+// stream returns io.ErrUnexpectedEOF.
+func GoValidateStream(inputBufferSize uint32, inputReader DataStreamEventHandler) (uncompressedLen uint64, err error) {
+	defer recoverPanic("GoValidateStream", &err)
+
+	werr := nativeWork.start()
+	if werr != nil {
+		return 0, werr
+	}
+	defer nativeWork.end()
+
+	zState := C.pool_acquire_zstream_state()
+	defer C.pool_release_zstream_state(zState)
+
+	handlers := &streamEventHandlers{}
+	handlers.onRead = inputReader
+
+	handlersPtr := C.pool_alloc(uintptrSize)
+	defer C.pool_free(handlersPtr)
+	// use the address of the C allocated pointer itself as ID
+	zState.data_handler = handlersPtr
+	registerStreamEventHandler(handlersPtr, handlers)
+	defer unregisterStreamEventHandler(handlersPtr)
+
+	var errorCode C.int = C.Z_OK
+	outLen := C.go_validate_stream(zState, C.uInt(inputBufferSize), &errorCode)
+	if handlers.err != nil {
+		return uint64(outLen), handlers.err
+	}
+	if errorCode == C.Z_BUF_ERROR {
+		return uint64(outLen), io.ErrUnexpectedEOF
+	}
+	if errorCode != C.Z_OK {
+		return uint64(outLen), fmt.Errorf(wrapErrorFormat, StreamUncompressError, errorCode)
+	}
+
+	return uint64(outLen), nil
+}
+
 // Buffer to buffer operations
 
 // GoGZipCompressBuffer compresses data in gzip format, reading from input and
 // writing to a pre allocated output buffer. If the output is too small to contain the compressed data, an error is returned
-func GoGZipCompressBuffer(level CompressionLevel, input []byte, output []byte) (uint64, error) {
+func GoGZipCompressBuffer(level CompressionLevel, input []byte, output []byte) (compressedLen uint64, err error) {
+	defer recoverPanic("GoGZipCompressBuffer", &err)
+
+	lerr := level.validate()
+	if lerr != nil {
+		return 0, lerr
+	}
+
 	inputCap := cap(input)
 	outputCap := cap(output)
 	if outputCap == 0 {
@@ -396,12 +1348,22 @@ func GoGZipCompressBuffer(level CompressionLevel, input []byte, output []byte) (
 	outputHdr := (*reflect.SliceHeader)(unsafe.Pointer(&output))
 	outputPtr := unsafe.Pointer(outputHdr.Data)
 
+	werr := nativeWork.start()
+	if werr != nil {
+		return 0, werr
+	}
+	defer nativeWork.end()
+
 	var errorCode C.int = C.Z_OK
 
 	compLen := C.gzip_compress_buffer(C.int(level), inputPtr, C.uInt(inputCap), outputPtr, C.uInt(outputCap), &errorCode)
 
 	if errorCode != C.Z_OK {
-		return 0, fmt.Errorf(wrapErrorFormat, BufferCompressError, errorCode)
+		err := newNativeError(BufferCompressError, errorCode)
+		if fallBack(NativeCompress, err) {
+			return fallbackCompressBuffer(level, input[:inputCap], output[:outputCap])
+		}
+		return 0, err
 	}
 
 	return uint64(compLen), nil
@@ -409,7 +1371,9 @@ func GoGZipCompressBuffer(level CompressionLevel, input []byte, output []byte) (
 
 // GoUncompressBuffer uncompresses a gzip or standard zlib input buffer writing to a pre allocated output
 // if the output is too small to contain the compressed data, an error is returned
-func GoUncompressBuffer(input []byte, output []byte) (uint64, error) {
+func GoUncompressBuffer(input []byte, output []byte) (uncompressedLen uint64, err error) {
+	defer recoverPanic("GoUncompressBuffer", &err)
+
 	inputCap := cap(input)
 	outputCap := cap(output)
 	if outputCap == 0 {
@@ -424,12 +1388,22 @@ func GoUncompressBuffer(input []byte, output []byte) (uint64, error) {
 	outputHdr := (*reflect.SliceHeader)(unsafe.Pointer(&output))
 	outputPtr := unsafe.Pointer(outputHdr.Data)
 
+	werr := nativeWork.start()
+	if werr != nil {
+		return 0, werr
+	}
+	defer nativeWork.end()
+
 	var errorCode C.int = C.Z_OK
 
 	uncompLen := C.uncompress_buffer_any(inputPtr, C.uInt(inputCap), outputPtr, C.uInt(outputCap), &errorCode)
 
 	if errorCode != C.Z_OK {
-		return 0, fmt.Errorf(wrapErrorFormat, BufferUncompressError, errorCode)
+		err := newNativeError(BufferUncompressError, errorCode)
+		if fallBack(NativeUncompress, err) {
+			return fallbackUncompressBuffer(input[:inputCap], output[:outputCap])
+		}
+		return 0, err
 	}
 
 	return uint64(uncompLen), nil
@@ -439,24 +1413,64 @@ func GoUncompressBuffer(input []byte, output []byte) (uint64, error) {
 
 // NativeSlicePool is a byte slice pool manager where memory allocated for each slice is allocated off-heap
 // The pool allows for slices of various types to be allocated and returned but given the way memory is internally tracked
-// slices of sizes that are power of 2 provide an optimal memory utilization.
+// slices of sizes matching the pool size classes provide an optimal memory utilization, by default sizes that are power of 2.
 type NativeSlicePool struct {
-	pool *C.struct_MultiPool
+	classes        []nativePoolClass
+	exactThreshold int
+	exactLock      sync.Mutex
+	exact          map[int]*nativePoolClass
 }
 
-// NewNativeSlicePool creates a new slice pool.
+// NewNativeSlicePool creates a new slice pool rounding sizes to the next power of 2.
 // Manually call NewNativeSlicePool.Free() to release the resouces allocated by the returned NewNativeSlicePool.
 func NewNativeSlicePool() *NativeSlicePool {
-	return &NativeSlicePool{
-		pool: C.multipool_create(),
+	// the default options are always valid
+	pool, _ := NewNativeSlicePoolWithOptions(NativeSlicePoolOptions{})
+	return pool
+}
+
+// NewNativeSlicePoolWithOptions creates a new slice pool with the size class rounding policy in opts
+// Manually call NewNativeSlicePool.Free() to release the resouces allocated by the returned NewNativeSlicePool.
+func NewNativeSlicePoolWithOptions(opts NativeSlicePoolOptions) (pool *NativeSlicePool, err error) {
+	defer recoverPanic("NewNativeSlicePoolWithOptions", &err)
+
+	if opts.ExactSizeThreshold < 0 {
+		return nil, fmt.Errorf("%w: negative exact size threshold", NativeSlicePoolOptionsError)
+	}
+
+	classes, err := newNativePoolClasses(opts)
+	if err != nil {
+		return nil, err
 	}
+
+	pool = &NativeSlicePool{classes: classes}
+	if opts.Rounding == NativePoolRoundingExactLarge {
+		pool.exactThreshold = opts.ExactSizeThreshold
+		if pool.exactThreshold == 0 {
+			pool.exactThreshold = defaultNativePoolExactSizeThreshold
+		}
+		pool.exact = make(map[int]*nativePoolClass)
+	}
+
+	return pool, nil
+}
+
+func newNativeMemPool(size int) unsafe.Pointer {
+	return unsafe.Pointer(C.alloc_mem_pool(C.uint32_t(size)))
 }
 
-// Acquire acquires a new byte array. For optimal memory utilization use sizes that are power of 2
+// Acquire acquires a new byte array. For optimal memory utilization use sizes matching the pool size classes
 // The maximum size of a slice is limited to 4Mb and the returned slice cannot have its capacity changed.
 // The returned slice is not zeroed out and it has length zero but capacity equals to size
 func (nsp *NativeSlicePool) Acquire(size int) []byte {
-	data := C.multipool_mem_acquire(nsp.pool, C.uint32_t(size))
+	var data unsafe.Pointer
+	class := nsp.classFor(size)
+	if class != nil {
+		data = C.pool_mem_acquire((*C.struct_MemPool)(class.pool))
+		if data != nil {
+			class.trackAcquire(size)
+		}
+	}
 
 	var slice []byte
 	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&slice))
@@ -469,14 +1483,27 @@ func (nsp *NativeSlicePool) Acquire(size int) []byte {
 }
 
 // Return returns the slice to the pool.
+// Slices Acquire failed to allocate, such as ones larger than the maximum size, are ignored.
 func (nsp *NativeSlicePool) Return(slice []byte) {
 	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&slice))
+	if hdr.Data == 0 {
+		return
+	}
+
+	// like Acquire, only slices backed by a pool class are tracked
+	class := nsp.classFor(hdr.Cap)
+	if class == nil {
+		return
+	}
 
 	C.pool_mem_return(unsafe.Pointer(hdr.Data))
+	class.trackReturn(hdr.Cap)
 }
 
 // Free releases the resources allocated by this pool
 // It must be invoked once the pool is not in use anymore to avoid resource leaks
 func (nsp *NativeSlicePool) Free() {
-	C.multipool_free(nsp.pool)
+	nsp.eachClass(func(class *nativePoolClass) {
+		C.free_mem_pool((*C.struct_MemPool)(class.pool))
+	})
 }
@@ -0,0 +1,37 @@
+package gozlib
+
+// Arena acquires slices from a NativeSlicePool for the scope of a unit of work, like a request, and returns them
+// all at once with Release, so callers don't need to return each slice individually.
+// An Arena is not safe for concurrent use and can be reused after Release.
+type Arena struct {
+	pool   *NativeSlicePool
+	slices [][]byte
+}
+
+// NewArena creates an arena acquiring its slices from pool
+func NewArena(pool *NativeSlicePool) *Arena {
+	return &Arena{pool: pool}
+}
+
+// Alloc acquires a slice of length zero and capacity size from the pool, which is returned when the arena is released
+// The slice must not be returned to the pool directly and must not be used after Release.
+func (a *Arena) Alloc(size int) []byte {
+	slice := a.pool.Acquire(size)
+	a.slices = append(a.slices, slice)
+
+	return slice
+}
+
+// Len returns the number of slices allocated since the arena was created or released
+func (a *Arena) Len() int {
+	return len(a.slices)
+}
+
+// Release returns all slices allocated by the arena to the pool
+func (a *Arena) Release() {
+	for pos, slice := range a.slices {
+		a.pool.Return(slice)
+		a.slices[pos] = nil
+	}
+	a.slices = a.slices[:0]
+}
@@ -0,0 +1,32 @@
+package gozlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArenaReleasesAllSlices(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	arena := NewArena(pool)
+	for round := 0; round < 3; round++ {
+		small := arena.Alloc(100)
+		large := arena.Alloc(100000)
+		assert.Equal(t, 100, cap(small))
+		assert.Equal(t, 100000, cap(large))
+		assert.Equal(t, 2, arena.Len())
+
+		small = append(small, "scratch"...)
+		assert.Equal(t, "scratch", string(small))
+		assert.Equal(t, int64(100+100000), pool.Stats().RequestedBytes())
+
+		arena.Release()
+		assert.Equal(t, 0, arena.Len())
+		assert.Equal(t, int64(0), pool.Stats().RequestedBytes())
+	}
+
+	// the blocks were reused across rounds
+	assert.Equal(t, int64(1), pool.Stats().Classes[0].Held)
+}
@@ -0,0 +1,220 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Compression backends
+// Engines run on a backend, the compression library behind their deflate and inflate calls, so alternative libraries
+// can be plugged in and tested against the same semantics.
+// New Engines, and what is built on them like Transcoder, ChunkCompressor and the segment writer and reader, run on the
+// default backend, zlib unless SelectFastestBackend picked another one, and each Engine can be moved to another backend
+// with SetBackend before it's used. Compressors and uncompressors run on the cgo zlib transformers unless created with
+// another backend in TransformerOptions.Backend. The buffer and stream functions always run on zlib.
+
+var (
+	BackendBenchmarkError = errors.New("no backend passed the benchmark")
+	BackendError          = errors.New("invalid backend")
+)
+
+// Backend names a compression library Engines can run on
+type Backend string
+
+const (
+	// BackendDefault is the backend new Engines run on
+	BackendDefault Backend = ""
+	// BackendZLib runs on the cgo zlib streams
+	BackendZLib Backend = "zlib"
+	// BackendGo runs on compress/flate, without cgo calls
+	BackendGo Backend = "go"
+)
+
+// provider returns the provider of the backend named b
+func (b Backend) provider() (*backendProvider, error) {
+	if b == BackendDefault {
+		return defaultBackend(), nil
+	}
+
+	for _, provider := range backends {
+		if provider.name == string(b) {
+			return provider, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unknown backend %q", BackendError, string(b))
+}
+
+// backend is a compression library stream, either compressing or uncompressing, the Engine runs on
+// Each call works over caller owned buffers and follows zlib semantics: a nil error means more input or output space
+// is needed and io.EOF signals the end of the stream.
+type backend interface {
+	deflate(in []byte, out []byte, flush FlushMode) (int, int, error)
+	inflate(in []byte, out []byte, flush FlushMode) (int, int, error)
+	// reset discards the stream state so the next call starts a new stream
+	reset()
+	// bound returns the maximum compressed size of n bytes, only valid for compressing streams
+	bound(n int) int
+	close()
+}
+
+// backendProvider creates backend streams for a compression library
+type backendProvider struct {
+	name        string
+	newDeflater func(level CompressionLevel, windowBits int) (backend, error)
+	newInflater func(windowBits int) (backend, error)
+}
+
+// zlibBackend is the default backend, backed by the cgo zlib streams
+var zlibBackend = &backendProvider{
+	name: string(BackendZLib),
+	newDeflater: func(level CompressionLevel, windowBits int) (backend, error) {
+		stream, err := newDeflateStream(level, windowBits, C.Z_DEFAULT_STRATEGY)
+		if err != nil {
+			return nil, err
+		}
+		return &zlibStream{stream: stream}, nil
+	},
+	newInflater: func(windowBits int) (backend, error) {
+		stream, err := newInflateStream(windowBits)
+		if err != nil {
+			return nil, err
+		}
+		return &zlibStream{stream: stream}, nil
+	},
+}
+
+// backends lists the available backends, the first one being the default
+var backends = []*backendProvider{zlibBackend, flateBackend}
+
+// backendSelection is the outcome of SelectFastestBackend
+type backendSelection struct {
+	provider   *backendProvider
+	benchmarks []BackendBenchmark
+}
+
+var selectedBackend atomic.Pointer[backendSelection]
+
+// defaultBackend returns the backend new engines run on
+func defaultBackend() *backendProvider {
+	selection := selectedBackend.Load()
+	if selection != nil {
+		return selection.provider
+	}
+
+	return backends[0]
+}
+
+// BackendBenchmark is the time a backend took to compress and uncompress the benchmark sample
+type BackendBenchmark struct {
+	Backend  string
+	Duration time.Duration
+	// Err is set if the backend failed the benchmark, in which case it's never selected
+	Err error
+}
+
+const (
+	backendBenchmarkSampleSize = 32 * 1024
+	backendBenchmarkRounds     = 8
+)
+
+// SelectFastestBackend benchmarks the available backends on a small sample and makes the fastest one the backend new
+// Engines run on. It's opt-in and meant to be called once on startup, taking a few milliseconds.
+// Compressors and uncompressors only run on the selected backend when it's set in TransformerOptions.Backend, for example
+// with the Backend reported by Capabilities.
+// The results, in the order backends are tried, and the selected backend are also reported by Capabilities.
+func SelectFastestBackend() (benchmarks []BackendBenchmark, err error) {
+	defer recoverPanic("SelectFastestBackend", &err)
+
+	sample := stressPayload(StressConfig{PayloadSize: backendBenchmarkSampleSize, Payload: StressPayloadText}, rand.New(rand.NewSource(1)), 0)
+
+	var fastest *backendProvider
+	var fastestDuration time.Duration
+	benchmarks = make([]BackendBenchmark, 0, len(backends))
+
+	for _, provider := range backends {
+		duration, err := benchmarkBackend(provider, sample)
+		benchmarks = append(benchmarks, BackendBenchmark{Backend: provider.name, Duration: duration, Err: err})
+
+		if err == nil && (fastest == nil || duration < fastestDuration) {
+			fastest = provider
+			fastestDuration = duration
+		}
+	}
+
+	if fastest == nil {
+		return benchmarks, BackendBenchmarkError
+	}
+
+	selectedBackend.Store(&backendSelection{provider: fastest, benchmarks: benchmarks})
+	return benchmarks, nil
+}
+
+// benchmarkBackend returns how long provider takes to compress and uncompress sample a few times, after a warm up round
+func benchmarkBackend(provider *backendProvider, sample []byte) (time.Duration, error) {
+	engine := newEngineWithBackend(TransformModeRawDeflate, CompressionLevelBestSpeed, provider)
+	defer engine.Close()
+
+	bound, err := engine.DeflateBound(len(sample))
+	if err != nil {
+		return 0, err
+	}
+	compressed := make([]byte, bound)
+	uncompressed := make([]byte, len(sample))
+
+	var start time.Time
+	for round := 0; round <= backendBenchmarkRounds; round++ {
+		if round == 1 {
+			start = time.Now()
+		}
+
+		engine.ResetDeflate()
+		_, produced, err := engine.Deflate(sample, compressed, FlushModeFinish)
+		if err != io.EOF {
+			return 0, fmt.Errorf("%w: deflate didn't finish the stream (%v)", TransformerCompressionError, err)
+		}
+
+		engine.ResetInflate()
+		_, uncompressedLen, err := engine.Inflate(compressed[:produced], uncompressed, FlushModeFinish)
+		if err != io.EOF || !bytes.Equal(sample, uncompressed[:uncompressedLen]) {
+			return 0, fmt.Errorf("%w: round trip mismatch (%v)", TransformerUncompressionError, err)
+		}
+	}
+
+	return time.Since(start), nil
+}
+
+type zlibStream struct {
+	stream *nativeStream
+}
+
+func (zs *zlibStream) deflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	consumed, produced, resultCode := zs.stream.step(in, out, C.int(flush))
+	return consumed, produced, engineResult(resultCode, TransformerCompressionError)
+}
+
+func (zs *zlibStream) inflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	consumed, produced, resultCode := zs.stream.step(in, out, C.int(flush))
+	return consumed, produced, engineResult(resultCode, TransformerUncompressionError)
+}
+
+func (zs *zlibStream) reset() {
+	zs.stream.reset()
+}
+
+func (zs *zlibStream) bound(n int) int {
+	return int(C.deflateBound(zs.stream.zs, C.uLong(n)))
+}
+
+func (zs *zlibStream) close() {
+	zs.stream.close()
+}
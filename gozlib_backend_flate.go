@@ -0,0 +1,501 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+)
+
+// Pure Go backend
+// The go backend runs Engines on compress/flate, without any cgo call. Deflate streams write the zlib and gzip framing
+// themselves around a raw flate writer, so full flushes can reset the compression state like zlib does. The stdlib
+// readers pull their input instead of being fed, so each inflate stream runs its reader in a goroutine that is handed
+// the input of every inflate call and reports back when it needs more.
+
+const (
+	// size of the buffer the stream reader goroutine uncompresses into
+	flateInflateBufferSize = 32 * 1024
+	// deflate streams always end with an empty final stored block, which zlib doesn't emit
+	flateFinalBlockOverhead = 5
+	// zlib's MAX_WBITS, the window bits beyond it select the gzip format or, when inflating, automatic detection
+	// compress/flate always compresses with this window size.
+	flateMaxWindowBits = 15
+)
+
+var errFlateStreamClosed = errors.New("flate stream closed")
+
+// flateBackend runs on compress/flate
+var flateBackend = &backendProvider{
+	name: string(BackendGo),
+	newDeflater: func(level CompressionLevel, windowBits int) (backend, error) {
+		return newFlateDeflater(level, windowBits)
+	},
+	newInflater: func(windowBits int) (backend, error) {
+		return &flateInflater{windowBits: windowBits}, nil
+	},
+}
+
+// flateFormat is the framing around the deflate data, given by the zlib window bits
+type flateFormat int
+
+const (
+	flateFormatRaw flateFormat = iota
+	flateFormatZLib
+	flateFormatGZip
+)
+
+func flateFormatFor(windowBits int) flateFormat {
+	switch {
+	case windowBits < 0:
+		return flateFormatRaw
+	case windowBits > flateMaxWindowBits:
+		return flateFormatGZip
+	default:
+		return flateFormatZLib
+	}
+}
+
+// flateDeflater compresses into a buffer the output of every deflate call is taken from
+// All input is consumed by each call, the compressed data not yet returned stays pending until the next calls.
+type flateDeflater struct {
+	level      CompressionLevel
+	format     flateFormat
+	windowBits int
+	writer     *flate.Writer
+	pending    bytes.Buffer
+	checksum   hash.Hash32
+	size       uint32
+	started    bool
+	// dirty is set when data was written since the last flush, so repeated flushes don't emit empty blocks
+	dirty    bool
+	finished bool
+}
+
+func newFlateDeflater(level CompressionLevel, windowBits int) (*flateDeflater, error) {
+	lerr := level.validate()
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	format := flateFormatFor(windowBits)
+	// the window size written in the zlib header, or implied by the other formats, must be the one compress/flate uses
+	windowSize := windowBits
+	switch format {
+	case flateFormatRaw:
+		windowSize = -windowBits
+	case flateFormatGZip:
+		windowSize = windowBits - 16
+	}
+	if windowSize != flateMaxWindowBits {
+		return nil, fmt.Errorf("%w: window bits %d not supported by the go backend", TransformerInitializationError, windowBits)
+	}
+
+	deflater := &flateDeflater{level: level, format: format, windowBits: windowSize}
+	writer, err := flate.NewWriter(&deflater.pending, int(level))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", TransformerInitializationError, err)
+	}
+	deflater.writer = writer
+	deflater.reset()
+
+	return deflater, nil
+}
+
+func (fd *flateDeflater) deflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	consumed := 0
+	if fd.finished && len(in) > 0 {
+		return 0, 0, fmt.Errorf("%w: stream already finished", TransformerCompressionError)
+	}
+
+	if !fd.finished {
+		if !fd.started {
+			fd.writeHeader()
+			fd.started = true
+		}
+
+		if len(in) > 0 {
+			// writes to the pending buffer can't fail
+			_, _ = fd.writer.Write(in)
+			fd.checksum.Write(in)
+			fd.size += uint32(len(in))
+			fd.dirty = true
+			consumed = len(in)
+		}
+
+		err := fd.flush(flush)
+		if err != nil {
+			return consumed, 0, fmt.Errorf("%w: %v", TransformerCompressionError, err)
+		}
+	}
+
+	produced, _ := fd.pending.Read(out)
+	if fd.finished && fd.pending.Len() == 0 {
+		return consumed, produced, io.EOF
+	}
+
+	return consumed, produced, nil
+}
+
+func (fd *flateDeflater) inflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	return 0, 0, fmt.Errorf("%w: compressing stream", TransformerUncompressionError)
+}
+
+func (fd *flateDeflater) flush(flush FlushMode) error {
+	switch flush {
+	case FlushModeNone:
+		return nil
+	case FlushModeFinish:
+		fd.finished = true
+		err := fd.writer.Close()
+		fd.writeTrailer()
+		return err
+	}
+
+	if !fd.dirty {
+		return nil
+	}
+	fd.dirty = false
+
+	err := fd.writer.Flush()
+	if err == nil && flush == FlushModeFull {
+		// the stream isn't finished, so resetting the writer only drops the references to earlier data
+		fd.writer.Reset(&fd.pending)
+	}
+	return err
+}
+
+// writeHeader writes the zlib or gzip header, with the same fields zlib writes
+func (fd *flateDeflater) writeHeader() {
+	level := fd.level
+	if level == CompressionLevelDefault {
+		level = 6
+	}
+
+	switch fd.format {
+	case flateFormatZLib:
+		levelFlags := 3
+		switch {
+		case level < 2:
+			levelFlags = 0
+		case level < 6:
+			levelFlags = 1
+		case level == 6:
+			levelFlags = 2
+		}
+		// the deflate method with the window size, as log2 of the size minus 8
+		method := (fd.windowBits-8)<<4 | 8
+		header := uint16(method<<8 | levelFlags<<6)
+		header += 31 - header%31
+		fd.pending.Write([]byte{byte(header >> 8), byte(header)})
+	case flateFormatGZip:
+		var extraFlags byte
+		if level == CompressionLevelBestCompression {
+			extraFlags = 2
+		} else if level < 2 {
+			extraFlags = 4
+		}
+		// no name, comment or modification time and the unix OS code
+		fd.pending.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, extraFlags, 3})
+	}
+}
+
+func (fd *flateDeflater) writeTrailer() {
+	switch fd.format {
+	case flateFormatZLib:
+		fd.pending.Write(binary.BigEndian.AppendUint32(nil, fd.checksum.Sum32()))
+	case flateFormatGZip:
+		trailer := binary.LittleEndian.AppendUint32(nil, fd.checksum.Sum32())
+		fd.pending.Write(binary.LittleEndian.AppendUint32(trailer, fd.size))
+	}
+}
+
+func (fd *flateDeflater) reset() {
+	fd.pending.Reset()
+	fd.writer.Reset(&fd.pending)
+	fd.size = 0
+	fd.started = false
+	fd.dirty = false
+	fd.finished = false
+
+	if fd.format == flateFormatGZip {
+		fd.checksum = crc32.NewIEEE()
+	} else {
+		fd.checksum = adler32.New()
+	}
+}
+
+func (fd *flateDeflater) bound(n int) int {
+	wrapLen := 0
+	switch fd.format {
+	case flateFormatZLib:
+		wrapLen = 6
+	case flateFormatGZip:
+		wrapLen = 18
+	}
+
+	// zlib's conservative bound plus the final block compress/flate adds
+	return n + n>>12 + n>>14 + n>>25 + 7 + wrapLen + flateFinalBlockOverhead
+}
+
+func (fd *flateDeflater) close() {
+	fd.pending = bytes.Buffer{}
+}
+
+// flateEvent is sent by the reader goroutine of a flateInflater, either asking for input or with the result of a read
+type flateEvent struct {
+	needInput bool
+	data      []byte
+	err       error
+}
+
+// flateInflater runs a compress/flate, zlib or gzip reader in a goroutine over the input of the inflate calls
+// The goroutine only runs between a proceed message and the event it answers with, while the inflate call waits,
+// so the input and output it touches are never accessed concurrently.
+type flateInflater struct {
+	windowBits int
+
+	running bool
+	proceed chan struct{}
+	events  chan flateEvent
+	quit    chan struct{}
+	exited  chan struct{}
+	// input is the part of the input of the current inflate call the reader hasn't read yet
+	input []byte
+	// unread is set when the reader must read lastByte again, after peeking at the stream format
+	unread   bool
+	lastByte byte
+	// needInput is set while the reader goroutine waits for more input
+	needInput bool
+
+	// pending is uncompressed data read but not yet returned, followed by end once it's all returned
+	pending    []byte
+	pendingBuf []byte
+	// end is io.EOF at the end of the stream or the error that failed it
+	end error
+}
+
+func (fi *flateInflater) inflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	if !fi.running {
+		fi.start()
+	}
+
+	fi.input = in
+	produced := 0
+	readWhenFull := false
+	for {
+		n := copy(out[produced:], fi.pending)
+		produced += n
+		fi.pending = fi.pending[n:]
+		if len(fi.pending) > 0 || fi.end != nil || (fi.needInput && len(fi.input) == 0) {
+			break
+		}
+
+		// reading once more when out is full tells whether the stream ends right there, which zlib reports
+		if produced == len(out) && (len(out) == 0 || readWhenFull) {
+			break
+		}
+		readWhenFull = produced == len(out)
+
+		fi.read()
+	}
+
+	consumed := len(in) - len(fi.input)
+	fi.input = nil
+	if len(fi.pending) == 0 && fi.end != nil {
+		return consumed, produced, fi.end
+	}
+
+	return consumed, produced, nil
+}
+
+// read lets the reader goroutine proceed until it needs more input or reads the next chunk of uncompressed data
+// It must only be called once all pending data was returned.
+func (fi *flateInflater) read() {
+	fi.needInput = false
+	fi.proceed <- struct{}{}
+	event := <-fi.events
+	if event.needInput {
+		fi.needInput = true
+		return
+	}
+
+	fi.pendingBuf = append(fi.pendingBuf[:0], event.data...)
+	fi.pending = fi.pendingBuf
+
+	if event.err == io.EOF || errors.Is(event.err, PanicError) {
+		fi.end = event.err
+	} else if event.err != nil {
+		fi.end = fmt.Errorf("%w: %v", TransformerUncompressionError, event.err)
+	}
+}
+
+func (fi *flateInflater) deflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	return 0, 0, fmt.Errorf("%w: uncompressing stream", TransformerCompressionError)
+}
+
+func (fi *flateInflater) start() {
+	fi.running = true
+	fi.proceed = make(chan struct{})
+	fi.events = make(chan flateEvent)
+	fi.quit = make(chan struct{})
+	fi.exited = make(chan struct{})
+
+	go fi.run()
+}
+
+// run is the reader goroutine, reading the next chunk of uncompressed data every time it's asked to proceed
+func (fi *flateInflater) run() {
+	defer close(fi.exited)
+
+	if !fi.wait() {
+		return
+	}
+
+	buffer := make([]byte, flateInflateBufferSize)
+	reader, err := fi.newReader()
+	for {
+		n := 0
+		if err == nil {
+			n, err = readChunk(reader, buffer)
+		}
+
+		if !fi.send(flateEvent{data: buffer[:n], err: err}) || err != nil {
+			return
+		}
+
+		if !fi.wait() {
+			return
+		}
+	}
+}
+
+// readChunk reads the next chunk of uncompressed data. Panics in the reader goroutine can't reach the recovery of
+// Engine.Inflate, so they are recovered here and passed on as the error of the read.
+func readChunk(reader io.Reader, buffer []byte) (n int, err error) {
+	defer recoverPanic("Engine.Inflate", &err)
+
+	return reader.Read(buffer)
+}
+
+func (fi *flateInflater) newReader() (reader io.Reader, err error) {
+	defer recoverPanic("Engine.Inflate", &err)
+
+	format := flateFormatFor(fi.windowBits)
+	if fi.windowBits > flateMaxWindowBits+16 {
+		// zlib and gzip streams are told apart by their first byte
+		first, err := fi.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		fi.unread = true
+		format = flateFormatZLib
+		if first == 0x1f {
+			format = flateFormatGZip
+		}
+	}
+
+	switch format {
+	case flateFormatRaw:
+		return flate.NewReader(fi), nil
+	case flateFormatGZip:
+		gzipReader, gerr := gzip.NewReader(fi)
+		if gerr != nil {
+			return nil, gerr
+		}
+		// like zlib, stop at the end of the first member
+		gzipReader.Multistream(false)
+		return gzipReader, nil
+	default:
+		return zlib.NewReader(fi)
+	}
+}
+
+func (fi *flateInflater) wait() bool {
+	select {
+	case <-fi.proceed:
+		return true
+	case <-fi.quit:
+		return false
+	}
+}
+
+func (fi *flateInflater) send(event flateEvent) bool {
+	select {
+	case fi.events <- event:
+		return true
+	case <-fi.quit:
+		return false
+	}
+}
+
+// ReadByte is called by the stdlib readers in the reader goroutine. Implementing io.ByteReader keeps them from
+// buffering input, so they never read past the end of the stream.
+func (fi *flateInflater) ReadByte() (byte, error) {
+	if fi.unread {
+		fi.unread = false
+		return fi.lastByte, nil
+	}
+
+	for len(fi.input) == 0 {
+		if !fi.send(flateEvent{needInput: true}) || !fi.wait() {
+			return 0, errFlateStreamClosed
+		}
+	}
+
+	fi.lastByte = fi.input[0]
+	fi.input = fi.input[1:]
+	return fi.lastByte, nil
+}
+
+// Read is called by the stdlib readers in the reader goroutine, always for data they need
+func (fi *flateInflater) Read(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	first, err := fi.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	data[0] = first
+
+	n := copy(data[1:], fi.input)
+	fi.input = fi.input[n:]
+	return n + 1, nil
+}
+
+func (fi *flateInflater) reset() {
+	fi.stop()
+	fi.pending = nil
+	fi.end = nil
+}
+
+func (fi *flateInflater) stop() {
+	if !fi.running {
+		return
+	}
+
+	close(fi.quit)
+	<-fi.exited
+	fi.running = false
+	fi.needInput = false
+	fi.unread = false
+	fi.input = nil
+}
+
+func (fi *flateInflater) bound(n int) int {
+	return 0
+}
+
+func (fi *flateInflater) close() {
+	fi.reset()
+	fi.pendingBuf = nil
+}
@@ -0,0 +1,502 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// engineRoundTrip compresses data with engine in chunks, flushing after each one, and uncompresses it back
+func engineRoundTrip(t *testing.T, engine *Engine, data []byte, chunkSize int) []byte {
+	return engineInflate(t, engine, engineDeflate(t, engine, data, chunkSize, FlushModeSync))
+}
+
+// engineDeflate compresses data with engine in chunks, ending each one with flush, and finishes the stream
+func engineDeflate(t *testing.T, engine *Engine, data []byte, chunkSize int, flush FlushMode) []byte {
+	out := make([]byte, 256)
+	compressed := []byte{}
+
+	for pos := 0; pos < len(data); pos += chunkSize {
+		end := pos + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		in := data[pos:end]
+		for {
+			consumed, produced, err := engine.Deflate(in, out, flush)
+			require.NoError(t, err)
+			compressed = append(compressed, out[:produced]...)
+			in = in[consumed:]
+			if len(in) == 0 && produced < len(out) {
+				break
+			}
+		}
+	}
+
+	for {
+		_, produced, err := engine.Deflate(nil, out, FlushModeFinish)
+		compressed = append(compressed, out[:produced]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+
+	return compressed
+}
+
+// engineInflate uncompresses a complete stream with engine, a few bytes at a time
+func engineInflate(t *testing.T, engine *Engine, compressed []byte) []byte {
+	out := make([]byte, 256)
+	uncompressed := []byte{}
+	in := compressed
+	for {
+		inLen := len(in)
+		if inLen > 100 {
+			inLen = 100
+		}
+
+		consumed, produced, err := engine.Inflate(in[:inLen], out, FlushModeNone)
+		uncompressed = append(uncompressed, out[:produced]...)
+		in = in[consumed:]
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.False(t, consumed == 0 && produced == 0 && len(in) == 0, "stream truncated")
+	}
+
+	assert.Empty(t, in)
+	return uncompressed
+}
+
+// testBackends returns the names of the available backends
+func testBackends() []Backend {
+	names := []Backend{}
+	for _, provider := range backends {
+		names = append(names, Backend(provider.name))
+	}
+	return names
+}
+
+// newTestEngine creates an engine running on backend
+func newTestEngine(t *testing.T, mode TransformMode, level CompressionLevel, backend Backend) *Engine {
+	engine, err := NewEngine(mode, level)
+	require.NoError(t, err)
+	require.NoError(t, engine.SetBackend(backend))
+	t.Cleanup(func() { engine.Close() })
+
+	return engine
+}
+
+func TestBackendsRoundTrip(t *testing.T) {
+	data := makeTestData(50000)
+
+	for _, provider := range backends {
+		for _, mode := range []TransformMode{TransformModeGZip, TransformModeZLib, TransformModeRawDeflate} {
+			engine := newEngineWithBackend(mode, CompressionLevelBestSpeed, provider)
+
+			assert.Equal(t, data, engineRoundTrip(t, engine, data, 3000), "backend %s, mode %v", provider.name, mode)
+
+			engine.ResetDeflate()
+			engine.ResetInflate()
+			assert.Equal(t, data[:10], engineRoundTrip(t, engine, data[:10], 3000), "backend %s, mode %v after reset", provider.name, mode)
+
+			assert.NoError(t, engine.Close())
+		}
+	}
+}
+
+func TestBackendsAgreeOnUncompressedData(t *testing.T) {
+	data := makeTestData(20000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	for _, provider := range backends {
+		engine := newEngineWithBackend(TransformModeGZip, CompressionLevelBestCompression, provider)
+
+		out := make([]byte, len(data)+1)
+		consumed, produced, err := engine.Inflate(compressed, out, FlushModeNone)
+		assert.Equal(t, io.EOF, err, "backend %s", provider.name)
+		assert.Equal(t, len(compressed), consumed, "backend %s", provider.name)
+		assert.True(t, bytes.Equal(data, out[:produced]), "backend %s", provider.name)
+
+		assert.NoError(t, engine.Close())
+	}
+}
+
+func TestEngineDeflateBound(t *testing.T) {
+	random := make([]byte, 300000)
+	rand.New(rand.NewSource(1)).Read(random)
+	payloads := [][]byte{{}, random[:1], random[:100], random[:16384*3+10], random[:65535], random, makeTestData(30000)}
+
+	for _, backend := range testBackends() {
+		for _, mode := range []TransformMode{TransformModeGZip, TransformModeZLib, TransformModeRawDeflate} {
+			for _, level := range []CompressionLevel{CompressionLevelNone, CompressionLevelBestSpeed, CompressionLevelDefault, CompressionLevelBestCompression} {
+				engine := newTestEngine(t, mode, level, backend)
+				for _, data := range payloads {
+					if backend == BackendZLib && level == CompressionLevelNone && len(data) < 2 {
+						// zlib's stored blocks need more room than its bound gives tiny inputs to finish in one call
+						continue
+					}
+
+					engine.ResetDeflate()
+					bound, err := engine.DeflateBound(len(data))
+					require.NoError(t, err)
+
+					out := make([]byte, bound)
+					consumed, produced, err := engine.Deflate(data, out, FlushModeFinish)
+					assert.Equal(t, io.EOF, err, "backend %s, mode %v, level %d, size %d", backend, mode, level, len(data))
+					assert.Equal(t, len(data), consumed)
+					assert.LessOrEqual(t, produced, bound)
+				}
+			}
+		}
+	}
+}
+
+func TestBackendsInteroperate(t *testing.T) {
+	data := makeTestData(40000)
+
+	for _, compressing := range testBackends() {
+		for _, uncompressing := range testBackends() {
+			for _, mode := range []TransformMode{TransformModeGZip, TransformModeZLib, TransformModeRawDeflate} {
+				for _, flush := range []FlushMode{FlushModeNone, FlushModeSync, FlushModeFull} {
+					deflater := newTestEngine(t, mode, CompressionLevelDefault, compressing)
+					inflater := newTestEngine(t, mode, CompressionLevelDefault, uncompressing)
+
+					compressed := engineDeflate(t, deflater, data, 3333, flush)
+					assert.Equal(t, data, engineInflate(t, inflater, compressed),
+						"%s to %s, mode %v, flush %d", compressing, uncompressing, mode, flush)
+				}
+			}
+		}
+	}
+}
+
+func TestBackendsStopAtStreamEnd(t *testing.T) {
+	data := makeTestData(5000)
+	trailing := []byte("next stream")
+
+	for _, backend := range testBackends() {
+		for _, mode := range []TransformMode{TransformModeGZip, TransformModeZLib, TransformModeRawDeflate} {
+			engine := newTestEngine(t, mode, CompressionLevelBestSpeed, backend)
+			compressed := engineDeflate(t, engine, data, len(data), FlushModeNone)
+
+			out := make([]byte, len(data))
+			consumed, produced, err := engine.Inflate(append(compressed, trailing...), out, FlushModeNone)
+			assert.Equal(t, io.EOF, err, "backend %s, mode %v", backend, mode)
+			assert.Equal(t, len(compressed), consumed, "backend %s, mode %v", backend, mode)
+			assert.Equal(t, data, out[:produced])
+
+			// the stream stays ended until the engine is reset
+			consumed, produced, err = engine.Inflate(trailing, out, FlushModeNone)
+			assert.Equal(t, io.EOF, err)
+			assert.Zero(t, consumed)
+			assert.Zero(t, produced)
+		}
+	}
+}
+
+func TestBackendsRejectCorruptedData(t *testing.T) {
+	data := makeTestData(5000)
+
+	for _, backend := range testBackends() {
+		for _, mode := range []TransformMode{TransformModeGZip, TransformModeZLib} {
+			engine := newTestEngine(t, mode, CompressionLevelBestSpeed, backend)
+			compressed := engineDeflate(t, engine, data, len(data), FlushModeNone)
+			// the trailer ends with the adler-32 checksum for zlib and the size for gzip
+			compressed[len(compressed)-1] ^= 0xff
+
+			out := make([]byte, len(data)+1)
+			_, _, err := engine.Inflate(compressed, out, FlushModeNone)
+			assert.ErrorIs(t, err, TransformerUncompressionError, "backend %s, mode %v", backend, mode)
+		}
+	}
+}
+
+func TestBackendsFullFlushRestartsStream(t *testing.T) {
+	first := makeTestData(3000)
+	second := makeTestData(4000)
+
+	for _, compressing := range testBackends() {
+		deflater := newTestEngine(t, TransformModeRawDeflate, CompressionLevelDefault, compressing)
+		out := make([]byte, 20000)
+		_, firstLen, err := deflater.Deflate(first, out, FlushModeFull)
+		require.NoError(t, err)
+		_, secondLen, err := deflater.Deflate(second, out[firstLen:], FlushModeFinish)
+		require.Equal(t, io.EOF, err)
+
+		// data after a full flush point doesn't reference data before it
+		for _, uncompressing := range testBackends() {
+			inflater := newTestEngine(t, TransformModeRawDeflate, CompressionLevelDefault, uncompressing)
+			assert.Equal(t, second, engineInflate(t, inflater, out[firstLen:firstLen+secondLen]), "%s to %s", compressing, uncompressing)
+		}
+	}
+}
+
+func TestBackendsWriteTheSameZLibHeader(t *testing.T) {
+	for _, level := range []CompressionLevel{CompressionLevelNone, CompressionLevelBestSpeed, 3, CompressionLevelDefault, CompressionLevelBestCompression} {
+		headers := [][]byte{}
+		for _, backend := range testBackends() {
+			engine := newTestEngine(t, TransformModeZLib, level, backend)
+			compressed := engineDeflate(t, engine, []byte("header"), 6, FlushModeNone)
+			headers = append(headers, compressed[:2])
+		}
+
+		for _, header := range headers[1:] {
+			assert.Equal(t, headers[0], header, "level %d", level)
+		}
+	}
+
+	// compress/flate can't compress with a smaller window than the header would announce
+	_, err := newFlateDeflater(CompressionLevelDefault, 9)
+	assert.ErrorIs(t, err, TransformerInitializationError)
+	_, err = newFlateDeflater(CompressionLevelDefault, -9)
+	assert.ErrorIs(t, err, TransformerInitializationError)
+}
+
+func TestUnclosedEngineStopsInflateGoroutine(t *testing.T) {
+	compressed, err := stdLibGZipCompressSlice(makeTestData(5000))
+	require.NoError(t, err)
+	goroutines := runtime.NumGoroutine()
+
+	func() {
+		engine := newEngineWithBackend(TransformModeGZip, CompressionLevelDefault, flateBackend)
+		// the reader goroutine is left waiting for the rest of the stream
+		_, _, err := engine.Inflate(compressed[:len(compressed)/2], make([]byte, 10000), FlushModeNone)
+		require.NoError(t, err)
+		assert.Greater(t, runtime.NumGoroutine(), goroutines)
+	}()
+
+	// the finalizer runs in its own goroutine after the collection that finds the engine unreachable
+	for attempt := 0; attempt < 100 && runtime.NumGoroutine() > goroutines; attempt++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+}
+
+func TestEngineSetBackend(t *testing.T) {
+	engine, err := NewEngine(TransformModeZLib, CompressionLevelDefault)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	assert.ErrorIs(t, engine.SetBackend("brotli"), BackendError)
+	assert.Equal(t, zlibBackend, engine.backend)
+
+	require.NoError(t, engine.SetBackend(BackendGo))
+	assert.Equal(t, flateBackend, engine.backend)
+	data := makeTestData(1000)
+	assert.Equal(t, data, engineRoundTrip(t, engine, data, 100))
+
+	assert.ErrorIs(t, engine.SetBackend(BackendZLib), BackendError)
+	assert.Equal(t, flateBackend, engine.backend)
+}
+
+func TestSelectFastestBackend(t *testing.T) {
+	defer selectedBackend.Store(nil)
+
+	assert.Nil(t, Capabilities().BackendBenchmarks)
+
+	benchmarks, err := SelectFastestBackend()
+	require.NoError(t, err)
+	require.Len(t, benchmarks, len(backends))
+
+	for pos, benchmark := range benchmarks {
+		assert.Equal(t, backends[pos].name, benchmark.Backend)
+		assert.NoError(t, benchmark.Err)
+		assert.Greater(t, benchmark.Duration, time.Duration(0))
+	}
+
+	report := Capabilities()
+	assert.Equal(t, defaultBackend().name, report.Backend)
+	assert.Equal(t, benchmarks, report.BackendBenchmarks)
+
+	// engines created after the selection run on the selected backend
+	engine, err := NewEngine(TransformModeZLib, CompressionLevelBestSpeed)
+	require.NoError(t, err)
+	defer engine.Close()
+	assert.Equal(t, report.Backend, engine.backend.name)
+}
+
+// slowBackend delays every deflate call of the backend it wraps
+type slowBackend struct {
+	backend
+}
+
+func (sb slowBackend) deflate(in []byte, out []byte, flush FlushMode) (int, int, error) {
+	time.Sleep(20 * time.Millisecond)
+	return sb.backend.deflate(in, out, flush)
+}
+
+// slowBackendProvider is a backend provider much slower than provider, running on it
+func slowBackendProvider(provider *backendProvider) *backendProvider {
+	return &backendProvider{
+		name: "slow " + provider.name,
+		newDeflater: func(level CompressionLevel, windowBits int) (backend, error) {
+			deflater, err := provider.newDeflater(level, windowBits)
+			if err != nil {
+				return nil, err
+			}
+			return slowBackend{deflater}, nil
+		},
+		newInflater: provider.newInflater,
+	}
+}
+
+// useBackends replaces the available backends for the duration of the test
+func useBackends(t *testing.T, providers ...*backendProvider) {
+	previous := backends
+	backends = providers
+	t.Cleanup(func() {
+		backends = previous
+		selectedBackend.Store(nil)
+	})
+}
+
+func TestSelectFastestBackendSkipsSlowBackend(t *testing.T) {
+	cases := [][]*backendProvider{
+		{slowBackendProvider(zlibBackend), zlibBackend, flateBackend},
+		{slowBackendProvider(flateBackend), flateBackend},
+		{slowBackendProvider(zlibBackend), flateBackend},
+	}
+
+	for _, providers := range cases {
+		useBackends(t, providers...)
+
+		benchmarks, err := SelectFastestBackend()
+		require.NoError(t, err)
+		require.Len(t, benchmarks, len(providers))
+
+		fastest := benchmarks[0]
+		for _, benchmark := range benchmarks[1:] {
+			require.NoError(t, benchmark.Err)
+			if benchmark.Duration < fastest.Duration {
+				fastest = benchmark
+			}
+		}
+		assert.Less(t, fastest.Duration, benchmarks[0].Duration)
+		assert.NotEqual(t, providers[0].name, fastest.Backend)
+
+		// the fastest backend becomes the default, reported by Capabilities and used by new engines
+		assert.Equal(t, fastest.Backend, defaultBackend().name)
+		report := Capabilities()
+		assert.Equal(t, fastest.Backend, report.Backend)
+		assert.Equal(t, benchmarks, report.BackendBenchmarks)
+
+		engine, err := NewEngine(TransformModeGZip, CompressionLevelDefault)
+		require.NoError(t, err)
+		assert.Equal(t, fastest.Backend, engine.backend.name)
+		data := makeTestData(2000)
+		assert.Equal(t, data, engineRoundTrip(t, engine, data, 500))
+		assert.NoError(t, engine.Close())
+	}
+}
+
+func TestSelectFastestBackendWithoutWorkingBackend(t *testing.T) {
+	broken := &backendProvider{
+		name: "broken",
+		newDeflater: func(level CompressionLevel, windowBits int) (backend, error) {
+			return nil, TransformerInitializationError
+		},
+		newInflater: zlibBackend.newInflater,
+	}
+	useBackends(t, broken)
+
+	benchmarks, err := SelectFastestBackend()
+	assert.ErrorIs(t, err, BackendBenchmarkError)
+	require.Len(t, benchmarks, 1)
+	assert.ErrorIs(t, benchmarks[0].Err, TransformerInitializationError)
+	// the default backend is still the first one
+	assert.Nil(t, selectedBackend.Load())
+	assert.Equal(t, broken.name, Capabilities().Backend)
+}
+
+func TestBackendTransformersRoundTrip(t *testing.T) {
+	data := makeTestData(100000)
+
+	for _, backend := range testBackends() {
+		options := TransformerOptions{Backend: backend}
+
+		compressed := bytes.NewBuffer([]byte{})
+		compressor, err := NewGoGZipCompressorWithOptions(compressed, CompressionLevelDefault, 1024, options)
+		require.NoError(t, err)
+		_, err = compressor.Write(data[:50000])
+		assert.NoError(t, err)
+		assert.NoError(t, SyncFlush(compressor))
+		_, err = compressor.Write(data[50000:])
+		assert.NoError(t, err)
+		compressedLen, err := Finish(compressor)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(compressed.Len()), compressedLen, "backend %s", backend)
+		assert.NoError(t, compressor.Close())
+
+		stdLibCompressed, err := stdLibGZipCompressSlice(data)
+		require.NoError(t, err)
+		for _, input := range [][]byte{compressed.Bytes(), stdLibCompressed} {
+			uncompressor, err := NewGoZLibUncompressorWithOptions(bytes.NewReader(input), 1024, options)
+			require.NoError(t, err)
+			uncompressed, err := io.ReadAll(uncompressor)
+			assert.NoError(t, err)
+			assert.Equal(t, data, uncompressed, "backend %s", backend)
+			assert.NoError(t, uncompressor.Close())
+		}
+	}
+}
+
+func TestBackendTransformersReset(t *testing.T) {
+	data := makeTestData(5000)
+	options := TransformerOptions{Backend: BackendGo}
+
+	compressor, err := NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelBestSpeed, 0, options)
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+
+	compressed := bytes.NewBuffer([]byte{})
+	ResetCompressor(compressed, compressor)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	uncompressor, err := NewGoZLibUncompressorWithOptions(bytes.NewReader(compressed.Bytes()[:compressed.Len()/2]), 0, options)
+	require.NoError(t, err)
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	ResetUncompressor(compressed, uncompressor)
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+	assert.NoError(t, uncompressor.Close())
+}
+
+func TestBackendTransformersInvalidOptions(t *testing.T) {
+	_, err := NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelDefault, 1024, TransformerOptions{Backend: "brotli"})
+	assert.ErrorIs(t, err, BackendError)
+	_, err = NewGoZLibUncompressorWithOptions(bytes.NewReader(nil), 1024, TransformerOptions{Backend: "brotli"})
+	assert.ErrorIs(t, err, BackendError)
+
+	_, err = NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelDefault, 1024,
+		TransformerOptions{Backend: BackendGo, Strategy: CompressionStrategyHuffmanOnly})
+	assert.ErrorIs(t, err, BackendError)
+	_, err = NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelDefault, 1024,
+		TransformerOptions{Backend: BackendGo, Header: &GZipHeader{Name: "file"}})
+	assert.ErrorIs(t, err, BackendError)
+	_, err = NewGoGZipCompressorWithOptions(io.Discard, CompressionLevel(20), 1024, TransformerOptions{Backend: BackendGo})
+	assert.ErrorIs(t, err, CompressionLevelError)
+
+	// zlib keeps the native transformers
+	compressor, err := NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelDefault, 1024, TransformerOptions{Backend: BackendZLib})
+	require.NoError(t, err)
+	assert.IsType(t, &goGZipCompressor{}, compressor)
+	assert.NoError(t, compressor.Close())
+}
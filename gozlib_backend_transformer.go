@@ -0,0 +1,263 @@
+package gozlib
+
+import (
+	"fmt"
+	"io"
+)
+
+// Backend transformers
+// Compressors and uncompressors created with TransformerOptions.Backend set to a backend other than zlib run on an
+// Engine instead of the cgo zlib transformers, moving data between the Engine and the output or input through a buffer
+// of bufferSize bytes. They support Flush, SyncFlush, FullFlush, Finish, ResetCompressor and ResetUncompressor, the
+// other helper functions need the zlib transformers.
+
+// backendProvider returns the provider of the backend the transformer runs on, nil for the cgo zlib transformers
+func (opts TransformerOptions) backendProvider() (*backendProvider, error) {
+	if opts.Backend == BackendDefault {
+		return nil, nil
+	}
+
+	provider, err := opts.Backend.provider()
+	if err != nil || provider == zlibBackend {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// validateBackendOptions rejects the options only the zlib transformers support
+func validateBackendOptions(options TransformerOptions) error {
+	if options.Strategy != CompressionStrategyDefault {
+		return fmt.Errorf("%w: backend %s doesn't support compression strategies", BackendError, options.Backend)
+	}
+
+	if options.Header != nil {
+		return fmt.Errorf("%w: backend %s doesn't support gzip headers", BackendError, options.Backend)
+	}
+
+	return nil
+}
+
+func backendBufferSize(bufferSize uint32) int {
+	if bufferSize == 0 {
+		return int(GetDefaults().CompressorBufferSize)
+	}
+
+	return int(bufferSize)
+}
+
+// backendCompressor is a compressor running on an Engine
+type backendCompressor struct {
+	engine   *Engine
+	output   io.Writer
+	buffer   []byte
+	written  uint64
+	finished bool
+}
+
+func newBackendCompressor(output io.Writer, mode TransformMode, level CompressionLevel, bufferSize uint32, provider *backendProvider) (*backendCompressor, error) {
+	lerr := level.validate()
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return &backendCompressor{
+		engine: newEngineWithBackend(mode, level, provider),
+		output: output,
+		buffer: make([]byte, backendBufferSize(bufferSize)),
+	}, nil
+}
+
+// Write compresses data, writing the compressed data produced to the output
+func (bc *backendCompressor) Write(data []byte) (n int, err error) {
+	defer recoverPanic("Write", &err)
+
+	written := 0
+	for {
+		consumed, produced, derr := bc.engine.Deflate(data[written:], bc.buffer, FlushModeNone)
+		written += consumed
+		if derr != nil {
+			return written, derr
+		}
+
+		werr := bc.writeOutput(produced)
+		if werr != nil {
+			return written, werr
+		}
+
+		if written == len(data) && produced < len(bc.buffer) {
+			return written, nil
+		}
+	}
+}
+
+func (bc *backendCompressor) writeOutput(produced int) error {
+	if produced == 0 {
+		return nil
+	}
+
+	written, err := bc.output.Write(bc.buffer[:produced])
+	bc.written += uint64(written)
+	if err == nil && written < produced {
+		err = io.ErrShortWrite
+	}
+
+	return err
+}
+
+// flush writes all data compressed so far to the output, ending the stream with FlushModeFinish
+func (bc *backendCompressor) flush(mode FlushMode) error {
+	if bc.finished {
+		return nil
+	}
+
+	for {
+		_, produced, derr := bc.engine.Deflate(nil, bc.buffer, mode)
+		if derr != nil && derr != io.EOF {
+			return derr
+		}
+
+		werr := bc.writeOutput(produced)
+		if werr != nil {
+			return werr
+		}
+
+		if derr == io.EOF {
+			bc.finished = true
+			return nil
+		}
+
+		if mode != FlushModeFinish && produced < len(bc.buffer) {
+			return nil
+		}
+	}
+}
+
+// Flush compresses all data written so far and ends the compressed stream
+func (bc *backendCompressor) Flush() (err error) {
+	defer recoverPanic("Flush", &err)
+
+	return bc.flush(FlushModeFinish)
+}
+
+// Finish ends the compressed stream and returns the number of compressed bytes written to the output
+func (bc *backendCompressor) Finish() (compressedLen uint64, err error) {
+	defer recoverPanic("Finish", &err)
+
+	ferr := bc.flush(FlushModeFinish)
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	return bc.written, nil
+}
+
+// SyncFlush compresses all data written so far and aligns the output to a byte boundary without ending the stream
+func (bc *backendCompressor) SyncFlush() (err error) {
+	defer recoverPanic("SyncFlush", &err)
+
+	return bc.flush(FlushModeSync)
+}
+
+// FullFlush is like SyncFlush but also resets the compression state
+func (bc *backendCompressor) FullFlush() (err error) {
+	defer recoverPanic("FullFlush", &err)
+
+	return bc.flush(FlushModeFull)
+}
+
+func (bc *backendCompressor) resetOutput(output io.Writer) {
+	bc.engine.ResetDeflate()
+	bc.output = output
+	bc.written = 0
+	bc.finished = false
+}
+
+// Close ends the compressed stream and releases the engine
+func (bc *backendCompressor) Close() (err error) {
+	defer recoverPanic("Close", &err)
+
+	ferr := bc.flush(FlushModeFinish)
+	bc.engine.Close()
+
+	return ferr
+}
+
+// backendUncompressor is a zlib or gzip uncompressor running on an Engine
+type backendUncompressor struct {
+	engine *Engine
+	input  io.Reader
+	buffer []byte
+	// in is the part of the buffer read from the input and not yet consumed
+	in         []byte
+	inputEnded bool
+	ended      bool
+}
+
+func newBackendUncompressor(input io.Reader, bufferSize uint32, provider *backendProvider) *backendUncompressor {
+	return &backendUncompressor{
+		// gzip engines inflate zlib and gzip streams
+		engine: newEngineWithBackend(TransformModeGZip, CompressionLevelDefault, provider),
+		input:  input,
+		buffer: make([]byte, backendBufferSize(bufferSize)),
+	}
+}
+
+// Read uncompresses data read from the input into output
+// If the input ends before the compressed stream does, io.ErrUnexpectedEOF is returned.
+func (bu *backendUncompressor) Read(output []byte) (n int, err error) {
+	defer recoverPanic("Read", &err)
+
+	if bu.ended {
+		return 0, io.EOF
+	}
+
+	if len(output) == 0 {
+		return 0, nil
+	}
+
+	for {
+		if len(bu.in) == 0 && !bu.inputEnded {
+			readLen, readErr := bu.input.Read(bu.buffer)
+			bu.in = bu.buffer[:readLen]
+			if readErr == io.EOF {
+				bu.inputEnded = true
+			} else if readErr != nil {
+				return 0, readErr
+			}
+		}
+
+		consumed, produced, ierr := bu.engine.Inflate(bu.in, output, FlushModeNone)
+		bu.in = bu.in[consumed:]
+		if ierr == io.EOF {
+			bu.ended = true
+			if produced > 0 {
+				return produced, nil
+			}
+			return 0, io.EOF
+		}
+
+		if ierr != nil || produced > 0 {
+			return produced, ierr
+		}
+
+		if len(bu.in) == 0 && bu.inputEnded {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+func (bu *backendUncompressor) resetInput(input io.Reader) {
+	bu.engine.ResetInflate()
+	bu.input = input
+	bu.in = nil
+	bu.inputEnded = false
+	bu.ended = false
+}
+
+// Close releases the engine
+func (bu *backendUncompressor) Close() (err error) {
+	defer recoverPanic("Close", &err)
+
+	return bu.engine.Close()
+}
@@ -0,0 +1,202 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Batch compression and uncompression
+// Compressing or uncompressing many small independent blobs, like database row values, with GoGZipCompressBuffer and
+// GoUncompressBuffer sets up and tears down a zlib stream for each blob, which dominates the cost when blobs are only
+// a few hundred bytes. BatchCompressor and BatchUncompressor keep a single deflate or inflate stream and only reset it
+// between blobs. Small blobs also compress poorly on their own, which a shared preset dictionary of common content helps with.
+
+// minimum number of bytes dst grows by when DecodeAppend runs out of room for uncompressed data
+const batchMinGrowSize = 512
+
+var (
+	BatchUncompressorClosedError = errors.New("batch uncompressor is closed")
+	BatchCompressorClosedError   = errors.New("batch compressor is closed")
+)
+
+// BatchUncompressor uncompresses independent gzip or zlib blobs one after the other, reusing the same inflate state
+// A BatchUncompressor is not safe for concurrent use and Close must be called to release the native resources.
+type BatchUncompressor struct {
+	stream     *nativeStream
+	dictionary []byte
+}
+
+// NewBatchUncompressor creates a batch uncompressor accepting gzip and zlib blobs
+func NewBatchUncompressor() (uncompressor *BatchUncompressor, err error) {
+	defer recoverPanic("NewBatchUncompressor", &err)
+
+	return NewBatchUncompressorWithDictionary(nil)
+}
+
+// NewBatchUncompressorWithDictionary creates a batch uncompressor accepting gzip and zlib blobs, using dictionary for
+// the zlib blobs that need a preset dictionary, like the ones produced by a BatchCompressor with the same dictionary
+func NewBatchUncompressorWithDictionary(dictionary []byte) (uncompressor *BatchUncompressor, err error) {
+	defer recoverPanic("NewBatchUncompressorWithDictionary", &err)
+
+	stream, err := newInflateStream(C.UNCOMPRESS_ANY_WINDOW_BITS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BatchUncompressor{stream: stream, dictionary: copyDictionary(dictionary)}, nil
+}
+
+// DecodeAppend uncompresses the single gzip or zlib stream in compressed, appending the uncompressed data to dst and
+// returning the extended slice. dst grows as needed, so reusing the returned slice for the next blobs avoids allocations.
+// On error, dst is returned with its original length. Data after the end of the stream fails with TrailingDataError
+// and a stream cut short fails with io.ErrUnexpectedEOF.
+func (bu *BatchUncompressor) DecodeAppend(dst []byte, compressed []byte) (result []byte, err error) {
+	defer recoverPanic("BatchUncompressor.DecodeAppend", &err)
+
+	if bu.stream == nil {
+		return dst, BatchUncompressorClosedError
+	}
+
+	bu.stream.reset()
+	start := len(dst)
+	input := compressed
+
+	for {
+		if len(dst) == cap(dst) {
+			grow := 2 * len(compressed)
+			if grow < batchMinGrowSize {
+				grow = batchMinGrowSize
+			}
+			dst = append(dst, make([]byte, grow)...)[:len(dst)]
+		}
+
+		consumed, produced, resultCode := bu.stream.step(input, dst[len(dst):cap(dst)], C.Z_NO_FLUSH)
+		input = input[consumed:]
+		dst = dst[:len(dst)+produced]
+
+		switch resultCode {
+		case C.Z_OK:
+			continue
+		case C.Z_NEED_DICT:
+			if bu.dictionary == nil {
+				return dst[:start], fmt.Errorf(wrapErrorFormat, BufferUncompressError, resultCode)
+			}
+			dictCode := C.set_uncompression_dictionary(bu.stream.zs, bytesPointer(bu.dictionary), C.uInt(len(bu.dictionary)))
+			if dictCode != C.Z_OK {
+				return dst[:start], fmt.Errorf(wrapErrorFormat, DictionaryError, dictCode)
+			}
+		case C.Z_STREAM_END:
+			if len(input) > 0 {
+				return dst[:start], TrailingDataError
+			}
+			return dst, nil
+		case C.Z_BUF_ERROR:
+			// there was room for output, so inflate couldn't progress for lack of input
+			return dst[:start], io.ErrUnexpectedEOF
+		default:
+			return dst[:start], fmt.Errorf(wrapErrorFormat, BufferUncompressError, resultCode)
+		}
+	}
+}
+
+// Close releases the native resources of the batch uncompressor
+func (bu *BatchUncompressor) Close() (err error) {
+	defer recoverPanic("BatchUncompressor.Close", &err)
+
+	if bu.stream != nil {
+		bu.stream.close()
+		bu.stream = nil
+	}
+	return nil
+}
+
+// BatchCompressor compresses independent blobs one after the other into zlib streams, reusing the same deflate state
+// The zlib format is used as, unlike gzip, it can reference a preset dictionary and its framing is only 6 bytes.
+// A BatchCompressor is not safe for concurrent use and Close must be called to release the native resources.
+type BatchCompressor struct {
+	stream     *nativeStream
+	dictionary []byte
+}
+
+// NewBatchCompressor creates a batch compressor with the given compression level and an optional preset dictionary
+// When dictionary isn't empty, every blob is compressed with it and must be uncompressed with the same dictionary,
+// for instance with NewBatchUncompressorWithDictionary or SetDictionaryResolver. Only the last MaxDictionarySize
+// bytes of the dictionary are used, so the most common content should be at its end.
+func NewBatchCompressor(level CompressionLevel, dictionary []byte) (compressor *BatchCompressor, err error) {
+	defer recoverPanic("NewBatchCompressor", &err)
+
+	stream, err := newDeflateStream(level, C.MAX_WBITS, C.Z_DEFAULT_STRATEGY)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BatchCompressor{stream: stream, dictionary: copyDictionary(dictionary)}, nil
+}
+
+// EncodeAppend compresses raw into a single zlib stream, appending it to dst and returning the extended slice.
+// dst grows as needed, so reusing the returned slice for the next blobs avoids allocations.
+// On error, dst is returned with its original length.
+func (bc *BatchCompressor) EncodeAppend(dst []byte, raw []byte) (result []byte, err error) {
+	defer recoverPanic("BatchCompressor.EncodeAppend", &err)
+
+	if bc.stream == nil {
+		return dst, BatchCompressorClosedError
+	}
+
+	bc.stream.reset()
+	if bc.dictionary != nil {
+		dictCode := C.set_compression_dictionary(bc.stream.zs, bytesPointer(bc.dictionary), C.uInt(len(bc.dictionary)))
+		if dictCode != C.Z_OK {
+			return dst, fmt.Errorf(wrapErrorFormat, DictionaryError, dictCode)
+		}
+	}
+
+	start := len(dst)
+	input := raw
+	// with room for the worst case compressed size, the whole blob is compressed in a single step
+	grow := int(C.deflateBound(bc.stream.zs, C.uLong(len(raw))))
+
+	for {
+		if cap(dst)-len(dst) < grow {
+			dst = append(dst, make([]byte, grow)...)[:len(dst)]
+		}
+
+		consumed, produced, resultCode := bc.stream.step(input, dst[len(dst):cap(dst)], C.Z_FINISH)
+		input = input[consumed:]
+		dst = dst[:len(dst)+produced]
+
+		switch resultCode {
+		case C.Z_STREAM_END:
+			return dst, nil
+		case C.Z_OK, C.Z_BUF_ERROR:
+			grow = batchMinGrowSize
+		default:
+			return dst[:start], fmt.Errorf(wrapErrorFormat, BufferCompressError, resultCode)
+		}
+	}
+}
+
+// Close releases the native resources of the batch compressor
+func (bc *BatchCompressor) Close() (err error) {
+	defer recoverPanic("BatchCompressor.Close", &err)
+
+	if bc.stream != nil {
+		bc.stream.close()
+		bc.stream = nil
+	}
+	return nil
+}
+
+// copyDictionary copies a dictionary so it can't be changed by the caller after being handed over
+// An empty dictionary is the same as no dictionary.
+func copyDictionary(dictionary []byte) []byte {
+	if len(dictionary) == 0 {
+		return nil
+	}
+	return append([]byte{}, dictionary...)
+}
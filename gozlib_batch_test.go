@@ -0,0 +1,182 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchUncompressorDecodeAppend(t *testing.T) {
+	batch, err := NewBatchUncompressor()
+	require.NoError(t, err)
+	defer batch.Close()
+
+	var decoded []byte
+	var expected []byte
+	for blob := 0; blob < 200; blob++ {
+		data := makeTestData(uint32(blob*37 + 1))
+		var compressed []byte
+		if blob%2 == 0 {
+			compressed, err = stdLibGZipCompressSlice(data)
+			require.NoError(t, err)
+		} else {
+			buffer := &bytes.Buffer{}
+			writer := zlib.NewWriter(buffer)
+			_, err = writer.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+			compressed = buffer.Bytes()
+		}
+
+		decoded, err = batch.DecodeAppend(decoded, compressed)
+		require.NoError(t, err)
+		expected = append(expected, data...)
+	}
+
+	assert.Equal(t, expected, decoded)
+}
+
+func TestBatchUncompressorErrors(t *testing.T) {
+	batch, err := NewBatchUncompressor()
+	require.NoError(t, err)
+
+	data := makeTestData(5000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	prefix := []byte("kept")
+	decoded, err := batch.DecodeAppend(prefix, compressed[:len(compressed)/2])
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, prefix, decoded)
+
+	_, err = batch.DecodeAppend(nil, append(append([]byte{}, compressed...), 1, 2))
+	assert.ErrorIs(t, err, TrailingDataError)
+
+	_, err = batch.DecodeAppend(nil, []byte("not compressed data"))
+	assert.ErrorIs(t, err, BufferUncompressError)
+
+	// failures don't affect the next blob
+	decoded, err = batch.DecodeAppend(nil, compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decoded)
+
+	assert.NoError(t, batch.Close())
+	_, err = batch.DecodeAppend(nil, compressed)
+	assert.ErrorIs(t, err, BatchUncompressorClosedError)
+}
+
+func TestBatchCompressorEncodeAppend(t *testing.T) {
+	batch, err := NewBatchCompressor(CompressionLevelDefault, nil)
+	require.NoError(t, err)
+	defer batch.Close()
+
+	var encoded []byte
+	var offsets []int
+	var blobs [][]byte
+	for blob := 0; blob < 200; blob++ {
+		blobs = append(blobs, makeTestData(uint32(blob*37)))
+		offsets = append(offsets, len(encoded))
+		encoded, err = batch.EncodeAppend(encoded, blobs[blob])
+		require.NoError(t, err)
+	}
+	offsets = append(offsets, len(encoded))
+
+	for blob := 0; blob < 200; blob++ {
+		reader, rerr := zlib.NewReader(bytes.NewReader(encoded[offsets[blob]:offsets[blob+1]]))
+		require.NoError(t, rerr)
+		decoded, rerr := io.ReadAll(reader)
+		require.NoError(t, rerr)
+		assert.Equal(t, blobs[blob], decoded)
+	}
+}
+
+func TestBatchCompressorIncompressibleData(t *testing.T) {
+	batch, err := NewBatchCompressor(CompressionLevelBestSpeed, nil)
+	require.NoError(t, err)
+	defer batch.Close()
+
+	data := make([]byte, 100000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	prefix := []byte("kept")
+	encoded, err := batch.EncodeAppend(prefix, data)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, encoded[:len(prefix)])
+
+	reader, err := zlib.NewReader(bytes.NewReader(encoded[len(prefix):]))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, decoded)
+}
+
+func TestBatchCompressorSharedDictionary(t *testing.T) {
+	dictionary := []byte(`{"status":"active","country":"NZ","plan":"enterprise","tags":["a","b"]}`)
+	row := []byte(`{"status":"active","country":"NZ","plan":"enterprise","tags":["a","c"]}`)
+
+	plain, err := NewBatchCompressor(CompressionLevelBestCompression, nil)
+	require.NoError(t, err)
+	defer plain.Close()
+	plainEncoded, err := plain.EncodeAppend(nil, row)
+	require.NoError(t, err)
+
+	batch, err := NewBatchCompressor(CompressionLevelBestCompression, dictionary)
+	require.NoError(t, err)
+	defer batch.Close()
+
+	var encoded []byte
+	var offsets []int
+	for blob := 0; blob < 10; blob++ {
+		offsets = append(offsets, len(encoded))
+		encoded, err = batch.EncodeAppend(encoded, row)
+		require.NoError(t, err)
+	}
+	offsets = append(offsets, len(encoded))
+	assert.Less(t, offsets[1], len(plainEncoded)/2)
+
+	// every blob uses the dictionary, not only the first one after creation
+	uncompressor, err := NewBatchUncompressorWithDictionary(dictionary)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+	for blob := 0; blob < 10; blob++ {
+		decoded, derr := uncompressor.DecodeAppend(nil, encoded[offsets[blob]:offsets[blob+1]])
+		require.NoError(t, derr)
+		assert.Equal(t, row, decoded)
+
+		reader, rerr := zlib.NewReaderDict(bytes.NewReader(encoded[offsets[blob]:offsets[blob+1]]), dictionary)
+		require.NoError(t, rerr)
+		decoded, rerr = io.ReadAll(reader)
+		require.NoError(t, rerr)
+		assert.Equal(t, row, decoded)
+	}
+
+	withoutDictionary, err := NewBatchUncompressor()
+	require.NoError(t, err)
+	defer withoutDictionary.Close()
+	_, err = withoutDictionary.DecodeAppend(nil, encoded[:offsets[1]])
+	assert.ErrorIs(t, err, BufferUncompressError)
+
+	wrongDictionary, err := NewBatchUncompressorWithDictionary([]byte("wrong"))
+	require.NoError(t, err)
+	defer wrongDictionary.Close()
+	_, err = wrongDictionary.DecodeAppend(nil, encoded[:offsets[1]])
+	assert.ErrorIs(t, err, DictionaryError)
+}
+
+func TestBatchCompressorErrors(t *testing.T) {
+	_, err := NewBatchCompressor(CompressionLevel(10), nil)
+	assert.ErrorIs(t, err, CompressionLevelError)
+
+	batch, err := NewBatchCompressor(CompressionLevelDefault, nil)
+	require.NoError(t, err)
+	assert.NoError(t, batch.Close())
+
+	_, err = batch.EncodeAppend(nil, []byte("data"))
+	assert.ErrorIs(t, err, BatchCompressorClosedError)
+}
@@ -57,3 +57,35 @@ func benchmarkgoGZipCompress(b *testing.B, input []byte) {
 		compressor.Close()
 	}
 }
+
+func BenchmarkBatchUncompressorSmall(b *testing.B) {
+	compressed, _ := stdLibGZipCompressSlice(smallTestData)
+	batch, _ := NewBatchUncompressor()
+	defer batch.Close()
+
+	var decoded []byte
+	for i := 0; i < b.N; i++ {
+		decoded, _ = batch.DecodeAppend(decoded[:0], compressed)
+	}
+	assert.Equal(b, smallTestData, decoded)
+}
+
+func BenchmarkGoUncompressBufferSmall(b *testing.B) {
+	compressed, _ := stdLibGZipCompressSlice(smallTestData)
+	decoded := make([]byte, 0, len(smallTestData))
+
+	for i := 0; i < b.N; i++ {
+		_, _ = GoUncompressBuffer(compressed, decoded)
+	}
+}
+
+func BenchmarkBatchCompressorSmall(b *testing.B) {
+	batch, _ := NewBatchCompressor(CompressionLevelDefault, nil)
+	defer batch.Close()
+
+	var encoded []byte
+	for i := 0; i < b.N; i++ {
+		encoded, _ = batch.EncodeAppend(encoded[:0], smallTestData)
+	}
+	assert.NotEmpty(b, encoded)
+}
@@ -115,3 +115,24 @@ func TestGoCompressUncompressBuffer(t *testing.T) {
 	assert.Equal(t, uint64(inputSize), uncompLen)
 	assert.Equal(t, input, uncompressed[:uncompLen])
 }
+
+func TestGoGZipCompressBufferLevels(t *testing.T) {
+	input := makeTestData(3712)
+	stored := make([]byte, 0, 4096)
+	storedLen, err := GoGZipCompressBuffer(CompressionLevelNone, input, stored)
+	assert.NoError(t, err)
+	// stored blocks hold the data as is
+	assert.Greater(t, storedLen, uint64(len(input)))
+
+	compressed := make([]byte, 0, 4096)
+	compressedLen, err := GoGZipCompressBuffer(CompressionLevelDefault, input, compressed)
+	assert.NoError(t, err)
+	assert.Less(t, compressedLen, storedLen)
+
+	_, err = GoGZipCompressBuffer(CompressionLevel(10), input, compressed)
+	assert.ErrorIs(t, err, CompressionLevelError)
+	_, err = GoGZipCompressStream(CompressionLevel(-5), 1024, 1024, nil, nil)
+	assert.ErrorIs(t, err, CompressionLevelError)
+	_, err = NewEngine(TransformModeRawDeflate, CompressionLevel(11))
+	assert.ErrorIs(t, err, CompressionLevelError)
+}
@@ -0,0 +1,57 @@
+package gozlib
+
+import (
+	"io"
+	"net"
+)
+
+// buffersReader reads sequentially from a list of buffers without modifying it
+type buffersReader struct {
+	buffers net.Buffers
+	offset  int
+}
+
+func (br *buffersReader) Read(p []byte) (int, error) {
+	readLen := 0
+	for readLen < len(p) && len(br.buffers) > 0 {
+		copied := copy(p[readLen:], br.buffers[0][br.offset:])
+		readLen += copied
+		br.offset += copied
+
+		if br.offset == len(br.buffers[0]) {
+			br.buffers = br.buffers[1:]
+			br.offset = 0
+		}
+	}
+
+	if readLen == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+
+	return readLen, nil
+}
+
+// NewUncompressorFromBuffers creates a zlib or gzip uncompressor reading compressed data from a list of buffers,
+// such as segments received from the network, without concatenating them first.
+// The buffers are read in order and neither the list nor the buffers are modified, so they must not change until
+// the uncompressor is done with them.
+func NewUncompressorFromBuffers(buffers net.Buffers, bufferSize uint32) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewUncompressorFromBuffers", &err)
+
+	goUncomp, err := newGoUncompressor(nil, TransformModeUncompress, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	goUncomp.buffersInput = buffersReader{buffers: buffers}
+	goUncomp.input = &goUncomp.buffersInput
+	return goUncomp, nil
+}
+
+// ResetUncompressorBuffers is like ResetUncompressor, making the uncompressor read from buffers
+// It works with any uncompressor from NewGoZLibUncompressor or NewUncompressorFromBuffers and doesn't allocate.
+func ResetUncompressorBuffers(buffers net.Buffers, uncompressor io.ReadCloser) {
+	goUncomp := uncompressor.(*goUncompressor)
+	goUncomp.buffersInput = buffersReader{buffers: buffers}
+	ResetUncompressor(&goUncomp.buffersInput, uncompressor)
+}
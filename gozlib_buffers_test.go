@@ -0,0 +1,65 @@
+package gozlib
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// splitBuffers splits data in segments of increasing sizes, including empty ones
+func splitBuffers(data []byte) net.Buffers {
+	buffers := net.Buffers{}
+	for size := 0; len(data) > 0; size += 37 {
+		if size > len(data) {
+			size = len(data)
+		}
+		buffers = append(buffers, data[:size])
+		data = data[size:]
+	}
+	return buffers
+}
+
+func TestUncompressorFromBuffers(t *testing.T) {
+	first := makeTestData(20000)
+	second := makeTestData(700)
+	firstCompressed, err := stdLibGZipCompressSlice(first)
+	require.NoError(t, err)
+	secondCompressed, err := stdLibGZipCompressSlice(second)
+	require.NoError(t, err)
+
+	buffers := splitBuffers(firstCompressed)
+	segments := len(buffers)
+	uncompressor, err := NewUncompressorFromBuffers(buffers, 512)
+	require.NoError(t, err)
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, first, uncompressed)
+	assert.Len(t, buffers, segments)
+
+	ResetUncompressorBuffers(splitBuffers(secondCompressed), uncompressor)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, second, uncompressed)
+
+	assert.NoError(t, uncompressor.Close())
+}
+
+func TestBuffersReader(t *testing.T) {
+	reader := &buffersReader{buffers: net.Buffers{[]byte("ab"), nil, []byte("cde")}}
+
+	output := make([]byte, 4)
+	read, err := reader.Read(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcd", string(output[:read]))
+
+	read, err = reader.Read(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "e", string(output[:read]))
+
+	_, err = reader.Read(output)
+	assert.ErrorIs(t, err, io.EOF)
+}
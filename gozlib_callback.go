@@ -0,0 +1,141 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// Callback transformers
+// Event driven frameworks push data as it arrives and handle results in callbacks. Callback transformers accept
+// input with Write and deliver their output to a ChunkHandler, with failures reported as errors in both directions.
+
+// ChunkHandler receives a chunk of output from a callback transformer
+// The chunk is only valid during the call and must be copied to be kept. Returning an error stops the transformer,
+// which reports it from the Write or Close call that produced the chunk.
+type ChunkHandler func(chunk []byte) error
+
+// callbackWriter adapts a ChunkHandler to io.Writer
+type callbackWriter ChunkHandler
+
+func (cw callbackWriter) Write(data []byte) (int, error) {
+	err := cw(data)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// NewCallbackCompressor creates a gzip compressor delivering compressed data to onChunk
+// Close must be called to end the stream and release the native resources.
+func NewCallbackCompressor(onChunk ChunkHandler, level CompressionLevel, bufferSize uint32) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewCallbackCompressor", &err)
+
+	return NewGoGZipCompressor(callbackWriter(onChunk), level, bufferSize)
+}
+
+// callbackUncompressor inflates data pushed with Write into a native work buffer handed to onChunk
+type callbackUncompressor struct {
+	stream  *nativeStream
+	onChunk ChunkHandler
+	work    []byte
+	workPtr unsafe.Pointer
+	ended   bool
+	err     error
+	closed  bool
+}
+
+// NewCallbackUncompressor creates a zlib or gzip uncompressor whose compressed input is written to it and whose
+// uncompressed data is delivered to onChunk, in chunks of up to bufferSize bytes. bufferSize must be between 1 byte
+// and 4MB, BufferSizeError is returned otherwise.
+// Data written after the end of the compressed stream is ignored. Close returns io.ErrUnexpectedEOF if the stream
+// is incomplete and must be called to release the native resources.
+func NewCallbackUncompressor(onChunk ChunkHandler, bufferSize uint32) (uncompressor io.WriteCloser, err error) {
+	defer recoverPanic("NewCallbackUncompressor", &err)
+
+	if bufferSize == 0 {
+		return nil, fmt.Errorf("%w: buffer size must be greater than zero", BufferSizeError)
+	}
+
+	workPtr, err := allocNativeBuffer(uint64(bufferSize))
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := newInflateStream(C.MAX_WBITS + 32)
+	if err != nil {
+		C.pool_free(workPtr)
+		return nil, err
+	}
+
+	return &callbackUncompressor{
+		stream:  stream,
+		onChunk: onChunk,
+		work:    nativeSlice(workPtr, int(bufferSize), int(bufferSize)),
+		workPtr: workPtr,
+	}, nil
+}
+
+// Write uncompresses data, calling onChunk for the uncompressed data produced
+func (cu *callbackUncompressor) Write(data []byte) (n int, err error) {
+	defer recoverPanic("callback uncompressor Write", &err)
+
+	if cu.err != nil {
+		return 0, cu.err
+	}
+
+	written := 0
+	for !cu.ended {
+		consumed, produced, resultCode := cu.stream.step(data[written:], cu.work, C.Z_NO_FLUSH)
+		written += consumed
+
+		if produced > 0 {
+			herr := cu.onChunk(cu.work[:produced])
+			if herr != nil {
+				cu.err = herr
+				return written, herr
+			}
+		}
+
+		if resultCode == C.Z_STREAM_END {
+			cu.ended = true
+			break
+		}
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+			cu.err = fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, resultCode)
+			return written, cu.err
+		}
+
+		// all input consumed and zlib had room left, so there's nothing more to produce
+		if written == len(data) && produced < len(cu.work) {
+			break
+		}
+	}
+
+	return len(data), nil
+}
+
+// Close releases the native resources, returning io.ErrUnexpectedEOF if the compressed stream didn't end
+func (cu *callbackUncompressor) Close() (err error) {
+	defer recoverPanic("callback uncompressor Close", &err)
+
+	if cu.closed {
+		return nil
+	}
+	cu.closed = true
+
+	cu.stream.close()
+	C.pool_free(cu.workPtr)
+
+	if cu.err == nil && !cu.ended {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
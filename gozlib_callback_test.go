@@ -0,0 +1,108 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbackCompressorAndUncompressor(t *testing.T) {
+	data := makeTestData(100000)
+
+	compressed := bytes.NewBuffer(nil)
+	compressor, err := NewCallbackCompressor(func(chunk []byte) error {
+		_, werr := compressed.Write(chunk)
+		return werr
+	}, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	uncompressed := bytes.NewBuffer(nil)
+	chunks := 0
+	uncompressor, err := NewCallbackUncompressor(func(chunk []byte) error {
+		chunks++
+		assert.LessOrEqual(t, len(chunk), 4096)
+		_, werr := uncompressed.Write(chunk)
+		return werr
+	}, 4096)
+	require.NoError(t, err)
+
+	// push the compressed data in small pieces, followed by trailing data which is ignored
+	input := append(compressed.Bytes(), "trailing"...)
+	for len(input) > 0 {
+		piece := input
+		if len(piece) > 333 {
+			piece = piece[:333]
+		}
+		written, werr := uncompressor.Write(piece)
+		assert.NoError(t, werr)
+		assert.Equal(t, len(piece), written)
+		input = input[len(piece):]
+	}
+	assert.NoError(t, uncompressor.Close())
+	assert.NoError(t, uncompressor.Close())
+
+	assert.Equal(t, data, uncompressed.Bytes())
+	assert.GreaterOrEqual(t, chunks, len(data)/4096)
+}
+
+func TestCallbackHandlerErrors(t *testing.T) {
+	handlerErr := errors.New("handler failed")
+	failing := func(chunk []byte) error { return handlerErr }
+
+	compressor, err := NewCallbackCompressor(failing, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	// enough data to fill the work buffer
+	_, err = compressor.Write(makeTestData(100000))
+	assert.ErrorIs(t, err, handlerErr)
+	compressor.Close()
+
+	compressed, err := stdLibGZipCompressSlice(makeTestData(1000))
+	require.NoError(t, err)
+	uncompressor, err := NewCallbackUncompressor(failing, 1024)
+	require.NoError(t, err)
+	_, err = uncompressor.Write(compressed)
+	assert.ErrorIs(t, err, handlerErr)
+	_, err = uncompressor.Write(compressed)
+	assert.ErrorIs(t, err, handlerErr)
+	assert.NoError(t, uncompressor.Close())
+}
+
+func TestCallbackUncompressorInvalidAndTruncatedInput(t *testing.T) {
+	discard := func(chunk []byte) error { return nil }
+
+	uncompressor, err := NewCallbackUncompressor(discard, 1024)
+	require.NoError(t, err)
+	_, err = uncompressor.Write([]byte("not compressed at all"))
+	assert.ErrorIs(t, err, TransformerUncompressionError)
+	assert.NoError(t, uncompressor.Close())
+
+	compressed, err := stdLibGZipCompressSlice(makeTestData(1000))
+	require.NoError(t, err)
+	uncompressor, err = NewCallbackUncompressor(discard, 1024)
+	require.NoError(t, err)
+	_, err = uncompressor.Write(compressed[:len(compressed)/2])
+	assert.NoError(t, err)
+	assert.ErrorIs(t, uncompressor.Close(), io.ErrUnexpectedEOF)
+}
+
+func TestCallbackUncompressorBufferSize(t *testing.T) {
+	discard := func(chunk []byte) error { return nil }
+
+	for _, bufferSize := range []uint32{0, nativePoolMaxSize + 1} {
+		uncompressor, err := NewCallbackUncompressor(discard, bufferSize)
+		assert.ErrorIs(t, err, BufferSizeError, "buffer size %d", bufferSize)
+		assert.Nil(t, uncompressor)
+	}
+
+	uncompressor, err := NewCallbackUncompressor(discard, nativePoolMaxSize)
+	require.NoError(t, err)
+	// nothing was written, so the stream is incomplete
+	assert.ErrorIs(t, uncompressor.Close(), io.ErrUnexpectedEOF)
+}
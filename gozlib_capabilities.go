@@ -0,0 +1,118 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import "runtime"
+
+// CapabilityReport describes the zlib library gozlib is running with and how gozlib was built
+type CapabilityReport struct {
+	// ZLibVersion is the version of the zlib library loaded at runtime
+	ZLibVersion string
+	// ZLibHeaderVersion is the version of the zlib headers gozlib was compiled with
+	ZLibHeaderVersion string
+	// CompileFlags is the raw value of zlibCompileFlags
+	CompileFlags uint64
+	// UIntSize, ULongSize, PointerSize and OffsetSize are the sizes in bytes of zlib's uInt, uLong, voidpf and z_off_t,
+	// zero when zlib reports a size other than 2, 4 or 8
+	UIntSize    int
+	ULongSize   int
+	PointerSize int
+	OffsetSize  int
+	// Debug is set when zlib was built with ZLIB_DEBUG
+	Debug bool
+	// Assembly is set when zlib was built with assembly code (ASMV or ASMINF)
+	Assembly bool
+	// BuildFixed is set when zlib builds its fixed inflate tables at runtime (BUILDFIXED)
+	BuildFixed bool
+	// DynamicCRCTable is set when zlib builds its CRC tables at runtime (DYNAMIC_CRC_TABLE)
+	DynamicCRCTable bool
+	// NoGZCompress is set when zlib was built without gzip file writing support (NO_GZCOMPRESS)
+	NoGZCompress bool
+	// NoGZip is set when zlib deflate and inflate were built without gzip support (NO_GZIP)
+	NoGZip bool
+	// PKZipBugWorkaround is set when zlib inflate accepts streams from buggy PKZip versions
+	PKZipBugWorkaround bool
+	// Fastest is set when zlib was built with FASTEST, only supporting the fastest compression
+	Fastest bool
+	// Backend is the compression library new Engines run on. Compressors and uncompressors run on zlib unless
+	// TransformerOptions.Backend selects another backend
+	Backend string
+	// BackendBenchmarks are the results of SelectFastestBackend, nil if it wasn't called
+	BackendBenchmarks []BackendBenchmark
+	// Vendored is set when the backend is compiled into gozlib instead of linked from the system
+	Vendored bool
+	// GoVersion is the Go runtime version
+	GoVersion string
+	// Platform is the operating system and architecture, as GOOS/GOARCH
+	Platform string
+}
+
+// zlibCompileFlags bits, see zlib.h
+const (
+	compileFlagDebug           = 1 << 8
+	compileFlagAssembly        = 1 << 9
+	compileFlagBuildFixed      = 1 << 12
+	compileFlagDynamicCRCTable = 1 << 13
+	compileFlagNoGZCompress    = 1 << 16
+	compileFlagNoGZip          = 1 << 17
+	compileFlagPKZipBug        = 1 << 20
+	compileFlagFastest         = 1 << 21
+)
+
+// compileFlagSize decodes the 2 bits size field of zlibCompileFlags starting at bit shift
+func compileFlagSize(flags uint64, shift uint) int {
+	switch (flags >> shift) & 3 {
+	case 0:
+		return 2
+	case 1:
+		return 4
+	case 2:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Capabilities returns the zlib library and build options gozlib is running with
+// This is meant for diagnostics, for example logging it at startup, to know what a deployment is actually running.
+func Capabilities() CapabilityReport {
+	flags := uint64(C.zlibCompileFlags())
+
+	var benchmarks []BackendBenchmark
+	selection := selectedBackend.Load()
+	if selection != nil {
+		benchmarks = selection.benchmarks
+	}
+
+	report := CapabilityReport{
+		ZLibVersion:       C.GoString(C.zlibVersion()),
+		ZLibHeaderVersion: C.ZLIB_VERSION,
+		Backend:           defaultBackend().name,
+		BackendBenchmarks: benchmarks,
+		Vendored:          false,
+		GoVersion:         runtime.Version(),
+		Platform:          runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	report.setCompileFlags(flags)
+
+	return report
+}
+
+// setCompileFlags decodes the zlibCompileFlags value flags into the report
+func (report *CapabilityReport) setCompileFlags(flags uint64) {
+	report.CompileFlags = flags
+	report.UIntSize = compileFlagSize(flags, 0)
+	report.ULongSize = compileFlagSize(flags, 2)
+	report.PointerSize = compileFlagSize(flags, 4)
+	report.OffsetSize = compileFlagSize(flags, 6)
+	report.Debug = flags&compileFlagDebug != 0
+	report.Assembly = flags&compileFlagAssembly != 0
+	report.BuildFixed = flags&compileFlagBuildFixed != 0
+	report.DynamicCRCTable = flags&compileFlagDynamicCRCTable != 0
+	report.NoGZCompress = flags&compileFlagNoGZCompress != 0
+	report.NoGZip = flags&compileFlagNoGZip != 0
+	report.PKZipBugWorkaround = flags&compileFlagPKZipBug != 0
+	report.Fastest = flags&compileFlagFastest != 0
+}
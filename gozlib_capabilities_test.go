@@ -0,0 +1,66 @@
+package gozlib
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilitiesReportRunningZLib(t *testing.T) {
+	report := Capabilities()
+
+	assert.NotEmpty(t, report.ZLibVersion)
+	// the loaded library must be compatible with the headers gozlib was built with
+	assert.Equal(t, report.ZLibHeaderVersion[:1], report.ZLibVersion[:1])
+	assert.Equal(t, 4, report.UIntSize)
+	assert.Equal(t, int(unsafe.Sizeof(uintptr(0))), report.PointerSize)
+	assert.False(t, report.Fastest)
+	assert.Equal(t, "zlib", report.Backend)
+	assert.NotEmpty(t, report.GoVersion)
+	assert.Contains(t, report.Platform, "/")
+}
+
+func TestCompileFlagSize(t *testing.T) {
+	flags := uint64(0b11_10_01_00)
+	assert.Equal(t, 2, compileFlagSize(flags, 0))
+	assert.Equal(t, 4, compileFlagSize(flags, 2))
+	assert.Equal(t, 8, compileFlagSize(flags, 4))
+	assert.Equal(t, 0, compileFlagSize(flags, 6))
+}
+
+func TestCompileFlagsDecodedBitByBit(t *testing.T) {
+	// sizes uInt=4, uLong=8, voidpf=8, z_off_t=8 with every feature bit set
+	flags := uint64(0b10_10_10_01 | 1<<8 | 1<<9 | 1<<12 | 1<<13 | 1<<16 | 1<<17 | 1<<20 | 1<<21)
+	var report CapabilityReport
+	report.setCompileFlags(flags)
+
+	assert.Equal(t, flags, report.CompileFlags)
+	assert.Equal(t, 4, report.UIntSize)
+	assert.Equal(t, 8, report.ULongSize)
+	assert.Equal(t, 8, report.PointerSize)
+	assert.Equal(t, 8, report.OffsetSize)
+
+	bits := []struct {
+		bit   uint
+		field func(CapabilityReport) bool
+	}{
+		{8, func(r CapabilityReport) bool { return r.Debug }},
+		{9, func(r CapabilityReport) bool { return r.Assembly }},
+		{12, func(r CapabilityReport) bool { return r.BuildFixed }},
+		{13, func(r CapabilityReport) bool { return r.DynamicCRCTable }},
+		{16, func(r CapabilityReport) bool { return r.NoGZCompress }},
+		{17, func(r CapabilityReport) bool { return r.NoGZip }},
+		{20, func(r CapabilityReport) bool { return r.PKZipBugWorkaround }},
+		{21, func(r CapabilityReport) bool { return r.Fastest }},
+	}
+	for _, b := range bits {
+		assert.True(t, b.field(report), "bit %d", b.bit)
+
+		var single CapabilityReport
+		single.setCompileFlags(1 << b.bit)
+		for _, other := range bits {
+			assert.Equal(t, other.bit == b.bit, other.field(single), "bit %d decoded from %d", other.bit, b.bit)
+		}
+	}
+}
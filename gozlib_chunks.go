@@ -0,0 +1,182 @@
+package gozlib
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Chunked compression
+// Columnar and row group based file formats compress each chunk independently, so chunks can be located with an index
+// and read on their own. ChunkCompressor compresses a batch of such chunks in parallel, recording what a reader needs
+// to validate each one.
+
+var (
+	ChunkCompressorOptionsError = errors.New("invalid chunk compressor options")
+	ChunkChecksumError          = errors.New("checksum of the uncompressed chunk doesn't match the recorded checksum")
+)
+
+// CompressedChunk is a chunk compressed as a complete stream
+type CompressedChunk struct {
+	Data []byte
+	// UncompressedSize is the size of the original chunk
+	UncompressedSize int
+	// Checksum is the CRC-32 (IEEE) of the original chunk
+	Checksum uint32
+}
+
+// ChunkCompressor compresses independent chunks in parallel. It is safe for concurrent use.
+type ChunkCompressor struct {
+	mode        TransformMode
+	level       CompressionLevel
+	concurrency int
+	backend     Backend
+}
+
+// NewChunkCompressor creates a chunk compressor producing chunks in the format given by mode, which can be
+// TransformModeGZip, TransformModeZLib or TransformModeRawDeflate, using up to concurrency goroutines
+func NewChunkCompressor(mode TransformMode, level CompressionLevel, concurrency int) (compressor *ChunkCompressor, err error) {
+	defer recoverPanic("NewChunkCompressor", &err)
+
+	if mode != TransformModeGZip && mode != TransformModeZLib && mode != TransformModeRawDeflate {
+		return nil, fmt.Errorf("%w: transform mode %v not supported", ChunkCompressorOptionsError, mode)
+	}
+	if concurrency <= 0 {
+		return nil, fmt.Errorf("%w: concurrency must be greater than zero", ChunkCompressorOptionsError)
+	}
+
+	return &ChunkCompressor{mode: mode, level: level, concurrency: concurrency}, nil
+}
+
+// SetBackend makes the chunk compressor run on the given backend instead of the default one
+// It must not be called concurrently with CompressChunks. BackendError is returned if the backend is unknown.
+func (cc *ChunkCompressor) SetBackend(backend Backend) (err error) {
+	defer recoverPanic("ChunkCompressor.SetBackend", &err)
+
+	_, err = backend.provider()
+	if err != nil {
+		return err
+	}
+
+	cc.backend = backend
+	return nil
+}
+
+// CompressChunks compresses each chunk as a complete stream, returning the compressed chunks in the same order
+func (cc *ChunkCompressor) CompressChunks(chunks [][]byte) (compressed []CompressedChunk, err error) {
+	defer recoverPanic("ChunkCompressor.CompressChunks", &err)
+
+	compressed = make([]CompressedChunk, len(chunks))
+	errs := make([]error, len(chunks))
+
+	workers := cc.concurrency
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	next := make(chan int, len(chunks))
+	for pos := range chunks {
+		next <- pos
+	}
+	close(next)
+
+	var wait sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			cc.compressWorker(chunks, compressed, errs, next)
+		}()
+	}
+	wait.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return compressed, nil
+}
+
+// compressWorker compresses the chunks at the positions received from next, reusing a single engine
+func (cc *ChunkCompressor) compressWorker(chunks [][]byte, compressed []CompressedChunk, errs []error, next <-chan int) {
+	engine, err := NewEngine(cc.mode, cc.level)
+	if err == nil {
+		err = engine.SetBackend(cc.backend)
+	}
+	if err != nil {
+		for pos := range next {
+			errs[pos] = err
+		}
+		return
+	}
+	defer engine.Close()
+
+	for pos := range next {
+		compressed[pos], errs[pos] = compressChunk(engine, chunks[pos])
+	}
+}
+
+func compressChunk(engine *Engine, chunk []byte) (CompressedChunk, error) {
+	engine.ResetDeflate()
+
+	bound, err := engine.DeflateBound(len(chunk))
+	if err != nil {
+		return CompressedChunk{}, err
+	}
+
+	data := make([]byte, bound)
+	_, produced, err := engine.Deflate(chunk, data, FlushModeFinish)
+	if err != io.EOF {
+		return CompressedChunk{}, fmt.Errorf("%w: chunk stream not finished (%v)", BufferCompressError, err)
+	}
+
+	return CompressedChunk{
+		Data:             data[:produced],
+		UncompressedSize: len(chunk),
+		Checksum:         crc32.ChecksumIEEE(chunk),
+	}, nil
+}
+
+// UncompressChunk uncompresses a chunk produced by a ChunkCompressor with the same mode, appending it to dst and
+// returning the extended slice
+// ObjectSizeError is returned if the chunk doesn't uncompress to its recorded size, io.ErrUnexpectedEOF if the chunk
+// data is truncated and ChunkChecksumError if the checksum doesn't match.
+func UncompressChunk(mode TransformMode, dst []byte, chunk CompressedChunk) (result []byte, err error) {
+	defer recoverPanic("UncompressChunk", &err)
+
+	engine, err := NewEngine(mode, CompressionLevelBestSpeed)
+	if err != nil {
+		return dst, err
+	}
+	defer engine.Close()
+
+	dstLen := len(dst)
+	// one extra byte tells a chunk larger than its recorded size from one matching it
+	dst = ensureSpareCapacity(dst, chunk.UncompressedSize+1)
+	output := dst[dstLen : dstLen+chunk.UncompressedSize+1]
+
+	_, produced, err := engine.Inflate(chunk.Data, output, FlushModeFinish)
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+		if produced > chunk.UncompressedSize {
+			err = ObjectSizeError
+		}
+	}
+	if err != io.EOF {
+		return dst[:dstLen], err
+	}
+
+	if produced != chunk.UncompressedSize {
+		return dst[:dstLen], ObjectSizeError
+	}
+
+	if crc32.ChecksumIEEE(output[:produced]) != chunk.Checksum {
+		return dst[:dstLen], ChunkChecksumError
+	}
+
+	return dst[:dstLen+produced], nil
+}
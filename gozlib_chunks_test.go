@@ -0,0 +1,103 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkCompressorRoundTrip(t *testing.T) {
+	chunks := [][]byte{}
+	for size := uint32(0); size < 40000; size += 3999 {
+		chunks = append(chunks, makeTestData(size))
+	}
+
+	for _, backend := range testBackends() {
+		for _, mode := range []TransformMode{TransformModeGZip, TransformModeZLib, TransformModeRawDeflate} {
+			compressor, err := NewChunkCompressor(mode, CompressionLevelBestCompression, 3)
+			require.NoError(t, err)
+			require.NoError(t, compressor.SetBackend(backend))
+
+			compressed, err := compressor.CompressChunks(chunks)
+			require.NoError(t, err)
+			require.Len(t, compressed, len(chunks))
+
+			uncompressed := []byte{}
+			for pos, chunk := range compressed {
+				assert.Equal(t, len(chunks[pos]), chunk.UncompressedSize)
+
+				uncompressed, err = UncompressChunk(mode, uncompressed, chunk)
+				require.NoError(t, err, "backend %s, mode %v, chunk %d", backend, mode, pos)
+			}
+			assert.Equal(t, bytes.Join(chunks, nil), uncompressed)
+		}
+	}
+
+	compressor, err := NewChunkCompressor(TransformModeGZip, CompressionLevelBestSpeed, 1)
+	require.NoError(t, err)
+	assert.ErrorIs(t, compressor.SetBackend("lz4"), BackendError)
+}
+
+func TestChunkCompressorRawChunksAreCompleteStreams(t *testing.T) {
+	compressor, err := NewChunkCompressor(TransformModeRawDeflate, CompressionLevelBestSpeed, 8)
+	require.NoError(t, err)
+
+	chunk := makeTestData(10000)
+	compressed, err := compressor.CompressChunks([][]byte{chunk})
+	require.NoError(t, err)
+
+	uncompressed, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed[0].Data)))
+	assert.NoError(t, err)
+	assert.Equal(t, chunk, uncompressed)
+}
+
+func TestUncompressChunkValidation(t *testing.T) {
+	compressor, err := NewChunkCompressor(TransformModeZLib, CompressionLevelBestSpeed, 1)
+	require.NoError(t, err)
+
+	compressed, err := compressor.CompressChunks([][]byte{makeTestData(5000)})
+	require.NoError(t, err)
+	chunk := compressed[0]
+
+	wrongChecksum := chunk
+	wrongChecksum.Checksum++
+	_, err = UncompressChunk(TransformModeZLib, nil, wrongChecksum)
+	assert.ErrorIs(t, err, ChunkChecksumError)
+
+	wrongSize := chunk
+	wrongSize.UncompressedSize--
+	_, err = UncompressChunk(TransformModeZLib, nil, wrongSize)
+	assert.ErrorIs(t, err, ObjectSizeError)
+
+	wrongSize.UncompressedSize += 2
+	_, err = UncompressChunk(TransformModeZLib, nil, wrongSize)
+	assert.ErrorIs(t, err, ObjectSizeError)
+
+	truncated := chunk
+	truncated.Data = truncated.Data[:len(truncated.Data)/2]
+	_, err = UncompressChunk(TransformModeZLib, nil, truncated)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// dst is left untouched on errors
+	dst, err := UncompressChunk(TransformModeZLib, []byte("prefix"), truncated)
+	assert.Error(t, err)
+	assert.Equal(t, []byte("prefix"), dst)
+}
+
+func TestChunkCompressorOptions(t *testing.T) {
+	_, err := NewChunkCompressor(TransformModeUncompress, CompressionLevelBestSpeed, 1)
+	assert.ErrorIs(t, err, ChunkCompressorOptionsError)
+
+	_, err = NewChunkCompressor(TransformModeGZip, CompressionLevelBestSpeed, 0)
+	assert.ErrorIs(t, err, ChunkCompressorOptionsError)
+
+	compressor, err := NewChunkCompressor(TransformModeGZip, CompressionLevelBestSpeed, 4)
+	require.NoError(t, err)
+	compressed, err := compressor.CompressChunks(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, compressed)
+}
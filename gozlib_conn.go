@@ -0,0 +1,219 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Connection level compression
+// Writes are compressed in zlib format and sync flushed, so every Write is fully received by the peer without
+// waiting for more data, while the compression context is kept for the whole connection. Reads uncompress the peer's stream.
+// The compressed output of each Write is collected and sent with a single write to the underlying connection.
+// Both ends of the connection must be wrapped.
+
+var (
+	ConnCompressionError = errors.New("connection doesn't support delayed compression")
+)
+
+type compressedConn struct {
+	net.Conn
+	writeMutex   sync.Mutex
+	compressor   *goGZipCompressor
+	compressed   *bytes.Buffer
+	readMutex    sync.Mutex
+	uncompressor *goUncompressor
+	// data flows uncompressed in each direction until compression is activated
+	writeActive atomic.Bool
+	readActive  atomic.Bool
+	closed      atomic.Bool
+}
+
+// WrapConn wraps c so that data written to it is compressed with the given level and data read from it is uncompressed
+// Each Write is sync flushed, so framing of the wrapped protocol is preserved without having to redesign it.
+// Closing the returned connection ends the compressed stream, closes c and releases the transformers.
+func WrapConn(c net.Conn, level CompressionLevel) (conn net.Conn, err error) {
+	defer recoverPanic("WrapConn", &err)
+
+	return wrapConn(c, level, TransformModeZLib, TransformModeUncompress, true)
+}
+
+// WrapConnDeflate wraps c using raw deflate in both directions, as required by the IMAP COMPRESS=DEFLATE extension (RFC 4978)
+// and the equivalent SMTP and POP extensions.
+// The compression context is never reset for the lifetime of the connection and each Write is sync flushed, so every command
+// or response must be written with a single Write to reach the peer immediately.
+// Compression starts with the first byte exchanged after the command completion response. If that response was read through
+// a bufio.Reader, any data it buffered past the response is already compressed and must be served by c's Read before new data.
+func WrapConnDeflate(c net.Conn, level CompressionLevel) (conn net.Conn, err error) {
+	defer recoverPanic("WrapConnDeflate", &err)
+
+	return wrapConn(c, level, TransformModeRawDeflate, TransformModeRawUncompress, true)
+}
+
+// WrapConnDelayed wraps c like WrapConn but with compression armed and not active, in the style of the SSH zlib@openssh.com
+// method, where compression is negotiated upfront and only starts after authentication.
+// Data is read and written uncompressed until ActivateCompression and ActivateDecompression are invoked for the write and
+// read directions. The transformers are created here so activation doesn't allocate.
+func WrapConnDelayed(c net.Conn, level CompressionLevel) (conn net.Conn, err error) {
+	defer recoverPanic("WrapConnDelayed", &err)
+
+	return wrapConn(c, level, TransformModeZLib, TransformModeUncompress, false)
+}
+
+func wrapConn(c net.Conn, level CompressionLevel, compressMode TransformMode, uncompressMode TransformMode, active bool) (net.Conn, error) {
+	defaults := GetDefaults()
+	compressed := bytes.NewBuffer([]byte{})
+
+	compressor, err := newGoCompressor(compressed, compressMode, level, defaults.CompressorBufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressor, err := newGoUncompressor(c, uncompressMode, defaults.UncompressorBufferSize)
+	if err != nil {
+		compressor.Close()
+		return nil, err
+	}
+
+	cc := &compressedConn{
+		Conn:         c,
+		compressor:   compressor,
+		compressed:   compressed,
+		uncompressor: uncompressor,
+	}
+	cc.writeActive.Store(active)
+	cc.readActive.Store(active)
+
+	return cc, nil
+}
+
+// Read reads uncompressed data sent by the peer
+// Reading from a closed connection returns net.ErrClosed.
+func (cc *compressedConn) Read(output []byte) (n int, err error) {
+	defer recoverPanic("compressed conn Read", &err)
+
+	cc.readMutex.Lock()
+	defer cc.readMutex.Unlock()
+
+	// the uncompressor is released by Close
+	if cc.closed.Load() {
+		return 0, net.ErrClosed
+	}
+
+	if !cc.readActive.Load() {
+		return cc.Conn.Read(output)
+	}
+
+	return cc.uncompressor.Read(output)
+}
+
+// Write compresses data and sync flushes it to the peer. It returns the number of uncompressed bytes written.
+// Writing to a closed connection returns net.ErrClosed.
+func (cc *compressedConn) Write(data []byte) (n int, err error) {
+	defer recoverPanic("compressed conn Write", &err)
+
+	cc.writeMutex.Lock()
+	defer cc.writeMutex.Unlock()
+
+	// the compressor is released by Close
+	if cc.closed.Load() {
+		return 0, net.ErrClosed
+	}
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	if !cc.writeActive.Load() {
+		return cc.Conn.Write(data)
+	}
+
+	written, err := cc.compressor.Write(data)
+	if err != nil {
+		return written, err
+	}
+
+	ferr := cc.compressor.SyncFlush()
+	if ferr != nil {
+		return written, ferr
+	}
+
+	return written, cc.sendCompressed()
+}
+
+func (cc *compressedConn) sendCompressed() error {
+	_, err := cc.Conn.Write(cc.compressed.Bytes())
+	cc.compressed.Reset()
+	return err
+}
+
+// Close ends the compressed stream, closes the underlying connection and releases the transformers
+// A Write in progress, for example blocked on a peer that isn't reading, is unblocked by closing the underlying connection
+// first, in which case the compressed stream isn't ended. Closing an already closed connection returns net.ErrClosed.
+func (cc *compressedConn) Close() (err error) {
+	defer recoverPanic("compressed conn Close", &err)
+
+	if cc.closed.Swap(true) {
+		return net.ErrClosed
+	}
+
+	var ferr, cerr error
+	if cc.writeMutex.TryLock() {
+		ferr = cc.compressor.Close()
+		if ferr == nil && cc.writeActive.Load() {
+			ferr = cc.sendCompressed()
+		}
+		cc.writeMutex.Unlock()
+
+		cerr = cc.Conn.Close()
+	} else {
+		cerr = cc.Conn.Close()
+
+		cc.writeMutex.Lock()
+		cc.compressor.Close()
+		cc.writeMutex.Unlock()
+	}
+
+	cc.readMutex.Lock()
+	cc.uncompressor.Close()
+	cc.readMutex.Unlock()
+
+	if cerr != nil {
+		return cerr
+	}
+	return ferr
+}
+
+// ActivateCompression starts compressing data written to a connection created by WrapConnDelayed
+// Data written by any later Write is compressed. Activating an already active connection has no effect.
+func ActivateCompression(conn net.Conn) (err error) {
+	defer recoverPanic("ActivateCompression", &err)
+
+	cc, isCompressedConn := conn.(*compressedConn)
+	if !isCompressedConn {
+		return ConnCompressionError
+	}
+
+	cc.writeMutex.Lock()
+	cc.writeActive.Store(true)
+	cc.writeMutex.Unlock()
+
+	return nil
+}
+
+// ActivateDecompression starts uncompressing data read from a connection created by WrapConnDelayed
+// It must be invoked from the reading goroutine, after reading the last uncompressed message and before reading the first compressed one.
+// Activating an already active connection has no effect.
+func ActivateDecompression(conn net.Conn) (err error) {
+	defer recoverPanic("ActivateDecompression", &err)
+
+	cc, isCompressedConn := conn.(*compressedConn)
+	if !isCompressedConn {
+		return ConnCompressionError
+	}
+
+	cc.readActive.Store(true)
+	return nil
+}
@@ -0,0 +1,215 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapConnRoundTrip(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+
+	client, err := WrapConn(clientSide, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	server, err := WrapConn(serverSide, CompressionLevelBestCompression)
+	assert.NoError(t, err)
+
+	requests := [][]byte{[]byte("PING"), makeTestData(50000), []byte("x")}
+
+	go func() {
+		// echo each request back without waiting for the stream to end, which only works if writes are flushed
+		for _, request := range requests {
+			received := make([]byte, len(request))
+			_, rerr := io.ReadFull(server, received)
+			if rerr != nil {
+				server.Close()
+				return
+			}
+			_, werr := server.Write(received)
+			if werr != nil {
+				server.Close()
+				return
+			}
+		}
+		server.Close()
+	}()
+
+	for _, request := range requests {
+		written, err := client.Write(request)
+		assert.NoError(t, err)
+		assert.Equal(t, len(request), written)
+
+		response := make([]byte, len(request))
+		_, err = io.ReadFull(client, response)
+		assert.NoError(t, err)
+		assert.Equal(t, request, response)
+	}
+
+	// the server ends its stream when closing
+	_, err = client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	client.Close()
+}
+
+func TestWrapConnDeflateInteroperability(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+
+	client, err := WrapConnDeflate(clientSide, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	command := []byte("a001 SELECT INBOX\r\n")
+	response := []byte("* 172 EXISTS\r\na001 OK [READ-WRITE] SELECT completed\r\n")
+
+	go func() {
+		defer serverSide.Close()
+		// the server side uses the standard library raw deflate implementation
+		received := make([]byte, len(command))
+		_, rerr := io.ReadFull(flate.NewReader(serverSide), received)
+		if rerr != nil || !bytes.Equal(command, received) {
+			return
+		}
+
+		compressed := bytes.NewBuffer([]byte{})
+		writer, _ := flate.NewWriter(compressed, flate.BestSpeed)
+		_, werr := writer.Write(response)
+		if werr == nil && writer.Flush() == nil {
+			serverSide.Write(compressed.Bytes())
+		}
+	}()
+
+	_, err = client.Write(command)
+	assert.NoError(t, err)
+
+	received := make([]byte, len(response))
+	_, err = io.ReadFull(client, received)
+	assert.NoError(t, err)
+	assert.Equal(t, response, received)
+}
+
+func TestWrapConnDelayed(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+
+	client, err := WrapConnDelayed(clientSide, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	server, err := WrapConnDelayed(serverSide, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+
+	auth := []byte("AUTH plain")
+	payload := makeTestData(10000)
+
+	go func() {
+		defer server.Close()
+
+		received := make([]byte, len(auth))
+		_, rerr := io.ReadFull(serverSide, received)
+		if rerr != nil || !bytes.Equal(auth, received) {
+			return
+		}
+
+		// authentication completed, both sides switch to compressed data
+		ActivateCompression(server)
+		ActivateDecompression(server)
+
+		received = make([]byte, len(payload))
+		_, rerr = io.ReadFull(server, received)
+		if rerr != nil {
+			return
+		}
+		server.Write(received)
+	}()
+
+	// before activation data is sent as is
+	_, err = client.Write(auth)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ActivateCompression(client))
+	assert.NoError(t, ActivateDecompression(client))
+
+	_, err = client.Write(payload)
+	assert.NoError(t, err)
+
+	received := make([]byte, len(payload))
+	_, err = io.ReadFull(client, received)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, received)
+
+	_, err = client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	client.Close()
+
+	assert.ErrorIs(t, ActivateCompression(clientSide), ConnCompressionError)
+}
+
+func TestWrapConnDoubleClose(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	client, err := WrapConn(clientSide, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+
+	// drain the end of the compressed stream sent when closing
+	go io.Copy(io.Discard, serverSide)
+
+	assert.NoError(t, client.Close())
+	assert.ErrorIs(t, client.Close(), net.ErrClosed)
+}
+
+func TestWrapConnReadWriteAfterClose(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	client, err := WrapConn(clientSide, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+
+	go io.Copy(io.Discard, serverSide)
+
+	assert.NoError(t, client.Close())
+
+	written, err := client.Write([]byte("after close"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+	assert.Equal(t, 0, written)
+
+	read, err := client.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, net.ErrClosed)
+	assert.Equal(t, 0, read)
+}
+
+func TestWrapConnCloseUnblocksWrite(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	client, err := WrapConn(clientSide, CompressionLevelBestSpeed)
+	require.NoError(t, err)
+
+	// the peer never reads, so the write blocks
+	writeDone := make(chan error)
+	go func() {
+		_, werr := client.Write([]byte("never read"))
+		writeDone <- werr
+	}()
+
+	cc := client.(*compressedConn)
+	for cc.writeMutex.TryLock() {
+		cc.writeMutex.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	closeDone := make(chan error)
+	go func() {
+		closeDone <- client.Close()
+	}()
+
+	select {
+	case <-closeDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by a pending Write")
+	}
+	assert.ErrorIs(t, <-writeDone, io.ErrClosedPipe)
+}
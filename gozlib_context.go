@@ -0,0 +1,133 @@
+package gozlib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Request scoped transformers
+// A compression context carries transformers acquired from a pool through a context.Context, so that handlers and
+// middleware deep in the call stack of a request reuse the same native state without passing writers around.
+// Transformers are acquired on first use and returned to the pool once the owner of the context releases it.
+
+var (
+	CompressionContextMissingError  = errors.New("context doesn't carry a compression context")
+	CompressionContextReleasedError = errors.New("compression context was already released")
+)
+
+type compressionContextKey struct{}
+
+type compressionContext struct {
+	pool         *TransformerPool
+	mutex        sync.Mutex
+	compressors  map[CompressionLevel]io.WriteCloser
+	uncompressor io.ReadCloser
+	released     bool
+}
+
+// WithCompressionContext returns a context carrying transformers acquired from pool on demand and a function returning
+// them to the pool, which must be called once the request is done, usually deferred by the handler creating the context.
+// A nil pool uses the pool of the package level convenience functions.
+func WithCompressionContext(ctx context.Context, pool *TransformerPool) (context.Context, func()) {
+	if pool == nil {
+		pool = defaultTransformerPool()
+	}
+
+	cc := &compressionContext{
+		pool:         pool,
+		compressors:  map[CompressionLevel]io.WriteCloser{},
+		uncompressor: nil,
+		released:     false,
+	}
+
+	return context.WithValue(ctx, compressionContextKey{}, cc), cc.release
+}
+
+func compressionContextFrom(ctx context.Context) (*compressionContext, error) {
+	cc, hasContext := ctx.Value(compressionContextKey{}).(*compressionContext)
+	if !hasContext {
+		return nil, CompressionContextMissingError
+	}
+
+	return cc, nil
+}
+
+// CompressorFromContext returns the gzip compressor with the given level carried by ctx, reset to write to output
+// Every call for the same level returns the same compressor, so only one layer can use it at a time. Data written
+// and not flushed before the next call is discarded. The compressor must not be closed by the caller.
+func CompressorFromContext(ctx context.Context, output io.Writer, level CompressionLevel) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("CompressorFromContext", &err)
+
+	cc, err := compressionContextFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if cc.released {
+		return nil, CompressionContextReleasedError
+	}
+
+	compressor, acquired := cc.compressors[level]
+	if acquired {
+		ResetCompressor(output, compressor)
+		return compressor, nil
+	}
+
+	compressor, err = cc.pool.AcquireCompressor(output, level)
+	if err != nil {
+		return nil, err
+	}
+	cc.compressors[level] = compressor
+
+	return compressor, nil
+}
+
+// UncompressorFromContext returns the uncompressor carried by ctx, reset to read from input
+// Every call returns the same uncompressor, so only one layer can use it at a time. The uncompressor must not be
+// closed by the caller.
+func UncompressorFromContext(ctx context.Context, input io.Reader) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("UncompressorFromContext", &err)
+
+	cc, err := compressionContextFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if cc.released {
+		return nil, CompressionContextReleasedError
+	}
+
+	if cc.uncompressor != nil {
+		ResetUncompressor(input, cc.uncompressor)
+		return cc.uncompressor, nil
+	}
+
+	cc.uncompressor, err = cc.pool.AcquireUncompressor(input)
+	return cc.uncompressor, err
+}
+
+// release returns the transformers acquired through the context to the pool, it can be called more than once
+func (cc *compressionContext) release() {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if cc.released {
+		return
+	}
+	cc.released = true
+
+	for _, compressor := range cc.compressors {
+		cc.pool.ReleaseCompressor(compressor)
+	}
+	cc.compressors = nil
+
+	if cc.uncompressor != nil {
+		cc.pool.ReleaseUncompressor(cc.uncompressor)
+		cc.uncompressor = nil
+	}
+}
@@ -0,0 +1,68 @@
+package gozlib
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressInNestedHandler(ctx context.Context, data []byte) ([]byte, io.WriteCloser, error) {
+	output := &bytes.Buffer{}
+	compressor, err := CompressorFromContext(ctx, output, CompressionLevelBestSpeed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = compressor.Write(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = Finish(compressor)
+	return output.Bytes(), compressor, err
+}
+
+func TestCompressionContextReusesTransformers(t *testing.T) {
+	pool := NewTransformerPool(1024, 4)
+	defer pool.Close()
+
+	ctx, release := WithCompressionContext(context.Background(), pool)
+	defer release()
+
+	data := makeTestData(5000)
+	first, firstCompressor, err := compressInNestedHandler(ctx, data)
+	require.NoError(t, err)
+	second, secondCompressor, err := compressInNestedHandler(ctx, data)
+	require.NoError(t, err)
+	assert.Same(t, firstCompressor, secondCompressor)
+	assert.Equal(t, first, second)
+
+	for range [2]int{} {
+		uncompressor, uerr := UncompressorFromContext(ctx, bytes.NewReader(first))
+		require.NoError(t, uerr)
+		uncompressed, rerr := io.ReadAll(uncompressor)
+		assert.NoError(t, rerr)
+		assert.Equal(t, data, uncompressed)
+	}
+
+	// releasing returns the transformers to the pool
+	release()
+	release()
+	assert.Equal(t, 2, pool.idleCount())
+
+	_, err = CompressorFromContext(ctx, io.Discard, CompressionLevelBestSpeed)
+	assert.ErrorIs(t, err, CompressionContextReleasedError)
+	_, err = UncompressorFromContext(ctx, bytes.NewReader(nil))
+	assert.ErrorIs(t, err, CompressionContextReleasedError)
+}
+
+func TestCompressionContextMissing(t *testing.T) {
+	_, err := CompressorFromContext(context.Background(), io.Discard, CompressionLevelBestSpeed)
+	assert.ErrorIs(t, err, CompressionContextMissingError)
+	_, err = UncompressorFromContext(context.Background(), bytes.NewReader(nil))
+	assert.ErrorIs(t, err, CompressionContextMissingError)
+}
@@ -0,0 +1,51 @@
+package gozlib
+
+import (
+	"io"
+)
+
+// CopyResult reports the data moved by Copy
+type CopyResult struct {
+	// Uncompressed is the number of bytes read from src and written to dst
+	Uncompressed int64
+	// CompressedIn is the number of compressed bytes consumed from its input when src is an uncompressor
+	CompressedIn int64
+	// CompressedOut is the number of compressed bytes produced when dst is a compressor. Data still held by the
+	// compressor is only produced once it's flushed.
+	CompressedOut int64
+}
+
+// Copy copies from src to dst until the end of src is reached, like io.Copy, using a pooled native buffer unless src
+// or dst can copy without one, through io.WriterTo or io.ReaderFrom. When src is an uncompressor or dst is a compressor,
+// reads and writes are large enough to bypass their internal small buffers and the compressed sizes are reported too.
+// The stream of a compressor dst isn't ended, Finish must be called once all data was copied.
+func Copy(dst io.Writer, src io.Reader) (result CopyResult, err error) {
+	defer recoverPanic("Copy", &err)
+
+	uncompressor, fromUncompressor := src.(*goUncompressor)
+	wrapped, toCompressor := dst.(wrappedCompressor)
+	var compressor *goGZipCompressor
+	if toCompressor {
+		compressor = wrapped.unwrapCompressor()
+	}
+
+	var totalIn, totalOut uint64
+	if fromUncompressor {
+		totalIn = uint64(uncompressor.transformer.zs.total_in)
+	}
+	if toCompressor {
+		totalOut = uint64(compressor.transformer.zs.total_out)
+	}
+
+	copied, err := copyWithNativeBuffer(dst, src)
+	result.Uncompressed = copied
+
+	if fromUncompressor {
+		result.CompressedIn = int64(uint64(uncompressor.transformer.zs.total_in) - totalIn)
+	}
+	if toCompressor {
+		result.CompressedOut = int64(uint64(compressor.transformer.zs.total_out) - totalOut)
+	}
+
+	return result, err
+}
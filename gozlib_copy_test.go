@@ -0,0 +1,73 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyCompressAndUncompress(t *testing.T) {
+	data := makeTestData(100000)
+
+	compressed := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(compressed, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	result, err := Copy(compressor, bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), result.Uncompressed)
+	assert.Zero(t, result.CompressedIn)
+	assert.Equal(t, int64(compressed.Len()), result.CompressedOut)
+
+	compressedLen, err := Finish(compressor)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(compressed.Len()), compressedLen)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed.Bytes()), 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed := &bytes.Buffer{}
+	result, err = Copy(uncompressed, uncompressor)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), result.Uncompressed)
+	assert.Equal(t, int64(compressedLen), result.CompressedIn)
+	assert.Zero(t, result.CompressedOut)
+	assert.Equal(t, data, uncompressed.Bytes())
+}
+
+func TestCopyTranscode(t *testing.T) {
+	data := makeTestData(50000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed), 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	recompressed := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(recompressed, CompressionLevelBestCompression, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	result, err := Copy(compressor, uncompressor)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), result.Uncompressed)
+	assert.Equal(t, int64(len(compressed)), result.CompressedIn)
+	assert.Positive(t, result.CompressedOut)
+
+	require.NoError(t, Flush(compressor))
+	uncompressed, err := stdLibGZipUncompress(recompressed, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	// plain readers and writers are copied as io.Copy does
+	plain := &bytes.Buffer{}
+	result, err = Copy(plain, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, CopyResult{Uncompressed: int64(len(data))}, result)
+	assert.Equal(t, data, plain.Bytes())
+}
@@ -0,0 +1,160 @@
+package gozlib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Defaults holds the package wide settings used by the convenience constructors and functions
+// (NewCompressor, NewUncompressor, Compress and Decompress), so that limits can be enforced in a single place
+// instead of at every call site.
+type Defaults struct {
+	// CompressionLevel is the level used by NewCompressor and CompressSections
+	CompressionLevel CompressionLevel
+	// CompressorBufferSize is the work buffer size of compressors created with default settings
+	CompressorBufferSize uint32
+	// UncompressorBufferSize is the work buffer size of uncompressors created with default settings
+	UncompressorBufferSize uint32
+	// MaxDecompressedSize is the maximum number of bytes Decompress and uncompressors created by NewUncompressor
+	// produce before failing with DecompressedSizeLimitError. Zero means no limit.
+	MaxDecompressedSize int64
+}
+
+var (
+	DefaultsAlreadySetError    = errors.New("defaults can only be set once, before they are used")
+	InvalidDefaultsError       = errors.New("invalid defaults")
+	DecompressedSizeLimitError = errors.New("decompressed data exceeds the maximum decompressed size")
+)
+
+var builtinDefaults = Defaults{
+	CompressionLevel:       CompressionLevelBestSpeed,
+	CompressorBufferSize:   defaultPoolBufferSize,
+	UncompressorBufferSize: defaultPoolBufferSize,
+	MaxDecompressedSize:    0,
+}
+
+var (
+	defaultsOnce   sync.Once
+	activeDefaults atomic.Pointer[Defaults]
+	// updateMutex serializes UpdateDefaults calls
+	updateMutex sync.Mutex
+)
+
+// SetDefaults replaces the package defaults. It's meant to be called once, during program initialization.
+// Setting the defaults more than once, or after they were used by any of the convenience functions, returns DefaultsAlreadySetError.
+func SetDefaults(defaults Defaults) (err error) {
+	defer recoverPanic("SetDefaults", &err)
+
+	err = validateDefaults(defaults)
+	if err != nil {
+		return err
+	}
+
+	set := false
+	defaultsOnce.Do(func() {
+		activeDefaults.Store(&defaults)
+		set = true
+	})
+
+	if !set {
+		return DefaultsAlreadySetError
+	}
+
+	return nil
+}
+
+// UpdateDefaults atomically replaces the package defaults at any time, for instance to change the compression level
+// in response to load
+// Operations already running keep the settings they started with. If the buffer sizes change, the pool shared by
+// Compress and Decompress is replaced and transformers of the previous pool are closed as they are released.
+func UpdateDefaults(defaults Defaults) (err error) {
+	defer recoverPanic("UpdateDefaults", &err)
+
+	err = validateDefaults(defaults)
+	if err != nil {
+		return err
+	}
+
+	updateMutex.Lock()
+	defer updateMutex.Unlock()
+
+	GetDefaults()
+	activeDefaults.Store(&defaults)
+
+	pool := defaultTransformerPool()
+	if pool.compressorBufferSize != defaults.CompressorBufferSize || pool.uncompressorBufferSize != defaults.UncompressorBufferSize {
+		defaultPool.Store(newTransformerPool(defaults.CompressorBufferSize, defaults.UncompressorBufferSize, runtime.GOMAXPROCS(0)*2))
+		pool.retire()
+	}
+
+	return nil
+}
+
+func validateDefaults(defaults Defaults) error {
+	if defaults.CompressionLevel.validate() != nil {
+		return fmt.Errorf("%w: compression level %d not supported", InvalidDefaultsError, defaults.CompressionLevel)
+	}
+
+	if defaults.CompressorBufferSize == 0 || defaults.UncompressorBufferSize == 0 {
+		return fmt.Errorf("%w: buffer sizes must be greater than zero", InvalidDefaultsError)
+	}
+
+	if defaults.MaxDecompressedSize < 0 {
+		return fmt.Errorf("%w: negative maximum decompressed size", InvalidDefaultsError)
+	}
+
+	return nil
+}
+
+// GetDefaults returns the package defaults in use. Once called, the defaults can only be changed with UpdateDefaults.
+func GetDefaults() Defaults {
+	defaultsOnce.Do(func() {
+		defaults := builtinDefaults
+		activeDefaults.Store(&defaults)
+	})
+
+	return *activeDefaults.Load()
+}
+
+// NewCompressor creates a new gzip compressor writing to output using the package defaults
+func NewCompressor(output io.Writer) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewCompressor", &err)
+
+	defaults := GetDefaults()
+	return NewGoGZipCompressor(output, defaults.CompressionLevel, defaults.CompressorBufferSize)
+}
+
+// NewUncompressor creates a new zlib or gzip uncompressor reading from input using the package defaults
+// If a maximum decompressed size is set, reads and skips past it fail with DecompressedSizeLimitError. The limit applies
+// again to the data read after ResetUncompressor.
+func NewUncompressor(input io.Reader) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewUncompressor", &err)
+
+	defaults := GetDefaults()
+	goUncomp, err := newGoUncompressor(input, TransformModeUncompress, defaults.UncompressorBufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	goUncomp.maxOutput = defaults.MaxDecompressedSize
+	return goUncomp, nil
+}
+
+var (
+	defaultPoolOnce sync.Once
+	defaultPool     atomic.Pointer[TransformerPool]
+)
+
+// defaultTransformerPool returns the pool shared by Compress and Decompress, created with the package defaults on first use
+func defaultTransformerPool() *TransformerPool {
+	defaultPoolOnce.Do(func() {
+		defaults := GetDefaults()
+		defaultPool.Store(newTransformerPool(defaults.CompressorBufferSize, defaults.UncompressorBufferSize, runtime.GOMAXPROCS(0)*2))
+	})
+
+	return defaultPool.Load()
+}
@@ -0,0 +1,182 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefaultsValidation(t *testing.T) {
+	valid := Defaults{
+		CompressionLevel:       CompressionLevelBestCompression,
+		CompressorBufferSize:   1024,
+		UncompressorBufferSize: 1024,
+		MaxDecompressedSize:    0,
+	}
+
+	invalidLevel := valid
+	invalidLevel.CompressionLevel = 42
+	assert.ErrorIs(t, SetDefaults(invalidLevel), InvalidDefaultsError)
+
+	invalidBufferSize := valid
+	invalidBufferSize.UncompressorBufferSize = 0
+	assert.ErrorIs(t, SetDefaults(invalidBufferSize), InvalidDefaultsError)
+
+	invalidMaxSize := valid
+	invalidMaxSize.MaxDecompressedSize = -1
+	assert.ErrorIs(t, SetDefaults(invalidMaxSize), InvalidDefaultsError)
+}
+
+func TestSetDefaultsAfterUse(t *testing.T) {
+	defaults := GetDefaults()
+	assert.ErrorIs(t, SetDefaults(defaults), DefaultsAlreadySetError)
+	assert.Equal(t, defaults, GetDefaults())
+}
+
+func TestDefaultCompressorUncompressor(t *testing.T) {
+	data := makeTestData(10000)
+	compressed := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewCompressor(compressed)
+	assert.NoError(t, err)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	uncompressor, err := NewUncompressor(compressed)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestDecompressWithDefaultMaxDecompressedSize(t *testing.T) {
+	original := GetDefaults()
+	t.Cleanup(func() { assert.NoError(t, UpdateDefaults(original)) })
+
+	data := makeTestData(5000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	decompressors := map[string]func(io.Writer, io.Reader) (int64, error){
+		"pooled":   decompressPooled,
+		"fallback": fallbackDecompress,
+	}
+	for name, decompress := range decompressors {
+		for _, limit := range []int64{4999, 5000, 5001} {
+			limited := original
+			limited.MaxDecompressedSize = limit
+			require.NoError(t, UpdateDefaults(limited))
+
+			uncompressed := &bytes.Buffer{}
+			written, err := decompress(uncompressed, bytes.NewReader(compressed))
+			if limit < int64(len(data)) {
+				assert.ErrorIs(t, err, DecompressedSizeLimitError, name)
+				assert.Equal(t, data[:limit], uncompressed.Bytes(), name)
+			} else {
+				assert.NoError(t, err, name)
+				assert.Equal(t, data, uncompressed.Bytes(), name)
+			}
+			assert.Equal(t, int64(uncompressed.Len()), written, name)
+		}
+	}
+
+	// pooled uncompressors don't keep the limit once released
+	limited := original
+	limited.MaxDecompressedSize = 1000
+	require.NoError(t, UpdateDefaults(limited))
+	pool := defaultTransformerPool()
+	_, err = Decompress(io.Discard, bytes.NewReader(compressed))
+	assert.ErrorIs(t, err, DecompressedSizeLimitError)
+
+	uncompressor, err := pool.AcquireUncompressor(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	defer pool.ReleaseUncompressor(uncompressor)
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestUpdateDefaults(t *testing.T) {
+	original := GetDefaults()
+	t.Cleanup(func() { assert.NoError(t, UpdateDefaults(original)) })
+
+	invalid := original
+	invalid.CompressorBufferSize = 0
+	assert.ErrorIs(t, UpdateDefaults(invalid), InvalidDefaultsError)
+	assert.Equal(t, original, GetDefaults())
+
+	previousPool := defaultTransformerPool()
+	updated := original
+	updated.CompressionLevel = CompressionLevelBestCompression
+	assert.NoError(t, UpdateDefaults(updated))
+	assert.Equal(t, updated, GetDefaults())
+	assert.Same(t, previousPool, defaultTransformerPool())
+
+	updated.CompressorBufferSize = original.CompressorBufferSize * 2
+	assert.NoError(t, UpdateDefaults(updated))
+	assert.Equal(t, updated, GetDefaults())
+
+	pool := defaultTransformerPool()
+	assert.NotSame(t, previousPool, pool)
+	assert.Equal(t, updated.CompressorBufferSize, pool.compressorBufferSize)
+	assert.Equal(t, 0, previousPool.maxIdle)
+	assert.Equal(t, 0, previousPool.idleCount())
+
+	data := makeTestData(10000)
+	compressed := bytes.NewBuffer([]byte{})
+	_, err := Compress(compressed, bytes.NewReader(data), GetDefaults().CompressionLevel)
+	assert.NoError(t, err)
+	uncompressed := bytes.NewBuffer([]byte{})
+	_, err = Decompress(uncompressed, compressed)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed.Bytes())
+}
+
+func TestUncompressorWithDefaultMaxDecompressedSize(t *testing.T) {
+	original := GetDefaults()
+	t.Cleanup(func() { assert.NoError(t, UpdateDefaults(original)) })
+
+	limited := original
+	limited.MaxDecompressedSize = 3000
+	require.NoError(t, UpdateDefaults(limited))
+
+	data := makeTestData(5000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	uncompressor, err := NewUncompressor(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	// the package helpers work with the uncompressor
+	peeked, err := Peek(uncompressor, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:10], peeked)
+
+	skipped, err := Skip(uncompressor, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), skipped)
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, DecompressedSizeLimitError)
+	assert.Equal(t, data[1000:3000], uncompressed)
+
+	ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+	skipped, err = Skip(uncompressor, int64(len(data)))
+	assert.ErrorIs(t, err, DecompressedSizeLimitError)
+	assert.Equal(t, int64(3000), skipped)
+
+	// data ending exactly at the limit is read in full
+	exact, err := stdLibGZipCompressSlice(data[:3000])
+	require.NoError(t, err)
+	ResetUncompressor(bytes.NewReader(exact), uncompressor)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:3000], uncompressed)
+}
@@ -0,0 +1,51 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+)
+
+// HTTP "deflate" content encoding
+// RFC 9110 defines "deflate" as zlib wrapped data, but some clients and servers send raw deflate data instead.
+// Like browsers do, the format is detected from the first two bytes, which form a valid zlib header only for zlib data.
+
+// isZLibHeader reports if the two bytes are a zlib header using the deflate method
+func isZLibHeader(header []byte) bool {
+	return len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// sniffDeflate reads the start of input, returning a reader with the complete input and true if it's raw deflate data
+func sniffDeflate(input io.Reader) (io.Reader, bool, error) {
+	header := make([]byte, 2)
+	readLen, err := io.ReadFull(input, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+
+	header = header[:readLen]
+	return io.MultiReader(bytes.NewReader(header), input), readLen == 2 && !isZLibHeader(header), nil
+}
+
+// NewDeflateUncompressor creates an uncompressor for data with the HTTP "deflate" content encoding, accepting both
+// zlib wrapped and raw deflate data
+// The format is detected when the uncompressor is created, which reads the first two bytes of input.
+// The uncompressor must not be reset to read another input, since the format would not be detected again.
+func NewDeflateUncompressor(input io.Reader, bufferSize uint32) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewDeflateUncompressor", &err)
+
+	sniffed, raw, err := sniffDeflate(input)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := TransformModeUncompress
+	if raw {
+		mode = TransformModeRawUncompress
+	}
+
+	goUncomp, err := newGoUncompressor(sniffed, mode, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return goUncomp, nil
+}
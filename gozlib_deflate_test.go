@@ -0,0 +1,76 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stdLibDeflateCompress(t *testing.T, data []byte, raw bool) []byte {
+	compressed := bytes.NewBuffer([]byte{})
+	var writer io.WriteCloser
+	if raw {
+		flateWriter, err := flate.NewWriter(compressed, flate.BestSpeed)
+		assert.NoError(t, err)
+		writer = flateWriter
+	} else {
+		writer = zlib.NewWriter(compressed)
+	}
+
+	_, err := writer.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return compressed.Bytes()
+}
+
+func TestDeflateUncompressorZLibAndRaw(t *testing.T) {
+	data := makeTestData(20000)
+
+	for _, raw := range []bool{false, true} {
+		uncompressor, err := NewDeflateUncompressor(bytes.NewReader(stdLibDeflateCompress(t, data, raw)), 1024)
+		assert.NoError(t, err)
+
+		uncompressed, err := io.ReadAll(uncompressor)
+		assert.NoError(t, err)
+		assert.Equal(t, data, uncompressed)
+		assert.NoError(t, uncompressor.Close())
+	}
+}
+
+func TestDeflateUncompressorShortInput(t *testing.T) {
+	uncompressor, err := NewDeflateUncompressor(bytes.NewReader([]byte{0x78}), 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed, _ := io.ReadAll(uncompressor)
+	assert.Empty(t, uncompressed)
+}
+
+func TestOpenPartRawDeflate(t *testing.T) {
+	data := makeTestData(5000)
+
+	for _, raw := range []bool{false, true} {
+		body := bytes.NewBuffer([]byte{})
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreatePart(textproto.MIMEHeader{contentEncodingHeader: {"deflate"}})
+		assert.NoError(t, err)
+		_, err = part.Write(stdLibDeflateCompress(t, data, raw))
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+
+		nextPart, err := multipart.NewReader(body, writer.Boundary()).NextPart()
+		assert.NoError(t, err)
+		partReader, err := OpenPart(nextPart)
+		assert.NoError(t, err)
+		content, err := io.ReadAll(partReader)
+		assert.NoError(t, err)
+		assert.Equal(t, data, content)
+		assert.NoError(t, partReader.Close())
+	}
+}
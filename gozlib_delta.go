@@ -0,0 +1,113 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Delta compression
+// A delta is the unsigned varint length of the new content followed by the new content compressed in zlib format
+// using the base content as the preset dictionary, so that anything shared with the base is encoded as back references.
+// Only the last MaxDictionarySize bytes of the base are visible to the compressor.
+
+// the dictionary id is added to the zlib header when a preset dictionary is used
+const zlibDictionaryIdLen = 4
+
+var (
+	DeltaCompressError   = errors.New("error compressing delta")
+	DeltaUncompressError = errors.New("error uncompressing delta")
+)
+
+// CompressDelta compresses newContent using base as the reference content and returns the delta
+// The same base must be provided to DecompressDelta to recover newContent.
+func CompressDelta(base []byte, newContent []byte) (result []byte, err error) {
+	defer recoverPanic("CompressDelta", &err)
+
+	compressBound := int(C.compressBound(C.uLong(len(newContent)))) + zlibDictionaryIdLen
+	delta := make([]byte, binary.MaxVarintLen64+compressBound)
+
+	prefixLen := binary.PutUvarint(delta, uint64(len(newContent)))
+	compressed := delta[prefixLen:]
+
+	werr := nativeWork.start()
+	if werr != nil {
+		return nil, werr
+	}
+	defer nativeWork.end()
+
+	var errorCode C.int = C.Z_OK
+	compLen := C.zlib_compress_buffer_with_dictionary(C.int(CompressionLevelBestCompression), bytesPointer(base), C.uInt(len(base)),
+		bytesPointer(newContent), C.uInt(len(newContent)), unsafe.Pointer(&compressed[0]), C.uInt(len(compressed)), &errorCode)
+
+	if errorCode != C.Z_OK {
+		return nil, fmt.Errorf(wrapErrorFormat, DeltaCompressError, errorCode)
+	}
+
+	return delta[:prefixLen+int(compLen)], nil
+}
+
+// DecompressDelta recovers the content compressed by CompressDelta, given the same base used to compress it
+func DecompressDelta(base []byte, delta []byte) (result []byte, err error) {
+	defer recoverPanic("DecompressDelta", &err)
+
+	contentLen, prefixLen := binary.Uvarint(delta)
+	if prefixLen <= 0 || contentLen > MaxMessageSize {
+		return nil, fmt.Errorf("%w: invalid length prefix", DeltaUncompressError)
+	}
+
+	inflater, err := newInflateStream(C.MAX_WBITS)
+	if err != nil {
+		return nil, err
+	}
+	defer inflater.close()
+
+	compressed := delta[prefixLen:]
+	input := compressed
+	// the length prefix isn't trusted, the content grows as the delta is applied up to one byte past that length,
+	// which detects deltas uncompressing to more data than recorded
+	contentLimit := int(contentLen) + 1
+	var content []byte
+
+	for {
+		grow := 2 * len(compressed)
+		if grow < batchMinGrowSize {
+			grow = batchMinGrowSize
+		}
+		content = ensureSpareCapacity(content, grow)
+		output := content[len(content):cap(content)]
+		if left := contentLimit - len(content); len(output) > left {
+			output = output[:left]
+		}
+
+		consumed, produced, resultCode := inflater.step(input, output, C.Z_NO_FLUSH)
+		input = input[consumed:]
+		content = content[:len(content)+produced]
+
+		if len(content) == contentLimit {
+			return nil, fmt.Errorf("%w: content length mismatch", DeltaUncompressError)
+		}
+
+		switch resultCode {
+		case C.Z_OK:
+			continue
+		case C.Z_NEED_DICT:
+			dictCode := C.set_uncompression_dictionary(inflater.zs, bytesPointer(base), C.uInt(len(base)))
+			if dictCode != C.Z_OK {
+				return nil, fmt.Errorf(wrapErrorFormat, DeltaUncompressError, dictCode)
+			}
+		case C.Z_STREAM_END:
+			if uint64(len(content)) != contentLen {
+				return nil, fmt.Errorf("%w: content length mismatch", DeltaUncompressError)
+			}
+			return content, nil
+		default:
+			return nil, fmt.Errorf(wrapErrorFormat, DeltaUncompressError, resultCode)
+		}
+	}
+}
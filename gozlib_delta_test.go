@@ -0,0 +1,80 @@
+package gozlib
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressDecompressDelta(t *testing.T) {
+	const baseLen = 20000
+
+	base := makeTestData(baseLen)
+	newContent := append([]byte{}, base...)
+	copy(newContent[1000:], []byte("an update in the new version"))
+	newContent = append(newContent, []byte("appended to the new version")...)
+
+	delta, err := CompressDelta(base, newContent)
+	assert.NoError(t, err)
+	// most of the content is shared with the base
+	assert.Less(t, len(delta), baseLen/10)
+
+	decompressed, err := DecompressDelta(base, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, newContent, decompressed)
+}
+
+func TestCompressDecompressDeltaEmptyContent(t *testing.T) {
+	base := makeTestData(100)
+
+	delta, err := CompressDelta(base, nil)
+	assert.NoError(t, err)
+
+	decompressed, err := DecompressDelta(base, delta)
+	assert.NoError(t, err)
+	assert.Empty(t, decompressed)
+
+	delta, err = CompressDelta(nil, base)
+	assert.NoError(t, err)
+
+	decompressed, err = DecompressDelta(nil, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, base, decompressed)
+}
+
+func TestDecompressDeltaFailDifferentBase(t *testing.T) {
+	base := makeTestData(1000)
+	newContent := append(makeTestData(10), base...)
+
+	delta, err := CompressDelta(base, newContent)
+	assert.NoError(t, err)
+
+	_, err = DecompressDelta(makeTestData(1000), delta)
+	assert.ErrorIs(t, err, DeltaUncompressError)
+
+	_, err = DecompressDelta(base, delta[:len(delta)/2])
+	assert.ErrorIs(t, err, DeltaUncompressError)
+
+	_, err = DecompressDelta(base, nil)
+	assert.ErrorIs(t, err, DeltaUncompressError)
+}
+
+func TestDecompressDeltaLengthNotTrusted(t *testing.T) {
+	base := makeTestData(1000)
+	delta, err := CompressDelta(base, base[:100])
+	assert.NoError(t, err)
+
+	// replace the length prefix with the maximum size
+	_, prefixLen := binary.Uvarint(delta)
+	forged := append(binary.AppendUvarint(nil, MaxMessageSize), delta[prefixLen:]...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = DecompressDelta(base, forged)
+	runtime.ReadMemStats(&after)
+
+	assert.ErrorIs(t, err, DeltaUncompressError)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
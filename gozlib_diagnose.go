@@ -0,0 +1,157 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"io"
+)
+
+// Corrupted stream diagnostics
+
+const diagnoseBufferSize = 1024 * 32
+
+// zlib messages reporting problems in the gzip or zlib header
+var headerErrorMessages = map[string]bool{
+	"incorrect header check":     true,
+	"unknown compression method": true,
+	"invalid window size":        true,
+	"unknown header flags set":   true,
+	"header crc mismatch":        true,
+}
+
+// zlib messages reporting problems in the gzip or zlib trailer, once all the data was uncompressed
+var trailerErrorMessages = map[string]bool{
+	"incorrect data check":   true,
+	"incorrect length check": true,
+}
+
+// Report describes the outcome of uncompressing a possibly damaged stream
+type Report struct {
+	// Format is gzip, zlib or unknown, as detected from the first bytes of the stream
+	Format string
+	// HeaderValid is true if the stream header was parsed successfully
+	HeaderValid bool
+	// TrailerValid is true if the stream trailer was read and its checksum and length match the uncompressed data
+	TrailerValid bool
+	// Truncated is true if the input ended before the end of the compressed stream
+	Truncated bool
+	// FailureOffset is the offset of the compressed byte where the failure was detected or -1 if there was no failure.
+	// zlib detects some failures a few bytes after the damaged data.
+	FailureOffset int64
+	// ErrorCode is the zlib error code of the failure, Z_OK if there was no failure
+	ErrorCode int
+	// Message is the zlib message describing the failure
+	Message string
+	// RecoveredBytes is the number of uncompressed bytes produced before the failure
+	RecoveredBytes uint64
+	// CompressedBytes is the number of compressed bytes consumed
+	CompressedBytes uint64
+}
+
+// Valid returns true if the stream was uncompressed successfully
+func (rep *Report) Valid() bool {
+	return rep.FailureOffset < 0
+}
+
+func detectFormat(header []byte) string {
+	if len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b {
+		return "gzip"
+	}
+
+	if len(header) >= 2 && header[0]&0x0f == C.Z_DEFLATED && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+		return "zlib"
+	}
+
+	return "unknown"
+}
+
+// Diagnose uncompresses a gzip or zlib stream read from r, discarding the output, and reports where and why it failed, if it did
+// The returned error is only set if reading from r fails, problems with the compressed data are described in the report.
+func Diagnose(r io.Reader) (report *Report, err error) {
+	defer recoverPanic("Diagnose", &err)
+
+	stream, err := newInflateStream(C.MAX_WBITS + 32)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.close()
+
+	inputPtr := C.pool_alloc(diagnoseBufferSize)
+	defer C.pool_free(inputPtr)
+	outputPtr := C.pool_alloc(diagnoseBufferSize)
+	defer C.pool_free(outputPtr)
+
+	inputBuffer := nativeSlice(inputPtr, diagnoseBufferSize, diagnoseBufferSize)
+	output := nativeSlice(outputPtr, diagnoseBufferSize, diagnoseBufferSize)
+
+	report = &Report{
+		Format:        "unknown",
+		FailureOffset: -1,
+		ErrorCode:     C.Z_OK,
+	}
+
+	firstRead := true
+	for {
+		readLen, rerr := io.ReadFull(r, inputBuffer)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return report, rerr
+		}
+
+		input := inputBuffer[:readLen]
+		if firstRead {
+			report.Format = detectFormat(input)
+			firstRead = false
+		}
+
+		for {
+			consumed, produced, resultCode := stream.step(input, output, C.Z_NO_FLUSH)
+			input = input[consumed:]
+			report.CompressedBytes += uint64(consumed)
+			report.RecoveredBytes += uint64(produced)
+
+			if resultCode == C.Z_STREAM_END {
+				report.HeaderValid = true
+				report.TrailerValid = true
+				return report, nil
+			}
+
+			if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+				report.fail(stream, int(resultCode))
+				return report, nil
+			}
+
+			// all input consumed and no more output pending
+			if len(input) == 0 && produced < len(output) {
+				break
+			}
+		}
+
+		if readLen < len(inputBuffer) {
+			report.HeaderValid = report.RecoveredBytes > 0 || report.CompressedBytes > uint64(len(gzipHeader))
+			report.Truncated = true
+			report.FailureOffset = int64(report.CompressedBytes)
+			report.ErrorCode = C.Z_BUF_ERROR
+			report.Message = "unexpected end of stream"
+			return report, nil
+		}
+	}
+}
+
+func (rep *Report) fail(stream *nativeStream, errorCode int) {
+	rep.ErrorCode = errorCode
+	rep.FailureOffset = int64(rep.CompressedBytes)
+	rep.Message = streamMessage(stream)
+
+	if errorCode == C.Z_NEED_DICT {
+		rep.Message = "preset dictionary required"
+	}
+
+	rep.HeaderValid = !headerErrorMessages[rep.Message]
+	// the trailer is only reached once all the data was uncompressed
+	rep.TrailerValid = false
+	if trailerErrorMessages[rep.Message] {
+		rep.HeaderValid = true
+	}
+}
@@ -0,0 +1,64 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnoseValidStream(t *testing.T) {
+	data := makeTestData(100000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	report, err := Diagnose(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	assert.True(t, report.Valid())
+	assert.Equal(t, "gzip", report.Format)
+	assert.True(t, report.HeaderValid)
+	assert.True(t, report.TrailerValid)
+	assert.Equal(t, uint64(len(data)), report.RecoveredBytes)
+	assert.Equal(t, uint64(len(compressed)), report.CompressedBytes)
+}
+
+func TestDiagnoseDamagedStreams(t *testing.T) {
+	data := makeTestData(100000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	badHeader := append([]byte{}, compressed...)
+	badHeader[2] = 7
+	report, err := Diagnose(bytes.NewReader(badHeader))
+	assert.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.False(t, report.HeaderValid)
+	assert.Equal(t, "unknown compression method", report.Message)
+
+	badChecksum := append([]byte{}, compressed...)
+	badChecksum[len(badChecksum)-6] ^= 0xff
+	report, err = Diagnose(bytes.NewReader(badChecksum))
+	assert.NoError(t, err)
+	assert.True(t, report.HeaderValid)
+	assert.False(t, report.TrailerValid)
+	assert.Equal(t, "incorrect data check", report.Message)
+	assert.Equal(t, uint64(len(data)), report.RecoveredBytes)
+
+	report, err = Diagnose(bytes.NewReader(compressed[:len(compressed)/2]))
+	assert.NoError(t, err)
+	assert.True(t, report.Truncated)
+	assert.True(t, report.HeaderValid)
+	assert.Equal(t, int64(len(compressed)/2), report.FailureOffset)
+	assert.Greater(t, report.RecoveredBytes, uint64(0))
+
+	corrupted := append([]byte{}, compressed...)
+	for pos := 1000; pos < 1100; pos++ {
+		corrupted[pos] = 0xff
+	}
+	report, err = Diagnose(bytes.NewReader(corrupted))
+	assert.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.Less(t, report.ErrorCode, 0)
+	assert.GreaterOrEqual(t, report.FailureOffset, int64(1000))
+	assert.NotEmpty(t, report.Message)
+}
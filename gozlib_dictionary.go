@@ -0,0 +1,218 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// MaxDictionarySize is the largest dictionary supported by zlib, the size of its sliding window
+const MaxDictionarySize = 1 << 15
+
+// substrings shorter than dictionaryGramLen are not worth adding to a dictionary built from samples
+const dictionaryGramLen = 8
+
+var (
+	DictionaryError = errors.New("error retrieving dictionary")
+)
+
+type dictionaryGetter func(zs C.z_streamp, dictionary unsafe.Pointer, dictionaryLen *C.uInt) C.int
+
+func appendDictionary(zs C.z_streamp, getDictionary dictionaryGetter, dst []byte) ([]byte, error) {
+	dstLen := len(dst)
+	if cap(dst)-dstLen < MaxDictionarySize {
+		grown := make([]byte, dstLen, dstLen+MaxDictionarySize)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	window := dst[dstLen : dstLen+MaxDictionarySize]
+	var windowLen C.uInt
+	resultCode := getDictionary(zs, unsafe.Pointer(&window[0]), &windowLen)
+	if resultCode != C.Z_OK {
+		return dst, fmt.Errorf(wrapErrorFormat, DictionaryError, resultCode)
+	}
+
+	return dst[:dstLen+int(windowLen)], nil
+}
+
+func getCompressionDictionary(zs C.z_streamp, dictionary unsafe.Pointer, dictionaryLen *C.uInt) C.int {
+	return C.get_compression_dictionary(zs, dictionary, dictionaryLen)
+}
+
+func getUncompressionDictionary(zs C.z_streamp, dictionary unsafe.Pointer, dictionaryLen *C.uInt) C.int {
+	return C.get_uncompression_dictionary(zs, dictionary, dictionaryLen)
+}
+
+// Dictionary appends the current compression sliding window, up to MaxDictionarySize bytes of the most recently written data, to dst
+// The window can be used as a preset dictionary for future zlib or raw deflate streams carrying related data.
+func (comp *goGZipCompressor) Dictionary(dst []byte) (dictionary []byte, err error) {
+	defer recoverPanic("Dictionary", &err)
+
+	// data still buffered is not part of the window yet
+	perr := comp.compressPending()
+	if perr != nil {
+		return dst, perr
+	}
+
+	return appendDictionary(comp.transformer.zs, getCompressionDictionary, dst)
+}
+
+// Dictionary appends the current uncompression sliding window, up to MaxDictionarySize bytes of the most recently uncompressed data, to dst
+// The window includes data held in the read ahead buffer that wasn't read yet. Once the end of the stream is reached,
+// zlib no longer updates the window, so data uncompressed in the last step might be missing from it.
+func (unc *goUncompressor) Dictionary(dst []byte) (dictionary []byte, err error) {
+	defer recoverPanic("Dictionary", &err)
+
+	return appendDictionary(unc.transformer.zs, getUncompressionDictionary, dst)
+}
+
+// DictionaryResolver returns the preset dictionary of a zlib stream given the dictionary id in the stream header,
+// which is the Adler-32 checksum of the dictionary
+type DictionaryResolver func(id uint32) ([]byte, error)
+
+// SetDictionaryResolver is a helper function to set the resolver called when a zlib stream needs a preset dictionary,
+// signaled by the FDICT bit of its header. Without a resolver these streams fail to uncompress.
+// The resolver is kept when the uncompressor is reset.
+func SetDictionaryResolver(uncompressor io.ReadCloser, resolver DictionaryResolver) {
+	uncompressor.(*goUncompressor).dictionaryResolver = resolver
+}
+
+// setPresetDictionary resolves and sets the dictionary after an uncompression step returned Z_NEED_DICT
+func (unc *goUncompressor) setPresetDictionary() error {
+	if unc.dictionaryResolver == nil {
+		return fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, C.Z_DATA_ERROR)
+	}
+
+	id := uint32(unc.transformer.zs.adler)
+	dictionary, err := unc.dictionaryResolver(id)
+	if err != nil {
+		return fmt.Errorf("resolving dictionary %08x: %w", id, err)
+	}
+
+	resultCode := C.set_uncompression_dictionary(unc.transformer.zs, bytesPointer(dictionary), C.uInt(len(dictionary)))
+	if resultCode != C.Z_OK {
+		return fmt.Errorf(wrapErrorFormat, DictionaryError, resultCode)
+	}
+
+	// the rest of the input is uncompressed with the dictionary
+	unc.hasMoreData = unc.transformer.zs.avail_in > 0
+	return nil
+}
+
+// Dictionary is a helper function to retrieve the sliding window of a compressor or an uncompressor given an interface
+// The window is appended to dst and the extended slice is returned
+func Dictionary(transformer io.Closer, dst []byte) (dictionary []byte, err error) {
+	defer recoverPanic("Dictionary", &err)
+
+	switch goTransformer := transformer.(type) {
+	case *goGZipCompressor:
+		return goTransformer.Dictionary(dst)
+	case *goUncompressor:
+		return goTransformer.Dictionary(dst)
+	default:
+		return dst, fmt.Errorf("%w: unsupported transformer type %T", DictionaryError, transformer)
+	}
+}
+
+type dictionaryCandidate struct {
+	content string
+	score   int
+}
+
+// BuildDictionary builds a preset dictionary of at most maxSize bytes from a corpus of sample payloads
+// The dictionary contains the substrings shared by the largest number of samples, weighted by their length, with the most valuable
+// substrings placed at the end of the dictionary where they are cheaper to reference.
+// Only substrings present in at least two samples are considered, so a useful dictionary needs a representative set of samples.
+// maxSize is capped at MaxDictionarySize and nil is returned if no common substrings are found.
+func BuildDictionary(samples [][]byte, maxSize int) []byte {
+	if maxSize > MaxDictionarySize {
+		maxSize = MaxDictionarySize
+	}
+
+	if maxSize <= 0 {
+		return nil
+	}
+
+	// count how many samples contain each gram
+	gramSampleCount := map[string]int{}
+	for _, sample := range samples {
+		seen := map[string]bool{}
+		for pos := 0; pos+dictionaryGramLen <= len(sample); pos++ {
+			gram := string(sample[pos : pos+dictionaryGramLen])
+			if !seen[gram] {
+				seen[gram] = true
+				gramSampleCount[gram]++
+			}
+		}
+	}
+
+	// merge overlapping common grams into the longest common segments
+	segmentCount := map[string]int{}
+	for _, sample := range samples {
+		segmentStart := -1
+		for pos := 0; pos+dictionaryGramLen <= len(sample)+1; pos++ {
+			isCommon := pos+dictionaryGramLen <= len(sample) && gramSampleCount[string(sample[pos:pos+dictionaryGramLen])] > 1
+
+			if isCommon && segmentStart < 0 {
+				segmentStart = pos
+			}
+
+			if !isCommon && segmentStart >= 0 {
+				segmentCount[string(sample[segmentStart:pos-1+dictionaryGramLen])]++
+				segmentStart = -1
+			}
+		}
+	}
+
+	candidates := make([]dictionaryCandidate, 0, len(segmentCount))
+	for segment, count := range segmentCount {
+		candidates = append(candidates, dictionaryCandidate{content: segment, score: count * len(segment)})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score == candidates[j].score {
+			return candidates[i].content < candidates[j].content
+		}
+		return candidates[i].score > candidates[j].score
+	})
+
+	chosen := []string{}
+	chosenLen := 0
+	for _, candidate := range candidates {
+		if chosenLen+len(candidate.content) > maxSize {
+			continue
+		}
+
+		isDuplicate := false
+		for _, existing := range chosen {
+			if strings.Contains(existing, candidate.content) {
+				isDuplicate = true
+				break
+			}
+		}
+
+		if !isDuplicate {
+			chosen = append(chosen, candidate.content)
+			chosenLen += len(candidate.content)
+		}
+	}
+
+	if chosenLen == 0 {
+		return nil
+	}
+
+	dictionary := make([]byte, 0, chosenLen)
+	for pos := len(chosen) - 1; pos >= 0; pos-- {
+		dictionary = append(dictionary, chosen[pos]...)
+	}
+
+	return dictionary
+}
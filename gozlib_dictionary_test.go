@@ -0,0 +1,156 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressorDictionary(t *testing.T) {
+	const originalLen = 50000
+
+	compressor, err := NewGoGZipCompressor(bytes.NewBuffer([]byte{}), CompressionLevelBestCompression, 1024)
+	assert.NoError(t, err)
+	defer compressor.Close()
+
+	original := makeTestData(originalLen)
+	_, err = compressor.Write(original[:100])
+	assert.NoError(t, err)
+
+	// buffered writes are part of the dictionary
+	dictionary, err := Dictionary(compressor, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, original[:100], dictionary)
+
+	_, err = compressor.Write(original[100:])
+	assert.NoError(t, err)
+
+	prefix := []byte{1, 2, 3}
+	dictionary, err = Dictionary(compressor, prefix)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxDictionarySize+len(prefix), len(dictionary))
+	assert.Equal(t, prefix, dictionary[:len(prefix)])
+	assert.Equal(t, original[originalLen-MaxDictionarySize:], dictionary[len(prefix):])
+}
+
+func TestUncompressorDictionary(t *testing.T) {
+	const originalLen = 3000
+
+	original := makeTestData(originalLen)
+	compressed, compErr := stdLibGZipCompress(original)
+	assert.NoError(t, compErr)
+
+	uncompressor, err := NewGoZLibUncompressor(compressed, 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed := make([]byte, 1500)
+	readLen, err := uncompressor.Read(uncompressed)
+	assert.NoError(t, err)
+
+	dictionary, err := Dictionary(uncompressor, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, original[:readLen], dictionary)
+}
+
+func TestBuildDictionary(t *testing.T) {
+	samples := [][]byte{}
+	for i := 0; i < 20; i++ {
+		sample := fmt.Sprintf(`{"customer_identifier":%d,"shipping_address":"%d Main Street","status":"delivered"}`, i*7919, i)
+		samples = append(samples, []byte(sample))
+	}
+
+	const maxSize = 200
+	dictionary := BuildDictionary(samples, maxSize)
+
+	assert.NotEmpty(t, dictionary)
+	assert.LessOrEqual(t, len(dictionary), maxSize)
+	assert.Contains(t, string(dictionary), `{"customer_identifier":`)
+	assert.Contains(t, string(dictionary), `,"status":"delivered"}`)
+}
+
+func TestBuildDictionaryNoCommonContent(t *testing.T) {
+	samples := [][]byte{[]byte("abcdefghijklmnop"), []byte("qrstuvwxyz012345")}
+
+	assert.Nil(t, BuildDictionary(samples, 100))
+	assert.Nil(t, BuildDictionary(samples, 0))
+	assert.Nil(t, BuildDictionary(nil, 100))
+}
+
+func zlibCompressWithDictionary(t *testing.T, data []byte, dictionary []byte) []byte {
+	compressed := &bytes.Buffer{}
+	writer, err := zlib.NewWriterLevelDict(compressed, zlib.BestCompression, dictionary)
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return compressed.Bytes()
+}
+
+func TestUncompressorDictionaryResolver(t *testing.T) {
+	dictionary := makeTestData(2000)
+	data := append(append([]byte{}, dictionary[1000:]...), makeTestData(30000)...)
+	compressed := zlibCompressWithDictionary(t, data, dictionary)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed), 512)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	resolvedIds := []uint32{}
+	SetDictionaryResolver(uncompressor, func(id uint32) ([]byte, error) {
+		resolvedIds = append(resolvedIds, id)
+		return dictionary, nil
+	})
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+	assert.Equal(t, []uint32{adler32.Checksum(dictionary)}, resolvedIds)
+
+	// the resolver is kept after a reset, also when skipping data
+	ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+	skipped, err := Skip(uncompressor, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), skipped)
+
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data[1000:], uncompressed)
+	assert.Len(t, resolvedIds, 2)
+}
+
+func TestUncompressorDictionaryResolverErrors(t *testing.T) {
+	dictionary := makeTestData(1000)
+	compressed := zlibCompressWithDictionary(t, makeTestData(5000), dictionary)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed), 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	// without a resolver the stream can't be uncompressed
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, TransformerUncompressionError)
+
+	resolverErr := errors.New("unknown dictionary")
+	SetDictionaryResolver(uncompressor, func(id uint32) ([]byte, error) {
+		return nil, resolverErr
+	})
+	ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, resolverErr)
+
+	SetDictionaryResolver(uncompressor, func(id uint32) ([]byte, error) {
+		return dictionary[1:], nil
+	})
+	ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, DictionaryError)
+}
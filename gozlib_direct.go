@@ -0,0 +1,57 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"io"
+)
+
+// Direct output
+// Compressors normally deflate into their native work buffer and hand it to the output writer, which copies it.
+// Writers that expose their spare capacity, like bytes.Buffer with Grow and AvailableBuffer, receive the compressed
+// data directly in that capacity instead, avoiding the copy out of native memory.
+
+// availableBufferWriter is implemented by writers whose spare capacity can be written to directly
+// After Grow(n), AvailableBuffer must return an empty slice with at least n bytes of capacity, and writing a prefix
+// of that capacity with Write must commit it. bytes.Buffer implements it from Go 1.21.
+type availableBufferWriter interface {
+	io.Writer
+	Grow(n int)
+	AvailableBuffer() []byte
+}
+
+// deflateDirect compresses data into the spare capacity of output, behaving like compress_to_outstream
+func (comp *goGZipCompressor) deflateDirect(output availableBufferWriter, data []byte, flush C.int) C.int {
+	chunkSize := int(comp.transformer.work_buffer_cap)
+
+	for {
+		output.Grow(chunkSize)
+		spare := output.AvailableBuffer()
+		spare = spare[:cap(spare)]
+
+		var consumed, produced C.uInt
+		defCode := C.deflate_step(comp.transformer.zs, bytesPointer(data), C.uInt(len(data)), bytesPointer(spare), C.uInt(len(spare)), flush, &consumed, &produced)
+		if defCode == C.Z_STREAM_ERROR {
+			return defCode
+		}
+		data = data[consumed:]
+
+		if produced > 0 {
+			written, werr := output.Write(spare[:produced])
+			if werr == nil && written < int(produced) {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				comp.twh.eventHandlers.setErr(werr)
+				return C.GOZLIB_STREAM_OUTPUT_WRITE_ERROR
+			}
+		}
+
+		// there's room in the buffer but it's not time to flush it yet
+		if int(produced) < len(spare) {
+			return defCode
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spareCapacityWriter exposes the spare capacity of a byte slice, counting how many times it was used
+type spareCapacityWriter struct {
+	data   []byte
+	grows  int
+	failOn int
+}
+
+func (scw *spareCapacityWriter) Grow(n int) {
+	scw.grows++
+	if cap(scw.data)-len(scw.data) < n {
+		grown := make([]byte, len(scw.data), len(scw.data)+n)
+		copy(grown, scw.data)
+		scw.data = grown
+	}
+}
+
+func (scw *spareCapacityWriter) AvailableBuffer() []byte {
+	return scw.data[len(scw.data):]
+}
+
+func (scw *spareCapacityWriter) Write(p []byte) (int, error) {
+	if scw.failOn > 0 && scw.grows >= scw.failOn {
+		return 0, errors.New("write failed")
+	}
+	scw.data = append(scw.data, p...)
+	return len(p), nil
+}
+
+func TestCompressorWritesDirectlyToSpareCapacity(t *testing.T) {
+	data := makeTestData(200000)
+	output := &spareCapacityWriter{}
+
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 4096)
+	require.NoError(t, err)
+
+	_, err = compressor.Write(data[:100000])
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.(*goGZipCompressor).SyncFlush())
+	_, err = compressor.Write(data[100000:])
+	assert.NoError(t, err)
+	compressedLen, err := Finish(compressor)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	assert.Positive(t, output.grows)
+	assert.Equal(t, uint64(len(output.data)), compressedLen)
+
+	uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(output.data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestCompressorDirectWriteError(t *testing.T) {
+	output := &spareCapacityWriter{failOn: 1}
+
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	_, err = compressor.Write(makeTestData(100000))
+	assert.EqualError(t, err, "write failed")
+	assert.EqualError(t, LastCallbackError(compressor), "write failed")
+}
@@ -0,0 +1,20 @@
+package gozlib
+
+import "io"
+
+// EmptyWriteMode controls what compressors do when Write is called without data, which io.Copy and similar helpers
+// can do when an intermediate read returns no data
+type EmptyWriteMode int
+
+const (
+	// EmptyWriteIgnore makes writes without data a no-op. This is the default
+	EmptyWriteIgnore EmptyWriteMode = iota
+	// EmptyWriteFlush makes writes without data flush the compressor like Flush does, ending the compressed stream
+	EmptyWriteFlush
+)
+
+// SetEmptyWriteMode is a helper function to set what a compressor does when Write is called without data
+// The mode is kept when the compressor is reset.
+func SetEmptyWriteMode(compressor io.WriteCloser, mode EmptyWriteMode) {
+	goCompressorOf(compressor).emptyWriteMode = mode
+}
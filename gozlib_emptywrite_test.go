@@ -0,0 +1,116 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressorEmptyWriteIgnored(t *testing.T) {
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	data := makeTestData(10000)
+	_, err = compressor.Write(data[:5000])
+	require.NoError(t, err)
+
+	written, err := compressor.Write(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, written)
+	written, err = compressor.Write([]byte{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, written)
+
+	// the stream continues after the empty writes
+	_, err = compressor.Write(data[5000:])
+	require.NoError(t, err)
+	require.NoError(t, Flush(compressor))
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestCompressorEmptyWriteFlush(t *testing.T) {
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	SetEmptyWriteMode(compressor, EmptyWriteFlush)
+	ResetCompressor(output, compressor)
+
+	data := makeTestData(3000)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	_, err = compressor.Write(nil)
+	require.NoError(t, err)
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestCompressorSyncFlush(t *testing.T) {
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	data := makeTestData(3000)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, SyncFlush(compressor))
+
+	// the data written so far can be uncompressed before the stream ends
+	uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(output.Bytes()), int64(len(data)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, data, uncompressed)
+
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, Flush(compressor))
+
+	uncompressed, err = stdLibGZipUncompress(output, int64(2*len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, data...), data...), uncompressed)
+}
+
+func TestCompressorInterfaceFullFlush(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	compressor, isCompressor := writer.(Compressor)
+	require.True(t, isCompressor)
+
+	head := makeTestData(3000)
+	tail := makeTestData(5000)
+	_, err = compressor.Write(head)
+	require.NoError(t, err)
+	require.NoError(t, compressor.FullFlush())
+	flushPoint := output.Len()
+
+	_, err = compressor.Write(tail)
+	require.NoError(t, err)
+	compressedLen, err := compressor.Finish()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(output.Len()), compressedLen)
+
+	// the history was reset at the flush point, so the deflate data after it can be uncompressed on its own
+	reader := flate.NewReader(bytes.NewReader(output.Bytes()[flushPoint:]))
+	uncompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, tail, uncompressed)
+
+	uncompressed, err = stdLibGZipUncompress(output, int64(len(head)+len(tail)))
+	assert.NoError(t, err)
+	assert.Equal(t, append(head, tail...), uncompressed)
+}
@@ -0,0 +1,319 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// nativeStream is a persistent zlib stream driven one deflate or inflate call at a time over caller owned buffers
+// It keeps no reference to the buffers between calls, so it can be reused for any number of small independent operations.
+type nativeStream struct {
+	zs        C.z_streamp
+	deflating bool
+}
+
+func newDeflateStream(level CompressionLevel, windowBits int, strategy int) (*nativeStream, error) {
+	lerr := level.validate()
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	werr := nativeWork.start()
+	if werr != nil {
+		return nil, werr
+	}
+	defer nativeWork.end()
+
+	var errorCode C.int = C.Z_OK
+	zs := C.acquire_deflate_stream(C.int(level), C.int(windowBits), C.int(strategy), &errorCode)
+
+	if errorCode != C.Z_OK {
+		C.release_deflate_stream(zs)
+		return nil, newNativeError(TransformerInitializationError, errorCode)
+	}
+
+	return &nativeStream{zs: zs, deflating: true}, nil
+}
+
+func newInflateStream(windowBits int) (*nativeStream, error) {
+	werr := nativeWork.start()
+	if werr != nil {
+		return nil, werr
+	}
+	defer nativeWork.end()
+
+	var errorCode C.int = C.Z_OK
+	zs := C.acquire_inflate_stream(C.int(windowBits), &errorCode)
+
+	if errorCode != C.Z_OK {
+		C.release_inflate_stream(zs)
+		return nil, newNativeError(TransformerInitializationError, errorCode)
+	}
+
+	return &nativeStream{zs: zs, deflating: false}, nil
+}
+
+// step runs deflate or inflate once with the given flush mode, returning the number of input bytes consumed,
+// the number of output bytes produced and the zlib result code
+func (ns *nativeStream) step(input []byte, output []byte, flush C.int) (int, int, C.int) {
+	var consumed C.uInt
+	var produced C.uInt
+	var resultCode C.int
+
+	// zlib rejects a nil output even when there's no room for output
+	var emptyOutput [1]byte
+	outputPtr := bytesPointer(output)
+	if outputPtr == nil {
+		outputPtr = unsafe.Pointer(&emptyOutput[0])
+	}
+
+	nativeWork.enter()
+	if ns.deflating {
+		resultCode = C.deflate_step(ns.zs, bytesPointer(input), C.uInt(len(input)), outputPtr, C.uInt(len(output)), flush, &consumed, &produced)
+	} else {
+		resultCode = C.inflate_step(ns.zs, bytesPointer(input), C.uInt(len(input)), outputPtr, C.uInt(len(output)), flush, &consumed, &produced)
+	}
+	nativeWork.end()
+
+	return int(consumed), int(produced), resultCode
+}
+
+// sync skips input until the next full flush point of an inflate stream, returning the number of input bytes skipped
+// and Z_OK if the flush point was found
+func (ns *nativeStream) sync(input []byte) (int, C.int) {
+	var consumed C.uInt
+	nativeWork.enter()
+	resultCode := C.inflate_sync_step(ns.zs, bytesPointer(input), C.uInt(len(input)), &consumed)
+	nativeWork.end()
+
+	return int(consumed), resultCode
+}
+
+func (ns *nativeStream) reset() {
+	if ns.deflating {
+		C.deflateReset(ns.zs)
+	} else {
+		C.inflateReset(ns.zs)
+	}
+}
+
+func (ns *nativeStream) close() {
+	if ns.deflating {
+		C.release_deflate_stream(ns.zs)
+	} else {
+		C.release_inflate_stream(ns.zs)
+	}
+}
+
+// FlushMode controls how much of the compressed data is emitted by a single Engine call
+type FlushMode int
+
+const (
+	// FlushModeNone lets zlib decide how much data to accumulate before producing output
+	FlushModeNone FlushMode = C.Z_NO_FLUSH
+	// FlushModeSync emits all pending output aligned to a byte boundary so the receiver can uncompress everything so far
+	FlushModeSync FlushMode = C.Z_SYNC_FLUSH
+	// FlushModeFull is like FlushModeSync and also resets the compression state, so uncompression can restart from this point
+	FlushModeFull FlushMode = C.Z_FULL_FLUSH
+	// FlushModeFinish completes the stream once all input is consumed
+	FlushModeFinish FlushMode = C.Z_FINISH
+)
+
+var (
+	EngineModeError = errors.New("transform mode not supported by the engine")
+)
+
+// Engine gives direct control over zlib deflate and inflate calls over caller owned buffers, for protocol implementations
+// that manage their own framing, such as HTTP/2, websockets or database wire protocols.
+// Compression and uncompression use independent streams, created on first use. An Engine is not safe for concurrent use.
+type Engine struct {
+	mode     TransformMode
+	level    CompressionLevel
+	backend  *backendProvider
+	deflater backend
+	inflater backend
+}
+
+// NewEngine creates an engine producing and consuming data in the format given by mode, which can be TransformModeZLib,
+// TransformModeGZip or TransformModeRawDeflate. When inflating zlib or gzip data, either format is accepted.
+// Close must be called to release the native resources and, on the go backend, the goroutine of the inflate stream.
+// Engines that become unreachable without being closed are closed by a finalizer, which may run much later.
+func NewEngine(mode TransformMode, level CompressionLevel) (engine *Engine, err error) {
+	defer recoverPanic("NewEngine", &err)
+
+	if mode != TransformModeZLib && mode != TransformModeGZip && mode != TransformModeRawDeflate {
+		return nil, fmt.Errorf("%w: %v", EngineModeError, mode)
+	}
+
+	lerr := level.validate()
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return newEngineWithBackend(mode, level, defaultBackend()), nil
+}
+
+// SetBackend makes the engine run on the given backend instead of the default one
+// It must be called before the engine is used, BackendError is returned once it was or if the backend is unknown.
+func (eng *Engine) SetBackend(backend Backend) (err error) {
+	defer recoverPanic("Engine.SetBackend", &err)
+
+	if eng.deflater != nil || eng.inflater != nil {
+		return fmt.Errorf("%w: engine already in use", BackendError)
+	}
+
+	provider, err := backend.provider()
+	if err != nil {
+		return err
+	}
+
+	eng.backend = provider
+	return nil
+}
+
+func newEngineWithBackend(mode TransformMode, level CompressionLevel, provider *backendProvider) *Engine {
+	engine := &Engine{
+		mode:     mode,
+		level:    level,
+		backend:  provider,
+		deflater: nil,
+		inflater: nil,
+	}
+	runtime.SetFinalizer(engine, (*Engine).Close)
+
+	return engine
+}
+
+func (eng *Engine) windowBits(inflating bool) int {
+	switch eng.mode {
+	case TransformModeGZip:
+		if inflating {
+			return C.MAX_WBITS + 32
+		}
+		return C.MAX_WBITS + 16
+	case TransformModeRawDeflate:
+		return -C.MAX_WBITS
+	default:
+		if inflating {
+			return C.MAX_WBITS + 32
+		}
+		return C.MAX_WBITS
+	}
+}
+
+// Deflate compresses data from in into out, returning the number of bytes consumed from in and produced into out
+// A single call may leave input unconsumed if out is full, in which case Deflate must be called again with the remaining input
+// and the same flush mode. Once the stream is finished with FlushModeFinish, io.EOF is returned.
+func (eng *Engine) Deflate(in []byte, out []byte, flush FlushMode) (consumed int, produced int, err error) {
+	defer recoverPanic("Engine.Deflate", &err)
+
+	err = eng.ensureDeflater()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	consumed, produced, err = eng.deflater.deflate(in, out, flush)
+	// the finalizer must not close the streams while they are in use
+	runtime.KeepAlive(eng)
+	return consumed, produced, err
+}
+
+// DeflateBound returns the maximum number of bytes Deflate can produce for n bytes of input when the stream is finished
+// with a single FlushModeFinish call, so out can be sized upfront
+func (eng *Engine) DeflateBound(n int) (bound int, err error) {
+	defer recoverPanic("Engine.DeflateBound", &err)
+
+	err = eng.ensureDeflater()
+	if err != nil {
+		return 0, err
+	}
+
+	bound = eng.deflater.bound(n)
+	runtime.KeepAlive(eng)
+	return bound, nil
+}
+
+func (eng *Engine) ensureDeflater() error {
+	if eng.deflater != nil {
+		return nil
+	}
+
+	deflater, err := eng.backend.newDeflater(eng.level, eng.windowBits(false))
+	if err != nil {
+		return err
+	}
+	eng.deflater = deflater
+	return nil
+}
+
+// Inflate uncompresses data from in into out, returning the number of bytes consumed from in and produced into out
+// If out is filled, more output may be available and Inflate must be called again with the remaining input.
+// Once the end of the compressed stream is reached, io.EOF is returned and any input past it is left unconsumed.
+func (eng *Engine) Inflate(in []byte, out []byte, flush FlushMode) (consumed int, produced int, err error) {
+	defer recoverPanic("Engine.Inflate", &err)
+
+	if eng.inflater == nil {
+		inflater, err := eng.backend.newInflater(eng.windowBits(true))
+		if err != nil {
+			return 0, 0, err
+		}
+		eng.inflater = inflater
+	}
+
+	consumed, produced, err = eng.inflater.inflate(in, out, flush)
+	runtime.KeepAlive(eng)
+	return consumed, produced, err
+}
+
+func engineResult(resultCode C.int, errorType error) error {
+	switch resultCode {
+	// a call that can't make progress isn't fatal, it only needs more input or output space
+	case C.Z_OK, C.Z_BUF_ERROR:
+		return nil
+	case C.Z_STREAM_END:
+		return io.EOF
+	default:
+		return fmt.Errorf(wrapErrorFormat, errorType, resultCode)
+	}
+}
+
+// ResetDeflate discards the compression state so that the next call to Deflate starts a new stream
+func (eng *Engine) ResetDeflate() {
+	if eng.deflater != nil {
+		eng.deflater.reset()
+	}
+	runtime.KeepAlive(eng)
+}
+
+// ResetInflate discards the uncompression state so that the next call to Inflate starts on a new stream
+func (eng *Engine) ResetInflate() {
+	if eng.inflater != nil {
+		eng.inflater.reset()
+	}
+	runtime.KeepAlive(eng)
+}
+
+// Close releases the native resources used by the engine
+func (eng *Engine) Close() (err error) {
+	defer recoverPanic("Engine.Close", &err)
+
+	if eng.deflater != nil {
+		eng.deflater.close()
+		eng.deflater = nil
+	}
+
+	if eng.inflater != nil {
+		eng.inflater.close()
+		eng.inflater = nil
+	}
+
+	runtime.SetFinalizer(eng, nil)
+	return nil
+}
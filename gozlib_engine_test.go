@@ -0,0 +1,83 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineDeflateInflateSmallBuffers(t *testing.T) {
+	engine, err := NewEngine(TransformModeGZip, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	data := makeTestData(20000)
+	out := make([]byte, 100)
+	compressed := []byte{}
+
+	// feed the input in small pieces through a small output buffer
+	for pos := 0; pos < len(data); pos += 1000 {
+		in := data[pos : pos+1000]
+		for len(in) > 0 {
+			consumed, produced, err := engine.Deflate(in, out, FlushModeNone)
+			assert.NoError(t, err)
+			compressed = append(compressed, out[:produced]...)
+			in = in[consumed:]
+		}
+	}
+
+	for {
+		_, produced, err := engine.Deflate(nil, out, FlushModeFinish)
+		compressed = append(compressed, out[:produced]...)
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+
+	stdUncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, stdUncompressed)
+
+	// trailing data after the stream is left unconsumed
+	in := append(compressed, []byte("next")...)
+	uncompressed := []byte{}
+	for {
+		consumed, produced, err := engine.Inflate(in, out, FlushModeNone)
+		uncompressed = append(uncompressed, out[:produced]...)
+		in = in[consumed:]
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, data, uncompressed)
+	assert.Equal(t, []byte("next"), in)
+}
+
+func TestEngineRawDeflateSyncFlush(t *testing.T) {
+	engine, err := NewEngine(TransformModeRawDeflate, CompressionLevelBestCompression)
+	assert.NoError(t, err)
+	defer engine.Close()
+
+	message := []byte("websocket message")
+	out := make([]byte, 1024)
+	consumed, produced, err := engine.Deflate(message, out, FlushModeSync)
+	assert.NoError(t, err)
+	assert.Equal(t, len(message), consumed)
+	// sync flushed raw deflate data ends with an empty stored block
+	assert.Equal(t, []byte{0, 0, 0xff, 0xff}, out[produced-4:produced])
+
+	uncompressed, err := io.ReadAll(flate.NewReader(io.MultiReader(bytes.NewReader(out[:produced]), bytes.NewReader([]byte{1, 0, 0, 0xff, 0xff}))))
+	assert.NoError(t, err)
+	assert.Equal(t, message, uncompressed)
+
+	_, _, err = engine.Inflate([]byte("invalid raw deflate data"), out, FlushModeSync)
+	assert.ErrorIs(t, err, TransformerUncompressionError)
+
+	_, err = NewEngine(TransformModeUncompress, CompressionLevelBestSpeed)
+	assert.ErrorIs(t, err, EngineModeError)
+}
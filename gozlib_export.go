@@ -1,16 +1,44 @@
 package gozlib
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"sync"
 	"unsafe"
 )
 import "C"
 
+var (
+	CallbackPanicError = errors.New("stream data handler panicked")
+)
+
 type DataStreamEventHandler func(data []byte) uint32
 type streamEventHandlers struct {
 	onRead  DataStreamEventHandler
 	onWrite DataStreamEventHandler
+	// err is the first error raised by a handler, reported to the caller once the native call returns
+	err error
+}
+
+// setErr records err unless an earlier error was already recorded
+func (sh *streamEventHandlers) setErr(err error) {
+	if sh.err == nil {
+		sh.err = err
+	}
+}
+
+// call invokes handler, recovering from panics so they never cross the cgo boundary
+// A panicking handler is reported as having processed no data.
+func (sh *streamEventHandlers) call(handler DataStreamEventHandler, data []byte) (processed uint32) {
+	defer func() {
+		if r := recover(); r != nil {
+			sh.setErr(fmt.Errorf("%w: %v", CallbackPanicError, r))
+			processed = 0
+		}
+	}()
+
+	return handler(data)
 }
 
 var dataStreamEventHandlersTracker = sync.Map{}
@@ -25,15 +53,11 @@ func unregisterStreamEventHandler(id unsafe.Pointer) {
 
 const uintptrSize = C.ulong(unsafe.Sizeof(uintptr(0)))
 
+// findStreamEventHandler returns the handlers registered with the given id, or nil if there are none
 func findStreamEventHandler(ptr unsafe.Pointer) *streamEventHandlers {
-	dsEventHandlerId := uintptr(ptr)
-	if dsEventHandlerId == 0 {
-		panic("event handler id cannot be nil")
-	}
-
-	shandlerValue, exists := dataStreamEventHandlersTracker.Load(dsEventHandlerId)
+	shandlerValue, exists := dataStreamEventHandlersTracker.Load(uintptr(ptr))
 	if !exists {
-		panic("event handler not found")
+		return nil
 	}
 
 	return shandlerValue.(*streamEventHandlers)
@@ -42,6 +66,10 @@ func findStreamEventHandler(ptr unsafe.Pointer) *streamEventHandlers {
 //export GoStreamDataInputHandler
 func GoStreamDataInputHandler(ptr unsafe.Pointer, buffer unsafe.Pointer, bufferLength uint32) uint32 {
 	shandler := findStreamEventHandler(ptr)
+	// without handlers there's no one to report to, reading nothing ends the stream
+	if shandler == nil {
+		return 0
+	}
 
 	var bufferSlice []byte
 	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&bufferSlice))
@@ -50,12 +78,16 @@ func GoStreamDataInputHandler(ptr unsafe.Pointer, buffer unsafe.Pointer, bufferL
 	hdr.Len = int(bufferLength)
 	hdr.Cap = int(bufferLength)
 
-	return shandler.onRead(bufferSlice)
+	return shandler.call(shandler.onRead, bufferSlice)
 }
 
 //export GoStreamDataOutputHandler
 func GoStreamDataOutputHandler(ptr unsafe.Pointer, buffer unsafe.Pointer, bufferLength uint32) uint32 {
 	shandler := findStreamEventHandler(ptr)
+	// without handlers there's no one to report to, writing nothing fails the native call
+	if shandler == nil {
+		return 0
+	}
 
 	var bufferSlice []byte
 	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&bufferSlice))
@@ -64,5 +96,5 @@ func GoStreamDataOutputHandler(ptr unsafe.Pointer, buffer unsafe.Pointer, buffer
 	hdr.Len = int(bufferLength)
 	hdr.Cap = int(bufferLength)
 
-	return shandler.onWrite(bufferSlice)
+	return shandler.call(shandler.onWrite, bufferSlice)
 }
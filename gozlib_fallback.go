@@ -0,0 +1,185 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Native fallback
+// When enabled, operations whose native state can't be set up because of the environment, like zlib failing to
+// allocate memory or a mismatched zlib library, are retried with the Go standard library instead of failing.
+// Only failures before any data is consumed fall back, so the retry is transparent to the caller.
+
+// result codes of failures caused by the environment rather than the data
+var environmentErrorCodes = []int{C.Z_MEM_ERROR, C.Z_VERSION_ERROR}
+
+// nativeError is a zlib failure keeping its result code, so environment failures can be told apart from data errors
+type nativeError struct {
+	err  error
+	code int
+}
+
+func newNativeError(err error, code C.int) error {
+	return &nativeError{err: err, code: int(code)}
+}
+
+func (ne *nativeError) Error() string {
+	return fmt.Errorf(wrapErrorFormat, ne.err, ne.code).Error()
+}
+
+func (ne *nativeError) Unwrap() error {
+	return ne.err
+}
+
+// NativeFallbackEvent describes an operation retried with the Go standard library after a native failure
+type NativeFallbackEvent struct {
+	// Operation is the kind of operation retried, NativeCompress or NativeUncompress
+	Operation NativeOperation
+	// Err is the native failure
+	Err error
+}
+
+// NativeFallbackCallback is called every time an operation falls back to the Go standard library
+type NativeFallbackCallback func(event NativeFallbackEvent)
+
+var nativeFallback atomic.Pointer[NativeFallbackCallback]
+
+// SetNativeFallback makes Compress, Decompress, GoGZipCompressBuffer and GoUncompressBuffer retry with the Go standard
+// library when the native operation fails because of the environment, calling callback for each retry so the event
+// can be recorded. Data errors, like corrupted input, are still reported. A nil callback disables the fallback.
+func SetNativeFallback(callback NativeFallbackCallback) {
+	if callback == nil {
+		nativeFallback.Store(nil)
+		return
+	}
+	nativeFallback.Store(&callback)
+}
+
+// fallBack reports whether an operation that failed with err must be retried with the Go standard library,
+// calling the fallback callback if so
+func fallBack(op NativeOperation, err error) bool {
+	callback := nativeFallback.Load()
+	if callback == nil {
+		return false
+	}
+
+	var native *nativeError
+	if !errors.As(err, &native) {
+		return false
+	}
+
+	for _, code := range environmentErrorCodes {
+		if native.code == code {
+			(*callback)(NativeFallbackEvent{Operation: op, Err: err})
+			return true
+		}
+	}
+
+	return false
+}
+
+func fallbackCompress(dst io.Writer, src io.Reader, level CompressionLevel) (int64, error) {
+	compressor, err := gzip.NewWriterLevel(dst, int(level))
+	if err != nil {
+		return 0, err
+	}
+
+	written, cerr := io.Copy(compressor, src)
+	if cerr != nil {
+		return written, cerr
+	}
+
+	return written, compressor.Close()
+}
+
+// fallbackUncompressor returns a standard library uncompressor for the gzip or zlib stream in src
+func fallbackUncompressor(src io.Reader) (io.ReadCloser, error) {
+	input := bufio.NewReader(src)
+	magic, err := input.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	if magic[0] != 0x1f || magic[1] != 0x8b {
+		return zlib.NewReader(input)
+	}
+
+	uncompressor, err := gzip.NewReader(input)
+	if err != nil {
+		return nil, err
+	}
+	// like the native uncompressor, stop at the end of the first member
+	uncompressor.Multistream(false)
+
+	return uncompressor, nil
+}
+
+func fallbackDecompress(dst io.Writer, src io.Reader) (int64, error) {
+	uncompressor, err := fallbackUncompressor(src)
+	if err != nil {
+		return 0, err
+	}
+	defer uncompressor.Close()
+
+	maxDecompressedSize := GetDefaults().MaxDecompressedSize
+	if maxDecompressedSize == 0 {
+		return io.Copy(dst, uncompressor)
+	}
+
+	// like the native uncompressors, write the data up to the limit and fail if there's more
+	written, err := io.CopyN(dst, uncompressor, maxDecompressedSize)
+	if err != nil {
+		if err == io.EOF {
+			return written, nil
+		}
+		return written, err
+	}
+
+	var next [1]byte
+	_, err = io.ReadFull(uncompressor, next[:])
+	if err == io.EOF {
+		return written, nil
+	}
+	if err != nil {
+		return written, err
+	}
+
+	return written, DecompressedSizeLimitError
+}
+
+// fallbackBuffer copies the result of a fallback operation into output
+func fallbackBuffer(result *bytes.Buffer, err error, output []byte) (uint64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	if result.Len() > len(output) {
+		return 0, OutputBufferTooSmallError
+	}
+
+	return uint64(copy(output, result.Bytes())), nil
+}
+
+func fallbackCompressBuffer(level CompressionLevel, input []byte, output []byte) (uint64, error) {
+	result := &bytes.Buffer{}
+	_, err := fallbackCompress(result, bytes.NewReader(input), level)
+
+	return fallbackBuffer(result, err, output)
+}
+
+func fallbackUncompressBuffer(input []byte, output []byte) (uint64, error) {
+	result := &bytes.Buffer{}
+	_, err := fallbackDecompress(result, bytes.NewReader(input))
+
+	return fallbackBuffer(result, err, output)
+}
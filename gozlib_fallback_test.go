@@ -0,0 +1,74 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeFallbackEnvironmentErrors(t *testing.T) {
+	memoryError := &nativeError{err: TransformerInitializationError, code: environmentErrorCodes[0]}
+	assert.ErrorIs(t, memoryError, TransformerInitializationError)
+	assert.Equal(t, "error initializing transformer ZLib error code -4", memoryError.Error())
+
+	assert.False(t, fallBack(NativeCompress, memoryError))
+
+	events := []NativeFallbackEvent{}
+	SetNativeFallback(func(event NativeFallbackEvent) { events = append(events, event) })
+	defer SetNativeFallback(nil)
+
+	assert.True(t, fallBack(NativeCompress, memoryError))
+	// data errors and errors not raised by zlib are reported
+	assert.False(t, fallBack(NativeUncompress, &nativeError{err: BufferUncompressError, code: -3}))
+	assert.False(t, fallBack(NativeUncompress, errors.New("not native")))
+
+	assert.Equal(t, []NativeFallbackEvent{{Operation: NativeCompress, Err: memoryError}}, events)
+}
+
+func TestNativeFallbackRoundTrip(t *testing.T) {
+	data := makeTestData(20000)
+
+	compressed := &bytes.Buffer{}
+	written, err := fallbackCompress(compressed, bytes.NewReader(data), CompressionLevelBestSpeed)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), written)
+
+	// the native uncompressor reads what the fallback produces
+	uncompressed := make([]byte, len(data))
+	uncompressedLen, err := GoUncompressBuffer(compressed.Bytes(), uncompressed)
+	require.NoError(t, err)
+	assert.Equal(t, data, uncompressed[:uncompressedLen])
+
+	zlibCompressed := &bytes.Buffer{}
+	zlibWriter := zlib.NewWriter(zlibCompressed)
+	_, err = zlibWriter.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zlibWriter.Close())
+
+	for _, input := range [][]byte{compressed.Bytes(), zlibCompressed.Bytes()} {
+		output := &bytes.Buffer{}
+		_, err = fallbackDecompress(output, bytes.NewReader(input))
+		assert.NoError(t, err)
+		assert.Equal(t, data, output.Bytes())
+	}
+}
+
+func TestNativeFallbackBuffers(t *testing.T) {
+	data := makeTestData(5000)
+
+	compressed := make([]byte, 6000)
+	compressedLen, err := fallbackCompressBuffer(CompressionLevelBestCompression, data, compressed)
+	require.NoError(t, err)
+
+	uncompressed := make([]byte, len(data))
+	uncompressedLen, err := fallbackUncompressBuffer(compressed[:compressedLen], uncompressed)
+	require.NoError(t, err)
+	assert.Equal(t, data, uncompressed[:uncompressedLen])
+
+	_, err = fallbackUncompressBuffer(compressed[:compressedLen], uncompressed[:100])
+	assert.ErrorIs(t, err, OutputBufferTooSmallError)
+}
@@ -0,0 +1,54 @@
+package gozlib
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	FrameSizeError = errors.New("frame buffers must not be empty")
+)
+
+// FrameHandler receives a frame of uncompressed data. Returning an error stops uncompression
+type FrameHandler func(frame []byte) error
+
+// UncompressFrames uncompresses gzip or zlib data from src into buffers returned by acquire, filling each one
+// completely before passing it to onFrame, so that data is delivered in fixed size frames
+// Buffers are filled directly by the uncompressor, without intermediate copies, and are owned by the caller again once
+// passed to onFrame, which can return them to its own pool. Only the last frame may be shorter than its buffer.
+// The function returns the number of uncompressed bytes delivered and an error, if any.
+func UncompressFrames(src io.Reader, acquire func() []byte, onFrame FrameHandler) (uncompressed int64, err error) {
+	defer recoverPanic("UncompressFrames", &err)
+
+	pool := defaultTransformerPool()
+	uncompressor, err := pool.AcquireUncompressor(src)
+	if err != nil {
+		return 0, err
+	}
+	defer pool.ReleaseUncompressor(uncompressor)
+
+	var delivered int64
+	for {
+		frame := acquire()
+		if len(frame) == 0 {
+			return delivered, FrameSizeError
+		}
+
+		frameLen, rerr := io.ReadFull(uncompressor, frame)
+		if rerr != nil && rerr != io.ErrUnexpectedEOF && rerr != io.EOF {
+			return delivered, rerr
+		}
+
+		if frameLen > 0 {
+			herr := onFrame(frame[:frameLen])
+			if herr != nil {
+				return delivered, herr
+			}
+			delivered += int64(frameLen)
+		}
+
+		if rerr != nil {
+			return delivered, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUncompressFrames(t *testing.T) {
+	const frameSize = 4096
+
+	for _, size := range []uint32{0, 100, frameSize, frameSize*5 + 123} {
+		data := makeTestData(size)
+		compressed, err := stdLibGZipCompressSlice(data)
+		assert.NoError(t, err)
+
+		// frames are recycled through a free list like a caller's pool would
+		free := [][]byte{}
+		acquire := func() []byte {
+			if len(free) == 0 {
+				return make([]byte, frameSize)
+			}
+			frame := free[len(free)-1]
+			free = free[:len(free)-1]
+			return frame[:frameSize]
+		}
+
+		uncompressed := []byte{}
+		frameLens := []int{}
+		delivered, err := UncompressFrames(bytes.NewReader(compressed), acquire, func(frame []byte) error {
+			uncompressed = append(uncompressed, frame...)
+			frameLens = append(frameLens, len(frame))
+			free = append(free, frame)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), delivered)
+		assert.True(t, bytes.Equal(data, uncompressed))
+		for i, frameLen := range frameLens {
+			if i < len(frameLens)-1 {
+				assert.Equal(t, frameSize, frameLen)
+			}
+		}
+		assert.LessOrEqual(t, len(free), 1)
+	}
+}
+
+func TestUncompressFramesErrors(t *testing.T) {
+	compressed, err := stdLibGZipCompressSlice(makeTestData(10000))
+	assert.NoError(t, err)
+
+	_, err = UncompressFrames(bytes.NewReader(compressed), func() []byte { return nil }, func(frame []byte) error { return nil })
+	assert.ErrorIs(t, err, FrameSizeError)
+
+	stop := errors.New("stop")
+	delivered, err := UncompressFrames(bytes.NewReader(compressed), func() []byte { return make([]byte, 1024) },
+		func(frame []byte) error { return stop })
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, int64(0), delivered)
+}
@@ -0,0 +1,238 @@
+package gozlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gzipExtension = ".gz"
+)
+
+var (
+	FSOptionsError = errors.New("invalid file tree options")
+	// errStopWalk ends walking a file tree once processing failed
+	errStopWalk = errors.New("stop walking")
+)
+
+// FSOptions configures CompressFS and DecompressFS
+type FSOptions struct {
+	// Level is the compression level used by CompressFS
+	Level CompressionLevel
+	// Concurrency is the maximum number of files processed at once, zero means one
+	Concurrency int
+	// BufferSize is the work buffer size of the transformers, zero means the default uncompressor buffer size
+	BufferSize uint32
+}
+
+// gzipModTime returns the modification time stored in a gzip header, or false if it's not set
+func gzipModTime(header []byte) (time.Time, bool) {
+	if len(header) < len(gzipHeader) || header[0] != gzipHeader[0] || header[1] != gzipHeader[1] {
+		return time.Time{}, false
+	}
+
+	mtime := binary.LittleEndian.Uint32(header[4:8])
+	if mtime == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(mtime), 0), true
+}
+
+// CompressFS compresses every regular file in src into a mirrored tree under the dst directory, appending .gz to
+// file names
+// The gzip headers store the original file names and modification times, which are also set on the compressed files.
+// Processing stops at the first error, which is returned once the files already being compressed are done.
+func CompressFS(dst string, src fs.FS, options FSOptions) (err error) {
+	defer recoverPanic("CompressFS", &err)
+
+	return processFS(src, options, func(name string) bool { return true }, func(name string, bufferSize uint32) error {
+		return compressFSFile(filepath.Join(dst, filepath.FromSlash(name)+gzipExtension), src, name, options.Level, bufferSize)
+	})
+}
+
+// DecompressFS uncompresses every .gz file in src into a mirrored tree under the dst directory, removing the extension
+// Modification times are restored from the gzip headers, or taken from the compressed files if not set.
+// Files without the .gz extension are ignored. Processing stops at the first error, which is returned once the files
+// already being uncompressed are done.
+func DecompressFS(dst string, src fs.FS, options FSOptions) (err error) {
+	defer recoverPanic("DecompressFS", &err)
+
+	accept := func(name string) bool {
+		return strings.HasSuffix(name, gzipExtension) && len(name) > len(gzipExtension)
+	}
+
+	return processFS(src, options, accept, func(name string, bufferSize uint32) error {
+		return decompressFSFile(filepath.Join(dst, filepath.FromSlash(strings.TrimSuffix(name, gzipExtension))), src, name, bufferSize)
+	})
+}
+
+// processFS walks src calling process for each accepted regular file, with at most options.Concurrency calls at once
+func processFS(src fs.FS, options FSOptions, accept func(name string) bool, process func(name string, bufferSize uint32) error) error {
+	if options.Concurrency < 0 {
+		return FSOptionsError
+	}
+
+	concurrency := options.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	bufferSize := options.BufferSize
+	if bufferSize == 0 {
+		bufferSize = GetDefaults().UncompressorBufferSize
+	}
+
+	var (
+		workers  sync.WaitGroup
+		mutex    sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return firstErr != nil
+	}
+	slots := make(chan struct{}, concurrency)
+
+	walkErr := fs.WalkDir(src, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if failed() {
+			return errStopWalk
+		}
+		if !entry.Type().IsRegular() || !accept(name) {
+			return nil
+		}
+
+		slots <- struct{}{}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			perr := process(name, bufferSize)
+			<-slots
+
+			if perr != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = perr
+				}
+				mutex.Unlock()
+			}
+		}()
+
+		return nil
+	})
+
+	workers.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if walkErr == errStopWalk {
+		return nil
+	}
+	return walkErr
+}
+
+func compressFSFile(dstPath string, src fs.FS, name string, level CompressionLevel, bufferSize uint32) error {
+	input, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	return writeFSFile(dstPath, info.ModTime(), func(output io.Writer) error {
+		header := NewGZipHeader()
+		header.ModTime = info.ModTime()
+		// names can't contain the terminating zero
+		if !strings.ContainsRune(path.Base(name), 0) {
+			header.Name = path.Base(name)
+		}
+
+		compressor, err := NewGZipHeaderCompressor(output, level, header, bufferSize)
+		if err != nil {
+			return err
+		}
+
+		_, cerr := copyWithNativeBuffer(compressor, input)
+		ferr := compressor.Close()
+		if cerr != nil {
+			return cerr
+		}
+		return ferr
+	})
+}
+
+func decompressFSFile(dstPath string, src fs.FS, name string, bufferSize uint32) error {
+	input, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	info, err := input.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, len(gzipHeader))
+	headerLen, err := io.ReadFull(input, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	modTime, found := gzipModTime(header[:headerLen])
+	if !found {
+		modTime = info.ModTime()
+	}
+
+	return writeFSFile(dstPath, modTime, func(output io.Writer) error {
+		uncompressor, err := NewGoZLibUncompressor(io.MultiReader(bytes.NewReader(header[:headerLen]), input), bufferSize)
+		if err != nil {
+			return err
+		}
+		defer uncompressor.Close()
+		SetIntegrityMode(uncompressor, IntegrityStrict)
+
+		_, err = copyWithNativeBuffer(output, uncompressor)
+		return err
+	})
+}
+
+// writeFSFile creates the file at dstPath and its parent directories, writes it with write and sets its modification time
+func writeFSFile(dstPath string, modTime time.Time, write func(output io.Writer) error) error {
+	err := os.MkdirAll(filepath.Dir(dstPath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	output, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+
+	werr := write(output)
+	cerr := output.Close()
+	if werr != nil {
+		return werr
+	}
+	if cerr != nil {
+		return cerr
+	}
+
+	return os.Chtimes(dstPath, modTime, modTime)
+}
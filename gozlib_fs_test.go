@@ -0,0 +1,80 @@
+package gozlib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressDecompressFS(t *testing.T) {
+	modTime := time.Unix(1600000000, 0)
+	files := map[string][]byte{
+		"a.txt":           makeTestData(10000),
+		"dir/b.bin":       makeTestData(3000),
+		"dir/sub/c.bin":   {},
+		"dir/sub/d.json":  []byte(`{"key": "value"}`),
+		"other/e/f/g.dat": makeTestData(70000),
+	}
+
+	src := fstest.MapFS{}
+	for name, data := range files {
+		src[name] = &fstest.MapFile{Data: data, Mode: 0o644, ModTime: modTime}
+	}
+
+	compressedDir := t.TempDir()
+	err := CompressFS(compressedDir, src, FSOptions{Level: CompressionLevelBestSpeed, Concurrency: 3})
+	assert.NoError(t, err)
+
+	for name, data := range files {
+		compressedPath := filepath.Join(compressedDir, filepath.FromSlash(name)+".gz")
+		compressed, err := os.ReadFile(compressedPath)
+		assert.NoError(t, err)
+
+		// the standard library reads the name and modification time from the header
+		uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed), int64(len(data)))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, uncompressed))
+
+		headerTime, found := gzipModTime(compressed)
+		assert.True(t, found)
+		assert.Equal(t, modTime, headerTime)
+
+		info, err := os.Stat(compressedPath)
+		assert.NoError(t, err)
+		assert.True(t, modTime.Equal(info.ModTime()))
+	}
+
+	uncompressedDir := t.TempDir()
+	err = DecompressFS(uncompressedDir, os.DirFS(compressedDir), FSOptions{Concurrency: 2})
+	assert.NoError(t, err)
+
+	for name, data := range files {
+		uncompressedPath := filepath.Join(uncompressedDir, filepath.FromSlash(name))
+		uncompressed, err := os.ReadFile(uncompressedPath)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, uncompressed))
+
+		info, err := os.Stat(uncompressedPath)
+		assert.NoError(t, err)
+		assert.True(t, modTime.Equal(info.ModTime()))
+	}
+}
+
+func TestDecompressFSErrors(t *testing.T) {
+	src := fstest.MapFS{
+		"bad.gz":    &fstest.MapFile{Data: []byte("not compressed")},
+		"ignored":   &fstest.MapFile{Data: []byte("plain")},
+		"dir/ok.gz": &fstest.MapFile{Data: []byte{}},
+	}
+
+	err := DecompressFS(t.TempDir(), src, FSOptions{})
+	assert.Error(t, err)
+
+	err = DecompressFS(t.TempDir(), src, FSOptions{Concurrency: -1})
+	assert.ErrorIs(t, err, FSOptionsError)
+}
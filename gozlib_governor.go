@@ -0,0 +1,161 @@
+package gozlib
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	GovernorOptionsError = errors.New("invalid governor options")
+)
+
+const (
+	defaultGovernorSmoothing  = 0.2
+	defaultGovernorMinSamples = 5
+)
+
+// GovernorState is how much a governor is reducing compression work
+type GovernorState int
+
+const (
+	// GovernorNormal uses the requested compression level
+	GovernorNormal GovernorState = iota
+	// GovernorDegraded uses CompressionLevelBestSpeed
+	GovernorDegraded
+	// GovernorIdentity skips compression
+	GovernorIdentity
+)
+
+// GovernorOptions configures a Governor
+type GovernorOptions struct {
+	// LatencyThreshold is the average operation latency above which compression is reduced, must be greater than zero
+	LatencyThreshold time.Duration
+	// Cooldown is how long a reduced state is kept before trying the previous one
+	Cooldown time.Duration
+	// AllowIdentity enables skipping compression when latency stays above the threshold with CompressionLevelBestSpeed
+	AllowIdentity bool
+	// Smoothing is the weight of each new latency sample in the moving average, between 0 and 1. Zero means 0.2
+	Smoothing float64
+	// MinSamples is the number of latency samples observed in a state before compression can be reduced further,
+	// so a single outlier doesn't change the state. These samples are averaged evenly before smoothing applies. Zero means 5
+	MinSamples int
+}
+
+// Governor reduces compression work when operations get slow, protecting tail latency during traffic spikes
+// Callers ask the governor which level to use with Level and report how long each operation took with Observe,
+// or use Compress which does both. The governor is safe for concurrent use.
+type Governor struct {
+	mutex     sync.Mutex
+	options   GovernorOptions
+	state     GovernorState
+	average   time.Duration
+	samples   int
+	changedAt time.Time
+	now       func() time.Time
+}
+
+// NewGovernor creates a governor in the normal state
+func NewGovernor(options GovernorOptions) (governor *Governor, err error) {
+	defer recoverPanic("NewGovernor", &err)
+
+	if options.LatencyThreshold <= 0 || options.Cooldown < 0 || options.Smoothing < 0 || options.Smoothing > 1 || options.MinSamples < 0 {
+		return nil, GovernorOptionsError
+	}
+	if options.Smoothing == 0 {
+		options.Smoothing = defaultGovernorSmoothing
+	}
+	if options.MinSamples == 0 {
+		options.MinSamples = defaultGovernorMinSamples
+	}
+
+	return &Governor{options: options, state: GovernorNormal, now: time.Now}, nil
+}
+
+// State returns the current governor state, restoring a previous state if the cooldown elapsed
+func (g *Governor) State() GovernorState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.restore()
+	return g.state
+}
+
+// Level returns the compression level to use in place of requested and false if compression should be skipped
+func (g *Governor) Level(requested CompressionLevel) (CompressionLevel, bool) {
+	switch g.State() {
+	case GovernorDegraded:
+		return CompressionLevelBestSpeed, true
+	case GovernorIdentity:
+		return requested, false
+	default:
+		return requested, true
+	}
+}
+
+// Observe records the latency of a compression operation
+// Operations that skipped compression should not be observed.
+func (g *Governor) Observe(latency time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.restore()
+	if g.state == GovernorIdentity {
+		return
+	}
+
+	// the first samples of a state are averaged evenly, so a single outlier doesn't dominate the moving average
+	if g.samples < g.options.MinSamples {
+		g.average += (latency - g.average) / time.Duration(g.samples+1)
+	} else {
+		g.average += time.Duration(g.options.Smoothing * float64(latency-g.average))
+	}
+	g.samples++
+
+	if g.samples < g.options.MinSamples || g.average <= g.options.LatencyThreshold {
+		return
+	}
+
+	if g.state == GovernorNormal {
+		g.setState(GovernorDegraded)
+	} else if g.options.AllowIdentity {
+		g.setState(GovernorIdentity)
+	}
+}
+
+// Compress copies src to dst compressed in gzip format at the level chosen by the governor, observing its latency
+// The returned boolean is false if compression was skipped and the data copied as is, in which case the caller must
+// not label dst as gzip encoded.
+func (g *Governor) Compress(dst io.Writer, src io.Reader, level CompressionLevel) (written int64, compressed bool, err error) {
+	defer recoverPanic("Governor.Compress", &err)
+
+	level, compress := g.Level(level)
+	if !compress {
+		written, err := copyWithNativeBuffer(dst, src)
+		return written, false, err
+	}
+
+	start := g.now()
+	written, err = Compress(dst, src, level)
+	if err == nil {
+		g.Observe(g.now().Sub(start))
+	}
+
+	return written, true, err
+}
+
+// restore moves to the previous state once the cooldown elapsed. Must be called with the mutex locked
+func (g *Governor) restore() {
+	if g.state != GovernorNormal && g.now().Sub(g.changedAt) >= g.options.Cooldown {
+		g.setState(g.state - 1)
+	}
+}
+
+// setState changes the state, discarding samples taken in the previous one. Must be called with the mutex locked
+func (g *Governor) setState(state GovernorState) {
+	g.state = state
+	g.changedAt = g.now()
+	g.average = 0
+	g.samples = 0
+}
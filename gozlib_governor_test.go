@@ -0,0 +1,119 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGovernor(t *testing.T, options GovernorOptions) (*Governor, *time.Time) {
+	governor, err := NewGovernor(options)
+	assert.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	governor.now = func() time.Time { return now }
+	return governor, &now
+}
+
+func observeGovernor(governor *Governor, count int, latency time.Duration) {
+	for i := 0; i < count; i++ {
+		governor.Observe(latency)
+	}
+}
+
+func TestGovernorOptions(t *testing.T) {
+	_, err := NewGovernor(GovernorOptions{})
+	assert.ErrorIs(t, err, GovernorOptionsError)
+
+	_, err = NewGovernor(GovernorOptions{LatencyThreshold: time.Millisecond, Smoothing: 2})
+	assert.ErrorIs(t, err, GovernorOptionsError)
+
+	_, err = NewGovernor(GovernorOptions{LatencyThreshold: time.Millisecond, MinSamples: -1})
+	assert.ErrorIs(t, err, GovernorOptionsError)
+}
+
+func TestGovernorDowngradesAndRestores(t *testing.T) {
+	governor, now := newTestGovernor(t, GovernorOptions{
+		LatencyThreshold: 10 * time.Millisecond,
+		Cooldown:         time.Second,
+		AllowIdentity:    true,
+		Smoothing:        0.5,
+		MinSamples:       3,
+	})
+
+	governor.Observe(5 * time.Millisecond)
+	governor.Observe(30 * time.Millisecond)
+	level, compress := governor.Level(CompressionLevelBestCompression)
+	assert.Equal(t, CompressionLevelBestCompression, level)
+	assert.True(t, compress)
+
+	governor.Observe(30 * time.Millisecond)
+	assert.Equal(t, GovernorDegraded, governor.State())
+	level, compress = governor.Level(CompressionLevelBestCompression)
+	assert.Equal(t, CompressionLevelBestSpeed, level)
+	assert.True(t, compress)
+
+	observeGovernor(governor, 2, 20*time.Millisecond)
+	assert.Equal(t, GovernorDegraded, governor.State())
+	governor.Observe(20 * time.Millisecond)
+	assert.Equal(t, GovernorIdentity, governor.State())
+	_, compress = governor.Level(CompressionLevelBestCompression)
+	assert.False(t, compress)
+
+	*now = now.Add(time.Second)
+	assert.Equal(t, GovernorDegraded, governor.State())
+	*now = now.Add(time.Second)
+	assert.Equal(t, GovernorNormal, governor.State())
+}
+
+func TestGovernorWithoutIdentity(t *testing.T) {
+	governor, _ := newTestGovernor(t, GovernorOptions{LatencyThreshold: time.Millisecond, Cooldown: time.Minute})
+
+	observeGovernor(governor, 2*defaultGovernorMinSamples, time.Second)
+	assert.Equal(t, GovernorDegraded, governor.State())
+}
+
+func TestGovernorIgnoresSingleOutlier(t *testing.T) {
+	governor, _ := newTestGovernor(t, GovernorOptions{LatencyThreshold: 10 * time.Millisecond, Cooldown: time.Minute, AllowIdentity: true})
+
+	governor.Observe(30 * time.Millisecond)
+	assert.Equal(t, GovernorNormal, governor.State())
+	observeGovernor(governor, defaultGovernorMinSamples, time.Millisecond)
+	assert.Equal(t, GovernorNormal, governor.State())
+
+	governor.Observe(time.Second)
+	assert.Equal(t, GovernorDegraded, governor.State())
+
+	// the samples needed are counted again after each state change
+	governor.Observe(30 * time.Millisecond)
+	observeGovernor(governor, defaultGovernorMinSamples-1, time.Millisecond)
+	assert.Equal(t, GovernorDegraded, governor.State())
+}
+
+func TestGovernorCompress(t *testing.T) {
+	governor, now := newTestGovernor(t, GovernorOptions{LatencyThreshold: time.Millisecond, Cooldown: time.Minute, AllowIdentity: true})
+	data := makeTestData(10000)
+
+	compressed := bytes.NewBuffer([]byte{})
+	written, wasCompressed, err := governor.Compress(compressed, bytes.NewReader(data), CompressionLevelBestCompression)
+	assert.NoError(t, err)
+	assert.True(t, wasCompressed)
+	assert.Equal(t, int64(len(data)), written)
+	uncompressed, err := stdLibGZipUncompress(compressed, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	observeGovernor(governor, 2*defaultGovernorMinSamples, time.Second)
+	assert.Equal(t, GovernorIdentity, governor.State())
+
+	copied := bytes.NewBuffer([]byte{})
+	_, wasCompressed, err = governor.Compress(copied, bytes.NewReader(data), CompressionLevelBestCompression)
+	assert.NoError(t, err)
+	assert.False(t, wasCompressed)
+	assert.Equal(t, data, copied.Bytes())
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, GovernorDegraded, governor.State())
+}
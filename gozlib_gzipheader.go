@@ -0,0 +1,410 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// gzip headers
+// RFC 1952 headers carry optional metadata: the original file name, a comment, the modification time, the operating
+// system that produced the stream and an extra field made of subfields identified by two bytes, SI1 and SI2, used by
+// formats such as BGZF and dictzip.
+
+// gzip header flags
+const (
+	gzipFlagHeaderCRC = 0x02
+	gzipFlagExtra     = 0x04
+	gzipFlagName      = 0x08
+	gzipFlagComment   = 0x10
+)
+
+// the extra field and each subfield store their length in two bytes
+const (
+	maxGZipExtraLen         = math.MaxUint16
+	gzipExtraSubfieldHeader = 4
+)
+
+// room for the name and comment read from gzip headers by uncompressors, longer ones are truncated
+const maxGZipHeaderStringLen = 4096
+
+var (
+	GZipHeaderError            = errors.New("invalid gzip header")
+	GZipHeaderUnavailableError = errors.New("gzip header not available")
+)
+
+// GZipOS is the operating system on which a gzip stream was produced, as defined by RFC 1952
+type GZipOS byte
+
+const (
+	GZipOSFAT       GZipOS = 0
+	GZipOSAmiga     GZipOS = 1
+	GZipOSVMS       GZipOS = 2
+	GZipOSUnix      GZipOS = 3
+	GZipOSVMCMS     GZipOS = 4
+	GZipOSAtari     GZipOS = 5
+	GZipOSHPFS      GZipOS = 6
+	GZipOSMacintosh GZipOS = 7
+	GZipOSZSystem   GZipOS = 8
+	GZipOSCPM       GZipOS = 9
+	GZipOSTOPS20    GZipOS = 10
+	GZipOSNTFS      GZipOS = 11
+	GZipOSQDOS      GZipOS = 12
+	GZipOSAcorn     GZipOS = 13
+	GZipOSUnknown   GZipOS = 255
+)
+
+// GZipHeader holds the optional fields of a gzip header
+type GZipHeader struct {
+	// Name is the original file name, it can't contain zero bytes
+	Name string
+	// Comment is a free form comment, it can't contain zero bytes
+	Comment string
+	// ModTime is the modification time of the original data, the zero time meaning it's not set
+	ModTime time.Time
+	// OS is the operating system that produced the stream. Its zero value is GZipOSFAT, see NewGZipHeader
+	OS GZipOS
+	// Extra is the extra field, built with AppendGZipExtraSubfield
+	Extra []byte
+}
+
+// GZipExtraSubfield is a subfield of the gzip header extra field
+type GZipExtraSubfield struct {
+	// ID holds the subfield identifier bytes SI1 and SI2, SI2 can't be zero
+	ID   [2]byte
+	Data []byte
+}
+
+// NewGZipHeader returns an empty header with the operating system set to GZipOSUnknown, like zlib writes by default
+func NewGZipHeader() *GZipHeader {
+	return &GZipHeader{OS: GZipOSUnknown}
+}
+
+// AppendGZipExtraSubfield appends subfield to the extra field extra, returning GZipHeaderError if it doesn't fit
+func AppendGZipExtraSubfield(extra []byte, subfield GZipExtraSubfield) (result []byte, err error) {
+	defer recoverPanic("AppendGZipExtraSubfield", &err)
+
+	if subfield.ID[1] == 0 {
+		return extra, fmt.Errorf("%w: subfield id %q is reserved", GZipHeaderError, subfield.ID[:])
+	}
+
+	if len(extra)+gzipExtraSubfieldHeader+len(subfield.Data) > maxGZipExtraLen {
+		return extra, fmt.Errorf("%w: extra field larger than %d bytes", GZipHeaderError, maxGZipExtraLen)
+	}
+
+	extra = append(extra, subfield.ID[:]...)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(subfield.Data)))
+	return append(extra, subfield.Data...), nil
+}
+
+// GZipExtraSubfields splits an extra field into its subfields, whose data references extra
+func GZipExtraSubfields(extra []byte) (subfields []GZipExtraSubfield, err error) {
+	defer recoverPanic("GZipExtraSubfields", &err)
+
+	subfields = []GZipExtraSubfield{}
+	for len(extra) > 0 {
+		if len(extra) < gzipExtraSubfieldHeader {
+			return nil, fmt.Errorf("%w: truncated extra subfield", GZipHeaderError)
+		}
+
+		dataLen := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra)-gzipExtraSubfieldHeader < dataLen {
+			return nil, fmt.Errorf("%w: truncated extra subfield", GZipHeaderError)
+		}
+
+		subfields = append(subfields, GZipExtraSubfield{
+			ID:   [2]byte{extra[0], extra[1]},
+			Data: extra[gzipExtraSubfieldHeader : gzipExtraSubfieldHeader+dataLen],
+		})
+		extra = extra[gzipExtraSubfieldHeader+dataLen:]
+	}
+
+	return subfields, nil
+}
+
+func validateGZipHeader(header *GZipHeader) error {
+	if strings.ContainsRune(header.Name, 0) || strings.ContainsRune(header.Comment, 0) {
+		return fmt.Errorf("%w: name and comment can't contain zero bytes", GZipHeaderError)
+	}
+	if len(header.Extra) > maxGZipExtraLen {
+		return fmt.Errorf("%w: extra field larger than %d bytes", GZipHeaderError, maxGZipExtraLen)
+	}
+	return nil
+}
+
+// modTime returns the header modification time in seconds since the Unix epoch, zero if it's not set or can't be represented
+func (header *GZipHeader) modTime() uint32 {
+	if header.ModTime.Unix() > 0 && header.ModTime.Unix() <= math.MaxUint32 {
+		return uint32(header.ModTime.Unix())
+	}
+	return 0
+}
+
+// NewGZipHeaderCompressor creates a gzip compressor writing header, which can be nil, before the compressed data
+// It's a shorthand for NewGoGZipCompressorWithOptions with the Header option, defaulting to NewGZipHeader.
+func NewGZipHeaderCompressor(output io.Writer, level CompressionLevel, header *GZipHeader, bufferSize uint32) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewGZipHeaderCompressor", &err)
+
+	if header == nil {
+		header = NewGZipHeader()
+	}
+
+	return NewGoGZipCompressorWithOptions(output, level, bufferSize, TransformerOptions{Header: header})
+}
+
+// setNativeGZipHeader copies header to native memory, where zlib reads it from when writing the gzip header
+func (comp *goGZipCompressor) setNativeGZipHeader(header *GZipHeader) error {
+	headerSize := int(C.sizeof_gz_header)
+	fieldsSize := len(header.Extra) + len(header.Name) + 1 + len(header.Comment) + 1
+	comp.gzHeaderPtr = comp.nativeAlloc(C.size_t(headerSize + fieldsSize))
+
+	nativeHeader := (*C.gz_header)(comp.gzHeaderPtr)
+	*nativeHeader = C.gz_header{}
+	nativeHeader.time = C.uLong(header.modTime())
+	nativeHeader.os = C.int(header.OS)
+
+	// the fields are stored right after the header, names and comments zero terminated
+	fieldsPtr := unsafe.Add(comp.gzHeaderPtr, headerSize)
+	fields := nativeSlice(fieldsPtr, 0, fieldsSize)
+	if header.Extra != nil {
+		nativeHeader.extra = (*C.Bytef)(fieldsPtr)
+		nativeHeader.extra_len = C.uInt(len(header.Extra))
+		fields = append(fields, header.Extra...)
+	}
+	if header.Name != "" {
+		nativeHeader.name = (*C.Bytef)(unsafe.Add(fieldsPtr, len(fields)))
+		fields = append(append(fields, header.Name...), 0)
+	}
+	if header.Comment != "" {
+		nativeHeader.comment = (*C.Bytef)(unsafe.Add(fieldsPtr, len(fields)))
+		fields = append(append(fields, header.Comment...), 0)
+	}
+	// in the written header, the extra field is preceded by its 2 byte length
+	comp.gzHeaderFieldsLen = len(fields)
+	if header.Extra != nil {
+		comp.gzHeaderFieldsLen += 2
+	}
+
+	return comp.applyNativeGZipHeader()
+}
+
+// applyNativeGZipHeader sets the native header of the compressor on its stream, which must not have produced output yet
+func (comp *goGZipCompressor) applyNativeGZipHeader() error {
+	if comp.gzHeaderPtr == nil {
+		return nil
+	}
+
+	resultCode := C.deflateSetHeader(comp.transformer.zs, (*C.gz_header)(comp.gzHeaderPtr))
+	if resultCode != C.Z_OK {
+		return fmt.Errorf(wrapErrorFormat, GZipHeaderError, resultCode)
+	}
+	return nil
+}
+
+// Header returns the header of the gzip stream being uncompressed, reading and uncompressing input as needed to reach
+// the end of the header, without consuming any uncompressed data.
+// To capture the header, Header must be called before any data is read from the uncompressor, or after it's reset.
+// Calling it later, or on zlib and raw deflate streams, fails with GZipHeaderUnavailableError.
+// Names and comments longer than 4096 bytes are truncated.
+func (unc *goUncompressor) Header() (header *GZipHeader, err error) {
+	defer recoverPanic("Header", &err)
+
+	if unc.gzHeaderPtr == nil {
+		if unc.transformer.zs.total_in > 0 {
+			return nil, fmt.Errorf("%w: the header must be requested before reading", GZipHeaderUnavailableError)
+		}
+
+		headerSize := int(C.sizeof_gz_header)
+		unc.gzHeaderPtr = unc.nativeAlloc(C.size_t(headerSize + maxGZipExtraLen + 2*maxGZipHeaderStringLen))
+		unc.registerNativeGZipHeader()
+	}
+
+	nativeHeader := (*C.gz_header)(unc.gzHeaderPtr)
+	if nativeHeader.done == 0 {
+		// the header is complete before the first uncompressed byte
+		_, perr := unc.Peek(1)
+		if perr != nil && perr != io.EOF {
+			return nil, perr
+		}
+	}
+
+	switch nativeHeader.done {
+	case 1:
+		return unc.nativeGZipHeader(nativeHeader), nil
+	case 0:
+		return nil, fmt.Errorf("%w: the stream ended before the header", GZipHeaderUnavailableError)
+	default:
+		return nil, fmt.Errorf("%w: not a gzip stream", GZipHeaderUnavailableError)
+	}
+}
+
+// registerNativeGZipHeader asks zlib to fill the native header of the uncompressor while reading the gzip header
+func (unc *goUncompressor) registerNativeGZipHeader() {
+	if unc.gzHeaderPtr == nil {
+		return
+	}
+
+	headerSize := int(C.sizeof_gz_header)
+	nativeHeader := (*C.gz_header)(unc.gzHeaderPtr)
+	*nativeHeader = C.gz_header{}
+	nativeHeader.extra = (*C.Bytef)(unsafe.Add(unc.gzHeaderPtr, headerSize))
+	nativeHeader.extra_max = maxGZipExtraLen
+	nativeHeader.name = (*C.Bytef)(unsafe.Add(unc.gzHeaderPtr, headerSize+maxGZipExtraLen))
+	nativeHeader.name_max = maxGZipHeaderStringLen
+	nativeHeader.comment = (*C.Bytef)(unsafe.Add(unc.gzHeaderPtr, headerSize+maxGZipExtraLen+maxGZipHeaderStringLen))
+	nativeHeader.comm_max = maxGZipHeaderStringLen
+
+	// raw deflate streams have no header to fill
+	resultCode := C.inflateGetHeader(unc.transformer.zs, nativeHeader)
+	if resultCode != C.Z_OK {
+		nativeHeader.done = -1
+	}
+}
+
+// nativeGZipHeader copies a header filled by zlib
+func (unc *goUncompressor) nativeGZipHeader(nativeHeader *C.gz_header) *GZipHeader {
+	header := &GZipHeader{OS: GZipOS(nativeHeader.os)}
+	if nativeHeader.time > 0 {
+		header.ModTime = time.Unix(int64(nativeHeader.time), 0)
+	}
+
+	// zlib sets extra to NULL when the header has no extra field
+	if nativeHeader.extra != nil {
+		header.Extra = C.GoBytes(unsafe.Pointer(nativeHeader.extra), C.int(nativeHeader.extra_len))
+	}
+	header.Name = nativeGZipHeaderString(nativeHeader.name)
+	header.Comment = nativeGZipHeaderString(nativeHeader.comment)
+
+	return header
+}
+
+// nativeGZipHeaderString returns a zero terminated header string, which zlib doesn't terminate when truncated
+func nativeGZipHeaderString(field *C.Bytef) string {
+	if field == nil {
+		return ""
+	}
+
+	value := nativeSlice(unsafe.Pointer(field), maxGZipHeaderStringLen, maxGZipHeaderStringLen)
+	end := bytes.IndexByte(value, 0)
+	if end < 0 {
+		end = len(value)
+	}
+	return string(value[:end])
+}
+
+// Header is a helper function returning the gzip header of the stream being uncompressed by an uncompressor given an
+// interface, see the Header method of the uncompressor
+func Header(uncompressor io.ReadCloser) (header *GZipHeader, err error) {
+	defer recoverPanic("Header", &err)
+
+	return uncompressor.(*goUncompressor).Header()
+}
+
+// ReadGZipHeader reads the header of the gzip stream in input, returning it along with a reader producing the whole
+// stream again, header included, so it can be uncompressed by any uncompressor
+// Names and comments longer than 4096 bytes fail with GZipHeaderError.
+func ReadGZipHeader(input io.Reader) (header *GZipHeader, reader io.Reader, err error) {
+	defer recoverPanic("ReadGZipHeader", &err)
+
+	buffered := bufio.NewReader(input)
+	consumed := &bytes.Buffer{}
+	reader = io.TeeReader(buffered, consumed)
+	replay := func() io.Reader {
+		return io.MultiReader(bytes.NewReader(consumed.Bytes()), buffered)
+	}
+
+	fixed := make([]byte, len(gzipHeader))
+	_, err = io.ReadFull(reader, fixed)
+	if err != nil {
+		return nil, replay(), fmt.Errorf("%w: %v", GZipHeaderError, err)
+	}
+	if fixed[0] != gzipHeader[0] || fixed[1] != gzipHeader[1] || fixed[2] != gzipHeader[2] {
+		return nil, replay(), fmt.Errorf("%w: not a gzip stream", GZipHeaderError)
+	}
+
+	header, err = readGZipHeaderFields(reader, fixed)
+	if err == nil && fixed[3]&gzipFlagHeaderCRC != 0 {
+		err = checkGZipHeaderCRC(reader, consumed.Bytes())
+	}
+	if err != nil {
+		return nil, replay(), err
+	}
+
+	return header, replay(), nil
+}
+
+func readGZipHeaderFields(reader io.Reader, fixed []byte) (*GZipHeader, error) {
+	header := &GZipHeader{OS: GZipOS(fixed[9])}
+	if mtime := binary.LittleEndian.Uint32(fixed[4:8]); mtime > 0 {
+		header.ModTime = time.Unix(int64(mtime), 0)
+	}
+
+	var err error
+	flags := fixed[3]
+	if flags&gzipFlagExtra != 0 {
+		var extraLen [2]byte
+		_, err = io.ReadFull(reader, extraLen[:])
+		if err == nil {
+			header.Extra = make([]byte, binary.LittleEndian.Uint16(extraLen[:]))
+			_, err = io.ReadFull(reader, header.Extra)
+		}
+	}
+	if err == nil && flags&gzipFlagName != 0 {
+		header.Name, err = readGZipHeaderString(reader)
+	}
+	if err == nil && flags&gzipFlagComment != 0 {
+		header.Comment, err = readGZipHeaderString(reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", GZipHeaderError, err)
+	}
+
+	return header, nil
+}
+
+// readGZipHeaderString reads a zero terminated string up to maxGZipHeaderStringLen bytes long
+func readGZipHeaderString(reader io.Reader) (string, error) {
+	value := []byte{}
+	var c [1]byte
+	for {
+		_, err := io.ReadFull(reader, c[:])
+		if err != nil {
+			return "", err
+		}
+		if c[0] == 0 {
+			return string(value), nil
+		}
+		if len(value) == maxGZipHeaderStringLen {
+			return "", fmt.Errorf("name or comment longer than %d bytes", maxGZipHeaderStringLen)
+		}
+		value = append(value, c[0])
+	}
+}
+
+// checkGZipHeaderCRC reads the header checksum, the low 16 bits of the CRC32 of the header bytes before it
+func checkGZipHeaderCRC(reader io.Reader, header []byte) error {
+	expected := uint16(crc32.ChecksumIEEE(header))
+
+	var checksum [2]byte
+	_, err := io.ReadFull(reader, checksum[:])
+	if err != nil {
+		return fmt.Errorf("%w: %v", GZipHeaderError, err)
+	}
+	if binary.LittleEndian.Uint16(checksum[:]) != expected {
+		return fmt.Errorf("%w: header checksum mismatch", GZipHeaderError)
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGZipHeaderCompressor(t *testing.T) {
+	// a BGZF style block size subfield and a custom one
+	extra, err := AppendGZipExtraSubfield(nil, GZipExtraSubfield{ID: [2]byte{'B', 'C'}, Data: []byte{0x1b, 0x00}})
+	require.NoError(t, err)
+	extra, err = AppendGZipExtraSubfield(extra, GZipExtraSubfield{ID: [2]byte{'G', 'Z'}, Data: []byte("index")})
+	require.NoError(t, err)
+
+	header := NewGZipHeader()
+	header.Name = "data.bin"
+	header.Comment = "test data"
+	header.ModTime = time.Unix(1700000000, 0)
+	header.OS = GZipOSUnix
+	header.Extra = extra
+
+	data := makeTestData(10000)
+	output := &bytes.Buffer{}
+	compressor, err := NewGZipHeaderCompressor(output, CompressionLevelBestSpeed, header, 1024)
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	stdReader, err := gzip.NewReader(bytes.NewReader(output.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, header.Name, stdReader.Name)
+	assert.Equal(t, header.Comment, stdReader.Comment)
+	assert.Equal(t, header.ModTime, stdReader.ModTime)
+	assert.Equal(t, byte(GZipOSUnix), stdReader.OS)
+	assert.Equal(t, extra, stdReader.Extra)
+
+	read, stream, err := ReadGZipHeader(output)
+	require.NoError(t, err)
+	assert.Equal(t, header, read)
+
+	subfields, err := GZipExtraSubfields(read.Extra)
+	require.NoError(t, err)
+	assert.Equal(t, []GZipExtraSubfield{
+		{ID: [2]byte{'B', 'C'}, Data: []byte{0x1b, 0x00}},
+		{ID: [2]byte{'G', 'Z'}, Data: []byte("index")},
+	}, subfields)
+
+	// the returned reader replays the header
+	uncompressor, err := NewGoZLibUncompressor(stream, 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestGoGZipCompressorWithHeader(t *testing.T) {
+	extra, err := AppendGZipExtraSubfield(nil, GZipExtraSubfield{ID: [2]byte{'G', 'Z'}, Data: []byte("meta")})
+	require.NoError(t, err)
+
+	header := NewGZipHeader()
+	header.Name = "report.csv"
+	header.Comment = "nightly export"
+	header.ModTime = time.Unix(1700000000, 0)
+	header.OS = GZipOSUnix
+	header.Extra = extra
+
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressorWithOptions(output, CompressionLevelDefault, 1024, TransformerOptions{Header: header})
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	// the header is kept when the compressor is reset
+	for round := 0; round < 2; round++ {
+		data := makeTestData(10000)
+		output.Reset()
+		ResetCompressor(output, compressor)
+		_, err = compressor.Write(data)
+		require.NoError(t, err)
+		_, err = Finish(compressor)
+		require.NoError(t, err)
+
+		stdReader, rerr := gzip.NewReader(bytes.NewReader(output.Bytes()))
+		require.NoError(t, rerr)
+		assert.Equal(t, header.Name, stdReader.Name)
+		assert.Equal(t, header.Comment, stdReader.Comment)
+		assert.Equal(t, header.ModTime, stdReader.ModTime)
+		assert.Equal(t, byte(GZipOSUnix), stdReader.OS)
+		assert.Equal(t, extra, stdReader.Extra)
+		uncompressed, rerr := io.ReadAll(stdReader)
+		assert.NoError(t, rerr)
+		assert.Equal(t, data, uncompressed)
+
+		read, _, rerr := ReadGZipHeader(bytes.NewReader(output.Bytes()))
+		require.NoError(t, rerr)
+		assert.Equal(t, header, read)
+	}
+}
+
+func TestGoGZipCompressorWithPartialHeader(t *testing.T) {
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressorWithOptions(output, CompressionLevelBestSpeed, 1024,
+		TransformerOptions{BypassNativePool: true, Header: &GZipHeader{Name: "only-name.txt", OS: GZipOSUnknown}})
+	require.NoError(t, err)
+	_, err = compressor.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	read, _, err := ReadGZipHeader(output)
+	require.NoError(t, err)
+	assert.Equal(t, &GZipHeader{Name: "only-name.txt", OS: GZipOSUnknown}, read)
+
+	_, err = NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelBestSpeed, 1024, TransformerOptions{Header: &GZipHeader{Comment: "a\x00b"}})
+	assert.ErrorIs(t, err, GZipHeaderError)
+}
+
+func TestUncompressorHeader(t *testing.T) {
+	extra, err := AppendGZipExtraSubfield(nil, GZipExtraSubfield{ID: [2]byte{'G', 'Z'}, Data: []byte("meta")})
+	require.NoError(t, err)
+	header := &GZipHeader{Name: "original.tar", Comment: "backup", ModTime: time.Unix(1700000000, 0), OS: GZipOSUnix, Extra: extra}
+
+	data := makeTestData(20000)
+	withHeader := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressorWithOptions(withHeader, CompressionLevelDefault, 1024, TransformerOptions{Header: header})
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	stdCompressed := &bytes.Buffer{}
+	stdWriter := gzip.NewWriter(stdCompressed)
+	stdWriter.Name = "std.txt"
+	_, err = stdWriter.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, stdWriter.Close())
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(withHeader.Bytes()), 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	read, err := Header(uncompressor)
+	require.NoError(t, err)
+	assert.Equal(t, header, read)
+
+	// reading the header doesn't consume uncompressed data
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+	read, err = Header(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, header, read)
+
+	// the header of the next stream replaces it after a reset
+	ResetUncompressor(bytes.NewReader(stdCompressed.Bytes()), uncompressor)
+	read, err = Header(uncompressor)
+	require.NoError(t, err)
+	assert.Equal(t, "std.txt", read.Name)
+	assert.Equal(t, "", read.Comment)
+	assert.Nil(t, read.Extra)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestUncompressorHeaderUnavailable(t *testing.T) {
+	data := makeTestData(5000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed), 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+	_, err = uncompressor.Read(make([]byte, 100))
+	require.NoError(t, err)
+	_, err = Header(uncompressor)
+	assert.ErrorIs(t, err, GZipHeaderUnavailableError)
+
+	zlibOutput := &bytes.Buffer{}
+	zlibCompressor, err := NewGoZLibCompressor(zlibOutput, CompressionLevelDefault, 1024)
+	require.NoError(t, err)
+	_, err = zlibCompressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zlibCompressor.Close())
+
+	ResetUncompressor(zlibOutput, uncompressor)
+	_, err = Header(uncompressor)
+	assert.ErrorIs(t, err, GZipHeaderUnavailableError)
+
+	ResetUncompressor(bytes.NewReader(compressed[:5]), uncompressor)
+	_, err = Header(uncompressor)
+	assert.Error(t, err)
+}
+
+func TestUncompressorHeaderEmptyStreamAndLongName(t *testing.T) {
+	longName := strings.Repeat("n", maxGZipHeaderStringLen+100)
+	output := &bytes.Buffer{}
+	compressor, err := NewGZipHeaderCompressor(output, CompressionLevelBestSpeed, &GZipHeader{Name: longName, OS: GZipOSUnknown}, 1024)
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	uncompressor, err := NewGoZLibUncompressor(output, 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	read, err := Header(uncompressor)
+	require.NoError(t, err)
+	assert.Equal(t, longName[:maxGZipHeaderStringLen], read.Name)
+	assert.Equal(t, GZipOSUnknown, read.OS)
+}
+
+func TestReadGZipHeaderChecksum(t *testing.T) {
+	fixed := []byte{0x1f, 0x8b, 8, gzipFlagHeaderCRC | gzipFlagName, 0, 0, 0, 0, 0, byte(GZipOSUnknown)}
+	fixed = append(fixed, "name\x00"...)
+	withChecksum := binary.LittleEndian.AppendUint16(append([]byte{}, fixed...), uint16(crc32.ChecksumIEEE(fixed)))
+
+	header, _, err := ReadGZipHeader(bytes.NewReader(withChecksum))
+	require.NoError(t, err)
+	assert.Equal(t, "name", header.Name)
+	assert.Equal(t, GZipOSUnknown, header.OS)
+	assert.True(t, header.ModTime.IsZero())
+
+	withChecksum[len(withChecksum)-1]++
+	_, _, err = ReadGZipHeader(bytes.NewReader(withChecksum))
+	assert.ErrorIs(t, err, GZipHeaderError)
+}
+
+func TestReadGZipHeaderStringTooLong(t *testing.T) {
+	fixed := []byte{0x1f, 0x8b, 8, gzipFlagComment, 0, 0, 0, 0, 0, byte(GZipOSUnknown)}
+
+	comment := bytes.Repeat([]byte{'c'}, maxGZipHeaderStringLen)
+	header, _, err := ReadGZipHeader(bytes.NewReader(append(append(fixed, comment...), 0)))
+	require.NoError(t, err)
+	assert.Equal(t, string(comment), header.Comment)
+
+	// a comment that never ends stops being read past the limit
+	unterminated := io.MultiReader(bytes.NewReader(fixed), bytes.NewReader(comment), strings.NewReader("more"))
+	_, _, err = ReadGZipHeader(unterminated)
+	assert.ErrorIs(t, err, GZipHeaderError)
+}
+
+func TestGZipHeaderInvalid(t *testing.T) {
+	_, err := AppendGZipExtraSubfield(nil, GZipExtraSubfield{ID: [2]byte{'A', 0}})
+	assert.ErrorIs(t, err, GZipHeaderError)
+	_, err = AppendGZipExtraSubfield(nil, GZipExtraSubfield{ID: [2]byte{'A', 'B'}, Data: make([]byte, maxGZipExtraLen)})
+	assert.ErrorIs(t, err, GZipHeaderError)
+
+	_, err = GZipExtraSubfields([]byte{'A', 'B', 5, 0, 1})
+	assert.ErrorIs(t, err, GZipHeaderError)
+	_, err = GZipExtraSubfields([]byte{'A', 'B'})
+	assert.ErrorIs(t, err, GZipHeaderError)
+
+	_, err = NewGZipHeaderCompressor(io.Discard, CompressionLevelBestSpeed, &GZipHeader{Name: "a\x00b"}, 1024)
+	assert.ErrorIs(t, err, GZipHeaderError)
+
+	_, stream, err := ReadGZipHeader(bytes.NewReader([]byte("not gzip data")))
+	assert.ErrorIs(t, err, GZipHeaderError)
+	replayed, _ := io.ReadAll(stream)
+	assert.Equal(t, []byte("not gzip data"), replayed)
+}
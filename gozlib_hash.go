@@ -0,0 +1,47 @@
+package gozlib
+
+import (
+	"bytes"
+	"hash"
+)
+
+// hashChunkSize is the size of the input chunks fed to the hash and the compressor, small enough to stay in cache
+const hashChunkSize = 1024 * 16
+
+// CompressAndHash compresses input in gzip format and computes its digest with h in a single pass over the input
+// The hash is reset first. It returns the compressed data, the digest of the uncompressed input and an error, if any.
+// The compression level is the one from the package defaults.
+func CompressAndHash(input []byte, h hash.Hash) (result []byte, digest []byte, err error) {
+	defer recoverPanic("CompressAndHash", &err)
+
+	h.Reset()
+
+	compressed := bytes.NewBuffer(make([]byte, 0, len(input)/2+64))
+	pool := defaultTransformerPool()
+	compressor, err := pool.AcquireCompressor(compressed, GetDefaults().CompressionLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pool.ReleaseCompressor(compressor)
+
+	for start := 0; start < len(input); start += hashChunkSize {
+		end := start + hashChunkSize
+		if end > len(input) {
+			end = len(input)
+		}
+
+		chunk := input[start:end]
+		h.Write(chunk)
+		_, err = compressor.Write(chunk)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, err = Finish(compressor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return compressed.Bytes(), h.Sum(nil), nil
+}
@@ -0,0 +1,27 @@
+package gozlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressAndHash(t *testing.T) {
+	for _, size := range []uint32{0, 100, hashChunkSize, hashChunkSize*3 + 7} {
+		data := makeTestData(size)
+		h := sha256.New()
+		h.Write([]byte("stale state"))
+
+		compressed, sum, err := CompressAndHash(data, h)
+		assert.NoError(t, err)
+
+		expected := sha256.Sum256(data)
+		assert.Equal(t, expected[:], sum)
+
+		uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed), int64(len(data)))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data, uncompressed))
+	}
+}
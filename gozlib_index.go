@@ -0,0 +1,295 @@
+package gozlib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Indexed compression
+// An indexed compressor full flushes the gzip stream at regular intervals of uncompressed data. Uncompression can start at any
+// full flush point without any previous data, so recording the compressed and uncompressed offsets of each point allows
+// random access to the compressed data.
+//
+// The index sidecar format, all integers being unsigned varints:
+//
+//	"GZIX" magic, version byte (1)
+//	flush interval
+//	number of points
+//	for each point, ordered by offset: compressed offset delta, uncompressed offset delta
+//
+// Deltas are relative to the previous point, the first point being relative to zero. Compressed offsets point to the
+// first byte of raw deflate data following the flush point, uncompressed offsets are the number of uncompressed bytes before it.
+
+var indexMagic = []byte("GZIX")
+
+const indexVersion = 1
+
+// largest number of points allocated upfront when reading an index, more points grow the slice as they're read
+const maxIndexPointsPrealloc = 1024
+
+// zlib writes a 10 byte gzip header when no custom header is set
+const defaultGZipHeaderLen = 10
+
+var (
+	IndexFormatError = errors.New("invalid compressed index")
+)
+
+// IndexPoint is a position in the compressed stream from where uncompression can start
+type IndexPoint struct {
+	CompressedOffset   uint64
+	UncompressedOffset uint64
+}
+
+// CompressedIndex lists the full flush points of a gzip stream
+type CompressedIndex struct {
+	FlushInterval uint64
+	Points        []IndexPoint
+}
+
+// WriteTo writes the index to w in the sidecar format
+func (ci *CompressedIndex) WriteTo(w io.Writer) (n int64, err error) {
+	defer recoverPanic("CompressedIndex.WriteTo", &err)
+
+	data := make([]byte, 0, len(indexMagic)+1+(2+2*len(ci.Points))*binary.MaxVarintLen64)
+	data = append(data, indexMagic...)
+	data = append(data, indexVersion)
+	data = binary.AppendUvarint(data, ci.FlushInterval)
+	data = binary.AppendUvarint(data, uint64(len(ci.Points)))
+
+	previous := IndexPoint{}
+	for _, point := range ci.Points {
+		data = binary.AppendUvarint(data, point.CompressedOffset-previous.CompressedOffset)
+		data = binary.AppendUvarint(data, point.UncompressedOffset-previous.UncompressedOffset)
+		previous = point
+	}
+
+	written, err := w.Write(data)
+	return int64(written), err
+}
+
+// ReadCompressedIndex reads an index in the sidecar format from r
+func ReadCompressedIndex(r io.Reader) (index *CompressedIndex, err error) {
+	defer recoverPanic("ReadCompressedIndex", &err)
+
+	byteReader, isByteReader := r.(io.ByteReader)
+	if !isByteReader {
+		byteReader = bufio.NewReader(r)
+	}
+
+	header := make([]byte, len(indexMagic)+1)
+	for pos := range header {
+		value, err := byteReader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", IndexFormatError, err)
+		}
+		header[pos] = value
+	}
+
+	if string(header[:len(indexMagic)]) != string(indexMagic) || header[len(indexMagic)] != indexVersion {
+		return nil, IndexFormatError
+	}
+
+	values := make([]uint64, 2)
+	for pos := range values {
+		value, err := binary.ReadUvarint(byteReader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", IndexFormatError, err)
+		}
+		values[pos] = value
+	}
+
+	pointCount := values[1]
+	// don't trust the count for the allocation, the points are still validated one by one
+	capacity := pointCount
+	if capacity > maxIndexPointsPrealloc {
+		capacity = maxIndexPointsPrealloc
+	}
+	index = &CompressedIndex{FlushInterval: values[0], Points: make([]IndexPoint, 0, capacity)}
+	previous := IndexPoint{}
+	for pos := uint64(0); pos < pointCount; pos++ {
+		compressedDelta, cerr := binary.ReadUvarint(byteReader)
+		uncompressedDelta, uerr := binary.ReadUvarint(byteReader)
+		if cerr != nil || uerr != nil {
+			return nil, fmt.Errorf("%w: truncated points", IndexFormatError)
+		}
+
+		if compressedDelta > math.MaxUint64-previous.CompressedOffset || uncompressedDelta > math.MaxUint64-previous.UncompressedOffset {
+			return nil, fmt.Errorf("%w: offset overflow", IndexFormatError)
+		}
+
+		previous = IndexPoint{
+			CompressedOffset:   previous.CompressedOffset + compressedDelta,
+			UncompressedOffset: previous.UncompressedOffset + uncompressedDelta,
+		}
+		index.Points = append(index.Points, previous)
+	}
+
+	return index, nil
+}
+
+// Lookup returns the last point at or before the given uncompressed offset
+func (ci *CompressedIndex) Lookup(uncompressedOffset uint64) (point IndexPoint, err error) {
+	defer recoverPanic("CompressedIndex.Lookup", &err)
+
+	next := sort.Search(len(ci.Points), func(pos int) bool {
+		return ci.Points[pos].UncompressedOffset > uncompressedOffset
+	})
+
+	if next == 0 {
+		return IndexPoint{}, fmt.Errorf("%w: no point before offset %d", IndexFormatError, uncompressedOffset)
+	}
+
+	return ci.Points[next-1], nil
+}
+
+// IndexedCompressor is a gzip compressor that full flushes at regular intervals and records the flush points
+type IndexedCompressor struct {
+	*goGZipCompressor
+	index     CompressedIndex
+	written   uint64
+	nextFlush uint64
+}
+
+// NewIndexedCompressor creates a gzip compressor writing to output that full flushes every flushInterval uncompressed bytes
+// Each full flush costs some compression ratio, so the interval trades off random access granularity for size.
+func NewIndexedCompressor(output io.Writer, level CompressionLevel, flushInterval uint64, bufferSize uint32) (indexed *IndexedCompressor, err error) {
+	defer recoverPanic("NewIndexedCompressor", &err)
+
+	if flushInterval == 0 {
+		return nil, fmt.Errorf("%w: flush interval must be greater than zero", IndexFormatError)
+	}
+
+	compressor, err := newGoCompressor(output, TransformModeGZip, level, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	indexed = &IndexedCompressor{goGZipCompressor: compressor}
+	indexed.resetIndex(flushInterval)
+
+	return indexed, nil
+}
+
+// resetIndex starts a new index with the first point at the start of the compressed data
+func (ic *IndexedCompressor) resetIndex(flushInterval uint64) {
+	ic.index = CompressedIndex{
+		FlushInterval: flushInterval,
+		Points:        []IndexPoint{{CompressedOffset: defaultGZipHeaderLen, UncompressedOffset: 0}},
+	}
+	ic.written = 0
+	ic.nextFlush = flushInterval
+}
+
+// resetOutput starts a new stream written to output, with a new index
+func (ic *IndexedCompressor) resetOutput(output io.Writer) {
+	ic.goGZipCompressor.resetOutput(output)
+	ic.resetIndex(ic.index.FlushInterval)
+}
+
+// Write compresses data, full flushing the stream every time the flush interval is reached
+func (ic *IndexedCompressor) Write(data []byte) (n int, err error) {
+	defer recoverPanic("IndexedCompressor.Write", &err)
+
+	written := 0
+	for written < len(data) {
+		chunk := data[written:]
+		if uint64(len(chunk)) > ic.nextFlush-ic.written {
+			chunk = chunk[:ic.nextFlush-ic.written]
+		}
+
+		chunkWritten, err := ic.goGZipCompressor.Write(chunk)
+		written += chunkWritten
+		ic.written += uint64(chunkWritten)
+		if err != nil {
+			return written, err
+		}
+
+		if ic.written == ic.nextFlush {
+			ferr := ic.flushPoint()
+			if ferr != nil {
+				return written, ferr
+			}
+			ic.nextFlush += ic.index.FlushInterval
+		}
+	}
+
+	return written, nil
+}
+
+// WriteByte writes a single byte, counting it towards the flush interval
+func (ic *IndexedCompressor) WriteByte(c byte) (err error) {
+	defer recoverPanic("IndexedCompressor.WriteByte", &err)
+
+	_, err = ic.Write([]byte{c})
+	return err
+}
+
+// FullFlush full flushes the stream outside of the flush interval, recording the flush point in the index
+func (ic *IndexedCompressor) FullFlush() (err error) {
+	defer recoverPanic("IndexedCompressor.FullFlush", &err)
+
+	return ic.flushPoint()
+}
+
+// flushPoint full flushes the stream and records the flush point
+func (ic *IndexedCompressor) flushPoint() error {
+	ferr := ic.goGZipCompressor.FullFlush()
+	if ferr != nil {
+		return ferr
+	}
+
+	// flushing again without new data doesn't add a point
+	uncompressedOffset := uint64(ic.transformer.zs.total_in)
+	if ic.index.Points[len(ic.index.Points)-1].UncompressedOffset == uncompressedOffset {
+		return nil
+	}
+
+	ic.index.Points = append(ic.index.Points, IndexPoint{
+		CompressedOffset:   uint64(ic.transformer.zs.total_out),
+		UncompressedOffset: uncompressedOffset,
+	})
+
+	return nil
+}
+
+// Index returns a copy of the index of the flush points written so far
+func (ic *IndexedCompressor) Index() *CompressedIndex {
+	return &CompressedIndex{
+		FlushInterval: ic.index.FlushInterval,
+		Points:        append([]IndexPoint{}, ic.index.Points...),
+	}
+}
+
+// OpenAt returns an uncompressor reading the gzip stream in compressed from the given uncompressed offset, using index
+// to start at the closest flush point instead of uncompressing the stream from the beginning
+func OpenAt(compressed io.ReaderAt, index *CompressedIndex, offset uint64, bufferSize uint32) (reader io.ReadCloser, err error) {
+	defer recoverPanic("OpenAt", &err)
+
+	point, err := index.Lookup(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if point.CompressedOffset > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: compressed offset out of range", IndexFormatError)
+	}
+
+	section := io.NewSectionReader(compressed, int64(point.CompressedOffset), math.MaxInt64-int64(point.CompressedOffset))
+	uncompressor, err := newGoUncompressor(section, TransformModeRawUncompress, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	_, serr := uncompressor.Skip(int64(offset - point.UncompressedOffset))
+	if serr != nil {
+		uncompressor.Close()
+		return nil, serr
+	}
+
+	return uncompressor, nil
+}
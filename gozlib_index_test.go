@@ -0,0 +1,118 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexedCompressorRandomAccess(t *testing.T) {
+	data := makeTestData(100000)
+	compressed := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewIndexedCompressor(compressed, CompressionLevelBestSpeed, 8192, 4096)
+	assert.NoError(t, err)
+
+	for pos := 0; pos < len(data); pos += 3000 {
+		end := pos + 3000
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err = compressor.Write(data[pos:end])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, compressor.Close())
+
+	// the indexed stream is a regular gzip stream
+	stdUncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed.Bytes()), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, stdUncompressed)
+
+	sidecar := bytes.NewBuffer([]byte{})
+	_, err = compressor.Index().WriteTo(sidecar)
+	assert.NoError(t, err)
+
+	index, err := ReadCompressedIndex(sidecar)
+	assert.NoError(t, err)
+	assert.Equal(t, compressor.Index(), index)
+	assert.Equal(t, len(data)/8192+1, len(index.Points))
+
+	for _, offset := range []uint64{0, 8191, 8192, 50001, 99999} {
+		reader, err := OpenAt(bytes.NewReader(compressed.Bytes()), index, offset, 1024)
+		assert.NoError(t, err)
+
+		tail, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, data[offset:], tail)
+		assert.NoError(t, reader.Close())
+	}
+}
+
+func TestIndexedCompressorFullFlush(t *testing.T) {
+	data := makeTestData(30000)
+	compressed := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewIndexedCompressor(compressed, CompressionLevelBestSpeed, 8192, 4096)
+	assert.NoError(t, err)
+
+	// explicit full flushes are recorded in the index along with the interval ones
+	_, err = compressor.Write(data[:5000])
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.FullFlush())
+	assert.NoError(t, compressor.FullFlush())
+	_, err = compressor.Write(data[5000:])
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	index := compressor.Index()
+	assert.Equal(t, []uint64{0, 5000, 8192, 16384, 24576}, pointOffsets(index))
+
+	reader, err := OpenAt(bytes.NewReader(compressed.Bytes()), index, 6000, 1024)
+	assert.NoError(t, err)
+	tail, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data[6000:], tail)
+	assert.NoError(t, reader.Close())
+}
+
+func pointOffsets(index *CompressedIndex) []uint64 {
+	offsets := make([]uint64, 0, len(index.Points))
+	for _, point := range index.Points {
+		offsets = append(offsets, point.UncompressedOffset)
+	}
+	return offsets
+}
+
+func TestReadCompressedIndexInvalid(t *testing.T) {
+	_, err := ReadCompressedIndex(bytes.NewReader([]byte("GZIX")))
+	assert.ErrorIs(t, err, IndexFormatError)
+
+	_, err = ReadCompressedIndex(bytes.NewReader([]byte{'G', 'Z', 'I', 'X', 1, 10, 5, 1}))
+	assert.ErrorIs(t, err, IndexFormatError)
+
+	_, err = (&CompressedIndex{}).Lookup(0)
+	assert.ErrorIs(t, err, IndexFormatError)
+}
+
+func TestIndexedCompressorReset(t *testing.T) {
+	compressor, err := NewIndexedCompressor(bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed, 1000, 4096)
+	assert.NoError(t, err)
+	_, err = compressor.Write(makeTestData(5000))
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Flush())
+
+	data := makeTestData(3500)
+	compressed := bytes.NewBuffer([]byte{})
+	ResetCompressor(compressed, compressor)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	index := compressor.Index()
+	assert.Len(t, index.Points, 4)
+	uncompressed, err := stdLibGZipUncompress(compressed, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
@@ -0,0 +1,85 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+var (
+	ChecksumMismatchError = errors.New("checksum of the uncompressed data doesn't match the stream trailer")
+	LengthMismatchError   = errors.New("length of the uncompressed data doesn't match the stream trailer")
+)
+
+// IntegrityMode controls how uncompressors report streams failing integrity checks
+type IntegrityMode int
+
+const (
+	// IntegrityDefault fails with ChecksumMismatchError or LengthMismatchError if the trailer doesn't match the data,
+	// while input ending before the end of the stream ends reading with io.EOF
+	IntegrityDefault IntegrityMode = iota
+	// IntegrityStrict is like IntegrityDefault but input ending before the end of the stream fails with io.ErrUnexpectedEOF
+	IntegrityStrict
+	// IntegrityLenient ignores trailer mismatches, ending the stream as if they matched
+	IntegrityLenient
+)
+
+// SetIntegrityMode is a helper function to set how an uncompressor reports streams failing integrity checks
+// The mode is kept when the uncompressor is reset.
+func SetIntegrityMode(uncompressor io.ReadCloser, mode IntegrityMode) {
+	uncompressor.(*goUncompressor).integrityMode = mode
+}
+
+// integrityError is an uncompression error caused by a trailer mismatch
+// It matches both TransformerUncompressionError and the mismatch error with errors.Is.
+type integrityError struct {
+	mismatch error
+	code     int
+}
+
+func (ie *integrityError) Error() string {
+	return fmt.Sprintf("%s: %s ZLib error code %d", TransformerUncompressionError, ie.mismatch, ie.code)
+}
+
+func (ie *integrityError) Is(target error) bool {
+	return target == TransformerUncompressionError || target == ie.mismatch
+}
+
+// uncompressionError returns the error for a failed uncompression step, or nil if the failure is a trailer mismatch
+// ignored by the integrity mode, in which case the stream is ended
+func (unc *goUncompressor) uncompressionError(transformCode C.int) error {
+	var mismatch error
+	if transformCode == C.Z_DATA_ERROR && unc.transformer.zs.msg != nil {
+		switch C.GoString((*C.char)(unsafe.Pointer(unc.transformer.zs.msg))) {
+		case "incorrect data check":
+			mismatch = ChecksumMismatchError
+		case "incorrect length check":
+			mismatch = LengthMismatchError
+		}
+	}
+
+	if mismatch == nil {
+		return fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, transformCode)
+	}
+
+	if unc.integrityMode == IntegrityLenient {
+		unc.endStream()
+		return nil
+	}
+
+	return &integrityError{mismatch: mismatch, code: int(transformCode)}
+}
+
+// inputError returns the error for a failed input read, reporting truncated input in strict mode
+func (unc *goUncompressor) inputError(readErr error) error {
+	if readErr == io.EOF && !unc.ended && unc.integrityMode == IntegrityStrict {
+		return io.ErrUnexpectedEOF
+	}
+
+	return readErr
+}
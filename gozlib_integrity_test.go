@@ -0,0 +1,76 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUncompressorIntegrityErrors(t *testing.T) {
+	data := makeTestData(5000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	badChecksum := append([]byte{}, compressed...)
+	badChecksum[len(badChecksum)-8] ^= 0xff
+	badLength := append([]byte{}, compressed...)
+	badLength[len(badLength)-4] ^= 0xff
+	truncated := compressed[:len(compressed)-4]
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(badChecksum), 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, ChecksumMismatchError)
+	assert.ErrorIs(t, err, TransformerUncompressionError)
+	assert.NotErrorIs(t, err, LengthMismatchError)
+
+	ResetUncompressor(bytes.NewReader(badLength), uncompressor)
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, LengthMismatchError)
+
+	// truncation is only reported in strict mode
+	ResetUncompressor(bytes.NewReader(truncated), uncompressor)
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	SetIntegrityMode(uncompressor, IntegrityStrict)
+	ResetUncompressor(bytes.NewReader(truncated), uncompressor)
+	_, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	ResetUncompressor(bytes.NewReader(badChecksum), uncompressor)
+	_, err = Skip(uncompressor, 10000)
+	assert.ErrorIs(t, err, ChecksumMismatchError)
+}
+
+func TestUncompressorIntegrityLenient(t *testing.T) {
+	data := makeTestData(5000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+	badChecksum := append(append([]byte{}, compressed...), "trailing"...)
+	badChecksum[len(compressed)-8] ^= 0xff
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(badChecksum), 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+	SetIntegrityMode(uncompressor, IntegrityLenient)
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	ResetUncompressor(bytes.NewReader(badChecksum), uncompressor)
+	skipped, err := Skip(uncompressor, 10000)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, int64(len(data)), skipped)
+}
@@ -0,0 +1,73 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import "io"
+
+// Memory footprint
+// zlib documents the memory used by its streams in zconf.h: deflate allocates (1 << (windowBits+2)) + (1 << (memLevel+9))
+// bytes for its window, hash chains and pending output while inflate allocates a 1 << windowBits bytes window, once
+// it produces output. Both also allocate their internal state, which isn't visible outside zlib, so its size is
+// estimated from zlib 1.2.13 on 64 bit platforms.
+
+const (
+	// deflateStateSize is the approximate size of the zlib deflate_state struct
+	deflateStateSize = 5952
+	// inflateStateSize is the approximate size of the zlib inflate_state struct
+	inflateStateSize = 7160
+)
+
+// TransformerMemory is the memory held in native code by a compressor or uncompressor
+type TransformerMemory struct {
+	// Buffers is the size of the work buffers allocated by the transformer, including the read ahead buffer of
+	// uncompressors once small reads were requested
+	Buffers uint64
+	// Stream is the estimated size of the zlib stream, its internal state and window
+	Stream uint64
+}
+
+// Total returns the memory held by the transformer
+func (tm TransformerMemory) Total() uint64 {
+	return tm.Buffers + tm.Stream
+}
+
+type memoryReporter interface {
+	MemoryFootprint() TransformerMemory
+}
+
+// MemoryFootprint is a helper function returning the memory held in native code by a compressor or uncompressor
+// given an interface, which can be used to bound the number of concurrent transformers by the memory available.
+// The returned memory is zero for types not created by this package.
+func MemoryFootprint(transformer io.Closer) TransformerMemory {
+	reporter, isReporter := transformer.(memoryReporter)
+	if !isReporter {
+		return TransformerMemory{}
+	}
+
+	return reporter.MemoryFootprint()
+}
+
+// MemoryFootprint returns the memory held in native code by the compressor
+func (comp *goGZipCompressor) MemoryFootprint() TransformerMemory {
+	return TransformerMemory{
+		Buffers: uint64(comp.transformer.work_buffer_cap) + smallWriteBufferSize,
+		Stream:  C.sizeof_z_stream + deflateStateSize + 1<<(comp.windowBits+2) + 1<<(C.MAX_MEM_LEVEL+9),
+	}
+}
+
+// MemoryFootprint returns the memory held in native code by the uncompressor
+// The window is counted even before the uncompressor produced any output.
+func (unc *goUncompressor) MemoryFootprint() TransformerMemory {
+	// raw streams use negative window bits while gzip and automatic header detection add 16 or 32 to them
+	windowBits := unc.windowBits
+	if windowBits < 0 {
+		windowBits = -windowBits
+	}
+
+	return TransformerMemory{
+		Buffers: uint64(unc.transformer.work_buffer_cap) + uint64(cap(unc.readAhead)),
+		Stream:  C.sizeof_z_stream + inflateStateSize + 1<<(windowBits&15),
+	}
+}
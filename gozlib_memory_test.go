@@ -0,0 +1,55 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressorMemoryFootprint(t *testing.T) {
+	compressor, err := NewGoGZipCompressor(io.Discard, CompressionLevelBestSpeed, 4096)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	memory := MemoryFootprint(compressor)
+	assert.Equal(t, uint64(4096+smallWriteBufferSize), memory.Buffers)
+	// 128KB of window and hash chains and 256KB of hash table and pending output
+	assert.Greater(t, memory.Stream, uint64(1<<17+1<<18))
+	assert.Less(t, memory.Stream, uint64(1<<17+1<<18+16*1024))
+	assert.Equal(t, memory.Buffers+memory.Stream, memory.Total())
+
+	// smaller windows use less memory
+	small, err := NewPNGCompressor(func([]byte) error { return nil }, CompressionLevelBestSpeed, 9, 1024, 4096)
+	require.NoError(t, err)
+	defer small.Close()
+	assert.Equal(t, memory.Stream-(1<<17-1<<11), MemoryFootprint(small).Stream)
+}
+
+func TestUncompressorMemoryFootprint(t *testing.T) {
+	compressed, err := stdLibGZipCompressSlice(makeTestData(10000))
+	require.NoError(t, err)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed), 2048)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	memory := MemoryFootprint(uncompressor)
+	assert.Equal(t, uint64(2048), memory.Buffers)
+	assert.Greater(t, memory.Stream, uint64(1<<15))
+	assert.Less(t, memory.Stream, uint64(1<<15+16*1024))
+
+	// small reads allocate the read ahead buffer
+	_, err = uncompressor.Read(make([]byte, 10))
+	require.NoError(t, err)
+	assert.Greater(t, MemoryFootprint(uncompressor).Buffers, memory.Buffers)
+
+	raw, err := newGoUncompressor(nil, TransformModeRawUncompress, 2048)
+	require.NoError(t, err)
+	defer raw.Close()
+	assert.Equal(t, memory.Stream, raw.MemoryFootprint().Stream)
+
+	assert.Equal(t, TransformerMemory{}, MemoryFootprint(io.NopCloser(nil)))
+}
@@ -0,0 +1,234 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Length prefixed compressed messages
+// Each message is written as an unsigned varint with the length of the compressed payload, followed by the payload compressed in gzip format.
+// The uncompressed length is not part of the frame, it's recovered from the gzip trailer when reading the message.
+
+// MaxMessageSize is the maximum size of a message payload, compressed or uncompressed
+const MaxMessageSize = 1 << 30
+
+// the gzip wrapper is 12 bytes larger than the zlib wrapper accounted for in compressBound
+const gzipWrapperExtraLen = 12
+
+// gzip stores the uncompressed length modulo 2^32 in the last 4 bytes of the stream
+const gzipTrailerSizeLen = 4
+
+// deflate can't expand data by more than 1032 times
+const maxDeflateExpansion = 1032
+
+var (
+	MessageTooLargeError = errors.New("message larger than the maximum message size")
+	MessageFormatError   = errors.New("invalid message format")
+)
+
+// buffers larger than this are dropped instead of being pooled, so a few large messages don't keep memory held
+const maxPooledMessageBufferSize = 1 << 18
+
+var messageBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 1024)
+		return &buffer
+	},
+}
+
+func acquireMessageBuffer(size int) *[]byte {
+	buffer := messageBufferPool.Get().(*[]byte)
+	if cap(*buffer) < size {
+		*buffer = make([]byte, 0, size)
+	}
+
+	return buffer
+}
+
+func releaseMessageBuffer(buffer *[]byte) {
+	if cap(*buffer) > maxPooledMessageBufferSize {
+		return
+	}
+
+	messageBufferPool.Put(buffer)
+}
+
+// messageStreamPool keeps idle gzip deflate streams per compression level, reset and ready to compress a new message
+// Like TransformerPool, streams released once the pool is full are closed instead of being dropped.
+type messageStreamPool struct {
+	mutex   sync.Mutex
+	maxIdle int
+	idle    map[CompressionLevel][]*nativeStream
+}
+
+var messageStreams = &messageStreamPool{
+	maxIdle: runtime.GOMAXPROCS(0) * 2,
+	idle:    map[CompressionLevel][]*nativeStream{},
+}
+
+func (msp *messageStreamPool) acquire(level CompressionLevel) (*nativeStream, error) {
+	msp.mutex.Lock()
+	idle := msp.idle[level]
+	if len(idle) > 0 {
+		stream := idle[len(idle)-1]
+		msp.idle[level] = idle[:len(idle)-1]
+		msp.mutex.Unlock()
+		return stream, nil
+	}
+	msp.mutex.Unlock()
+
+	return newDeflateStream(level, C.COMPRESS_GZIP_WINDOW_BITS, C.Z_DEFAULT_STRATEGY)
+}
+
+func (msp *messageStreamPool) release(level CompressionLevel, stream *nativeStream) {
+	stream.reset()
+
+	msp.mutex.Lock()
+	defer msp.mutex.Unlock()
+
+	if len(msp.idle[level]) >= msp.maxIdle {
+		stream.close()
+		return
+	}
+	msp.idle[level] = append(msp.idle[level], stream)
+}
+
+// closeIdle closes all idle streams
+func (msp *messageStreamPool) closeIdle() {
+	msp.mutex.Lock()
+	defer msp.mutex.Unlock()
+
+	for level, idle := range msp.idle {
+		for _, stream := range idle {
+			stream.close()
+		}
+		delete(msp.idle, level)
+	}
+}
+
+// WriteMessage compresses payload and writes it to w as a single length prefixed message
+// The deflate state is taken from an internal pool and reset after each message, so no native state is initialized per call.
+// The function returns the total number of bytes written to w, including the length prefix, and an error, if any.
+func WriteMessage(w io.Writer, level CompressionLevel, payload []byte) (n int, err error) {
+	defer recoverPanic("WriteMessage", &err)
+
+	if len(payload) > MaxMessageSize {
+		return 0, MessageTooLargeError
+	}
+
+	stream, err := messageStreams.acquire(level)
+	if err != nil {
+		return 0, err
+	}
+	defer messageStreams.release(level, stream)
+
+	compressBound := int(C.compressBound(C.uLong(len(payload)))) + gzipWrapperExtraLen
+	buffer := acquireMessageBuffer(binary.MaxVarintLen64 + compressBound)
+	defer releaseMessageBuffer(buffer)
+
+	// leave room for the length prefix and compress the payload right after it
+	frame := (*buffer)[:cap(*buffer)]
+	compressed := frame[binary.MaxVarintLen64:]
+	// with room for the worst case compressed size, the whole payload is compressed in a single step
+	consumed, compLen, resultCode := stream.step(payload, compressed, C.Z_FINISH)
+	if resultCode != C.Z_STREAM_END || consumed != len(payload) {
+		return 0, fmt.Errorf(wrapErrorFormat, BufferCompressError, resultCode)
+	}
+
+	var prefix [binary.MaxVarintLen64]byte
+	prefixLen := binary.PutUvarint(prefix[:], uint64(compLen))
+	frameStart := binary.MaxVarintLen64 - prefixLen
+	copy(frame[frameStart:], prefix[:prefixLen])
+
+	return w.Write(frame[frameStart : binary.MaxVarintLen64+compLen])
+}
+
+type singleByteReader struct {
+	reader io.Reader
+	data   [1]byte
+}
+
+func (sbr *singleByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(sbr.reader, sbr.data[:])
+	return sbr.data[0], err
+}
+
+// ReadMessage reads a single message written by WriteMessage from r, appending the uncompressed payload to dst
+// and returning the extended slice.
+// If r implements io.ByteReader, no data past the end of the message is read from it.
+// ReadMessage returns io.EOF if no message could be read and io.ErrUnexpectedEOF if the message is truncated.
+func ReadMessage(r io.Reader, dst []byte) (message []byte, err error) {
+	defer recoverPanic("ReadMessage", &err)
+
+	byteReader, isByteReader := r.(io.ByteReader)
+	if !isByteReader {
+		byteReader = &singleByteReader{reader: r}
+	}
+
+	compLen, lerr := binary.ReadUvarint(byteReader)
+	if lerr != nil {
+		return dst, lerr
+	}
+
+	if compLen > MaxMessageSize {
+		return dst, MessageTooLargeError
+	}
+
+	if compLen < gzipTrailerSizeLen {
+		return dst, MessageFormatError
+	}
+
+	// the length prefix isn't trusted, the buffer only grows with the data actually read
+	buffer := acquireMessageBuffer(0)
+	defer releaseMessageBuffer(buffer)
+
+	var rerr error
+	*buffer, rerr = readAppend((*buffer)[:0], r, int64(compLen))
+	if rerr != nil {
+		return dst, rerr
+	}
+	// the buffer can have more capacity than the payload and the input is sized by its capacity
+	compressed := (*buffer)[:compLen:compLen]
+
+	// the trailer length is only a hint, it can't be more than what the received payload can expand to
+	uncompLen := binary.LittleEndian.Uint32(compressed[compLen-gzipTrailerSizeLen:])
+	if uncompLen > MaxMessageSize {
+		return dst, MessageTooLargeError
+	}
+	if uint64(uncompLen) > compLen*maxDeflateExpansion {
+		return dst, MessageFormatError
+	}
+
+	dstLen := len(dst)
+	if cap(dst)-dstLen < int(uncompLen) {
+		grown := make([]byte, dstLen, dstLen+int(uncompLen))
+		copy(grown, dst)
+		dst = grown
+	}
+
+	// the uncompressed output needs at least one byte to hold data, even for an empty payload
+	var emptyPayload [1]byte
+	output := dst[dstLen : dstLen+int(uncompLen) : dstLen+int(uncompLen)]
+	if uncompLen == 0 {
+		output = emptyPayload[:0:1]
+	}
+
+	written, uerr := GoUncompressBuffer(compressed, output)
+	if uerr != nil {
+		return dst, uerr
+	}
+
+	if written != uint64(uncompLen) {
+		return dst, MessageFormatError
+	}
+
+	return dst[:dstLen+int(uncompLen)], nil
+}
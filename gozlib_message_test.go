@@ -0,0 +1,126 @@
+package gozlib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReadMessages(t *testing.T) {
+	messages := [][]byte{makeTestData(1024), {}, makeTestData(1), makeTestData(70000)}
+	framed := bytes.NewBuffer([]byte{})
+
+	for _, message := range messages {
+		written, err := WriteMessage(framed, CompressionLevelBestSpeed, message)
+		assert.NoError(t, err)
+		assert.Greater(t, written, 0)
+	}
+
+	// a reader that isn't an io.ByteReader must not lose data between messages
+	reader := io.MultiReader(framed)
+	for _, message := range messages {
+		uncompressed, err := ReadMessage(reader, nil)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(message, uncompressed))
+	}
+
+	_, err := ReadMessage(reader, nil)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestWriteMessageReusesNativeStreams(t *testing.T) {
+	messageStreams.closeIdle()
+	framed := bytes.NewBuffer([]byte{})
+	messages := [][]byte{makeTestData(100), makeTestData(200)}
+
+	_, err := WriteMessage(framed, CompressionLevelBestSpeed, messages[0])
+	assert.NoError(t, err)
+	assert.Len(t, messageStreams.idle[CompressionLevelBestSpeed], 1)
+	stream := messageStreams.idle[CompressionLevelBestSpeed][0]
+
+	_, err = WriteMessage(framed, CompressionLevelBestSpeed, messages[1])
+	assert.NoError(t, err)
+	assert.Equal(t, []*nativeStream{stream}, messageStreams.idle[CompressionLevelBestSpeed])
+
+	for _, expected := range messages {
+		message, err := ReadMessage(framed, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, message)
+	}
+}
+
+func TestReadMessageAfterLargerMessage(t *testing.T) {
+	framed := bytes.NewBuffer([]byte{})
+	// the compressed payload of the first message is larger than the second one, leaving a larger buffer in the pool
+	messages := [][]byte{makeTestData(5000), makeTestData(10)}
+	for _, message := range messages {
+		_, err := WriteMessage(framed, CompressionLevelBestSpeed, message)
+		assert.NoError(t, err)
+	}
+
+	for _, message := range messages {
+		uncompressed, err := ReadMessage(framed, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, message, uncompressed)
+	}
+}
+
+func TestReadMessageAppendsToDestination(t *testing.T) {
+	message := makeTestData(300)
+	framed := bytes.NewBuffer([]byte{})
+
+	_, err := WriteMessage(framed, CompressionLevelBestCompression, message)
+	assert.NoError(t, err)
+
+	prefix := []byte("prefix")
+	result, err := ReadMessage(bufio.NewReader(framed), prefix)
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte("prefix"), message...), result)
+}
+
+func TestReadMessageFailTruncated(t *testing.T) {
+	framed := bytes.NewBuffer([]byte{})
+
+	_, err := WriteMessage(framed, CompressionLevelBestCompression, makeTestData(500))
+	assert.NoError(t, err)
+
+	truncated := framed.Bytes()[:framed.Len()-10]
+	_, err = ReadMessage(bytes.NewBuffer(truncated), nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReadMessageFailInvalidPayload(t *testing.T) {
+	framed := []byte{100}
+	framed = append(framed, makeTestData(100)...)
+
+	_, err := ReadMessage(bytes.NewBuffer(framed), nil)
+	assert.Error(t, err)
+}
+
+func TestReadMessageLengthsNotTrusted(t *testing.T) {
+	// a prefix claiming the maximum message size, followed by a few bytes only
+	framed := binary.AppendUvarint(nil, MaxMessageSize)
+	framed = append(framed, make([]byte, 100)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := ReadMessage(bytes.NewBuffer(framed), nil)
+	runtime.ReadMemStats(&after)
+
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+
+	// a trailer claiming more data than the payload can hold
+	message := bytes.NewBuffer([]byte{})
+	_, err = WriteMessage(message, CompressionLevelBestSpeed, []byte("small"))
+	assert.NoError(t, err)
+	binary.LittleEndian.PutUint32(message.Bytes()[message.Len()-gzipTrailerSizeLen:], MaxMessageSize)
+
+	_, err = ReadMessage(message, nil)
+	assert.ErrorIs(t, err, MessageFormatError)
+}
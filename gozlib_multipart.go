@@ -0,0 +1,213 @@
+package gozlib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// Compressed multipart bodies
+// Each compressed part declares its encoding in its own Content-Encoding header, so a single body can mix compressed and
+// uncompressed parts. Compressors and uncompressors are drawn from the shared transformer pool, one per part.
+
+const contentEncodingHeader = "Content-Encoding"
+
+var (
+	MultipartPartClosedError = errors.New("multipart part is closed")
+)
+
+// MultipartWriter writes multipart bodies with parts compressed in gzip format on the fly
+// All methods of multipart.Writer are available to write uncompressed parts and to end the body.
+type MultipartWriter struct {
+	*multipart.Writer
+	level       CompressionLevel
+	currentPart *compressedPartWriter
+}
+
+// NewMultipartWriter creates a new multipart writer writing to w, compressing parts with the given level
+func NewMultipartWriter(w io.Writer, level CompressionLevel) *MultipartWriter {
+	return &MultipartWriter{
+		Writer:      multipart.NewWriter(w),
+		level:       level,
+		currentPart: nil,
+	}
+}
+
+type compressedPartWriter struct {
+	compressor io.WriteCloser
+}
+
+func (cpw *compressedPartWriter) Write(data []byte) (n int, err error) {
+	defer recoverPanic("compressed part Write", &err)
+
+	if cpw.compressor == nil {
+		return 0, MultipartPartClosedError
+	}
+
+	return cpw.compressor.Write(data)
+}
+
+// Close ends the compressed data of the part and returns the compressor to the pool
+func (cpw *compressedPartWriter) Close() (err error) {
+	defer recoverPanic("compressed part Close", &err)
+
+	if cpw.compressor == nil {
+		return nil
+	}
+
+	compressor := cpw.compressor
+	cpw.compressor = nil
+	defer defaultTransformerPool().ReleaseCompressor(compressor)
+
+	_, err = Finish(compressor)
+	return err
+}
+
+// CreateCompressedPart creates a new part with the given header and a gzip Content-Encoding, returning a writer for its uncompressed content
+// The part must be closed to end its compressed data. A part still open is closed when the next part is created or the writer is closed.
+func (mw *MultipartWriter) CreateCompressedPart(header textproto.MIMEHeader) (part io.WriteCloser, err error) {
+	defer recoverPanic("MultipartWriter.CreateCompressedPart", &err)
+
+	cerr := mw.closeCurrentPart()
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	header.Set(contentEncodingHeader, "gzip")
+	partWriter, err := mw.Writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+
+	compressor, err := defaultTransformerPool().AcquireCompressor(partWriter, mw.level)
+	if err != nil {
+		return nil, err
+	}
+
+	mw.currentPart = &compressedPartWriter{compressor: compressor}
+	return mw.currentPart, nil
+}
+
+// CreateCompressedFormFile is a convenience wrapper around CreateCompressedPart creating a form-data file part
+func (mw *MultipartWriter) CreateCompressedFormFile(fieldName string, fileName string) (part io.WriteCloser, err error) {
+	defer recoverPanic("MultipartWriter.CreateCompressedFormFile", &err)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(fieldName), escapeQuotes(fileName)))
+	header.Set("Content-Type", "application/octet-stream")
+
+	return mw.CreateCompressedPart(header)
+}
+
+// CreatePart creates a new uncompressed part, closing the current compressed part if there's one
+func (mw *MultipartWriter) CreatePart(header textproto.MIMEHeader) (part io.Writer, err error) {
+	defer recoverPanic("MultipartWriter.CreatePart", &err)
+
+	cerr := mw.closeCurrentPart()
+	if cerr != nil {
+		return nil, cerr
+	}
+
+	return mw.Writer.CreatePart(header)
+}
+
+// Close closes the current compressed part, if there's one, and ends the multipart body
+func (mw *MultipartWriter) Close() (err error) {
+	defer recoverPanic("MultipartWriter.Close", &err)
+
+	cerr := mw.closeCurrentPart()
+	if cerr != nil {
+		return cerr
+	}
+
+	return mw.Writer.Close()
+}
+
+func (mw *MultipartWriter) closeCurrentPart() error {
+	if mw.currentPart == nil {
+		return nil
+	}
+
+	err := mw.currentPart.Close()
+	mw.currentPart = nil
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+type uncompressedPartReader struct {
+	uncompressor io.ReadCloser
+	// pooled is true if the uncompressor must be returned to the default pool instead of closed
+	pooled bool
+}
+
+func (upr *uncompressedPartReader) Read(output []byte) (n int, err error) {
+	defer recoverPanic("uncompressed part Read", &err)
+
+	if upr.uncompressor == nil {
+		return 0, MultipartPartClosedError
+	}
+
+	return upr.uncompressor.Read(output)
+}
+
+// Close returns the uncompressor to the pool or closes it. The part itself is not consumed.
+func (upr *uncompressedPartReader) Close() (err error) {
+	defer recoverPanic("uncompressed part Close", &err)
+
+	if upr.uncompressor != nil && upr.pooled {
+		defaultTransformerPool().ReleaseUncompressor(upr.uncompressor)
+	} else if upr.uncompressor != nil {
+		err = upr.uncompressor.Close()
+	}
+	upr.uncompressor = nil
+
+	return err
+}
+
+// OpenPart returns a reader for the uncompressed content of a multipart part
+// Parts with a gzip or deflate Content-Encoding are uncompressed on the fly, other parts are returned as is.
+// The reader must be closed once the part is read.
+func OpenPart(part *multipart.Part) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("OpenPart", &err)
+
+	switch strings.ToLower(strings.TrimSpace(part.Header.Get(contentEncodingHeader))) {
+	case "gzip", "x-gzip":
+		uncompressor, err := defaultTransformerPool().AcquireUncompressor(part)
+		if err != nil {
+			return nil, err
+		}
+		return &uncompressedPartReader{uncompressor: uncompressor, pooled: true}, nil
+	case "deflate":
+		sniffed, raw, err := sniffDeflate(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if !raw {
+			uncompressor, aerr := defaultTransformerPool().AcquireUncompressor(sniffed)
+			if aerr != nil {
+				return nil, aerr
+			}
+			return &uncompressedPartReader{uncompressor: uncompressor, pooled: true}, nil
+		}
+
+		uncompressor, err := newGoUncompressor(sniffed, TransformModeRawUncompress, GetDefaults().UncompressorBufferSize)
+		if err != nil {
+			return nil, err
+		}
+		return &uncompressedPartReader{uncompressor: uncompressor, pooled: false}, nil
+	case "", "identity":
+		return io.NopCloser(part), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported part content encoding %s", StreamUncompressError, part.Header.Get(contentEncodingHeader))
+	}
+}
@@ -0,0 +1,57 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartCompressedParts(t *testing.T) {
+	first := makeTestData(20000)
+	second := []byte("plain part")
+	third := makeTestData(100)
+
+	body := bytes.NewBuffer([]byte{})
+	writer := NewMultipartWriter(body, CompressionLevelBestSpeed)
+
+	part, err := writer.CreateCompressedFormFile("upload", "first.bin")
+	assert.NoError(t, err)
+	_, err = part.Write(first)
+	assert.NoError(t, err)
+	assert.NoError(t, part.Close())
+
+	plain, err := writer.CreatePart(textproto.MIMEHeader{"Content-Disposition": {`form-data; name="plain"`}})
+	assert.NoError(t, err)
+	_, err = plain.Write(second)
+	assert.NoError(t, err)
+
+	// the last part is closed by the writer
+	part, err = writer.CreateCompressedFormFile("upload", "third.bin")
+	assert.NoError(t, err)
+	_, err = part.Write(third)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	_, err = part.Write(third)
+	assert.ErrorIs(t, err, MultipartPartClosedError)
+
+	reader := multipart.NewReader(body, writer.Boundary())
+	for _, expected := range [][]byte{first, second, third} {
+		nextPart, err := reader.NextPart()
+		assert.NoError(t, err)
+
+		partReader, err := OpenPart(nextPart)
+		assert.NoError(t, err)
+		content, err := io.ReadAll(partReader)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, content)
+		assert.NoError(t, partReader.Close())
+	}
+
+	_, err = reader.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+}
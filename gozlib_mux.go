@@ -0,0 +1,370 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Stream multiplexing
+// A Mux carries several independent logical streams over a single writer, as done by tunnel protocols. Each logical
+// stream is compressed in zlib format by its own native stream and written as a sequence of frames, made of an unsigned
+// varint with the stream id, an unsigned varint with the payload length and the payload. Payloads end at a sync flush
+// point so every frame can be uncompressed as soon as it's received, and frames of different streams can be interleaved.
+// The last frame of a logical stream ends its zlib stream, after which its id can be used again.
+
+// MaxMuxFrameSize is the maximum size of a frame payload accepted by a Demux
+const MaxMuxFrameSize = 1 << 20
+
+// MaxMuxFrameDataSize is the maximum size of the uncompressed data of a frame accepted by a Demux
+// Frames written by a Mux carry at most 16KB, the limit keeps a peer from making a small payload uncompress to large
+// amounts of memory.
+const MaxMuxFrameDataSize = 1 << 20
+
+// MaxMuxOpenStreams is the maximum number of logical streams a Demux keeps open at the same time
+// Each open logical stream holds a native inflate stream, so the limit bounds the memory a peer can make a Demux hold.
+const MaxMuxOpenStreams = 1 << 10
+
+// largest amount of uncompressed data carried by a single frame, so long writes don't hold back the other streams
+// and payloads stay well below MaxMuxFrameSize
+const muxChunkSize = 1 << 14
+
+// the frame header is made of two unsigned varints up to 32 bits long
+const muxHeaderMaxLen = 2 * binary.MaxVarintLen32
+
+var (
+	MuxStreamInUseError  = errors.New("multiplexed stream id already in use")
+	MuxStreamClosedError = errors.New("multiplexed stream is closed")
+	MuxClosedError       = errors.New("multiplexer is closed")
+	MuxFrameError        = errors.New("invalid multiplexed frame")
+)
+
+// Mux writes several compressed logical streams to a single writer
+// Logical streams can be written concurrently from different goroutines, frames are written to the writer one at a time.
+// A single logical stream is not safe for concurrent use.
+type Mux struct {
+	level CompressionLevel
+
+	mu      sync.Mutex
+	output  io.Writer
+	streams map[uint32]*muxStream
+	closed  bool
+	// err is the first error writing to output, after which frame boundaries can't be trusted anymore
+	err error
+}
+
+// NewMux creates a multiplexer writing frames to output, compressing the logical streams with the given level
+func NewMux(output io.Writer, level CompressionLevel) (mux *Mux, err error) {
+	defer recoverPanic("NewMux", &err)
+
+	lerr := level.validate()
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	return &Mux{
+		level:   level,
+		output:  output,
+		streams: map[uint32]*muxStream{},
+	}, nil
+}
+
+// Stream opens the logical stream with the given id, returning a writer for its data
+// Every Write call sends the written data in one or more frames. Closing the writer sends the final frame of the
+// stream and releases its native resources, but doesn't close the underlying writer.
+func (m *Mux) Stream(id uint32) (writer io.WriteCloser, err error) {
+	defer recoverPanic("Mux.Stream", &err)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, MuxClosedError
+	}
+
+	if _, inUse := m.streams[id]; inUse {
+		return nil, MuxStreamInUseError
+	}
+
+	deflater, err := newDeflateStream(m.level, C.MAX_WBITS, C.Z_DEFAULT_STRATEGY)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &muxStream{mux: m, id: id, deflater: deflater}
+	m.streams[id] = stream
+	return stream, nil
+}
+
+// Close ends all logical streams still open, sending their final frames. The underlying writer isn't closed
+// Close must not be called while logical streams are being written.
+func (m *Mux) Close() (err error) {
+	defer recoverPanic("Mux.Close", &err)
+
+	m.mu.Lock()
+	m.closed = true
+	open := make([]*muxStream, 0, len(m.streams))
+	for _, stream := range m.streams {
+		open = append(open, stream)
+	}
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, stream := range open {
+		err := stream.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// writeFrame writes a frame to the output, frame starting with muxHeaderMaxLen bytes reserved for the header
+func (m *Mux) writeFrame(id uint32, frame []byte) error {
+	payloadLen := len(frame) - muxHeaderMaxLen
+
+	var header [muxHeaderMaxLen]byte
+	headerLen := binary.PutUvarint(header[:], uint64(id))
+	headerLen += binary.PutUvarint(header[headerLen:], uint64(payloadLen))
+	frameStart := muxHeaderMaxLen - headerLen
+	copy(frame[frameStart:], header[:headerLen])
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	_, werr := m.output.Write(frame[frameStart:])
+	m.err = werr
+	return werr
+}
+
+func (m *Mux) removeStream(id uint32) {
+	m.mu.Lock()
+	delete(m.streams, id)
+	m.mu.Unlock()
+}
+
+type muxStream struct {
+	mux      *Mux
+	id       uint32
+	deflater *nativeStream
+	frame    []byte
+}
+
+func (ms *muxStream) Write(data []byte) (n int, err error) {
+	defer recoverPanic("Mux stream Write", &err)
+
+	if ms.deflater == nil {
+		return 0, MuxStreamClosedError
+	}
+
+	written := 0
+	for written < len(data) {
+		chunk := data[written:]
+		if len(chunk) > muxChunkSize {
+			chunk = chunk[:muxChunkSize]
+		}
+
+		err := ms.sendFrame(chunk, C.Z_SYNC_FLUSH)
+		if err != nil {
+			return written, err
+		}
+		written += len(chunk)
+	}
+
+	return written, nil
+}
+
+// Close sends the final frame of the logical stream and releases its native resources
+func (ms *muxStream) Close() (err error) {
+	defer recoverPanic("Mux stream Close", &err)
+
+	if ms.deflater == nil {
+		return nil
+	}
+
+	err = ms.sendFrame(nil, C.Z_FINISH)
+	ms.deflater.close()
+	ms.deflater = nil
+	ms.mux.removeStream(ms.id)
+	return err
+}
+
+// sendFrame compresses data up to a sync flush or the end of the stream and writes it as a single frame
+func (ms *muxStream) sendFrame(data []byte, flush C.int) error {
+	frame := ensureSpareCapacity(ms.frame[:0], muxHeaderMaxLen)[:muxHeaderMaxLen]
+	input := data
+
+	for {
+		frame = ensureSpareCapacity(frame, wireFlushReserve+len(input))
+		spare := cap(frame) - len(frame)
+
+		consumed, produced, resultCode := ms.deflater.step(input, frame[len(frame):cap(frame)], flush)
+		frame = frame[:len(frame)+produced]
+		input = input[consumed:]
+
+		if resultCode == C.Z_STREAM_END {
+			break
+		}
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+			return fmt.Errorf(wrapErrorFormat, TransformerCompressionError, resultCode)
+		}
+
+		// a sync flush is complete once all input is consumed and there's output space left
+		if flush == C.Z_SYNC_FLUSH && len(input) == 0 && produced < spare {
+			break
+		}
+	}
+
+	ms.frame = frame
+	return ms.mux.writeFrame(ms.id, frame)
+}
+
+// MuxFrame is a frame of a logical stream read by a Demux
+type MuxFrame struct {
+	// StreamID is the id of the logical stream the frame belongs to
+	StreamID uint32
+	// Data is the uncompressed data of the frame
+	Data []byte
+	// End is true for the last frame of the logical stream
+	End bool
+}
+
+// Demux reads the frames written by a Mux, uncompressing each logical stream with its own native stream
+// A Demux is not safe for concurrent use and Close must be called to release the native resources of the logical
+// streams that didn't end.
+type Demux struct {
+	input      io.Reader
+	byteReader io.ByteReader
+	streams    map[uint32]*nativeStream
+	payload    []byte
+}
+
+// NewDemux creates a demultiplexer reading frames from input
+// No data past the end of the last frame read is read from input. When input doesn't implement io.ByteReader, frame
+// headers are read one byte at a time, so unbuffered inputs like network connections should be wrapped in a bufio.Reader.
+func NewDemux(input io.Reader) *Demux {
+	byteReader, isByteReader := input.(io.ByteReader)
+	if !isByteReader {
+		byteReader = &singleByteReader{reader: input}
+	}
+
+	return &Demux{
+		input:      input,
+		byteReader: byteReader,
+		streams:    map[uint32]*nativeStream{},
+	}
+}
+
+// ReadFrame reads the next frame, appending its uncompressed data to dst and returning it in the Data field of the frame
+// ReadFrame returns io.EOF if there are no more frames and io.ErrUnexpectedEOF if the frame is truncated.
+func (d *Demux) ReadFrame(dst []byte) (muxFrame MuxFrame, err error) {
+	defer recoverPanic("Demux.ReadFrame", &err)
+
+	id, err := binary.ReadUvarint(d.byteReader)
+	if err != nil {
+		return MuxFrame{Data: dst}, err
+	}
+
+	payloadLen, err := binary.ReadUvarint(d.byteReader)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return MuxFrame{Data: dst}, err
+	}
+
+	if id > 1<<32-1 || payloadLen > MaxMuxFrameSize {
+		return MuxFrame{Data: dst}, MuxFrameError
+	}
+
+	frame := MuxFrame{StreamID: uint32(id), Data: dst}
+
+	inflater, open := d.streams[frame.StreamID]
+	if !open && len(d.streams) >= MaxMuxOpenStreams {
+		return frame, fmt.Errorf("%w: more than %d open streams", MuxFrameError, MaxMuxOpenStreams)
+	}
+
+	// the payload length comes from the input, so the buffer only grows with the data actually read
+	d.payload, err = readAppend(d.payload[:0], d.input, int64(payloadLen))
+	if err != nil {
+		return frame, err
+	}
+
+	if !open {
+		inflater, err = newInflateStream(C.MAX_WBITS)
+		if err != nil {
+			return frame, err
+		}
+		d.streams[frame.StreamID] = inflater
+	}
+
+	frame.Data, frame.End, err = uncompressMuxPayload(inflater, dst, d.payload)
+	if err != nil || frame.End {
+		inflater.close()
+		delete(d.streams, frame.StreamID)
+	}
+
+	return frame, err
+}
+
+// uncompressMuxPayload uncompresses a frame payload, returning dst extended with the uncompressed data and whether the
+// payload ended the logical stream
+func uncompressMuxPayload(inflater *nativeStream, dst []byte, payload []byte) ([]byte, bool, error) {
+	dstLen := len(dst)
+	input := payload
+	// one extra byte detects frames uncompressing to more data than allowed
+	outputLimit := MaxMuxFrameDataSize + 1
+
+	for {
+		dst = ensureSpareCapacity(dst, 2*len(input)+wireFlushReserve)
+		output := dst[len(dst):cap(dst)]
+		if left := outputLimit - (len(dst) - dstLen); len(output) > left {
+			output = output[:left]
+		}
+
+		consumed, produced, resultCode := inflater.step(input, output, C.Z_SYNC_FLUSH)
+		dst = dst[:len(dst)+produced]
+		input = input[consumed:]
+
+		if len(dst)-dstLen == outputLimit {
+			return dst[:dstLen], false, fmt.Errorf("%w: more than %d bytes of data", MuxFrameError, MaxMuxFrameDataSize)
+		}
+
+		if resultCode == C.Z_STREAM_END {
+			if len(input) > 0 {
+				return dst[:dstLen], false, MuxFrameError
+			}
+			return dst, true, nil
+		}
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+			return dst[:dstLen], false, fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, resultCode)
+		}
+
+		if len(input) == 0 && produced < len(output) {
+			return dst, false, nil
+		}
+	}
+}
+
+// Close releases the native resources of the logical streams that didn't end
+func (d *Demux) Close() (err error) {
+	defer recoverPanic("Demux.Close", &err)
+
+	for id, inflater := range d.streams {
+		inflater.close()
+		delete(d.streams, id)
+	}
+	return nil
+}
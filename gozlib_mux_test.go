@@ -0,0 +1,265 @@
+package gozlib
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllMuxFrames(t *testing.T, input io.Reader) (map[uint32][]byte, map[uint32]int) {
+	demux := NewDemux(input)
+	defer demux.Close()
+
+	received := map[uint32][]byte{}
+	ended := map[uint32]int{}
+	for {
+		frame, err := demux.ReadFrame(nil)
+		if err == io.EOF {
+			return received, ended
+		}
+		require.NoError(t, err)
+
+		received[frame.StreamID] = append(received[frame.StreamID], frame.Data...)
+		if frame.End {
+			ended[frame.StreamID]++
+		}
+	}
+}
+
+func TestMuxInterleavedStreams(t *testing.T) {
+	physical := &bytes.Buffer{}
+	mux, err := NewMux(physical, CompressionLevelDefault)
+	require.NoError(t, err)
+
+	data := map[uint32][]byte{1: makeTestData(100000), 7: makeTestData(300), 1 << 30: makeTestData(5000)}
+	writers := map[uint32]io.WriteCloser{}
+	for id := range data {
+		writers[id], err = mux.Stream(id)
+		require.NoError(t, err)
+	}
+
+	_, err = mux.Stream(7)
+	assert.ErrorIs(t, err, MuxStreamInUseError)
+
+	// small writes alternating between streams
+	for offset := 0; offset < 100000; offset += 250 {
+		for id, streamData := range data {
+			if offset < len(streamData) {
+				end := offset + 250
+				if end > len(streamData) {
+					end = len(streamData)
+				}
+				_, err = writers[id].Write(streamData[offset:end])
+				require.NoError(t, err)
+			}
+		}
+	}
+
+	require.NoError(t, writers[7].Close())
+	_, err = writers[7].Write([]byte("late"))
+	assert.ErrorIs(t, err, MuxStreamClosedError)
+	require.NoError(t, mux.Close())
+
+	_, err = mux.Stream(2)
+	assert.ErrorIs(t, err, MuxClosedError)
+
+	received, ended := readAllMuxFrames(t, physical)
+	for id, streamData := range data {
+		assert.Equal(t, streamData, received[id], id)
+		assert.Equal(t, 1, ended[id], id)
+	}
+}
+
+func TestMuxFramesUncompressAsReceived(t *testing.T) {
+	reader, writer := io.Pipe()
+	mux, err := NewMux(writer, CompressionLevelBestSpeed)
+	require.NoError(t, err)
+	stream, err := mux.Stream(3)
+	require.NoError(t, err)
+
+	demux := NewDemux(bufio.NewReader(reader))
+	defer demux.Close()
+
+	// every write is readable before the stream is closed
+	for _, message := range [][]byte{[]byte("hello"), makeTestData(50000), []byte("bye")} {
+		go func(message []byte) {
+			_, _ = stream.Write(message)
+		}(message)
+
+		var received []byte
+		for len(received) < len(message) {
+			frame, rerr := demux.ReadFrame(nil)
+			require.NoError(t, rerr)
+			assert.Equal(t, uint32(3), frame.StreamID)
+			assert.False(t, frame.End)
+			assert.LessOrEqual(t, len(frame.Data), muxChunkSize)
+			received = append(received, frame.Data...)
+		}
+		assert.Equal(t, message, received)
+	}
+
+	go func() {
+		_ = stream.Close()
+	}()
+	frame, err := demux.ReadFrame(nil)
+	assert.NoError(t, err)
+	assert.True(t, frame.End)
+	assert.Empty(t, frame.Data)
+}
+
+func TestMuxConcurrentStreams(t *testing.T) {
+	physical := &bytes.Buffer{}
+	mux, err := NewMux(physical, CompressionLevelBestSpeed)
+	require.NoError(t, err)
+
+	const streams = 8
+	data := make([][]byte, streams)
+	var wg sync.WaitGroup
+	for id := 0; id < streams; id++ {
+		data[id] = makeTestData(uint32(20000 + id))
+		stream, serr := mux.Stream(uint32(id))
+		require.NoError(t, serr)
+
+		wg.Add(1)
+		go func(stream io.WriteCloser, streamData []byte) {
+			defer wg.Done()
+			for offset := 0; offset < len(streamData); offset += 1000 {
+				end := offset + 1000
+				if end > len(streamData) {
+					end = len(streamData)
+				}
+				_, werr := stream.Write(streamData[offset:end])
+				assert.NoError(t, werr)
+			}
+			assert.NoError(t, stream.Close())
+		}(stream, data[id])
+	}
+	wg.Wait()
+
+	received, ended := readAllMuxFrames(t, physical)
+	for id := 0; id < streams; id++ {
+		assert.Equal(t, data[id], received[uint32(id)])
+		assert.Equal(t, 1, ended[uint32(id)])
+	}
+}
+
+func TestMuxStreamIDReuse(t *testing.T) {
+	physical := &bytes.Buffer{}
+	mux, err := NewMux(physical, CompressionLevelDefault)
+	require.NoError(t, err)
+
+	for round := 0; round < 3; round++ {
+		stream, serr := mux.Stream(5)
+		require.NoError(t, serr)
+		_, serr = stream.Write([]byte("round"))
+		require.NoError(t, serr)
+		require.NoError(t, stream.Close())
+	}
+
+	received, ended := readAllMuxFrames(t, physical)
+	assert.Equal(t, []byte("roundroundround"), received[5])
+	assert.Equal(t, 3, ended[5])
+}
+
+func TestDemuxInvalidFrames(t *testing.T) {
+	physical := &bytes.Buffer{}
+	mux, err := NewMux(physical, CompressionLevelDefault)
+	require.NoError(t, err)
+	stream, err := mux.Stream(1)
+	require.NoError(t, err)
+	_, err = stream.Write(makeTestData(1000))
+	require.NoError(t, err)
+	require.NoError(t, mux.Close())
+	frames := physical.Bytes()
+
+	demux := NewDemux(bytes.NewReader(frames[:len(frames)-1]))
+	_, err = demux.ReadFrame(nil)
+	assert.NoError(t, err)
+	_, err = demux.ReadFrame(nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NoError(t, demux.Close())
+
+	var oversized []byte
+	oversized = binary.AppendUvarint(oversized, 1)
+	oversized = binary.AppendUvarint(oversized, MaxMuxFrameSize+1)
+	_, err = NewDemux(bytes.NewReader(oversized)).ReadFrame(nil)
+	assert.ErrorIs(t, err, MuxFrameError)
+
+	var garbage []byte
+	garbage = binary.AppendUvarint(garbage, 1)
+	garbage = binary.AppendUvarint(garbage, 4)
+	garbage = append(garbage, 1, 2, 3, 4)
+	_, err = NewDemux(bytes.NewReader(garbage)).ReadFrame(nil)
+	assert.ErrorIs(t, err, TransformerUncompressionError)
+
+	_, err = NewMux(physical, CompressionLevel(10))
+	assert.ErrorIs(t, err, CompressionLevelError)
+}
+
+func TestDemuxLimitsFrameData(t *testing.T) {
+	// a small payload uncompressing to more data than a frame can carry
+	payload := &bytes.Buffer{}
+	writer := zlib.NewWriter(payload)
+	_, err := writer.Write(make([]byte, MaxMuxFrameDataSize+1))
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+
+	var frame []byte
+	frame = binary.AppendUvarint(frame, 1)
+	frame = binary.AppendUvarint(frame, uint64(payload.Len()))
+	frame = append(frame, payload.Bytes()...)
+	require.Less(t, len(frame), MaxMuxFrameSize)
+
+	demux := NewDemux(bytes.NewReader(frame))
+	defer demux.Close()
+	received, err := demux.ReadFrame(nil)
+	assert.ErrorIs(t, err, MuxFrameError)
+	assert.Empty(t, received.Data)
+	assert.Empty(t, demux.streams)
+}
+
+func TestDemuxLimitsOpenStreams(t *testing.T) {
+	physical := &bytes.Buffer{}
+	mux, err := NewMux(physical, CompressionLevelDefault)
+	require.NoError(t, err)
+	for id := uint32(0); id <= MaxMuxOpenStreams; id++ {
+		stream, serr := mux.Stream(id)
+		require.NoError(t, serr)
+		_, err = stream.Write([]byte("open"))
+		require.NoError(t, err)
+	}
+	// only the frames keeping every stream open are read
+	frames := append([]byte(nil), physical.Bytes()...)
+	require.NoError(t, mux.Close())
+
+	demux := NewDemux(bytes.NewReader(frames))
+	defer demux.Close()
+	for id := uint32(0); id < MaxMuxOpenStreams; id++ {
+		frame, ferr := demux.ReadFrame(nil)
+		require.NoError(t, ferr)
+		assert.Equal(t, id, frame.StreamID)
+		assert.False(t, frame.End)
+	}
+
+	_, err = demux.ReadFrame(nil)
+	assert.ErrorIs(t, err, MuxFrameError)
+}
+
+func TestDemuxTruncatedPayloadLength(t *testing.T) {
+	var truncated []byte
+	truncated = binary.AppendUvarint(truncated, 1)
+	truncated = binary.AppendUvarint(truncated, MaxMuxFrameSize)
+	truncated = append(truncated, 1, 2, 3)
+
+	demux := NewDemux(bytes.NewReader(truncated))
+	_, err := demux.ReadFrame(nil)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, cap(demux.payload), MaxMuxFrameSize)
+}
@@ -0,0 +1,419 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"unsafe"
+)
+
+// native slice pool size classes and usage tracking
+
+const (
+	// same classes as the multipool, see DynPoolMinMultiPoolMemNodeSizeBits and MULTIPOOL_ENTRY_COUNT in dyn_mem_pool.h
+	nativePoolMinClassBits = 9
+	nativePoolClassCount   = 14
+)
+
+// NativePoolClassStats holds the usage of a single size class in a NativeSlicePool
+type NativePoolClassStats struct {
+	// ClassSize is the size of each memory block in the class
+	ClassSize int
+	// Held is the number of blocks owned by the class, acquired or idle.
+	// Blocks are never released back to the system so it's also the peak number of blocks acquired at once.
+	Held int64
+	// Acquired is the number of blocks currently acquired
+	Acquired int64
+	// RequestedBytes is the sum of the sizes requested for the blocks currently acquired
+	RequestedBytes int64
+}
+
+// HeldBytes returns the native memory owned by the class
+func (cs NativePoolClassStats) HeldBytes() int64 {
+	return cs.Held * int64(cs.ClassSize)
+}
+
+// AcquiredBytes returns the native memory of the blocks currently acquired
+func (cs NativePoolClassStats) AcquiredBytes() int64 {
+	return cs.Acquired * int64(cs.ClassSize)
+}
+
+// WastedBytes returns the memory acquired but not requested, caused by rounding requests up to the class size
+func (cs NativePoolClassStats) WastedBytes() int64 {
+	return cs.AcquiredBytes() - cs.RequestedBytes
+}
+
+// Fragmentation returns the fraction of acquired memory wasted by rounding, between 0 and 1
+func (cs NativePoolClassStats) Fragmentation() float64 {
+	acquired := cs.AcquiredBytes()
+	if acquired == 0 {
+		return 0
+	}
+
+	return float64(cs.WastedBytes()) / float64(acquired)
+}
+
+// Utilization returns the fraction of held blocks currently acquired, between 0 and 1
+func (cs NativePoolClassStats) Utilization() float64 {
+	if cs.Held == 0 {
+		return 0
+	}
+
+	return float64(cs.Acquired) / float64(cs.Held)
+}
+
+// NativePoolStats holds the usage of a NativeSlicePool per size class
+type NativePoolStats struct {
+	Classes []NativePoolClassStats
+}
+
+// HeldBytes returns the native memory owned by the pool
+func (ps NativePoolStats) HeldBytes() int64 {
+	var total int64
+	for _, class := range ps.Classes {
+		total += class.HeldBytes()
+	}
+	return total
+}
+
+// RequestedBytes returns the sum of the sizes requested for the blocks currently acquired
+func (ps NativePoolStats) RequestedBytes() int64 {
+	var total int64
+	for _, class := range ps.Classes {
+		total += class.RequestedBytes
+	}
+	return total
+}
+
+// WastedBytes returns the memory acquired but not requested across all classes
+func (ps NativePoolStats) WastedBytes() int64 {
+	var total int64
+	for _, class := range ps.Classes {
+		total += class.WastedBytes()
+	}
+	return total
+}
+
+// NativeMemStats returns the usage of the internal native memory pools shared by all compressors and uncompressors
+// It covers every allocation made by gozlib and by zlib itself, whose allocator is wired to the same pools, but not
+// memory from a NativeSlicePool, see NativeSlicePool.Stats for those, or of transformers bypassing the pools.
+// Requested sizes aren't tracked internally so RequestedBytes is reported as the acquired bytes.
+func NativeMemStats() NativePoolStats {
+	var sizes, held, idle [C.GOZLIB_NATIVE_POOL_COUNT]C.uint32_t
+	filled := int(C.native_pool_usage(&sizes[0], &held[0], &idle[0], C.GOZLIB_NATIVE_POOL_COUNT))
+
+	stats := NativePoolStats{Classes: make([]NativePoolClassStats, filled)}
+	for pos := range stats.Classes {
+		class := &stats.Classes[pos]
+		class.ClassSize = int(sizes[pos])
+		class.Held = int64(held[pos])
+		class.Acquired = int64(held[pos]) - int64(idle[pos])
+		class.RequestedBytes = class.AcquiredBytes()
+	}
+
+	return stats
+}
+
+// NativePoolRounding is the policy used by a NativeSlicePool to round requested sizes up to a size class
+type NativePoolRounding int
+
+const (
+	// NativePoolRoundingPowerOf2 rounds sizes up to the next power of 2, wasting up to half of each block
+	NativePoolRoundingPowerOf2 NativePoolRounding = iota
+	// NativePoolRoundingGeometric uses size classes growing by 1.25x, wasting up to a fifth of each block
+	NativePoolRoundingGeometric
+	// NativePoolRoundingExactLarge rounds sizes below the exact size threshold to the next power of 2
+	// and allocates larger sizes exactly, each distinct size in its own class
+	NativePoolRoundingExactLarge
+)
+
+const (
+	nativePoolMaxSize                   = 1 << (nativePoolMinClassBits + nativePoolClassCount - 1)
+	defaultNativePoolExactSizeThreshold = 1024 * 64
+	// geometric classes are aligned to a cache line
+	nativePoolGeometricAlignment = 64
+)
+
+var (
+	NativeSlicePoolOptionsError = errors.New("invalid native slice pool options")
+	PooledSliceReleasedError    = errors.New("pooled slice already released")
+)
+
+// NativeSlicePoolOptions configures a NativeSlicePool
+type NativeSlicePoolOptions struct {
+	// Rounding is the size class rounding policy
+	Rounding NativePoolRounding
+	// ExactSizeThreshold is the size from which NativePoolRoundingExactLarge allocates sizes exactly, 64Kb if zero
+	ExactSizeThreshold int
+}
+
+type nativePoolClass struct {
+	size      int
+	pool      unsafe.Pointer
+	held      atomic.Int64
+	acquired  atomic.Int64
+	requested atomic.Int64
+}
+
+func powerOf2ClassSizes() []int {
+	sizes := make([]int, nativePoolClassCount)
+	for pos := range sizes {
+		sizes[pos] = 1 << (nativePoolMinClassBits + pos)
+	}
+	return sizes
+}
+
+func geometricClassSizes() []int {
+	sizes := []int{1 << nativePoolMinClassBits}
+	for last := sizes[0]; last < nativePoolMaxSize; last = sizes[len(sizes)-1] {
+		// rounding down keeps the growth, and so the waste, within the ratio
+		next := (last + last/4) / nativePoolGeometricAlignment * nativePoolGeometricAlignment
+		if next > nativePoolMaxSize {
+			next = nativePoolMaxSize
+		}
+		sizes = append(sizes, next)
+	}
+	return sizes
+}
+
+func newNativePoolClasses(opts NativeSlicePoolOptions) ([]nativePoolClass, error) {
+	var sizes []int
+	switch opts.Rounding {
+	case NativePoolRoundingPowerOf2, NativePoolRoundingExactLarge:
+		sizes = powerOf2ClassSizes()
+	case NativePoolRoundingGeometric:
+		sizes = geometricClassSizes()
+	default:
+		return nil, fmt.Errorf("%w: unknown rounding policy %d", NativeSlicePoolOptionsError, opts.Rounding)
+	}
+
+	classes := make([]nativePoolClass, len(sizes))
+	for pos, size := range sizes {
+		classes[pos].size = size
+		classes[pos].pool = newNativeMemPool(size)
+	}
+	return classes, nil
+}
+
+// classFor returns the class serving size, or nil if size is larger than the maximum slice size
+func (nsp *NativeSlicePool) classFor(size int) *nativePoolClass {
+	if size > nativePoolMaxSize {
+		return nil
+	}
+
+	if nsp.exactThreshold > 0 && size >= nsp.exactThreshold {
+		return nsp.exactClassFor(size)
+	}
+
+	pos := sort.Search(len(nsp.classes), func(pos int) bool {
+		return nsp.classes[pos].size >= size
+	})
+	return &nsp.classes[pos]
+}
+
+func (nsp *NativeSlicePool) exactClassFor(size int) *nativePoolClass {
+	nsp.exactLock.Lock()
+	defer nsp.exactLock.Unlock()
+
+	class, found := nsp.exact[size]
+	if !found {
+		class = &nativePoolClass{size: size, pool: newNativeMemPool(size)}
+		nsp.exact[size] = class
+	}
+	return class
+}
+
+// eachClass calls fn for every class in the pool, in increasing size order
+func (nsp *NativeSlicePool) eachClass(fn func(class *nativePoolClass)) {
+	for pos := range nsp.classes {
+		fn(&nsp.classes[pos])
+	}
+
+	if nsp.exact == nil {
+		return
+	}
+
+	nsp.exactLock.Lock()
+	exact := make([]*nativePoolClass, 0, len(nsp.exact))
+	for _, class := range nsp.exact {
+		exact = append(exact, class)
+	}
+	nsp.exactLock.Unlock()
+
+	sort.Slice(exact, func(i, j int) bool {
+		return exact[i].size < exact[j].size
+	})
+	for _, class := range exact {
+		fn(class)
+	}
+}
+
+func (npc *nativePoolClass) trackAcquire(size int) {
+	acquired := npc.acquired.Add(1)
+	npc.requested.Add(int64(size))
+
+	for {
+		held := npc.held.Load()
+		if acquired <= held || npc.held.CompareAndSwap(held, acquired) {
+			return
+		}
+	}
+}
+
+func (npc *nativePoolClass) trackReturn(size int) {
+	npc.acquired.Add(-1)
+	npc.requested.Add(-int64(size))
+}
+
+func (npc *nativePoolClass) stats() NativePoolClassStats {
+	return NativePoolClassStats{
+		ClassSize:      npc.size,
+		Held:           npc.held.Load(),
+		Acquired:       npc.acquired.Load(),
+		RequestedBytes: npc.requested.Load(),
+	}
+}
+
+// Stats returns the usage of each size class in the pool
+// Slices must be returned with the same capacity they were acquired with for the stats to be accurate.
+// Counters are updated independently so stats taken while other goroutines use the pool are approximate.
+func (nsp *NativeSlicePool) Stats() NativePoolStats {
+	stats := NativePoolStats{}
+	nsp.eachClass(func(class *nativePoolClass) {
+		stats.Classes = append(stats.Classes, class.stats())
+	})
+	return stats
+}
+
+// Grow returns a slice from the pool with capacity newCap holding the contents of slice, which is returned to the pool
+// If newCap is not larger than the capacity of slice, slice is returned unchanged.
+// It returns nil and leaves slice owned by the caller when the pool can't allocate the new slice, such as when newCap is
+// larger than the maximum slice size.
+func (nsp *NativeSlicePool) Grow(slice []byte, newCap int) []byte {
+	if newCap <= cap(slice) {
+		return slice
+	}
+
+	grown := nsp.Acquire(newCap)
+	if grown == nil {
+		return nil
+	}
+
+	grown = grown[:len(slice)]
+	copy(grown, slice)
+	nsp.Return(slice)
+
+	return grown
+}
+
+// Clone returns a slice from the pool with the same length, capacity and contents of slice
+// slice can be either a pool or a Go heap slice and it remains owned by the caller.
+// It returns nil when the pool can't allocate the clone.
+func (nsp *NativeSlicePool) Clone(slice []byte) []byte {
+	clone := nsp.Acquire(cap(slice))
+	if clone == nil {
+		return nil
+	}
+
+	clone = clone[:len(slice)]
+	copy(clone, slice)
+
+	return clone
+}
+
+// ToHeap copies the contents of a slice acquired from the pool to a new Go heap slice and returns slice to the pool
+// slice must not be used after this call, the returned slice is owned by the caller and garbage collected as usual.
+func (nsp *NativeSlicePool) ToHeap(slice []byte) []byte {
+	heap := make([]byte, len(slice))
+	copy(heap, slice)
+	nsp.Return(slice)
+
+	return heap
+}
+
+// FromHeap copies data to a slice acquired from the pool with capacity equal to its length
+// data remains owned by the caller and the returned slice must be given back with Return or ToHeap.
+// It returns nil when the pool can't allocate the slice.
+func (nsp *NativeSlicePool) FromHeap(data []byte) []byte {
+	slice := nsp.Acquire(len(data))
+	if slice == nil {
+		return nil
+	}
+
+	slice = slice[:len(data)]
+	copy(slice, data)
+
+	return slice
+}
+
+// PooledSlice is a handle owning a slice acquired from a NativeSlicePool
+// Unlike a raw slice, releasing it more than once is detected and reported instead of corrupting the pool.
+type PooledSlice struct {
+	pool     *NativeSlicePool
+	data     []byte
+	released atomic.Bool
+}
+
+// AcquireSlice acquires a slice of length and capacity size wrapped in a PooledSlice handle
+// The slice must be given back with PooledSlice.Release.
+// It returns nil when the pool can't allocate the slice, such as when size is larger than the maximum slice size.
+func (nsp *NativeSlicePool) AcquireSlice(size int) *PooledSlice {
+	data := nsp.Acquire(size)
+	if data == nil {
+		return nil
+	}
+
+	return &PooledSlice{
+		pool: nsp,
+		data: data[:size],
+	}
+}
+
+// AcquireManaged acquires a slice like AcquireSlice that is also returned to the pool when its handle becomes unreachable
+// Release can still be called to return it deterministically. The slice is only valid while the handle is reachable,
+// so keep a reference to the handle (or use runtime.KeepAlive) while using Bytes, and don't Free the pool while
+// managed slices may still be collected.
+// Like AcquireSlice, it returns nil when the pool can't allocate the slice.
+func (nsp *NativeSlicePool) AcquireManaged(size int) *PooledSlice {
+	handle := nsp.AcquireSlice(size)
+	if handle == nil {
+		return nil
+	}
+
+	runtime.SetFinalizer(handle, func(ps *PooledSlice) {
+		// the only error is a previous release, which is fine here
+		_ = ps.Release()
+	})
+
+	return handle
+}
+
+// Bytes returns the slice owned by the handle, or nil once it was released
+// The returned slice must not be used after Release is called.
+func (ps *PooledSlice) Bytes() []byte {
+	if ps.released.Load() {
+		return nil
+	}
+
+	return ps.data
+}
+
+// Release returns the slice to the pool. Releasing a handle more than once returns PooledSliceReleasedError
+func (ps *PooledSlice) Release() (err error) {
+	defer recoverPanic("PooledSlice.Release", &err)
+
+	if !ps.released.CompareAndSwap(false, true) {
+		return PooledSliceReleasedError
+	}
+
+	runtime.SetFinalizer(ps, nil)
+	ps.pool.Return(ps.data)
+
+	return nil
+}
@@ -1,9 +1,14 @@
 package gozlib
 
 import (
+	"bytes"
+	"io"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAllocAndReturnVariousSize(t *testing.T) {
@@ -20,6 +25,20 @@ func TestAllocAndReturnVariousSize(t *testing.T) {
 	}
 }
 
+func TestNativePoolReturnIgnoresFailedAcquisitions(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	oversized := pool.Acquire(nativePoolMaxSize + 1)
+	assert.Nil(t, oversized)
+	assert.NotPanics(t, func() { pool.Return(oversized) })
+	assert.NotPanics(t, func() { pool.Return(nil) })
+
+	for _, class := range pool.Stats().Classes {
+		assert.Equal(t, int64(0), class.Acquired)
+	}
+}
+
 func TestNativePoolAllocAndReuse(t *testing.T) {
 	const desiredBufferSize = 1024
 	pool := NewNativeSlicePool()
@@ -41,3 +60,315 @@ func TestNativePoolAllocAndReuse(t *testing.T) {
 	actual := dataAfterReturned[:len(tag)]
 	assert.Equal(t, tag, actual)
 }
+
+func TestNativePoolStatsTrackClassUsage(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	exact := pool.Acquire(1024)
+	rounded := pool.Acquire(1536)
+	small := pool.Acquire(100)
+
+	stats := pool.Stats()
+	assert.Len(t, stats.Classes, nativePoolClassCount)
+
+	smallClass := stats.Classes[0]
+	assert.Equal(t, 512, smallClass.ClassSize)
+	assert.Equal(t, int64(1), smallClass.Acquired)
+	assert.Equal(t, int64(412), smallClass.WastedBytes())
+
+	exactClass := stats.Classes[1]
+	assert.Equal(t, 1024, exactClass.ClassSize)
+	assert.Equal(t, int64(0), exactClass.WastedBytes())
+	assert.Equal(t, float64(0), exactClass.Fragmentation())
+
+	roundedClass := stats.Classes[2]
+	assert.Equal(t, 2048, roundedClass.ClassSize)
+	assert.Equal(t, int64(1536), roundedClass.RequestedBytes)
+	assert.Equal(t, 0.25, roundedClass.Fragmentation())
+	assert.Equal(t, float64(1), roundedClass.Utilization())
+
+	assert.Equal(t, int64(100+1024+1536), stats.RequestedBytes())
+	assert.Equal(t, int64(512+1024+2048), stats.HeldBytes())
+
+	pool.Return(rounded)
+	pool.Return(exact)
+	pool.Return(small)
+
+	stats = pool.Stats()
+	roundedClass = stats.Classes[2]
+	assert.Equal(t, int64(1), roundedClass.Held)
+	assert.Equal(t, int64(0), roundedClass.Acquired)
+	assert.Equal(t, float64(0), roundedClass.Utilization())
+	assert.Equal(t, int64(0), stats.WastedBytes())
+	assert.Equal(t, int64(512+1024+2048), stats.HeldBytes())
+
+	// reusing a block doesn't grow the class
+	pool.Return(pool.Acquire(2000))
+	assert.Equal(t, int64(1), pool.Stats().Classes[2].Held)
+}
+
+func TestNativePoolRoundingPolicies(t *testing.T) {
+	const size = 1536 * 1024
+
+	tests := []struct {
+		name              string
+		opts              NativeSlicePoolOptions
+		expectedClassSize int
+	}{
+		{"power of 2", NativeSlicePoolOptions{Rounding: NativePoolRoundingPowerOf2}, 2048 * 1024},
+		{"geometric", NativeSlicePoolOptions{Rounding: NativePoolRoundingGeometric}, 1617408},
+		{"exact large", NativeSlicePoolOptions{Rounding: NativePoolRoundingExactLarge}, size},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, err := NewNativeSlicePoolWithOptions(test.opts)
+			require.NoError(t, err)
+			defer pool.Free()
+
+			data := pool.Acquire(size)
+			assert.Equal(t, size, cap(data))
+			// the whole capacity must be usable
+			data = data[:size]
+			data[size-1] = 1
+
+			var class NativePoolClassStats
+			for _, class = range pool.Stats().Classes {
+				if class.Acquired > 0 {
+					break
+				}
+			}
+			assert.Equal(t, test.expectedClassSize, class.ClassSize)
+			assert.Equal(t, int64(test.expectedClassSize-size), pool.Stats().WastedBytes())
+
+			pool.Return(data)
+			assert.Equal(t, int64(0), pool.Stats().RequestedBytes())
+		})
+	}
+}
+
+func TestNativePoolGeometricClassesBoundWaste(t *testing.T) {
+	pool, err := NewNativeSlicePoolWithOptions(NativeSlicePoolOptions{Rounding: NativePoolRoundingGeometric})
+	require.NoError(t, err)
+	defer pool.Free()
+
+	for size := 600; size <= nativePoolMaxSize; size = size*3/2 + 7 {
+		data := pool.Acquire(size)
+		assert.Equal(t, size, cap(data))
+		wasted := pool.Stats().WastedBytes()
+		assert.LessOrEqual(t, float64(wasted)/float64(size+int(wasted)), 0.2)
+		pool.Return(data)
+	}
+}
+
+func TestNativePoolExactLargeKeepsSmallSizesInClasses(t *testing.T) {
+	pool, err := NewNativeSlicePoolWithOptions(NativeSlicePoolOptions{Rounding: NativePoolRoundingExactLarge, ExactSizeThreshold: 4096})
+	require.NoError(t, err)
+	defer pool.Free()
+
+	small := pool.Acquire(3000)
+	large := pool.Acquire(5000)
+	again := pool.Acquire(5000)
+
+	stats := pool.Stats()
+	assert.Len(t, stats.Classes, nativePoolClassCount+1)
+	assert.Equal(t, int64(4096-3000), stats.Classes[3].WastedBytes())
+	exact := stats.Classes[nativePoolClassCount]
+	assert.Equal(t, 5000, exact.ClassSize)
+	assert.Equal(t, int64(2), exact.Acquired)
+	assert.Equal(t, int64(0), exact.WastedBytes())
+
+	pool.Return(small)
+	pool.Return(large)
+	pool.Return(again)
+}
+
+func TestNativePoolInvalidOptions(t *testing.T) {
+	_, err := NewNativeSlicePoolWithOptions(NativeSlicePoolOptions{Rounding: NativePoolRounding(10)})
+	assert.ErrorIs(t, err, NativeSlicePoolOptionsError)
+
+	_, err = NewNativeSlicePoolWithOptions(NativeSlicePoolOptions{Rounding: NativePoolRoundingExactLarge, ExactSizeThreshold: -1})
+	assert.ErrorIs(t, err, NativeSlicePoolOptionsError)
+}
+
+func TestNativePoolGrowPreservesContents(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	content := []byte("grow me")
+	data := append(pool.Acquire(600), content...)
+
+	assert.Equal(t, data, pool.Grow(data, 600))
+	assert.Equal(t, data, pool.Grow(data, 10))
+
+	grown := pool.Grow(data, 5000)
+	assert.Equal(t, 5000, cap(grown))
+	assert.Equal(t, content, grown)
+
+	stats := pool.Stats()
+	assert.Equal(t, int64(0), stats.Classes[1].Acquired)
+	assert.Equal(t, int64(1), stats.Classes[4].Acquired)
+
+	pool.Return(grown)
+	assert.Equal(t, int64(0), pool.Stats().RequestedBytes())
+}
+
+func TestNativePoolGrowOverMaxSize(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	content := []byte("keep me")
+	data := append(pool.Acquire(16), content...)
+
+	assert.Nil(t, pool.Grow(data, nativePoolMaxSize+1))
+	// the original slice is still owned by the caller
+	assert.Equal(t, content, data)
+	assert.Equal(t, int64(1), pool.Stats().Classes[0].Acquired)
+
+	assert.Nil(t, pool.Clone(make([]byte, 1, nativePoolMaxSize+1)))
+	assert.Nil(t, pool.FromHeap(make([]byte, nativePoolMaxSize+1)))
+
+	pool.Return(data)
+	assert.Equal(t, int64(0), pool.Stats().RequestedBytes())
+}
+
+func TestNativePoolClone(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	heap := make([]byte, 3, 1000)
+	copy(heap, "abc")
+
+	clone := pool.Clone(heap)
+	assert.Equal(t, heap, clone)
+	assert.Equal(t, 1000, cap(clone))
+
+	cloneOfClone := pool.Clone(clone)
+	clone[0] = 'x'
+	assert.Equal(t, []byte("abc"), cloneOfClone)
+
+	pool.Return(clone)
+	pool.Return(cloneOfClone)
+	assert.Equal(t, int64(0), pool.Stats().RequestedBytes())
+}
+
+func TestNativePoolHeapConversions(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	data := []byte("owned by the heap")
+	pooled := pool.FromHeap(data)
+	assert.Equal(t, data, pooled)
+	assert.Equal(t, len(data), cap(pooled))
+
+	data[0] = 'X'
+	assert.Equal(t, byte('o'), pooled[0])
+
+	heap := pool.ToHeap(pooled)
+	assert.Equal(t, []byte("owned by the heap"), heap)
+	assert.Equal(t, int64(0), pool.Stats().Classes[0].Acquired)
+}
+
+func TestPooledSliceRelease(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	handle := pool.AcquireSlice(100)
+	assert.Len(t, handle.Bytes(), 100)
+	assert.Equal(t, int64(1), pool.Stats().Classes[0].Acquired)
+
+	assert.NoError(t, handle.Release())
+	assert.Nil(t, handle.Bytes())
+	assert.Equal(t, int64(0), pool.Stats().Classes[0].Acquired)
+
+	assert.ErrorIs(t, handle.Release(), PooledSliceReleasedError)
+	assert.Equal(t, int64(0), pool.Stats().Classes[0].Acquired)
+}
+
+func TestPooledSliceOversize(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	assert.Nil(t, pool.AcquireSlice(nativePoolMaxSize+1))
+	assert.Nil(t, pool.AcquireManaged(nativePoolMaxSize+1))
+
+	handle := pool.AcquireSlice(nativePoolMaxSize)
+	require.NotNil(t, handle)
+	assert.Len(t, handle.Bytes(), nativePoolMaxSize)
+	assert.NoError(t, handle.Release())
+}
+
+func TestManagedSliceReturnedWhenUnreachable(t *testing.T) {
+	pool := NewNativeSlicePool()
+	defer pool.Free()
+
+	handle := pool.AcquireManaged(100)
+	handle.Bytes()[0] = 1
+	assert.Equal(t, int64(1), pool.Stats().Classes[0].Acquired)
+	handle = nil
+	assert.Nil(t, handle)
+
+	assert.Eventually(t, func() bool {
+		runtime.GC()
+		return pool.Stats().Classes[0].Acquired == 0
+	}, time.Second, 10*time.Millisecond)
+
+	released := pool.AcquireManaged(100)
+	assert.NoError(t, released.Release())
+	assert.ErrorIs(t, released.Release(), PooledSliceReleasedError)
+}
+
+func TestNativeMemStatsCoverZLibAllocations(t *testing.T) {
+	acquiredBytes := func(stats NativePoolStats) int64 {
+		var total int64
+		for _, class := range stats.Classes {
+			total += class.AcquiredBytes()
+		}
+		return total
+	}
+
+	before := NativeMemStats()
+	compressor, err := NewGoGZipCompressor(io.Discard, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+
+	during := NativeMemStats()
+	// zlib's own deflate state comes from the pool
+	assert.GreaterOrEqual(t, acquiredBytes(during)-acquiredBytes(before), int64(deflateStateMemory))
+	assert.GreaterOrEqual(t, during.HeldBytes(), acquiredBytes(during))
+	assert.Equal(t, int64(0), during.WastedBytes())
+
+	assert.NoError(t, compressor.Close())
+	assert.Equal(t, acquiredBytes(before), acquiredBytes(NativeMemStats()))
+}
+
+func TestUnpooledTransformersBypassNativePools(t *testing.T) {
+	acquired := NativeMemStats().RequestedBytes()
+	data := makeTestData(100000)
+
+	compressed := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressorWithOptions(compressed, CompressionLevelBestSpeed, 1024, TransformerOptions{BypassNativePool: true})
+	require.NoError(t, err)
+	_, err = compressor.Write(data[:100])
+	require.NoError(t, err)
+	_, err = compressor.Write(data[100:])
+	require.NoError(t, err)
+	assert.NoError(t, Flush(compressor))
+
+	SetNativePoolBypass(true)
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed.Bytes()), 1024)
+	SetNativePoolBypass(false)
+	require.NoError(t, err)
+
+	// small reads allocate the read ahead buffer too
+	head := make([]byte, 10)
+	_, err = io.ReadFull(uncompressor, head)
+	require.NoError(t, err)
+	assert.Equal(t, acquired, NativeMemStats().RequestedBytes())
+
+	rest, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, append(head, rest...))
+	assert.NoError(t, uncompressor.Close())
+	assert.NoError(t, compressor.Close())
+}
@@ -0,0 +1,160 @@
+package gozlib
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	NDJSONOptionsError      = errors.New("invalid NDJSON writer options")
+	NDJSONWriterClosedError = errors.New("NDJSON writer is closed")
+)
+
+// NDJSONOptions configures an NDJSONWriter
+type NDJSONOptions struct {
+	Level CompressionLevel
+	// BufferSize is the work buffer size of the compressor, zero means 16Kb
+	BufferSize uint32
+	// FlushRecords is the number of records after which the writer sync flushes, zero disables flushing by count
+	FlushRecords int
+	// FlushInterval is the longest a record is kept unflushed, zero disables flushing by time
+	FlushInterval time.Duration
+}
+
+// NDJSONWriter writes values as newline delimited JSON records to a gzip stream, sync flushing periodically so the
+// receiver can process the records written so far without waiting for the stream to end
+// Records are flushed every FlushRecords records and at most FlushInterval after being written, whichever comes first.
+// An NDJSONWriter is safe for concurrent use.
+type NDJSONWriter struct {
+	mutex      sync.Mutex
+	compressor io.WriteCloser
+	encoder    *json.Encoder
+	options    NDJSONOptions
+	// unflushed is the number of records written since the last flush
+	unflushed  int
+	flushTimer *time.Timer
+	// flushErr is the error of a flush triggered by the timer, returned by the next call
+	flushErr error
+	closed   bool
+}
+
+// NewNDJSONWriter creates a writer compressing records to output
+func NewNDJSONWriter(output io.Writer, options NDJSONOptions) (writer *NDJSONWriter, err error) {
+	defer recoverPanic("NewNDJSONWriter", &err)
+
+	if options.FlushRecords < 0 || options.FlushInterval < 0 {
+		return nil, NDJSONOptionsError
+	}
+	if options.BufferSize == 0 {
+		options.BufferSize = defaultPoolBufferSize
+	}
+
+	compressor, err := NewGoGZipCompressor(output, options.Level, options.BufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NDJSONWriter{
+		compressor: compressor,
+		encoder:    json.NewEncoder(compressor),
+		options:    options,
+	}, nil
+}
+
+// Encode writes value as a JSON record followed by a newline
+func (nw *NDJSONWriter) Encode(value any) (err error) {
+	defer recoverPanic("NDJSONWriter.Encode", &err)
+
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	if nw.closed {
+		return NDJSONWriterClosedError
+	}
+	if nw.flushErr != nil {
+		return nw.flushErr
+	}
+
+	err = nw.encoder.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	nw.unflushed++
+	if nw.options.FlushRecords > 0 && nw.unflushed >= nw.options.FlushRecords {
+		return nw.flush()
+	}
+
+	if nw.options.FlushInterval > 0 && nw.flushTimer == nil {
+		nw.flushTimer = time.AfterFunc(nw.options.FlushInterval, nw.flushOnTimer)
+	}
+
+	return nil
+}
+
+// Flush sync flushes the records written so far
+func (nw *NDJSONWriter) Flush() (err error) {
+	defer recoverPanic("NDJSONWriter.Flush", &err)
+
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	if nw.closed {
+		return NDJSONWriterClosedError
+	}
+	if nw.flushErr != nil {
+		return nw.flushErr
+	}
+
+	return nw.flush()
+}
+
+func (nw *NDJSONWriter) flushOnTimer() {
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	// the timer fired while a flush or close was stopping it
+	if nw.closed || nw.unflushed == 0 {
+		return
+	}
+
+	nw.flushErr = nw.flush()
+}
+
+func (nw *NDJSONWriter) flush() error {
+	if nw.flushTimer != nil {
+		nw.flushTimer.Stop()
+		nw.flushTimer = nil
+	}
+
+	nw.unflushed = 0
+	return SyncFlush(nw.compressor)
+}
+
+// Close ends the compressed stream and releases the compressor. The output is not closed.
+func (nw *NDJSONWriter) Close() (err error) {
+	defer recoverPanic("NDJSONWriter.Close", &err)
+
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+
+	if nw.closed {
+		return NDJSONWriterClosedError
+	}
+	nw.closed = true
+
+	if nw.flushTimer != nil {
+		nw.flushTimer.Stop()
+		nw.flushTimer = nil
+	}
+
+	// closing the compressor ends the stream
+	cerr := nw.compressor.Close()
+	if nw.flushErr != nil {
+		return nw.flushErr
+	}
+	return cerr
+}
@@ -0,0 +1,120 @@
+package gozlib
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ndjsonEvent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// syncBuffer is a bytes.Buffer safe to write from the flush timer while the test reads it
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(data []byte) (int, error) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return sb.buffer.Write(data)
+}
+
+func (sb *syncBuffer) Bytes() []byte {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+	return append([]byte{}, sb.buffer.Bytes()...)
+}
+
+// readNDJSON uncompresses the complete records available in compressed, which may be an unfinished stream
+func readNDJSON(t *testing.T, compressed []byte) []ndjsonEvent {
+	events := []ndjsonEvent{}
+	if len(compressed) == 0 {
+		return events
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var event ndjsonEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestNDJSONWriterFlushesByCount(t *testing.T) {
+	output := &syncBuffer{}
+	writer, err := NewNDJSONWriter(output, NDJSONOptions{Level: CompressionLevelBestSpeed, FlushRecords: 3})
+	require.NoError(t, err)
+
+	for id := 0; id < 7; id++ {
+		require.NoError(t, writer.Encode(ndjsonEvent{ID: id, Name: "event"}))
+	}
+
+	// the last record isn't flushed yet
+	assert.Len(t, readNDJSON(t, output.Bytes()), 6)
+
+	require.NoError(t, writer.Close())
+	events := readNDJSON(t, output.Bytes())
+	require.Len(t, events, 7)
+	assert.Equal(t, ndjsonEvent{ID: 6, Name: "event"}, events[6])
+
+	assert.ErrorIs(t, writer.Encode(ndjsonEvent{}), NDJSONWriterClosedError)
+	assert.ErrorIs(t, writer.Close(), NDJSONWriterClosedError)
+}
+
+func TestNDJSONWriterFlushesByInterval(t *testing.T) {
+	output := &syncBuffer{}
+	writer, err := NewNDJSONWriter(output, NDJSONOptions{Level: CompressionLevelBestSpeed, FlushInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer writer.Close()
+
+	require.NoError(t, writer.Encode(ndjsonEvent{ID: 1, Name: "first"}))
+	require.NoError(t, writer.Encode(ndjsonEvent{ID: 2, Name: "second"}))
+
+	assert.Eventually(t, func() bool {
+		return len(readNDJSON(t, output.Bytes())) == 2
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, writer.Encode(ndjsonEvent{ID: 3, Name: "third"}))
+	assert.Eventually(t, func() bool {
+		return len(readNDJSON(t, output.Bytes())) == 3
+	}, time.Second, time.Millisecond)
+}
+
+func TestNDJSONWriterExplicitFlush(t *testing.T) {
+	output := &syncBuffer{}
+	writer, err := NewNDJSONWriter(output, NDJSONOptions{Level: CompressionLevelBestCompression})
+	require.NoError(t, err)
+	defer writer.Close()
+
+	require.NoError(t, writer.Encode(ndjsonEvent{ID: 1}))
+	assert.Empty(t, readNDJSON(t, output.Bytes()))
+
+	require.NoError(t, writer.Flush())
+	assert.Equal(t, []ndjsonEvent{{ID: 1}}, readNDJSON(t, output.Bytes()))
+
+	assert.Error(t, writer.Encode(func() {}))
+}
+
+func TestNDJSONWriterOptions(t *testing.T) {
+	_, err := NewNDJSONWriter(&bytes.Buffer{}, NDJSONOptions{FlushRecords: -1})
+	assert.ErrorIs(t, err, NDJSONOptionsError)
+
+	_, err = NewNDJSONWriter(&bytes.Buffer{}, NDJSONOptions{FlushInterval: -time.Second})
+	assert.ErrorIs(t, err, NDJSONOptionsError)
+}
@@ -0,0 +1,152 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Zlib wrapped objects
+// Formats such as git packfiles store many small objects, each one a complete zlib stream, back to back in a larger buffer.
+// The uncompressed size of each object is known upfront but its compressed size is only known once the object is inflated.
+// ObjectDeflater and ObjectInflater reuse a single native stream for all objects, avoiding a zlib initialization per object.
+
+// the most the output of Inflate grows by at once, until the object is uncompressed
+const objectInflateGrowth = 64 * 1024
+
+var (
+	ObjectSizeError = errors.New("uncompressed object size doesn't match the expected size")
+)
+
+// ObjectDeflater compresses independent objects in zlib format. It is not safe for concurrent use.
+type ObjectDeflater struct {
+	stream *nativeStream
+}
+
+// NewObjectDeflater creates a new object deflater using the given compression level
+// Close must be called to release the native resources.
+func NewObjectDeflater(level CompressionLevel) (deflater *ObjectDeflater, err error) {
+	defer recoverPanic("NewObjectDeflater", &err)
+
+	stream, err := newDeflateStream(level, C.MAX_WBITS, C.Z_DEFAULT_STRATEGY)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectDeflater{stream: stream}, nil
+}
+
+// Deflate compresses object as a complete zlib stream, appending it to dst and returning the extended slice
+func (od *ObjectDeflater) Deflate(dst []byte, object []byte) (result []byte, err error) {
+	defer recoverPanic("ObjectDeflater.Deflate", &err)
+
+	od.stream.reset()
+
+	bound := int(C.deflateBound(od.stream.zs, C.uLong(len(object))))
+	dstLen := len(dst)
+	if cap(dst)-dstLen < bound {
+		grown := make([]byte, dstLen, dstLen+bound)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	_, produced, resultCode := od.stream.step(object, dst[dstLen:dstLen+bound], C.Z_FINISH)
+	if resultCode != C.Z_STREAM_END {
+		return dst, fmt.Errorf(wrapErrorFormat, BufferCompressError, resultCode)
+	}
+
+	return dst[:dstLen+produced], nil
+}
+
+// Close releases the native resources used by the deflater
+func (od *ObjectDeflater) Close() (err error) {
+	defer recoverPanic("ObjectDeflater.Close", &err)
+
+	od.stream.close()
+	return nil
+}
+
+// ObjectInflater uncompresses independent zlib objects. It is not safe for concurrent use.
+type ObjectInflater struct {
+	stream *nativeStream
+}
+
+// NewObjectInflater creates a new object inflater
+// Close must be called to release the native resources.
+func NewObjectInflater() (inflater *ObjectInflater, err error) {
+	defer recoverPanic("NewObjectInflater", &err)
+
+	stream, err := newInflateStream(C.MAX_WBITS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInflater{stream: stream}, nil
+}
+
+// Inflate uncompresses the zlib object at the start of src, which may be followed by unrelated data, whose uncompressed size is size.
+// The uncompressed object is appended to dst and the extended slice is returned, along with the number of compressed bytes consumed from src,
+// which is the offset of the data following the object.
+// dst grows as the object is uncompressed, so a size read from untrusted input can't cause an allocation larger than the object.
+// ObjectSizeError is returned if size is negative or the object doesn't uncompress to exactly size bytes and io.ErrUnexpectedEOF if
+// src ends before the object.
+func (oi *ObjectInflater) Inflate(dst []byte, src []byte, size int) (result []byte, consumed int, err error) {
+	defer recoverPanic("ObjectInflater.Inflate", &err)
+
+	if size < 0 {
+		return dst, 0, fmt.Errorf("%w: negative size %d", ObjectSizeError, size)
+	}
+
+	oi.stream.reset()
+
+	dstLen := len(dst)
+	result = dst
+	for {
+		// room for one byte more than size tells whether the object is larger
+		remaining := size + 1 - (len(result) - dstLen)
+		growth := remaining
+		if growth > objectInflateGrowth {
+			growth = objectInflateGrowth
+		}
+		result = ensureSpareCapacity(result, growth)
+		output := result[len(result):cap(result)]
+		if len(output) > remaining {
+			output = output[:remaining]
+		}
+
+		stepConsumed, produced, resultCode := oi.stream.step(src[consumed:], output, C.Z_NO_FLUSH)
+		consumed += stepConsumed
+		result = result[:len(result)+produced]
+
+		if len(result)-dstLen > size {
+			return result[:dstLen], consumed, ObjectSizeError
+		}
+
+		switch resultCode {
+		case C.Z_STREAM_END:
+			if len(result)-dstLen != size {
+				return result[:dstLen], consumed, ObjectSizeError
+			}
+			return result, consumed, nil
+		case C.Z_OK, C.Z_BUF_ERROR:
+			// zlib had room for more output, so it stopped for lack of input
+			if consumed == len(src) && produced < len(output) {
+				return result[:dstLen], consumed, io.ErrUnexpectedEOF
+			}
+		default:
+			return result[:dstLen], consumed, fmt.Errorf(wrapErrorFormat, BufferUncompressError, resultCode)
+		}
+	}
+}
+
+// Close releases the native resources used by the inflater
+func (oi *ObjectInflater) Close() (err error) {
+	defer recoverPanic("ObjectInflater.Close", &err)
+
+	oi.stream.close()
+	return nil
+}
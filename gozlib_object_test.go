@@ -0,0 +1,107 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeflateInflateConsecutiveObjects(t *testing.T) {
+	deflater, err := NewObjectDeflater(CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer deflater.Close()
+
+	objects := [][]byte{makeTestData(100), {}, makeTestData(70000), []byte("tree 1234")}
+	pack := []byte("PACK")
+	offsets := []int{}
+	for _, object := range objects {
+		offsets = append(offsets, len(pack))
+		pack, err = deflater.Deflate(pack, object)
+		assert.NoError(t, err)
+	}
+
+	// objects are standard zlib streams
+	reader, err := zlib.NewReader(bytes.NewReader(pack[offsets[2]:]))
+	assert.NoError(t, err)
+	standard, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, objects[2], standard)
+
+	inflater, err := NewObjectInflater()
+	assert.NoError(t, err)
+	defer inflater.Close()
+
+	offset := offsets[0]
+	for pos, object := range objects {
+		assert.Equal(t, offsets[pos], offset)
+
+		inflated, consumed, err := inflater.Inflate(nil, pack[offset:], len(object))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(object, inflated))
+		offset += consumed
+	}
+	assert.Equal(t, len(pack), offset)
+}
+
+func TestInflateObjectErrors(t *testing.T) {
+	deflater, err := NewObjectDeflater(CompressionLevelBestCompression)
+	assert.NoError(t, err)
+	defer deflater.Close()
+
+	object := makeTestData(1000)
+	compressed, err := deflater.Deflate(nil, object)
+	assert.NoError(t, err)
+
+	inflater, err := NewObjectInflater()
+	assert.NoError(t, err)
+	defer inflater.Close()
+
+	_, _, err = inflater.Inflate(nil, compressed, len(object)-1)
+	assert.ErrorIs(t, err, ObjectSizeError)
+
+	_, _, err = inflater.Inflate(nil, compressed, len(object)+1)
+	assert.ErrorIs(t, err, ObjectSizeError)
+
+	_, _, err = inflater.Inflate(nil, compressed[:len(compressed)/2], len(object))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, _, err = inflater.Inflate(nil, object, len(object))
+	assert.ErrorIs(t, err, BufferUncompressError)
+
+	// the inflater is still usable after errors
+	inflated, consumed, err := inflater.Inflate([]byte("prefix"), compressed, len(object))
+	assert.NoError(t, err)
+	assert.Equal(t, len(compressed), consumed)
+	assert.Equal(t, append([]byte("prefix"), object...), inflated)
+}
+
+func TestInflateObjectUntrustedSize(t *testing.T) {
+	deflater, err := NewObjectDeflater(CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer deflater.Close()
+
+	object := makeTestData(200000)
+	compressed, err := deflater.Deflate(nil, object)
+	assert.NoError(t, err)
+
+	inflater, err := NewObjectInflater()
+	assert.NoError(t, err)
+	defer inflater.Close()
+
+	_, consumed, err := inflater.Inflate(nil, compressed, -1)
+	assert.ErrorIs(t, err, ObjectSizeError)
+	assert.Zero(t, consumed)
+
+	// the output only grows with the data uncompressed
+	inflated, _, err := inflater.Inflate(nil, compressed[:100], 1<<40)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, cap(inflated), 1<<20)
+
+	inflated, consumed, err = inflater.Inflate(nil, compressed, len(object))
+	assert.NoError(t, err)
+	assert.Equal(t, len(compressed), consumed)
+	assert.Equal(t, object, inflated)
+}
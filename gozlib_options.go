@@ -0,0 +1,64 @@
+package gozlib
+
+import "reflect"
+
+// OptionInfo describes a field of Defaults, so configuration layers can list, document and validate the package
+// settings without hand maintaining a copy of them
+type OptionInfo struct {
+	// Name is the name of the Defaults field
+	Name string
+	// Type is the Go type of the field
+	Type string
+	// Default is the value used when the defaults aren't set
+	Default any
+	// Allowed lists the only accepted values, nil when any value from Min is accepted
+	Allowed []any
+	// Min is the smallest accepted value of numeric settings without Allowed values
+	Min int64
+	// Description explains what the setting controls
+	Description string
+}
+
+// Options returns the settings accepted by SetDefaults and UpdateDefaults, in the order of the Defaults fields
+func Options() []OptionInfo {
+	options := []OptionInfo{
+		{
+			Name:        "CompressionLevel",
+			Allowed:     compressionLevels(),
+			Description: "compression level used by NewCompressor",
+		},
+		{
+			Name:        "CompressorBufferSize",
+			Min:         1,
+			Description: "work buffer size of compressors created with default settings",
+		},
+		{
+			Name:        "UncompressorBufferSize",
+			Min:         1,
+			Description: "work buffer size of uncompressors created with default settings",
+		},
+		{
+			Name:        "MaxDecompressedSize",
+			Min:         0,
+			Description: "maximum number of bytes produced by Decompress and NewUncompressor uncompressors, zero means no limit",
+		},
+	}
+
+	defaults := reflect.ValueOf(builtinDefaults)
+	for pos := range options {
+		field := defaults.FieldByName(options[pos].Name)
+		options[pos].Type = field.Type().String()
+		options[pos].Default = field.Interface()
+	}
+
+	return options
+}
+
+// compressionLevels returns every level accepted by zlib
+func compressionLevels() []any {
+	levels := []any{CompressionLevelDefault}
+	for level := CompressionLevelNone; level <= CompressionLevelBestCompression; level++ {
+		levels = append(levels, level)
+	}
+	return levels
+}
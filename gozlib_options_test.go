@@ -0,0 +1,55 @@
+package gozlib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsDescribeDefaults(t *testing.T) {
+	options := Options()
+	defaultsType := reflect.TypeOf(Defaults{})
+	require.Len(t, options, defaultsType.NumField())
+
+	for pos, option := range options {
+		field := defaultsType.Field(pos)
+		assert.Equal(t, field.Name, option.Name)
+		assert.Equal(t, field.Type.String(), option.Type)
+		assert.NotEmpty(t, option.Description)
+		assert.Equal(t, reflect.ValueOf(builtinDefaults).Field(pos).Interface(), option.Default)
+	}
+
+	assert.Equal(t, "gozlib.CompressionLevel", options[0].Type)
+	assert.Equal(t, CompressionLevelBestSpeed, options[0].Default)
+}
+
+func TestOptionsConstraintsMatchValidation(t *testing.T) {
+	for pos, option := range Options() {
+		valid := builtinDefaults
+		field := reflect.ValueOf(&valid).Elem().Field(pos)
+
+		if option.Allowed != nil {
+			for _, allowed := range option.Allowed {
+				field.Set(reflect.ValueOf(allowed))
+				assert.NoError(t, validateDefaults(valid), option.Name)
+			}
+
+			field.SetInt(-100)
+			assert.ErrorIs(t, validateDefaults(valid), InvalidDefaultsError, option.Name)
+			continue
+		}
+
+		if field.CanUint() {
+			field.SetUint(uint64(option.Min))
+			assert.NoError(t, validateDefaults(valid), option.Name)
+			field.SetUint(uint64(option.Min - 1))
+		} else {
+			field.SetInt(option.Min)
+			assert.NoError(t, validateDefaults(valid), option.Name)
+			field.SetInt(option.Min - 1)
+		}
+		assert.ErrorIs(t, validateDefaults(valid), InvalidDefaultsError, option.Name)
+	}
+}
@@ -0,0 +1,157 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"io"
+)
+
+// Flush overhead accounting
+// Every sync or full flush ends the current deflate block and emits an empty stored block, the flush marker, so the
+// receiver can uncompress everything written so far. Compressors keep track of the output spent on flush markers and on
+// the gzip or zlib framing, so streaming services can measure what their flush frequency costs.
+// Telling markers apart takes extra native calls on every flush, so accounting is enabled per compressor with
+// SetFlushAccounting.
+// Ending blocks early also costs compression ratio through more block headers and less repetition found within a
+// block. That cost is part of the compressed data and can only be measured by comparing with fewer flushes.
+
+var (
+	FlushAccountingDisabledError = errors.New("flush accounting is not enabled")
+)
+
+// gzip and zlib header and trailer sizes, without the optional gzip header fields
+const (
+	gzipFixedHeaderLen = 10
+	gzipTrailerLen     = 8
+	zlibHeaderLen      = 2
+	zlibTrailerLen     = 4
+)
+
+// FlushAccounting splits the output of a compressor, since it was created or last reset, between framing, flush
+// markers and compressed data
+type FlushAccounting struct {
+	// Flushes is the number of sync and full flushes that emitted a flush marker. Flushing without new data doesn't.
+	Flushes uint64
+	// FlushBytes is the size of the flush markers, including the padding aligning them to a byte boundary, rounded down
+	FlushBytes uint64
+	// FramingBytes is the size of the gzip or zlib header and trailer written so far, zero for raw deflate streams
+	FramingBytes uint64
+	// DataBytes is the rest of the output, the compressed deflate blocks
+	DataBytes uint64
+}
+
+// Total returns the size of the output
+func (fa FlushAccounting) Total() uint64 {
+	return fa.FlushBytes + fa.FramingBytes + fa.DataBytes
+}
+
+// Overhead returns the fraction of the output spent on flush markers and framing, zero when there's no output
+func (fa FlushAccounting) Overhead() float64 {
+	total := fa.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(fa.FlushBytes+fa.FramingBytes) / float64(total)
+}
+
+// flushAccounting is the state a compressor keeps to tell flush markers apart from compressed data
+type flushAccounting struct {
+	enabled    bool
+	flushes    uint64
+	markerBits uint64
+	// lastFlushIn is the total input of the stream at the last flush
+	lastFlushIn uint64
+	// finished is true once the stream ended and its trailer was written
+	finished bool
+}
+
+// completeBlock ends the current deflate block without aligning the output to a byte boundary, so the flush marker
+// that follows can be told apart from the compressed data. It's skipped when there's no new input since the last flush,
+// as zlib would otherwise emit a marker for a flush that has nothing to flush.
+func (comp *goGZipCompressor) completeBlock() C.int {
+	zs := comp.transformer.zs
+	if uint64(zs.total_in) == comp.flushAccounting.lastFlushIn && zs.total_out > 0 {
+		return C.Z_OK
+	}
+	return comp.deflateFlush(C.Z_BLOCK)
+}
+
+// outputBits returns the number of bits produced by the stream, including the ones not yet written to the output
+func (comp *goGZipCompressor) outputBits() uint64 {
+	var pending C.unsigned
+	var bits C.int
+	C.deflatePending(comp.transformer.zs, &pending, &bits)
+
+	return (uint64(comp.transformer.zs.total_out)+uint64(pending))*8 + uint64(bits)
+}
+
+// recordFlush accounts the output produced by a flush after the compressed data ending at dataEnd bits
+func (comp *goGZipCompressor) recordFlush(dataEnd uint64) {
+	end := comp.outputBits()
+	if end > dataEnd {
+		comp.flushAccounting.flushes++
+		comp.flushAccounting.markerBits += end - dataEnd
+	}
+	comp.flushAccounting.lastFlushIn = uint64(comp.transformer.zs.total_in)
+}
+
+// framingLen returns the size of the header and trailer of the stream format
+func (comp *goGZipCompressor) framingLen() (int, int) {
+	switch {
+	case comp.initWindowBits > C.MAX_WBITS:
+		return gzipFixedHeaderLen + comp.gzHeaderFieldsLen, gzipTrailerLen
+	case comp.initWindowBits > 0:
+		return zlibHeaderLen, zlibTrailerLen
+	default:
+		return 0, 0
+	}
+}
+
+// SetFlushAccounting is a helper function to enable or disable the flush accounting of a compressor
+// Flushes made while accounting is disabled are counted as compressed data, so it's best enabled before the first
+// write. The setting is kept when the compressor is reset.
+func SetFlushAccounting(compressor io.WriteCloser, enabled bool) (err error) {
+	defer recoverPanic("SetFlushAccounting", &err)
+
+	goCompressorOf(compressor).flushAccounting.enabled = enabled
+	return nil
+}
+
+// FlushOverhead returns how the output of the compressor splits between framing, flush markers and compressed data
+// It fails with FlushAccountingDisabledError unless accounting was enabled with SetFlushAccounting.
+func (comp *goGZipCompressor) FlushOverhead() (accounting FlushAccounting, err error) {
+	defer recoverPanic("FlushOverhead", &err)
+
+	if !comp.flushAccounting.enabled {
+		return FlushAccounting{}, FlushAccountingDisabledError
+	}
+
+	total := uint64(comp.transformer.zs.total_out)
+	headerLen, trailerLen := comp.framingLen()
+
+	var framing uint64
+	if total > 0 {
+		framing += uint64(headerLen)
+	}
+	if comp.flushAccounting.finished {
+		framing += uint64(trailerLen)
+	}
+
+	flushBytes := comp.flushAccounting.markerBits / 8
+	return FlushAccounting{
+		Flushes:      comp.flushAccounting.flushes,
+		FlushBytes:   flushBytes,
+		FramingBytes: framing,
+		DataBytes:    total - framing - flushBytes,
+	}, nil
+}
+
+// FlushOverhead is a helper function returning the output accounting of a compressor given an interface
+func FlushOverhead(compressor io.WriteCloser) (accounting FlushAccounting, err error) {
+	defer recoverPanic("FlushOverhead", &err)
+
+	return goCompressorOf(compressor).FlushOverhead()
+}
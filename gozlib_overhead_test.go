@@ -0,0 +1,133 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushOverheadSyncFlushes(t *testing.T) {
+	const flushes = 100
+	data := makeTestData(flushes * 1000)
+
+	// writers with and without spare capacity take different native paths
+	for _, direct := range []bool{false, true} {
+		buffer := &bytes.Buffer{}
+		var output io.Writer = struct{ io.Writer }{buffer}
+		if direct {
+			output = buffer
+		}
+
+		compressor, err := NewGoGZipCompressor(output, CompressionLevelDefault, 4096)
+		require.NoError(t, err)
+		require.NoError(t, SetFlushAccounting(compressor, true))
+
+		for flush := 0; flush < flushes; flush++ {
+			_, err = compressor.Write(data[flush*1000 : (flush+1)*1000])
+			require.NoError(t, err)
+			require.NoError(t, SyncFlush(compressor))
+
+			// a flush without new data emits nothing
+			flushedLen := buffer.Len()
+			require.NoError(t, SyncFlush(compressor))
+			assert.Equal(t, flushedLen, buffer.Len())
+		}
+
+		overhead, err := FlushOverhead(compressor)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(flushes), overhead.Flushes)
+		// each marker is a 3 bit block header, up to 7 bits of padding and 4 bytes of stored length
+		assert.GreaterOrEqual(t, overhead.FlushBytes, uint64(flushes*35/8))
+		assert.LessOrEqual(t, overhead.FlushBytes, uint64(flushes*42/8))
+		assert.Equal(t, uint64(gzipFixedHeaderLen), overhead.FramingBytes)
+		assert.Equal(t, uint64(buffer.Len()), overhead.Total())
+
+		_, err = Finish(compressor)
+		require.NoError(t, err)
+		overhead, err = FlushOverhead(compressor)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(gzipFixedHeaderLen+gzipTrailerLen), overhead.FramingBytes)
+		assert.Equal(t, uint64(buffer.Len()), overhead.Total())
+		assert.Greater(t, overhead.Overhead(), 0.0)
+		assert.Less(t, overhead.Overhead(), 1.0)
+		require.NoError(t, compressor.Close())
+
+		uncompressed, err := stdLibGZipUncompress(buffer, int64(len(data)))
+		assert.NoError(t, err)
+		assert.Equal(t, data, uncompressed)
+	}
+}
+
+func TestFlushOverheadFraming(t *testing.T) {
+	data := makeTestData(5000)
+	header := &GZipHeader{Name: "name.txt", Comment: "comment", ModTime: time.Unix(1700000000, 0), Extra: []byte{'A', 'B', 0, 0}}
+
+	newCompressors := map[uint64]func(io.Writer) (io.WriteCloser, error){
+		zlibHeaderLen + zlibTrailerLen: func(output io.Writer) (io.WriteCloser, error) {
+			return NewGoZLibCompressor(output, CompressionLevelBestSpeed, 1024)
+		},
+		0: func(output io.Writer) (io.WriteCloser, error) {
+			return NewGoRawDeflateCompressor(output, CompressionLevelBestSpeed, 1024)
+		},
+		gzipFixedHeaderLen + 2 + 4 + 9 + 8 + gzipTrailerLen: func(output io.Writer) (io.WriteCloser, error) {
+			return NewGoGZipCompressorWithOptions(output, CompressionLevelBestSpeed, 1024, TransformerOptions{Header: header})
+		},
+	}
+
+	for framing, newCompressor := range newCompressors {
+		output := &bytes.Buffer{}
+		compressor, err := newCompressor(output)
+		require.NoError(t, err)
+		require.NoError(t, SetFlushAccounting(compressor, true))
+
+		_, err = compressor.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, FullFlush(compressor))
+		_, err = compressor.Write(data)
+		require.NoError(t, err)
+		_, err = Finish(compressor)
+		require.NoError(t, err)
+
+		overhead, err := FlushOverhead(compressor)
+		require.NoError(t, err)
+		assert.Equal(t, framing, overhead.FramingBytes)
+		assert.Equal(t, uint64(1), overhead.Flushes)
+		assert.Equal(t, uint64(output.Len()), overhead.Total())
+
+		// resetting starts a new accounting, still enabled
+		ResetCompressor(io.Discard, compressor)
+		overhead, err = FlushOverhead(compressor)
+		require.NoError(t, err)
+		assert.Equal(t, FlushAccounting{}, overhead)
+		assert.Equal(t, 0.0, overhead.Overhead())
+		require.NoError(t, compressor.Close())
+	}
+}
+
+func TestFlushOverheadDisabled(t *testing.T) {
+	data := makeTestData(5000)
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	_, err = FlushOverhead(compressor)
+	assert.ErrorIs(t, err, FlushAccountingDisabledError)
+
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, SyncFlush(compressor))
+	flushedLen := output.Len()
+	require.NoError(t, SyncFlush(compressor))
+	assert.Equal(t, flushedLen, output.Len())
+
+	_, err = Finish(compressor)
+	require.NoError(t, err)
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
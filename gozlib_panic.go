@@ -0,0 +1,54 @@
+package gozlib
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Panic recovery
+// When enabled, panics raised while running the main public entry points, including the ones caused by misuse like
+// passing a writer not created by this package to Flush, are recovered and returned as errors instead of taking down
+// the process. A transformer whose call panicked may be left in an inconsistent state and should only be closed.
+// Helper functions that don't return an error, like ResetCompressor, ResetUncompressor, SetTrailingDataMode or
+// SetIntegrityMode, aren't covered and panic as usual when given a writer or reader not created by this package.
+
+var PanicError = errors.New("gozlib panicked")
+
+// PanicDiagnostic is the error returned in place of a recovered panic, it wraps PanicError
+type PanicDiagnostic struct {
+	// Operation is the public entry point that panicked
+	Operation string
+	// Value is the value the panic was raised with
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+func (pd *PanicDiagnostic) Error() string {
+	return fmt.Sprintf("%v in %s: %v", PanicError, pd.Operation, pd.Value)
+}
+
+func (pd *PanicDiagnostic) Unwrap() error {
+	return PanicError
+}
+
+var panicRecovery atomic.Bool
+
+// SetPanicRecovery sets whether panics in public entry points are recovered and returned as errors wrapping PanicError
+func SetPanicRecovery(enabled bool) {
+	panicRecovery.Store(enabled)
+}
+
+// recoverPanic sets err to a PanicDiagnostic when panic recovery is enabled and operation panicked
+// It must be deferred directly by the entry point for recover to stop the panic.
+func recoverPanic(operation string, err *error) {
+	if !panicRecovery.Load() {
+		return
+	}
+
+	if r := recover(); r != nil {
+		*err = &PanicDiagnostic{Operation: operation, Value: r, Stack: debug.Stack()}
+	}
+}
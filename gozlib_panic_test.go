@@ -0,0 +1,250 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestPanicRecoveryReturnsError(t *testing.T) {
+	SetPanicRecovery(true)
+	t.Cleanup(func() { SetPanicRecovery(false) })
+
+	// helpers only accept transformers created by this package
+	err := Flush(nopWriteCloser{io.Discard})
+	require.ErrorIs(t, err, PanicError)
+
+	var diagnostic *PanicDiagnostic
+	require.ErrorAs(t, err, &diagnostic)
+	assert.Equal(t, "Flush", diagnostic.Operation)
+	assert.NotEmpty(t, diagnostic.Stack)
+	assert.Contains(t, err.Error(), "Flush")
+
+	_, err = Peek(io.NopCloser(bytes.NewReader(nil)), 10)
+	assert.ErrorIs(t, err, PanicError)
+	_, err = Header(io.NopCloser(bytes.NewReader(nil)))
+	assert.ErrorIs(t, err, PanicError)
+	err = SetWriteChunking(nopWriteCloser{io.Discard}, WriteChunkOptions{})
+	assert.ErrorIs(t, err, PanicError)
+	err = ResetUncompressorAt(bytes.NewReader(nil), 0, io.NopCloser(bytes.NewReader(nil)))
+	assert.ErrorIs(t, err, PanicError)
+
+	// regular calls are unaffected
+	compressed, err := stdLibGZipCompressSlice(makeTestData(1000))
+	require.NoError(t, err)
+	uncompressed := &bytes.Buffer{}
+	_, err = Decompress(uncompressed, bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, uncompressed.Len())
+}
+
+func TestPanicRecoveryDisabled(t *testing.T) {
+	assert.Panics(t, func() {
+		_ = Flush(nopWriteCloser{io.Discard})
+	})
+}
+
+type panickingReader struct{}
+
+func (panickingReader) Read([]byte) (int, error) {
+	panic("read")
+}
+
+type panickingWriter struct{}
+
+func (panickingWriter) Write([]byte) (int, error) {
+	panic("write")
+}
+
+type panickingConn struct {
+	net.Conn
+}
+
+func (panickingConn) Read([]byte) (int, error) {
+	panic("read")
+}
+
+type panickingJobStore struct {
+	memoryJobStore
+}
+
+func (*panickingJobStore) Pending() ([]Job, error) {
+	panic("pending")
+}
+
+func TestPanicRecoveryCoversEntryPoints(t *testing.T) {
+	SetPanicRecovery(true)
+	t.Cleanup(func() { SetPanicRecovery(false) })
+
+	// methods panic when invoked on nil receivers, functions when given inputs or handlers that panic
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"ActivateCompression", func() error { return ActivateCompression((*compressedConn)(nil)) }},
+		{"ActivateDecompression", func() error { return ActivateDecompression((*compressedConn)(nil)) }},
+		{"CapturePosition", func() error { _, err := CapturePosition((*goUncompressor)(nil)); return err }},
+		{"Compress", func() error { _, err := Compress(io.Discard, panickingReader{}, CompressionLevelBestSpeed); return err }},
+		{"CompressAndHash", func() error { _, _, err := CompressAndHash([]byte("data"), nil); return err }},
+		{"CompressFS", func() error { return CompressFS(t.TempDir(), nil, FSOptions{}) }},
+		{"CompressorFromContext", func() error { _, err := CompressorFromContext(nil, io.Discard, CompressionLevelBestSpeed); return err }},
+		{"Copy", func() error { _, err := Copy(io.Discard, panickingReader{}); return err }},
+		{"Decompress", func() error { _, err := Decompress(io.Discard, panickingReader{}); return err }},
+		{"DecompressBounded", func() error { _, _, err := DecompressBounded(io.Discard, panickingReader{}, 10); return err }},
+		{"DecompressFS", func() error { return DecompressFS(t.TempDir(), nil, FSOptions{}) }},
+		{"Diagnose", func() error { _, err := Diagnose(panickingReader{}); return err }},
+		{"Dictionary", func() error { _, err := Dictionary((*goUncompressor)(nil), nil); return err }},
+		{"Finish", func() error { _, err := Finish(nopWriteCloser{io.Discard}); return err }},
+		{"FlushOverhead", func() error { _, err := FlushOverhead(nopWriteCloser{io.Discard}); return err }},
+		{"FullFlush", func() error { return FullFlush(nopWriteCloser{io.Discard}) }},
+		{"LastCallbackError", func() error { return LastCallbackError((*goUncompressor)(nil)) }},
+		{"NewIndexedRangeHandler", func() error {
+			_, err := NewIndexedRangeHandler(bytes.NewReader(nil), 0, nil, "name", time.Time{})
+			return err
+		}},
+		{"NewQueue", func() error { _, err := NewQueue(QueueOptions{Workers: 1, Store: &panickingJobStore{}}); return err }},
+		{"NewUncompressorAtPosition", func() error { _, err := NewUncompressorAtPosition(bytes.NewReader(nil), nil, 0); return err }},
+		{"OpenAt", func() error { _, err := OpenAt(bytes.NewReader(nil), nil, 0, 0); return err }},
+		{"OpenPart", func() error { _, err := OpenPart(nil); return err }},
+		{"ReadCompressedIndex", func() error { _, err := ReadCompressedIndex(panickingReader{}); return err }},
+		{"ReadGZipHeader", func() error { _, _, err := ReadGZipHeader(panickingReader{}); return err }},
+		{"ReadMessage", func() error { _, err := ReadMessage(panickingReader{}, nil); return err }},
+		{"RecoverData", func() error { _, err := RecoverData(io.Discard, panickingReader{}); return err }},
+		{"RecoverSegment", func() error { _, _, err := RecoverSegment(panickingReader{}); return err }},
+		{"ResumeCompressor", func() error { _, err := ResumeCompressor(io.Discard, nil, 0); return err }},
+		{"SetFlushAccounting", func() error { return SetFlushAccounting(nopWriteCloser{io.Discard}, true) }},
+		{"Skip", func() error { _, err := Skip(io.NopCloser(bytes.NewReader(nil)), 10); return err }},
+		{"SyncFlush", func() error { return SyncFlush(nopWriteCloser{io.Discard}) }},
+		{"UncompressFrames", func() error { _, err := UncompressFrames(panickingReader{}, nil, nil); return err }},
+		{"UncompressorFromContext", func() error { _, err := UncompressorFromContext(nil, bytes.NewReader(nil)); return err }},
+		{"WrapConn Read", func() error {
+			client, server := net.Pipe()
+			conn, err := WrapConn(panickingConn{client}, CompressionLevelBestSpeed)
+			require.NoError(t, err)
+			defer conn.Close()
+			// closed first so closing conn doesn't block sending the end of the stream
+			defer server.Close()
+			_, err = conn.Read(make([]byte, 10))
+			return err
+		}},
+		{"WriteMessage", func() error {
+			_, err := WriteMessage(panickingWriter{}, CompressionLevelBestSpeed, []byte("data"))
+			return err
+		}},
+		{"WritePNGChunk", func() error { return WritePNGChunk(panickingWriter{}, "IDAT", []byte("data")) }},
+
+		{"BatchCompressor.EncodeAppend", func() error { _, err := (*BatchCompressor)(nil).EncodeAppend(nil, []byte("data")); return err }},
+		{"BatchCompressor.Close", func() error { return (*BatchCompressor)(nil).Close() }},
+		{"BatchUncompressor.DecodeAppend", func() error { _, err := (*BatchUncompressor)(nil).DecodeAppend(nil, []byte("data")); return err }},
+		{"BatchUncompressor.Close", func() error { return (*BatchUncompressor)(nil).Close() }},
+		{"ChunkCompressor.SetBackend", func() error { return (*ChunkCompressor)(nil).SetBackend(BackendGo) }},
+		{"ChunkCompressor.CompressChunks", func() error { _, err := (*ChunkCompressor)(nil).CompressChunks([][]byte{{1}}); return err }},
+		{"CompressedIndex.WriteTo", func() error { _, err := (*CompressedIndex)(nil).WriteTo(io.Discard); return err }},
+		{"CompressedIndex.Lookup", func() error { _, err := (*CompressedIndex)(nil).Lookup(0); return err }},
+		{"CompressorSnapshot.MarshalBinary", func() error { _, err := (*CompressorSnapshot)(nil).MarshalBinary(); return err }},
+		{"CompressorSnapshot.UnmarshalBinary", func() error {
+			data, err := (&CompressorSnapshot{}).MarshalBinary()
+			require.NoError(t, err)
+			return (*CompressorSnapshot)(nil).UnmarshalBinary(data)
+		}},
+		{"Demux.ReadFrame", func() error { _, err := (*Demux)(nil).ReadFrame(nil); return err }},
+		{"Demux.Close", func() error { return (*Demux)(nil).Close() }},
+		{"Engine.SetBackend", func() error { return (*Engine)(nil).SetBackend(BackendGo) }},
+		{"Engine.Deflate", func() error { _, _, err := (*Engine)(nil).Deflate(nil, nil, FlushModeNone); return err }},
+		{"Engine.DeflateBound", func() error { _, err := (*Engine)(nil).DeflateBound(10); return err }},
+		{"Engine.Inflate", func() error { _, _, err := (*Engine)(nil).Inflate(nil, nil, FlushModeNone); return err }},
+		{"Engine.Close", func() error { return (*Engine)(nil).Close() }},
+		{"Governor.Compress", func() error {
+			_, _, err := (*Governor)(nil).Compress(io.Discard, bytes.NewReader(nil), CompressionLevelBestSpeed)
+			return err
+		}},
+		{"IndexedCompressor.Write", func() error { _, err := (*IndexedCompressor)(nil).Write([]byte("data")); return err }},
+		{"IndexedCompressor.WriteByte", func() error { return (*IndexedCompressor)(nil).WriteByte(1) }},
+		{"IndexedCompressor.FullFlush", func() error { return (*IndexedCompressor)(nil).FullFlush() }},
+		{"MultipartWriter.CreateCompressedPart", func() error { _, err := (*MultipartWriter)(nil).CreateCompressedPart(nil); return err }},
+		{"MultipartWriter.CreateCompressedFormFile", func() error {
+			_, err := (*MultipartWriter)(nil).CreateCompressedFormFile("field", "file")
+			return err
+		}},
+		{"MultipartWriter.CreatePart", func() error { _, err := (*MultipartWriter)(nil).CreatePart(nil); return err }},
+		{"MultipartWriter.Close", func() error { return (*MultipartWriter)(nil).Close() }},
+		{"Mux.Stream", func() error { _, err := (*Mux)(nil).Stream(1); return err }},
+		{"Mux.Close", func() error { return (*Mux)(nil).Close() }},
+		{"NDJSONWriter.Encode", func() error { return (*NDJSONWriter)(nil).Encode("value") }},
+		{"NDJSONWriter.Flush", func() error { return (*NDJSONWriter)(nil).Flush() }},
+		{"NDJSONWriter.Close", func() error { return (*NDJSONWriter)(nil).Close() }},
+		{"ObjectDeflater.Deflate", func() error { _, err := (*ObjectDeflater)(nil).Deflate(nil, []byte("data")); return err }},
+		{"ObjectDeflater.Close", func() error { return (*ObjectDeflater)(nil).Close() }},
+		{"ObjectInflater.Inflate", func() error { _, _, err := (*ObjectInflater)(nil).Inflate(nil, []byte("data"), 10); return err }},
+		{"ObjectInflater.Close", func() error { return (*ObjectInflater)(nil).Close() }},
+		{"PooledSlice.Release", func() error { return (*PooledSlice)(nil).Release() }},
+		{"Queue.Enqueue", func() error { return (*Queue)(nil).Enqueue(Job{Source: bytes.NewReader(nil), Destination: io.Discard}) }},
+		{"Queue.Close", func() error { return (*Queue)(nil).Close() }},
+		{"ReadPosition.MarshalBinary", func() error { _, err := (*ReadPosition)(nil).MarshalBinary(); return err }},
+		{"ReadPosition.UnmarshalBinary", func() error {
+			data, err := (&ReadPosition{}).MarshalBinary()
+			require.NoError(t, err)
+			return (*ReadPosition)(nil).UnmarshalBinary(data)
+		}},
+		{"ResumableCompressor.Write", func() error { _, err := (*ResumableCompressor)(nil).Write([]byte("data")); return err }},
+		{"ResumableCompressor.Snapshot", func() error { _, err := (*ResumableCompressor)(nil).Snapshot(); return err }},
+		{"ResumableCompressor.Close", func() error { return (*ResumableCompressor)(nil).Close() }},
+		{"SegmentReader.Next", func() error { _, err := (*SegmentReader)(nil).Next(nil); return err }},
+		{"SegmentReader.SetBackend", func() error { return (*SegmentReader)(nil).SetBackend(BackendGo) }},
+		{"SegmentReader.Close", func() error { return (*SegmentReader)(nil).Close() }},
+		{"SegmentWriter.Append", func() error { _, _, err := (*SegmentWriter)(nil).Append([]byte("data")); return err }},
+		{"SegmentWriter.Sync", func() error { return (*SegmentWriter)(nil).Sync() }},
+		{"SegmentWriter.SetBackend", func() error { return (*SegmentWriter)(nil).SetBackend(BackendGo) }},
+		{"SegmentWriter.Close", func() error { return (*SegmentWriter)(nil).Close() }},
+		{"SizedCompressor.Write", func() error { _, err := (*SizedCompressor)(nil).Write([]byte("data")); return err }},
+		{"SizedCompressor.Finish", func() error { _, _, err := (*SizedCompressor)(nil).Finish(); return err }},
+		{"SizedCompressor.Close", func() error { return (*SizedCompressor)(nil).Close() }},
+		{"Transcoder.Transcode", func() error { _, err := (*Transcoder)(nil).Transcode(io.Discard, bytes.NewReader(nil)); return err }},
+		{"Transcoder.SetBackend", func() error { return (*Transcoder)(nil).SetBackend(BackendGo) }},
+		{"Transcoder.Close", func() error { return (*Transcoder)(nil).Close() }},
+		{"TransformerPool.AcquireCompressorFor", func() error {
+			_, err := (*TransformerPool)(nil).AcquireCompressorFor("tenant", io.Discard, CompressionLevelBestSpeed)
+			return err
+		}},
+		{"TransformerPool.AcquireUncompressorFor", func() error {
+			_, err := (*TransformerPool)(nil).AcquireUncompressorFor("tenant", bytes.NewReader(nil))
+			return err
+		}},
+		{"TransformerPool.Close", func() error { return (*TransformerPool)(nil).Close() }},
+		{"WireCodec.CompressPacket", func() error { _, err := (*WireCodec)(nil).CompressPacket(nil, []byte("data")); return err }},
+		{"WireCodec.UncompressPacket", func() error { _, err := (*WireCodec)(nil).UncompressPacket(nil, []byte("data")); return err }},
+		{"WireCodec.Close", func() error { return (*WireCodec)(nil).Close() }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			require.ErrorIs(t, err, PanicError)
+
+			var diagnostic *PanicDiagnostic
+			require.ErrorAs(t, err, &diagnostic)
+			assert.NotEmpty(t, diagnostic.Operation)
+		})
+	}
+
+	// panics raised by stream handlers can't unwind through zlib, they are always returned as CallbackPanicError
+	_, err := GoGZipCompressStream(CompressionLevelBestSpeed, 16, 16, nil, nil)
+	assert.ErrorIs(t, err, CallbackPanicError)
+	_, err = GoUncompressStream(16, 16, nil, nil)
+	assert.ErrorIs(t, err, CallbackPanicError)
+	_, err = GoValidateStream(16, nil)
+	assert.ErrorIs(t, err, CallbackPanicError)
+}
@@ -0,0 +1,207 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// PNG image data compression
+// PNG image data is a single zlib stream split across IDAT chunks. The compressor here uses the Z_FILTERED strategy,
+// which suits scanlines already processed by PNG filters, and hands compressed data over in chunk sized pieces.
+
+// PNGDefaultChunkSize is the IDAT chunk size used by image/png
+const PNGDefaultChunkSize = 1 << 15
+
+const (
+	pngMinWindowBits = 9
+	pngMaxWindowBits = C.MAX_WBITS
+	pngChunkTypeLen  = 4
+)
+
+var (
+	PNGCompressorOptionsError = errors.New("invalid PNG compressor options")
+	PNGChunkTypeError         = errors.New("PNG chunk type must be 4 bytes long")
+)
+
+// PNGChunkHandler receives compressed image data, at most one chunk in size
+type PNGChunkHandler func(chunk []byte) error
+
+type pngChunker struct {
+	chunk   []byte
+	onChunk PNGChunkHandler
+}
+
+func (pc *pngChunker) Write(data []byte) (int, error) {
+	written := 0
+	for written < len(data) {
+		copied := copy(pc.chunk[len(pc.chunk):cap(pc.chunk)], data[written:])
+		pc.chunk = pc.chunk[:len(pc.chunk)+copied]
+		written += copied
+
+		if len(pc.chunk) == cap(pc.chunk) {
+			err := pc.emit()
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (pc *pngChunker) emit() error {
+	if len(pc.chunk) == 0 {
+		return nil
+	}
+
+	err := pc.onChunk(pc.chunk)
+	pc.chunk = pc.chunk[:0]
+	return err
+}
+
+type pngCompressor struct {
+	*goGZipCompressor
+	chunker *pngChunker
+}
+
+// NewPNGCompressor creates a compressor for PNG image data, producing a zlib stream with the Z_FILTERED strategy
+// windowBits sets the size of the sliding window, from 9 to 15 (32KB), and smaller windows save memory for small images.
+// onChunk is called with compressed data chunkSize bytes at a time, except for the last chunk which may be smaller.
+// The chunk slice is reused and is only valid during the call. Closing the compressor ends the stream and emits the last chunk.
+// Flushing it, directly or with the Flush, SyncFlush, FullFlush and Finish helpers, also emits the data compressed so far
+// as a possibly smaller chunk.
+func NewPNGCompressor(onChunk PNGChunkHandler, level CompressionLevel, windowBits int, chunkSize int, bufferSize uint32) (writer io.WriteCloser, err error) {
+	defer recoverPanic("NewPNGCompressor", &err)
+
+	if windowBits < pngMinWindowBits || windowBits > pngMaxWindowBits {
+		return nil, fmt.Errorf("%w: window bits %d out of range", PNGCompressorOptionsError, windowBits)
+	}
+
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("%w: chunk size must be greater than zero", PNGCompressorOptionsError)
+	}
+
+	chunker := &pngChunker{
+		chunk:   make([]byte, 0, chunkSize),
+		onChunk: onChunk,
+	}
+
+	compressor, err := newGoCompressorWithInit(chunker, level, func(goTransformer *goZLibTransformer) error {
+		return initCompressionTransformer(goTransformer, level, windowBits, C.Z_FILTERED, bufferSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	compressor.windowBits = windowBits
+
+	return &pngCompressor{goGZipCompressor: compressor, chunker: chunker}, nil
+}
+
+// Close ends the compressed stream, emits the last chunk and releases the compressor
+func (pc *pngCompressor) Close() (err error) {
+	defer recoverPanic("PNG compressor Close", &err)
+
+	cerr := pc.goGZipCompressor.Close()
+	if cerr != nil {
+		return cerr
+	}
+
+	return pc.chunker.emit()
+}
+
+// Flush ends the compressed stream and emits the last chunk
+func (pc *pngCompressor) Flush() (err error) {
+	defer recoverPanic("PNG compressor Flush", &err)
+
+	ferr := pc.goGZipCompressor.Flush()
+	if ferr != nil {
+		return ferr
+	}
+
+	return pc.chunker.emit()
+}
+
+// Finish ends the compressed stream, emits the last chunk and returns the total number of compressed bytes
+func (pc *pngCompressor) Finish() (compressedLen uint64, err error) {
+	defer recoverPanic("PNG compressor Finish", &err)
+
+	compressedLen, ferr := pc.goGZipCompressor.Finish()
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	return compressedLen, pc.chunker.emit()
+}
+
+// SyncFlush compresses all data written so far without ending the stream and emits it as a chunk
+func (pc *pngCompressor) SyncFlush() (err error) {
+	defer recoverPanic("PNG compressor SyncFlush", &err)
+
+	ferr := pc.goGZipCompressor.SyncFlush()
+	if ferr != nil {
+		return ferr
+	}
+
+	return pc.chunker.emit()
+}
+
+// FullFlush is like SyncFlush but also resets the compression state
+func (pc *pngCompressor) FullFlush() (err error) {
+	defer recoverPanic("PNG compressor FullFlush", &err)
+
+	ferr := pc.goGZipCompressor.FullFlush()
+	if ferr != nil {
+		return ferr
+	}
+
+	return pc.chunker.emit()
+}
+
+// resetOutput starts a new stream whose chunks are written to output, dropping the chunk not yet emitted
+func (pc *pngCompressor) resetOutput(output io.Writer) {
+	pc.chunker.chunk = pc.chunker.chunk[:0]
+	pc.chunker.onChunk = func(chunk []byte) error {
+		_, err := output.Write(chunk)
+		return err
+	}
+	pc.goGZipCompressor.resetOutput(pc.chunker)
+}
+
+// WritePNGChunk writes a complete PNG chunk with the given 4 byte type and data to w, including its length and CRC
+// Combined with NewPNGCompressor, it can be used to write IDAT chunks:
+//
+//	NewPNGCompressor(func(chunk []byte) error { return WritePNGChunk(w, "IDAT", chunk) }, ...)
+func WritePNGChunk(w io.Writer, chunkType string, data []byte) (err error) {
+	defer recoverPanic("WritePNGChunk", &err)
+
+	if len(chunkType) != pngChunkTypeLen {
+		return PNGChunkTypeError
+	}
+
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	for _, part := range [][]byte{header[:], data, footer[:]} {
+		_, err := w.Write(part)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPNGCompressorProducesValidImage(t *testing.T) {
+	const width, height = 300, 200
+	encoded := bytes.NewBuffer([]byte{})
+	encoded.Write([]byte("\x89PNG\r\n\x1a\n"))
+
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 0 // grayscale
+	assert.NoError(t, WritePNGChunk(encoded, "IHDR", ihdr[:]))
+
+	chunkSizes := []int{}
+	compressor, err := NewPNGCompressor(func(chunk []byte) error {
+		chunkSizes = append(chunkSizes, len(chunk))
+		return WritePNGChunk(encoded, "IDAT", chunk)
+	}, CompressionLevelBestCompression, 12, 1024, 4096)
+	assert.NoError(t, err)
+
+	// noise compresses poorly, forcing the data to span several chunks
+	pixels := makeTestData(width * height)
+	for row := 0; row < height; row++ {
+		// each scanline starts with the filter type, 0 for none
+		_, err = compressor.Write([]byte{0})
+		assert.NoError(t, err)
+		_, err = compressor.Write(pixels[row*width : (row+1)*width])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, compressor.Close())
+	assert.NoError(t, WritePNGChunk(encoded, "IEND", nil))
+
+	assert.Greater(t, len(chunkSizes), 1)
+	for _, size := range chunkSizes[:len(chunkSizes)-1] {
+		assert.Equal(t, 1024, size)
+	}
+
+	img, err := png.Decode(encoded)
+	assert.NoError(t, err)
+	bounds := img.Bounds()
+	assert.Equal(t, width, bounds.Dx())
+	assert.Equal(t, height, bounds.Dy())
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gray, _, _, _ := img.At(x, y).RGBA()
+			assert.Equal(t, uint32(pixels[y*width+x]), gray>>8)
+		}
+	}
+}
+
+func TestPNGCompressorOptions(t *testing.T) {
+	onChunk := func(chunk []byte) error { return nil }
+
+	_, err := NewPNGCompressor(onChunk, CompressionLevelBestSpeed, 8, PNGDefaultChunkSize, 1024)
+	assert.ErrorIs(t, err, PNGCompressorOptionsError)
+
+	_, err = NewPNGCompressor(onChunk, CompressionLevelBestSpeed, 15, 0, 1024)
+	assert.ErrorIs(t, err, PNGCompressorOptionsError)
+
+	assert.ErrorIs(t, WritePNGChunk(bytes.NewBuffer([]byte{}), "IDATA", nil), PNGChunkTypeError)
+}
+
+func TestPNGCompressorWithHelpers(t *testing.T) {
+	data := makeTestData(5000)
+	chunks := bytes.NewBuffer([]byte{})
+	compressor, err := NewPNGCompressor(func(chunk []byte) error {
+		chunks.Write(chunk)
+		return nil
+	}, CompressionLevelDefault, 15, 1<<20, 1024)
+	require.NoError(t, err)
+
+	SetEmptyWriteMode(compressor, EmptyWriteIgnore)
+	assert.NoError(t, SetFlushAccounting(compressor, true))
+
+	_, err = compressor.Write(data[:1000])
+	assert.NoError(t, err)
+	assert.NoError(t, SyncFlush(compressor))
+	// the chunk isn't full, but flushing emits the data compressed so far
+	assert.NotZero(t, chunks.Len())
+
+	_, err = compressor.Write(data[1000:])
+	assert.NoError(t, err)
+	assert.NoError(t, FullFlush(compressor))
+	compressedLen, err := Finish(compressor)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(chunks.Len()), compressedLen)
+	assert.NoError(t, LastCallbackError(compressor))
+	assert.NoError(t, compressor.Close())
+
+	reader, err := zlib.NewReader(chunks)
+	require.NoError(t, err)
+	uncompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestPNGCompressorReset(t *testing.T) {
+	compressor, err := NewPNGCompressor(func(chunk []byte) error {
+		return nil
+	}, CompressionLevelDefault, 15, 1<<20, 1024)
+	require.NoError(t, err)
+	_, err = compressor.Write(makeTestData(1000))
+	assert.NoError(t, err)
+
+	data := makeTestData(5000)
+	chunks := bytes.NewBuffer([]byte{})
+	ResetCompressor(chunks, compressor)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	reader, err := zlib.NewReader(chunks)
+	require.NoError(t, err)
+	uncompressed, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
@@ -0,0 +1,485 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolBufferSize = 1024 * 16
+	copyBufferSize        = 1024 * 32
+
+	// native memory used by zlib for default window and memory levels, see zlib's zconf.h
+	deflateStateMemory = (1 << (15 + 2)) + (1 << (8 + 9))
+	inflateStateMemory = (1 << 15) + 1024*7
+)
+
+var (
+	TransformerPoolClosedError = errors.New("transformer pool is closed")
+	TenantQuotaExceededError   = errors.New("tenant quota exceeded")
+	OutputLimitReachedError    = errors.New("output limit reached before the end of the compressed data")
+)
+
+// TenantQuota limits the transformers a tenant can have acquired at once, zero values mean no limit
+type TenantQuota struct {
+	// MaxActive is the maximum number of acquired transformers
+	MaxActive int
+	// MaxNativeMemory is the maximum estimated native memory of acquired transformers, including zlib state and buffers
+	MaxNativeMemory uint64
+}
+
+// TenantQuotaError is returned when acquiring a transformer would exceed a tenant quota
+// It matches TenantQuotaExceededError with errors.Is.
+type TenantQuotaError struct {
+	Tenant string
+	// Resource is either "active" or "memory"
+	Resource string
+	Limit    uint64
+}
+
+func (tqe *TenantQuotaError) Error() string {
+	return fmt.Sprintf("%s: tenant %q, %s limit %d", TenantQuotaExceededError, tqe.Tenant, tqe.Resource, tqe.Limit)
+}
+
+func (tqe *TenantQuotaError) Unwrap() error {
+	return TenantQuotaExceededError
+}
+
+type tenantUsage struct {
+	active       int
+	nativeMemory uint64
+}
+
+type tenantLease struct {
+	tenant       string
+	nativeMemory uint64
+}
+
+// TransformerPool keeps idle compressors and uncompressors so they can be reused, avoiding the cost of initializing
+// new native transformers for each operation. It is safe for concurrent use.
+// Unlike sync.Pool, idle transformers are never dropped without being closed, so pooling doesn't leak native resources.
+type TransformerPool struct {
+	mutex                  sync.Mutex
+	compressorBufferSize   uint32
+	uncompressorBufferSize uint32
+	maxIdle                int
+	compressors            map[CompressionLevel][]io.WriteCloser
+	uncompressors          []io.ReadCloser
+	closed                 bool
+	quotas                 map[string]TenantQuota
+	usage                  map[string]*tenantUsage
+	leases                 map[io.Closer]tenantLease
+	releaseWindows         bool
+	// idleSince holds when each idle transformer was released, used by the idle reaper
+	idleSince  map[io.Closer]time.Time
+	reaperStop chan struct{}
+	now        func() time.Time
+}
+
+// NewTransformerPool creates a new transformer pool
+// bufferSize is the work buffer size of the transformers created by the pool and maxIdle the maximum number of idle
+// compressors and uncompressors kept by the pool. Transformers released once the pool is full are closed.
+func NewTransformerPool(bufferSize uint32, maxIdle int) *TransformerPool {
+	return newTransformerPool(bufferSize, bufferSize, maxIdle)
+}
+
+func newTransformerPool(compressorBufferSize uint32, uncompressorBufferSize uint32, maxIdle int) *TransformerPool {
+	return &TransformerPool{
+		compressorBufferSize:   compressorBufferSize,
+		uncompressorBufferSize: uncompressorBufferSize,
+		maxIdle:                maxIdle,
+		compressors:            map[CompressionLevel][]io.WriteCloser{},
+		uncompressors:          []io.ReadCloser{},
+		closed:                 false,
+		quotas:                 map[string]TenantQuota{},
+		usage:                  map[string]*tenantUsage{},
+		leases:                 map[io.Closer]tenantLease{},
+		idleSince:              map[io.Closer]time.Time{},
+		now:                    time.Now,
+	}
+}
+
+// SetTenantQuota sets the quota of a tenant, applied to transformers acquired after the call
+func (tp *TransformerPool) SetTenantQuota(tenant string, quota TenantQuota) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	tp.quotas[tenant] = quota
+}
+
+// AcquireCompressorFor is like AcquireCompressor, counting the compressor against the quota of tenant
+// A *TenantQuotaError is returned if the tenant is over quota.
+func (tp *TransformerPool) AcquireCompressorFor(tenant string, output io.Writer, level CompressionLevel) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("TransformerPool.AcquireCompressorFor", &err)
+
+	nativeMemory := uint64(deflateStateMemory) + uint64(tp.compressorBufferSize)
+	err = tp.reserve(tenant, nativeMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	compressor, err = tp.AcquireCompressor(output, level)
+	return compressor, tp.lease(compressor, err, tenant, nativeMemory)
+}
+
+// AcquireUncompressorFor is like AcquireUncompressor, counting the uncompressor against the quota of tenant
+// A *TenantQuotaError is returned if the tenant is over quota.
+func (tp *TransformerPool) AcquireUncompressorFor(tenant string, input io.Reader) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("TransformerPool.AcquireUncompressorFor", &err)
+
+	nativeMemory := uint64(inflateStateMemory) + uint64(tp.uncompressorBufferSize)
+	err = tp.reserve(tenant, nativeMemory)
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressor, err = tp.AcquireUncompressor(input)
+	return uncompressor, tp.lease(uncompressor, err, tenant, nativeMemory)
+}
+
+// reserve adds to the usage of tenant if within its quota
+func (tp *TransformerPool) reserve(tenant string, nativeMemory uint64) error {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	usage, found := tp.usage[tenant]
+	if !found {
+		usage = &tenantUsage{}
+		tp.usage[tenant] = usage
+	}
+
+	quota := tp.quotas[tenant]
+	if quota.MaxActive > 0 && usage.active >= quota.MaxActive {
+		return &TenantQuotaError{Tenant: tenant, Resource: "active", Limit: uint64(quota.MaxActive)}
+	}
+	if quota.MaxNativeMemory > 0 && usage.nativeMemory+nativeMemory > quota.MaxNativeMemory {
+		return &TenantQuotaError{Tenant: tenant, Resource: "memory", Limit: quota.MaxNativeMemory}
+	}
+
+	usage.active++
+	usage.nativeMemory += nativeMemory
+	return nil
+}
+
+// lease records the tenant of an acquired transformer, or undoes the reservation if acquisition failed
+func (tp *TransformerPool) lease(transformer io.Closer, err error, tenant string, nativeMemory uint64) error {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	if err != nil {
+		tp.unreserve(tenantLease{tenant: tenant, nativeMemory: nativeMemory})
+		return err
+	}
+
+	tp.leases[transformer] = tenantLease{tenant: tenant, nativeMemory: nativeMemory}
+	return nil
+}
+
+// releaseLease removes the tenant usage of a transformer, if it was acquired for a tenant. Must be called with the mutex locked
+func (tp *TransformerPool) releaseLease(transformer io.Closer) {
+	lease, found := tp.leases[transformer]
+	if !found {
+		return
+	}
+
+	delete(tp.leases, transformer)
+	tp.unreserve(lease)
+}
+
+func (tp *TransformerPool) unreserve(lease tenantLease) {
+	usage := tp.usage[lease.tenant]
+	usage.active--
+	usage.nativeMemory -= lease.nativeMemory
+	if usage.active == 0 {
+		delete(tp.usage, lease.tenant)
+	}
+}
+
+// AcquireCompressor returns a gzip compressor writing to output, reusing an idle compressor with the same level if available
+// The compressor must be returned to the pool with ReleaseCompressor and must not be closed by the caller.
+func (tp *TransformerPool) AcquireCompressor(output io.Writer, level CompressionLevel) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("TransformerPool.AcquireCompressor", &err)
+
+	tp.mutex.Lock()
+	if tp.closed {
+		tp.mutex.Unlock()
+		return nil, TransformerPoolClosedError
+	}
+
+	idle := tp.compressors[level]
+	if len(idle) > 0 {
+		compressor := idle[len(idle)-1]
+		tp.compressors[level] = idle[:len(idle)-1]
+		delete(tp.idleSince, compressor)
+		tp.mutex.Unlock()
+
+		ResetCompressor(output, compressor)
+		return compressor, nil
+	}
+	tp.mutex.Unlock()
+
+	return NewGoGZipCompressor(output, level, tp.compressorBufferSize)
+}
+
+// ReleaseCompressor returns a compressor acquired with AcquireCompressor to the pool
+// Any data written but not flushed is discarded.
+func (tp *TransformerPool) ReleaseCompressor(compressor io.WriteCloser) {
+	goComp := compressor.(*goGZipCompressor)
+	// don't hold on to the output while idle
+	ResetCompressor(io.Discard, compressor)
+
+	tp.mutex.Lock()
+	tp.releaseLease(compressor)
+	idle := tp.compressors[goComp.level]
+	if tp.closed || tp.idleCount() >= tp.maxIdle {
+		tp.mutex.Unlock()
+		compressor.Close()
+		return
+	}
+
+	tp.compressors[goComp.level] = append(idle, compressor)
+	tp.idleSince[compressor] = tp.now()
+	tp.mutex.Unlock()
+}
+
+// AcquireUncompressor returns an uncompressor reading from input, reusing an idle uncompressor if available
+// The uncompressor must be returned to the pool with ReleaseUncompressor and must not be closed by the caller.
+func (tp *TransformerPool) AcquireUncompressor(input io.Reader) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("TransformerPool.AcquireUncompressor", &err)
+
+	tp.mutex.Lock()
+	if tp.closed {
+		tp.mutex.Unlock()
+		return nil, TransformerPoolClosedError
+	}
+
+	if len(tp.uncompressors) > 0 {
+		uncompressor := tp.uncompressors[len(tp.uncompressors)-1]
+		tp.uncompressors = tp.uncompressors[:len(tp.uncompressors)-1]
+		delete(tp.idleSince, uncompressor)
+		tp.mutex.Unlock()
+
+		ResetUncompressor(input, uncompressor)
+		return uncompressor, nil
+	}
+	releaseWindow := tp.releaseWindows
+	tp.mutex.Unlock()
+
+	uncompressor, err = NewGoZLibUncompressor(input, tp.uncompressorBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	SetReleaseWindowOnReset(uncompressor, releaseWindow)
+
+	return uncompressor, nil
+}
+
+// ReleaseUncompressor returns an uncompressor acquired with AcquireUncompressor to the pool
+func (tp *TransformerPool) ReleaseUncompressor(uncompressor io.ReadCloser) {
+	// don't hold on to the input while idle
+	ResetUncompressor(nil, uncompressor)
+
+	tp.mutex.Lock()
+	tp.releaseLease(uncompressor)
+	if tp.closed || tp.idleCount() >= tp.maxIdle {
+		tp.mutex.Unlock()
+		uncompressor.Close()
+		return
+	}
+
+	tp.uncompressors = append(tp.uncompressors, uncompressor)
+	tp.idleSince[uncompressor] = tp.now()
+	tp.mutex.Unlock()
+}
+
+// Close closes all idle transformers. Transformers released after the pool is closed are closed as well.
+func (tp *TransformerPool) Close() (err error) {
+	defer recoverPanic("TransformerPool.Close", &err)
+
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	tp.closed = true
+	tp.stopReaper()
+	tp.closeIdle()
+
+	return nil
+}
+
+// closeIdle closes and removes all idle transformers. Must be called with the mutex locked
+func (tp *TransformerPool) closeIdle() {
+	for level, idle := range tp.compressors {
+		for _, compressor := range idle {
+			compressor.Close()
+		}
+		delete(tp.compressors, level)
+	}
+
+	for _, uncompressor := range tp.uncompressors {
+		uncompressor.Close()
+	}
+	tp.uncompressors = nil
+	tp.idleSince = map[io.Closer]time.Time{}
+}
+
+// retire closes all idle transformers and stops keeping released ones, while still allowing new acquisitions
+func (tp *TransformerPool) retire() {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	tp.maxIdle = 0
+	tp.stopReaper()
+	tp.closeIdle()
+}
+
+func (tp *TransformerPool) idleCount() int {
+	count := len(tp.uncompressors)
+	for _, idle := range tp.compressors {
+		count += len(idle)
+	}
+
+	return count
+}
+
+// Convenience functions
+
+// copyWithNativeBuffer copies from src to dst using a temporary buffer allocated off-heap
+func copyWithNativeBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	bufferPtr := C.pool_alloc(copyBufferSize)
+	defer C.pool_free(bufferPtr)
+
+	return io.CopyBuffer(dst, src, nativeSlice(bufferPtr, copyBufferSize, copyBufferSize))
+}
+
+// Compress reads all data from src and writes it to dst compressed in gzip format
+// It uses compressors from a shared pool so no setup is needed and it's safe to be called concurrently.
+// The function returns the number of uncompressed bytes read from src and an error, if any.
+func Compress(dst io.Writer, src io.Reader, level CompressionLevel) (uncompressed int64, err error) {
+	defer recoverPanic("Compress", &err)
+
+	sampler := sampleTelemetry()
+	if sampler != nil {
+		return sampler.compress(dst, src, level)
+	}
+
+	return compressPooled(dst, src, level)
+}
+
+func compressPooled(dst io.Writer, src io.Reader, level CompressionLevel) (int64, error) {
+	pool := defaultTransformerPool()
+	compressor, err := pool.AcquireCompressor(dst, level)
+	if err != nil {
+		if fallBack(NativeCompress, err) {
+			return fallbackCompress(dst, src, level)
+		}
+		return 0, err
+	}
+	defer pool.ReleaseCompressor(compressor)
+
+	written, cerr := copyWithNativeBuffer(compressor, src)
+	if cerr != nil {
+		return written, cerr
+	}
+
+	_, ferr := Finish(compressor)
+	return written, ferr
+}
+
+// Decompress reads all gzip or zlib compressed data from src and writes it uncompressed to dst
+// It uses uncompressors from a shared pool so no setup is needed and it's safe to be called concurrently.
+// The function returns the number of uncompressed bytes written to dst and an error, if any.
+// If the package defaults set a maximum decompressed size, DecompressedSizeLimitError is returned once it's exceeded.
+func Decompress(dst io.Writer, src io.Reader) (uncompressed int64, err error) {
+	defer recoverPanic("Decompress", &err)
+
+	sampler := sampleTelemetry()
+	if sampler != nil {
+		return sampler.decompress(dst, src)
+	}
+
+	return decompressPooled(dst, src)
+}
+
+func decompressPooled(dst io.Writer, src io.Reader) (int64, error) {
+	pool := defaultTransformerPool()
+	uncompressor, err := pool.AcquireUncompressor(src)
+	if err != nil {
+		if fallBack(NativeUncompress, err) {
+			return fallbackDecompress(dst, src)
+		}
+		return 0, err
+	}
+	defer pool.ReleaseUncompressor(uncompressor)
+
+	// the pool only creates goUncompressors, the limit is lifted before the uncompressor goes back to the pool
+	goUncomp := uncompressor.(*goUncompressor)
+	goUncomp.maxOutput = GetDefaults().MaxDecompressedSize
+	defer func() { goUncomp.maxOutput = 0 }()
+
+	return copyWithNativeBuffer(dst, goUncomp)
+}
+
+// DecompressBounded is like Decompress but stops after writing maxOutput bytes to dst, for instance to preview the start
+// of a compressed blob
+// It returns the number of bytes written, the number of compressed bytes consumed to produce them and
+// OutputLimitReachedError if there was more data after the limit. maxOutput replaces the default maximum decompressed size.
+// The compressed bytes consumed include the stream header and, as inflate works on bits, may include the few bytes
+// holding the start of the data after the limit.
+func DecompressBounded(dst io.Writer, src io.Reader, maxOutput int64) (written int64, consumed int64, err error) {
+	defer recoverPanic("DecompressBounded", &err)
+
+	pool := defaultTransformerPool()
+	uncompressor, err := pool.AcquireUncompressor(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer pool.ReleaseUncompressor(uncompressor)
+	goUncomp := uncompressor.(*goUncompressor)
+
+	bufferPtr := C.pool_alloc(copyBufferSize)
+	defer C.pool_free(bufferPtr)
+	buffer := nativeSlice(bufferPtr, copyBufferSize, copyBufferSize)
+
+	for written < maxOutput {
+		readBuffer := buffer
+		if int64(len(readBuffer)) > maxOutput-written {
+			readBuffer = readBuffer[:maxOutput-written]
+		}
+
+		// reading directly into the buffer, never through the read ahead buffer, stops inflate once the limit is reached
+		readLen, rerr := goUncomp.readDirect(readBuffer)
+		consumed = int64(goUncomp.transformer.zs.total_in)
+		if readLen > 0 {
+			writeLen, werr := dst.Write(readBuffer[:readLen])
+			written += int64(writeLen)
+			if werr != nil {
+				return written, consumed, werr
+			}
+		}
+
+		if rerr == io.EOF {
+			return written, consumed, nil
+		}
+		if rerr != nil {
+			return written, consumed, rerr
+		}
+	}
+
+	// tell data ending exactly at the limit from data exceeding it, which uncompresses past the consumed input
+	more, perr := goUncomp.Peek(1)
+	if len(more) > 0 {
+		return written, consumed, OutputLimitReachedError
+	}
+	if perr != io.EOF {
+		return written, consumed, perr
+	}
+
+	return written, consumed, nil
+}
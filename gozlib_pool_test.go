@@ -0,0 +1,187 @@
+package gozlib
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	data := makeTestData(200000)
+
+	compressed := bytes.NewBuffer([]byte{})
+	read, err := Compress(compressed, bytes.NewReader(data), CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), read)
+	stdUncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed.Bytes()), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, stdUncompressed)
+
+	uncompressed := bytes.NewBuffer([]byte{})
+	written, err := Decompress(uncompressed, bytes.NewReader(compressed.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), written)
+	assert.Equal(t, data, uncompressed.Bytes())
+}
+
+func TestCompressDecompressConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(size uint32) {
+			defer wg.Done()
+			data := makeTestData(size)
+
+			compressed := bytes.NewBuffer([]byte{})
+			_, err := Compress(compressed, bytes.NewReader(data), CompressionLevelBestCompression)
+			assert.NoError(t, err)
+
+			uncompressed := bytes.NewBuffer([]byte{})
+			_, err = Decompress(uncompressed, compressed)
+			assert.NoError(t, err)
+			assert.Equal(t, data, uncompressed.Bytes())
+		}(uint32(1000 * (i + 1)))
+	}
+	wg.Wait()
+}
+
+func TestTransformerPoolReusesTransformers(t *testing.T) {
+	pool := NewTransformerPool(1024, 2)
+	defer pool.Close()
+
+	first := bytes.NewBuffer([]byte{})
+	compressor, err := pool.AcquireCompressor(first, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	_, err = compressor.Write([]byte("partial data that must not leak into the next stream"))
+	assert.NoError(t, err)
+	pool.ReleaseCompressor(compressor)
+
+	data := makeTestData(5000)
+	second := bytes.NewBuffer([]byte{})
+	reused, err := pool.AcquireCompressor(second, CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	assert.Same(t, compressor, reused)
+
+	_, err = reused.Write(data)
+	assert.NoError(t, err)
+	_, err = Finish(reused)
+	assert.NoError(t, err)
+	pool.ReleaseCompressor(reused)
+	stdUncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(second.Bytes()), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, stdUncompressed)
+
+	uncompressor, err := pool.AcquireUncompressor(bytes.NewReader(second.Bytes()))
+	assert.NoError(t, err)
+	pool.ReleaseUncompressor(uncompressor)
+
+	reusedUncompressor, err := pool.AcquireUncompressor(bytes.NewReader(second.Bytes()))
+	assert.NoError(t, err)
+	assert.Same(t, uncompressor, reusedUncompressor)
+	uncompressed := bytes.NewBuffer([]byte{})
+	_, err = uncompressed.ReadFrom(reusedUncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed.Bytes())
+	pool.ReleaseUncompressor(reusedUncompressor)
+}
+
+func TestTransformerPoolClosed(t *testing.T) {
+	pool := NewTransformerPool(1024, 2)
+	assert.NoError(t, pool.Close())
+
+	_, err := pool.AcquireCompressor(bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed)
+	assert.ErrorIs(t, err, TransformerPoolClosedError)
+
+	_, err = pool.AcquireUncompressor(bytes.NewReader([]byte{}))
+	assert.ErrorIs(t, err, TransformerPoolClosedError)
+}
+
+func TestTransformerPoolTenantQuotas(t *testing.T) {
+	pool := NewTransformerPool(1024, 2)
+	defer pool.Close()
+
+	pool.SetTenantQuota("limited", TenantQuota{MaxActive: 1})
+	compressor, err := pool.AcquireCompressorFor("limited", bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+
+	_, err = pool.AcquireUncompressorFor("limited", bytes.NewReader([]byte{}))
+	assert.ErrorIs(t, err, TenantQuotaExceededError)
+	var quotaErr *TenantQuotaError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "limited", quotaErr.Tenant)
+	assert.Equal(t, "active", quotaErr.Resource)
+	assert.Equal(t, uint64(1), quotaErr.Limit)
+
+	// other tenants and untracked acquisitions are not affected
+	other, err := pool.AcquireCompressorFor("other", bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	pool.ReleaseCompressor(other)
+
+	pool.ReleaseCompressor(compressor)
+	uncompressor, err := pool.AcquireUncompressorFor("limited", bytes.NewReader([]byte{}))
+	assert.NoError(t, err)
+	pool.ReleaseUncompressor(uncompressor)
+	assert.Empty(t, pool.usage)
+}
+
+func TestTransformerPoolTenantMemoryQuota(t *testing.T) {
+	pool := NewTransformerPool(1024, 2)
+	defer pool.Close()
+
+	pool.SetTenantQuota("small", TenantQuota{MaxNativeMemory: inflateStateMemory + 1024})
+	uncompressor, err := pool.AcquireUncompressorFor("small", bytes.NewReader([]byte{}))
+	assert.NoError(t, err)
+
+	_, err = pool.AcquireCompressorFor("small", bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed)
+	var quotaErr *TenantQuotaError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "memory", quotaErr.Resource)
+
+	pool.ReleaseUncompressor(uncompressor)
+	_, err = pool.AcquireCompressorFor("small", bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed)
+	assert.ErrorIs(t, err, TenantQuotaExceededError)
+}
+
+func TestDecompressBounded(t *testing.T) {
+	data := makeTestData(100000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	preview := bytes.NewBuffer([]byte{})
+	written, consumed, err := DecompressBounded(preview, bytes.NewReader(compressed), 1000)
+	assert.ErrorIs(t, err, OutputLimitReachedError)
+	assert.Equal(t, int64(1000), written)
+	assert.Equal(t, data[:1000], preview.Bytes())
+	assert.Greater(t, consumed, int64(0))
+	assert.Less(t, consumed, int64(len(compressed)))
+
+	for _, limit := range []int64{int64(len(data)), int64(len(data)) + 1} {
+		full := bytes.NewBuffer([]byte{})
+		written, consumed, err = DecompressBounded(full, bytes.NewReader(compressed), limit)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), written)
+		assert.Equal(t, int64(len(compressed)), consumed)
+		assert.Equal(t, data, full.Bytes())
+	}
+}
+
+func TestDecompressBoundedConsumedMatchesOutput(t *testing.T) {
+	data := makeTestData(100000)
+	// stored blocks hold the data as is, so the position of each uncompressed byte in the compressed data is known
+	compressedBuffer := bytes.NewBuffer([]byte{})
+	_, err := Compress(compressedBuffer, bytes.NewReader(data), CompressionLevelNone)
+	assert.NoError(t, err)
+	compressed := compressedBuffer.Bytes()
+
+	for _, limit := range []int64{1, 511, 1000} {
+		preview := bytes.NewBuffer([]byte{})
+		written, consumed, err := DecompressBounded(preview, bytes.NewReader(compressed), limit)
+		assert.ErrorIs(t, err, OutputLimitReachedError)
+		assert.Equal(t, limit, written)
+
+		// the data after the limit continues right at the consumed offset
+		assert.Equal(t, data[written:written+100], compressed[consumed:consumed+100])
+	}
+}
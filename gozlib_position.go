@@ -0,0 +1,306 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// Read positions
+// Deflate data can only be uncompressed from the start of a block, given the sliding window of the data before it and,
+// as blocks aren't byte aligned, the bits of the block's first byte already used by the previous block. Capturing a
+// position copies the inflate stream and runs the copy up to the next block boundary, keeping the uncompressed data
+// between the current read position and that boundary. Restoring it primes a raw inflate stream with the window and
+// bits at the boundary and serves the kept data first, so reading continues exactly where the original uncompressor was.
+//
+// The serialized format, all integers being unsigned varints:
+//
+//	"GZRP" magic, version byte (1)
+//	compressed offset, bit count, ended flag
+//	window length, window
+//	pending data length, pending data
+
+var positionMagic = []byte("GZRP")
+
+const positionVersion = 1
+
+// sizes of the buffers used to run the copy of the inflate stream to the next block boundary
+const (
+	positionInputSize  = 1024 * 16
+	positionOutputSize = 1024 * 32
+)
+
+var (
+	PositionUnsupportedError = errors.New("read positions are only supported by uncompressors reading from an io.ReaderAt")
+	PositionFormatError      = errors.New("invalid read position")
+)
+
+// ReadPosition is a position in a compressed stream from where an uncompressor can resume reading
+// It should be treated as opaque and stored with MarshalBinary, for example as a pagination cursor.
+type ReadPosition struct {
+	// CompressedOffset is the offset of the byte holding the start of the next deflate block
+	CompressedOffset int64
+	// Bits is the number of bits of the byte before CompressedOffset not yet used by the previous block
+	Bits int
+	// Ended is set when the compressed stream ended before the next block, only Pending is left to read
+	Ended bool
+	// Window is the uncompression sliding window at the block boundary
+	Window []byte
+	// Pending is the uncompressed data between the read position and the block boundary
+	Pending []byte
+}
+
+// MarshalBinary serializes the position
+func (rp *ReadPosition) MarshalBinary() (data []byte, err error) {
+	defer recoverPanic("ReadPosition.MarshalBinary", &err)
+
+	data = make([]byte, 0, len(positionMagic)+1+5*binary.MaxVarintLen64+len(rp.Window)+len(rp.Pending))
+	data = append(data, positionMagic...)
+	data = append(data, positionVersion)
+	data = binary.AppendUvarint(data, uint64(rp.CompressedOffset))
+	data = binary.AppendUvarint(data, uint64(rp.Bits))
+
+	ended := uint64(0)
+	if rp.Ended {
+		ended = 1
+	}
+	data = binary.AppendUvarint(data, ended)
+	data = binary.AppendUvarint(data, uint64(len(rp.Window)))
+	data = append(data, rp.Window...)
+	data = binary.AppendUvarint(data, uint64(len(rp.Pending)))
+	data = append(data, rp.Pending...)
+
+	return data, nil
+}
+
+// UnmarshalBinary restores a position serialized by MarshalBinary
+func (rp *ReadPosition) UnmarshalBinary(data []byte) (err error) {
+	defer recoverPanic("ReadPosition.UnmarshalBinary", &err)
+
+	headerLen := len(positionMagic) + 1
+	if len(data) < headerLen || string(data[:len(positionMagic)]) != string(positionMagic) || data[len(positionMagic)] != positionVersion {
+		return PositionFormatError
+	}
+	data = data[headerLen:]
+
+	values := [3]uint64{}
+	for pos := range values {
+		value, valueLen := binary.Uvarint(data)
+		if valueLen <= 0 {
+			return PositionFormatError
+		}
+		values[pos] = value
+		data = data[valueLen:]
+	}
+
+	sections := [2][]byte{}
+	for pos := range sections {
+		sectionLen, sectionLenLen := binary.Uvarint(data)
+		if sectionLenLen <= 0 || sectionLen > uint64(len(data)-sectionLenLen) {
+			return PositionFormatError
+		}
+		data = data[sectionLenLen:]
+		sections[pos] = append([]byte{}, data[:sectionLen]...)
+		data = data[sectionLen:]
+	}
+
+	if len(data) > 0 || values[0] > 1<<62 || values[1] > 7 || values[2] > 1 || len(sections[0]) > MaxDictionarySize {
+		return PositionFormatError
+	}
+
+	rp.CompressedOffset = int64(values[0])
+	rp.Bits = int(values[1])
+	rp.Ended = values[2] == 1
+	rp.Window = sections[0]
+	rp.Pending = sections[1]
+
+	return nil
+}
+
+// CapturePosition captures the read position of an uncompressor created with NewUncompressorAt or NewUncompressorAtPosition
+// The uncompressor is not affected and can keep being used. The position holds the uncompressed data up to the next
+// deflate block, which is usually tens of kilobytes but can be much more for highly compressible data.
+func CapturePosition(uncompressor io.ReadCloser) (position *ReadPosition, err error) {
+	defer recoverPanic("CapturePosition", &err)
+
+	unc, isUncompressor := uncompressor.(*goUncompressor)
+	if !isUncompressor || unc.input != &unc.atInput {
+		return nil, PositionUnsupportedError
+	}
+
+	zs := unc.transformer.zs
+	// input left in the work buffer is only used by the next step if there's more data to uncompress from it
+	var input []byte
+	if unc.hasMoreData || unc.ended {
+		input = nativeSlice(unsafe.Pointer(zs.next_in), int(zs.avail_in), int(zs.avail_in))
+	}
+
+	position = &ReadPosition{
+		CompressedOffset: unc.atInput.offset - int64(len(input)),
+		Pending:          make([]byte, 0, len(unc.readAhead)-unc.readAheadPos+len(unc.resumed)),
+	}
+	position.Pending = append(position.Pending, unc.readAhead[unc.readAheadPos:]...)
+	position.Pending = append(position.Pending, unc.resumed...)
+
+	if unc.ended {
+		position.Ended = true
+		return position, nil
+	}
+
+	stream, err := copyInflateStream(zs)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.close()
+
+	rerr := stream.runToBlock(unc.atInput.r, input, position)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return position, nil
+}
+
+func copyInflateStream(zs C.z_streamp) (*nativeStream, error) {
+	werr := nativeWork.start()
+	if werr != nil {
+		return nil, werr
+	}
+	defer nativeWork.end()
+
+	var errorCode C.int = C.Z_OK
+	copied := C.copy_inflate_stream(zs, &errorCode)
+
+	if errorCode != C.Z_OK {
+		C.release_inflate_stream(copied)
+		return nil, fmt.Errorf(wrapErrorFormat, TransformerInitializationError, errorCode)
+	}
+
+	return &nativeStream{zs: copied, deflating: false}, nil
+}
+
+// runToBlock inflates input, followed by the compressed data in r from position.CompressedOffset, until the next block
+// boundary or the end of the stream, appending the data uncompressed to position.Pending and recording the boundary
+func (ns *nativeStream) runToBlock(r io.ReaderAt, input []byte, position *ReadPosition) error {
+	inputBuffer := make([]byte, positionInputSize)
+	output := make([]byte, positionOutputSize)
+	offset := position.CompressedOffset
+	flush := C.int(C.Z_BLOCK)
+
+	for {
+		if len(input) == 0 {
+			readLen, readErr := r.ReadAt(inputBuffer, offset)
+			if readLen == 0 {
+				if readErr == nil || readErr == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return readErr
+			}
+			input = inputBuffer[:readLen]
+		}
+
+		consumed, produced, resultCode := ns.step(input, output, flush)
+		input = input[consumed:]
+		offset += int64(consumed)
+		position.Pending = append(position.Pending, output[:produced]...)
+		position.CompressedOffset = offset
+
+		if resultCode == C.Z_STREAM_END {
+			position.Ended = true
+			return nil
+		}
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+			return fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, resultCode)
+		}
+
+		// inflate stops at every block boundary, including the one right after the stream header
+		dataType := ns.zs.data_type
+		if flush == C.Z_BLOCK && dataType&128 != 0 {
+			if dataType&64 == 0 {
+				break
+			}
+			// the last block ended, only the stream trailer is left
+			flush = C.Z_NO_FLUSH
+		}
+	}
+
+	position.Bits = int(ns.zs.data_type & 7)
+	window, err := appendDictionary(ns.zs, getUncompressionDictionary, nil)
+	position.Window = window
+
+	return err
+}
+
+// NewUncompressorAtPosition creates an uncompressor reading the compressed data in r from position, continuing with
+// the uncompressed data that followed it when the position was captured. r must hold the same compressed data.
+// Streams are resumed in the middle of the deflate data, so the checksum in the trailer is not verified.
+// Like NewUncompressorAt, the uncompressor uses TrailingDataExpose and stops reading at the end of the deflate data.
+func NewUncompressorAtPosition(r io.ReaderAt, position *ReadPosition, bufferSize uint32) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewUncompressorAtPosition", &err)
+
+	if position.CompressedOffset < 0 || position.Bits < 0 || position.Bits > 7 || len(position.Window) > MaxDictionarySize {
+		return nil, PositionFormatError
+	}
+
+	goUncomp, err := newGoUncompressor(nil, TransformModeRawUncompress, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	goUncomp.trailingMode = TrailingDataExpose
+	goUncomp.atInput = offsetReader{r: r, offset: position.CompressedOffset}
+	goUncomp.input = &goUncomp.atInput
+	goUncomp.resumed = append([]byte{}, position.Pending...)
+	goUncomp.ended = position.Ended
+
+	if !position.Ended {
+		perr := primeUncompressor(goUncomp, r, position)
+		if perr != nil {
+			goUncomp.Close()
+			return nil, perr
+		}
+	}
+
+	return goUncomp, nil
+}
+
+// primeUncompressor loads the unused bits of the byte before the block boundary and the window into the inflate stream
+func primeUncompressor(unc *goUncompressor, r io.ReaderAt, position *ReadPosition) error {
+	zs := unc.transformer.zs
+	if position.Bits > 0 {
+		if position.CompressedOffset == 0 {
+			return PositionFormatError
+		}
+
+		var partial [1]byte
+		readLen, rerr := r.ReadAt(partial[:], position.CompressedOffset-1)
+		if readLen == 0 {
+			if rerr == nil || rerr == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return rerr
+		}
+
+		// the unused bits are the high bits of the byte
+		resultCode := C.inflatePrime(zs, C.int(position.Bits), C.int(partial[0]>>(8-position.Bits)))
+		if resultCode != C.Z_OK {
+			return fmt.Errorf(wrapErrorFormat, TransformerInitializationError, resultCode)
+		}
+	}
+
+	if len(position.Window) > 0 {
+		resultCode := C.set_uncompression_dictionary(zs, unsafe.Pointer(&position.Window[0]), C.uInt(len(position.Window)))
+		if resultCode != C.Z_OK {
+			return fmt.Errorf(wrapErrorFormat, TransformerInitializationError, resultCode)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makePositionTestData() []byte {
+	text := stressPayload(StressConfig{PayloadSize: 150000, Payload: StressPayloadText}, rand.New(rand.NewSource(1)), 0)
+	return append(text, makeTestData(150000)...)
+}
+
+func TestReadPositionPagination(t *testing.T) {
+	data := makePositionTestData()
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+	reader := bytes.NewReader(compressed)
+
+	uncompressor, err := NewUncompressorAt(reader, 0, 4096)
+	require.NoError(t, err)
+
+	var paginated []byte
+	page := make([]byte, 7001)
+	for {
+		// each page is read by a new uncompressor resuming from the serialized position of the previous one
+		position, cerr := CapturePosition(uncompressor)
+		require.NoError(t, cerr)
+		assert.NoError(t, uncompressor.Close())
+
+		token, merr := position.MarshalBinary()
+		require.NoError(t, merr)
+		restored := &ReadPosition{}
+		require.NoError(t, restored.UnmarshalBinary(token))
+		assert.Equal(t, position.Pending, restored.Pending)
+		assert.Equal(t, position.CompressedOffset, restored.CompressedOffset)
+
+		uncompressor, err = NewUncompressorAtPosition(reader, restored, 4096)
+		require.NoError(t, err)
+
+		readLen, rerr := io.ReadFull(uncompressor, page)
+		paginated = append(paginated, page[:readLen]...)
+		if rerr != nil {
+			assert.ErrorIs(t, rerr, io.ErrUnexpectedEOF)
+			break
+		}
+	}
+
+	assert.NoError(t, uncompressor.Close())
+	assert.Equal(t, data, paginated)
+}
+
+func TestReadPositionKeepsUncompressor(t *testing.T) {
+	data := makePositionTestData()
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+	reader := bytes.NewReader(compressed)
+
+	uncompressor, err := NewUncompressorAt(reader, 0, 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	// small reads leave data in the read ahead buffer
+	head := make([]byte, 100)
+	_, err = io.ReadFull(uncompressor, head)
+	require.NoError(t, err)
+
+	position, err := CapturePosition(uncompressor)
+	require.NoError(t, err)
+
+	rest, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data[100:], rest)
+
+	resumed, err := NewUncompressorAtPosition(reader, position, 1024)
+	require.NoError(t, err)
+	defer resumed.Close()
+
+	skipped, err := resumed.(*goUncompressor).Skip(50000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50000), skipped)
+	rest, err = io.ReadAll(resumed)
+	assert.NoError(t, err)
+	assert.Equal(t, data[50100:], rest)
+}
+
+func TestReadPositionAtEnd(t *testing.T) {
+	data := makeTestData(3000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+	reader := bytes.NewReader(compressed)
+
+	uncompressor, err := NewUncompressorAt(reader, 0, 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	head := make([]byte, 2000)
+	_, err = io.ReadFull(uncompressor, head)
+	require.NoError(t, err)
+
+	position, err := CapturePosition(uncompressor)
+	require.NoError(t, err)
+	assert.Equal(t, data[2000:], position.Pending)
+
+	// a position captured once the stream ended only holds the data not read yet
+	_, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	ended, err := CapturePosition(uncompressor)
+	require.NoError(t, err)
+	assert.True(t, ended.Ended)
+	assert.Empty(t, ended.Pending)
+
+	for _, resumePosition := range []*ReadPosition{position, ended} {
+		resumed, rerr := NewUncompressorAtPosition(reader, resumePosition, 1024)
+		require.NoError(t, rerr)
+
+		rest, rerr := io.ReadAll(resumed)
+		assert.NoError(t, rerr)
+		assert.Equal(t, resumePosition.Pending, rest)
+		assert.NoError(t, resumed.Close())
+	}
+}
+
+func TestReadPositionUnsupported(t *testing.T) {
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(nil), 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	_, err = CapturePosition(uncompressor)
+	assert.ErrorIs(t, err, PositionUnsupportedError)
+
+	// the next block boundary is past the end of the truncated input
+	truncated, err := stdLibGZipCompressSlice(makeTestData(100000))
+	require.NoError(t, err)
+	uncompressor, err = NewUncompressorAt(bytes.NewReader(truncated[:5000]), 0, 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	_, err = io.ReadFull(uncompressor, make([]byte, 100))
+	require.NoError(t, err)
+	_, err = CapturePosition(uncompressor)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestReadPositionInvalid(t *testing.T) {
+	position := &ReadPosition{CompressedOffset: 10, Bits: 3, Window: []byte("window"), Pending: []byte("pending")}
+	token, err := position.MarshalBinary()
+	require.NoError(t, err)
+
+	invalid := [][]byte{
+		nil,
+		[]byte("GZRS"),
+		token[:len(token)-1],
+		append(append([]byte{}, token...), 0),
+	}
+	for _, data := range invalid {
+		assert.ErrorIs(t, (&ReadPosition{}).UnmarshalBinary(data), PositionFormatError)
+	}
+
+	_, err = NewUncompressorAtPosition(bytes.NewReader(nil), &ReadPosition{Bits: 8}, 1024)
+	assert.ErrorIs(t, err, PositionFormatError)
+	_, err = NewUncompressorAtPosition(bytes.NewReader(nil), &ReadPosition{Bits: 1}, 1024)
+	assert.ErrorIs(t, err, PositionFormatError)
+}
@@ -0,0 +1,71 @@
+package gozlib
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NativeOperation identifies the kind of native zlib call measured by a NativeCallHook
+type NativeOperation int
+
+const (
+	NativeCompress NativeOperation = iota
+	NativeFlush
+	NativeUncompress
+	NativeSkip
+)
+
+func (op NativeOperation) String() string {
+	switch op {
+	case NativeCompress:
+		return "compress"
+	case NativeFlush:
+		return "flush"
+	case NativeUncompress:
+		return "uncompress"
+	case NativeSkip:
+		return "skip"
+	default:
+		return "unknown"
+	}
+}
+
+// NativeCallHook receives the duration of each native call made by compressors and uncompressors
+// Hooks run on the goroutine that made the call, so they can attribute native time using the caller's context,
+// for instance by recording it in a histogram per endpoint. Durations include the time spent in the Go readers and
+// writers invoked by the native code. Hooks must be fast and safe for concurrent use.
+type NativeCallHook func(op NativeOperation, duration time.Duration)
+
+var nativeCallHook atomic.Pointer[NativeCallHook]
+
+// SetNativeCallHook sets the hook called after each native call, replacing the previous one. A nil hook disables timing
+// Native calls are not timed while no hook is set.
+func SetNativeCallHook(hook NativeCallHook) {
+	if hook == nil {
+		nativeCallHook.Store(nil)
+		return
+	}
+
+	nativeCallHook.Store(&hook)
+}
+
+// startNativeCall returns the start time of a native call, or the zero time if no hook is set
+func startNativeCall() time.Time {
+	if nativeCallHook.Load() == nil {
+		return time.Time{}
+	}
+
+	return time.Now()
+}
+
+// endNativeCall reports the duration of a native call started with startNativeCall to the hook
+func endNativeCall(op NativeOperation, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+
+	hook := nativeCallHook.Load()
+	if hook != nil {
+		(*hook)(op, time.Since(start))
+	}
+}
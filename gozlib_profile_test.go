@@ -0,0 +1,49 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeCallHook(t *testing.T) {
+	var mutex sync.Mutex
+	calls := map[NativeOperation]int{}
+	SetNativeCallHook(func(op NativeOperation, duration time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls[op]++
+		assert.GreaterOrEqual(t, duration, time.Duration(0))
+	})
+	t.Cleanup(func() { SetNativeCallHook(nil) })
+
+	data := makeTestData(20000)
+	compressed := bytes.NewBuffer([]byte{})
+	compressor, err := NewGoGZipCompressor(compressed, CompressionLevelBestSpeed, 4096)
+	assert.NoError(t, err)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	uncompressor, err := NewGoZLibUncompressor(compressed, 4096)
+	assert.NoError(t, err)
+	_, err = Skip(uncompressor, 100)
+	assert.NoError(t, err)
+	_, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.NoError(t, uncompressor.Close())
+
+	mutex.Lock()
+	assert.Greater(t, calls[NativeCompress], 0)
+	assert.Greater(t, calls[NativeUncompress], 0)
+	assert.Greater(t, calls[NativeSkip], 0)
+	mutex.Unlock()
+
+	SetNativeCallHook(nil)
+	assert.True(t, startNativeCall().IsZero())
+	assert.Equal(t, "uncompress", NativeUncompress.String())
+}
@@ -0,0 +1,281 @@
+package gozlib
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	QueueClosedError  = errors.New("queue is closed")
+	QueueOptionsError = errors.New("invalid queue options")
+	JobSourceError    = errors.New("job has no source or destination")
+)
+
+// JobKind is the operation executed by a queued job
+type JobKind int
+
+const (
+	// JobCompress compresses the job source in gzip format
+	JobCompress JobKind = iota
+	// JobUncompress uncompresses a gzip or zlib job source
+	JobUncompress
+)
+
+// Job describes a compression or uncompression job
+// File jobs set SourcePath and DestinationPath, stream jobs set Source and Destination. Stream jobs can't be
+// reopened, so they are attempted only once and are never persisted.
+type Job struct {
+	ID   string
+	Kind JobKind
+	// Tenant identifies who submitted the job, used by fair share scheduling
+	Tenant string
+	// Priority orders jobs in priority scheduling, higher priorities run first
+	Priority        int
+	Level           CompressionLevel
+	SourcePath      string
+	DestinationPath string
+	Source          io.Reader
+	Destination     io.Writer
+}
+
+func (job Job) isStream() bool {
+	return job.Source != nil || job.Destination != nil
+}
+
+// JobResult is the outcome of a job, reported once it succeeds or fails for the last time
+type JobResult struct {
+	Job Job
+	// Attempts is the number of times the job was executed
+	Attempts int
+	// Written is the number of uncompressed bytes read or written by the job
+	Written int64
+	Err     error
+}
+
+// JobStore persists file jobs so a queue can resume them after a crash
+// Save is called when a job is enqueued and Complete once it has a final result. Pending returns the jobs saved but
+// not completed and is called when the queue is created.
+type JobStore interface {
+	Save(job Job) error
+	Complete(result JobResult) error
+	Pending() ([]Job, error)
+}
+
+// QueueOptions configures a Queue
+type QueueOptions struct {
+	// Workers is the number of jobs executed concurrently, must be greater than zero
+	Workers int
+	// MaxAttempts is the maximum number of executions of a job failing with transient errors, 0 means 1
+	MaxAttempts int
+	// RetryDelay is the time waited before retrying a job
+	RetryDelay time.Duration
+	// IsTransient reports if a job error can be retried, defaults to network timeouts and temporary errors
+	IsTransient func(err error) bool
+	// OnComplete, if set, is called with the result of each job from the worker that executed it
+	OnComplete func(result JobResult)
+	// Store, if set, persists file jobs
+	Store JobStore
+	// Scheduler, if set, decides the order jobs are executed, defaults to FIFO
+	Scheduler Scheduler
+}
+
+// Queue executes compression and uncompression jobs with a bounded number of workers
+type Queue struct {
+	options QueueOptions
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	jobs    Scheduler
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewQueue creates a queue and starts its workers
+// If the options have a store, its pending jobs are enqueued before the queue is returned.
+func NewQueue(options QueueOptions) (queue *Queue, err error) {
+	defer recoverPanic("NewQueue", &err)
+
+	if options.Workers <= 0 || options.MaxAttempts < 0 || options.RetryDelay < 0 {
+		return nil, QueueOptionsError
+	}
+	if options.MaxAttempts == 0 {
+		options.MaxAttempts = 1
+	}
+	if options.IsTransient == nil {
+		options.IsTransient = isTransientError
+	}
+	if options.Scheduler == nil {
+		options.Scheduler = NewFIFOScheduler()
+	}
+
+	queue = &Queue{options: options, jobs: options.Scheduler}
+	queue.cond = sync.NewCond(&queue.mutex)
+
+	if options.Store != nil {
+		pending, err := options.Store.Pending()
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range pending {
+			queue.jobs.Push(job)
+		}
+	}
+
+	queue.workers.Add(options.Workers)
+	for worker := 0; worker < options.Workers; worker++ {
+		go queue.work()
+	}
+
+	return queue, nil
+}
+
+// Enqueue adds a job to the queue, saving it to the store first if it's a file job
+func (q *Queue) Enqueue(job Job) (err error) {
+	defer recoverPanic("Queue.Enqueue", &err)
+
+	if job.isStream() {
+		if job.Source == nil || job.Destination == nil {
+			return JobSourceError
+		}
+	} else if job.SourcePath == "" || job.DestinationPath == "" {
+		return JobSourceError
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return QueueClosedError
+	}
+
+	if q.options.Store != nil && !job.isStream() {
+		err := q.options.Store.Save(job)
+		if err != nil {
+			return err
+		}
+	}
+
+	q.jobs.Push(job)
+	q.cond.Signal()
+
+	return nil
+}
+
+// Close stops accepting jobs and waits for the queued ones to finish
+func (q *Queue) Close() (err error) {
+	defer recoverPanic("Queue.Close", &err)
+
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return QueueClosedError
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
+	q.workers.Wait()
+	return nil
+}
+
+func (q *Queue) next() (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for q.jobs.Len() == 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.jobs.Len() == 0 {
+		return Job{}, false
+	}
+
+	return q.jobs.Pop(), true
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	for {
+		job, ok := q.next()
+		if !ok {
+			return
+		}
+
+		result := q.execute(job)
+
+		if q.options.Store != nil && !job.isStream() {
+			serr := q.options.Store.Complete(result)
+			if serr != nil && result.Err == nil {
+				result.Err = serr
+			}
+		}
+
+		if q.options.OnComplete != nil {
+			q.options.OnComplete(result)
+		}
+	}
+}
+
+func (q *Queue) execute(job Job) JobResult {
+	result := JobResult{Job: job}
+
+	for {
+		result.Attempts++
+		result.Written, result.Err = runJob(job)
+
+		retry := result.Err != nil && !job.isStream() && result.Attempts < q.options.MaxAttempts &&
+			q.options.IsTransient(result.Err)
+		if !retry {
+			return result
+		}
+
+		time.Sleep(q.options.RetryDelay)
+	}
+}
+
+func runJob(job Job) (int64, error) {
+	if job.isStream() {
+		return transformJob(job.Kind, job.Level, job.Destination, job.Source)
+	}
+
+	source, err := os.Open(job.SourcePath)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(job.DestinationPath)
+	if err != nil {
+		return 0, err
+	}
+
+	written, terr := transformJob(job.Kind, job.Level, destination, source)
+	cerr := destination.Close()
+	if terr != nil {
+		return written, terr
+	}
+
+	return written, cerr
+}
+
+func transformJob(kind JobKind, level CompressionLevel, dst io.Writer, src io.Reader) (int64, error) {
+	if kind == JobUncompress {
+		return Decompress(dst, src)
+	}
+
+	return Compress(dst, src, level)
+}
+
+func isTransientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
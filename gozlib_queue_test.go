@@ -0,0 +1,161 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryJobStore struct {
+	mutex     sync.Mutex
+	saved     map[string]Job
+	completed []JobResult
+}
+
+func (s *memoryJobStore) Save(job Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.saved[job.ID] = job
+	return nil
+}
+
+func (s *memoryJobStore) Complete(result JobResult) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.saved, result.Job.ID)
+	s.completed = append(s.completed, result)
+	return nil
+}
+
+func (s *memoryJobStore) Pending() ([]Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	jobs := []Job{}
+	for _, job := range s.saved {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+
+type flakyWriter struct {
+	bytes.Buffer
+	failures int
+}
+
+func (fw *flakyWriter) Write(p []byte) (int, error) {
+	if fw.failures > 0 {
+		fw.failures--
+		return 0, temporaryError{}
+	}
+	return fw.Buffer.Write(p)
+}
+
+func TestQueueStreamJobs(t *testing.T) {
+	data := makeTestData(50000)
+	compressed := bytes.NewBuffer([]byte{})
+	uncompressed := bytes.NewBuffer([]byte{})
+
+	results := make(chan JobResult, 2)
+	queue, err := NewQueue(QueueOptions{Workers: 2, OnComplete: func(result JobResult) { results <- result }})
+	assert.NoError(t, err)
+
+	assert.NoError(t, queue.Enqueue(Job{ID: "c", Kind: JobCompress, Level: CompressionLevelBestSpeed,
+		Source: bytes.NewReader(data), Destination: compressed}))
+	result := <-results
+	assert.NoError(t, result.Err)
+	assert.Equal(t, int64(len(data)), result.Written)
+
+	assert.NoError(t, queue.Enqueue(Job{ID: "u", Kind: JobUncompress, Source: compressed, Destination: uncompressed}))
+	result = <-results
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Attempts)
+	assert.Equal(t, data, uncompressed.Bytes())
+
+	assert.NoError(t, queue.Close())
+	assert.ErrorIs(t, queue.Enqueue(Job{ID: "x", Source: compressed, Destination: uncompressed}), QueueClosedError)
+	assert.ErrorIs(t, queue.Close(), QueueClosedError)
+}
+
+func TestQueueInvalidJobsAndOptions(t *testing.T) {
+	_, err := NewQueue(QueueOptions{Workers: 0})
+	assert.ErrorIs(t, err, QueueOptionsError)
+
+	queue, err := NewQueue(QueueOptions{Workers: 1})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, queue.Enqueue(Job{ID: "a", SourcePath: "in"}), JobSourceError)
+	assert.ErrorIs(t, queue.Enqueue(Job{ID: "b", Source: bytes.NewReader(nil)}), JobSourceError)
+	assert.NoError(t, queue.Close())
+}
+
+func TestQueueStreamJobsNotRetried(t *testing.T) {
+	results := make(chan JobResult, 1)
+	queue, err := NewQueue(QueueOptions{Workers: 1, MaxAttempts: 3, OnComplete: func(result JobResult) { results <- result }})
+	assert.NoError(t, err)
+
+	assert.NoError(t, queue.Enqueue(Job{ID: "s", Source: bytes.NewReader(makeTestData(100)), Destination: &flakyWriter{failures: 1}}))
+	result := <-results
+	assert.Error(t, result.Err)
+	assert.Equal(t, 1, result.Attempts)
+	assert.NoError(t, queue.Close())
+}
+
+func TestQueueFileJobsRetryAndPersist(t *testing.T) {
+	dir := t.TempDir()
+	data := makeTestData(20000)
+	sourcePath := filepath.Join(dir, "data")
+	assert.NoError(t, os.WriteFile(sourcePath, data, 0o600))
+
+	store := &memoryJobStore{saved: map[string]Job{}}
+	// a job left over from a previous run
+	assert.NoError(t, store.Save(Job{ID: "resumed", Kind: JobCompress, Level: CompressionLevelBestSpeed,
+		SourcePath: sourcePath, DestinationPath: filepath.Join(dir, "resumed.gz")}))
+
+	attempts := 0
+	results := make(chan JobResult, 2)
+	queue, err := NewQueue(QueueOptions{
+		Workers:     1,
+		MaxAttempts: 3,
+		RetryDelay:  time.Millisecond,
+		IsTransient: func(err error) bool {
+			attempts++
+			return errors.Is(err, os.ErrNotExist)
+		},
+		OnComplete: func(result JobResult) { results <- result },
+		Store:      store,
+	})
+	assert.NoError(t, err)
+
+	result := <-results
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "resumed", result.Job.ID)
+
+	assert.NoError(t, queue.Enqueue(Job{ID: "missing", Kind: JobUncompress,
+		SourcePath: filepath.Join(dir, "missing.gz"), DestinationPath: filepath.Join(dir, "missing")}))
+	result = <-results
+	assert.ErrorIs(t, result.Err, os.ErrNotExist)
+	assert.Equal(t, 3, result.Attempts)
+	assert.Equal(t, 2, attempts)
+
+	assert.NoError(t, queue.Close())
+
+	pending, _ := store.Pending()
+	assert.Empty(t, pending)
+	assert.Equal(t, 2, len(store.completed))
+
+	compressed, err := os.ReadFile(filepath.Join(dir, "resumed.gz"))
+	assert.NoError(t, err)
+	uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
@@ -0,0 +1,145 @@
+package gozlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Range requests over indexed gzip data
+// The uncompressed representation of an indexed gzip stream is served as a seekable resource, uncompressing only from
+// the flush point closest to each requested range.
+
+const rangeHandlerBufferSize = 1024 * 16
+
+var (
+	SeekOffsetError = errors.New("seek to a negative offset")
+)
+
+// indexedReadSeeker reads the uncompressed data of an indexed gzip stream from any offset
+type indexedReadSeeker struct {
+	compressed io.ReaderAt
+	index      *CompressedIndex
+	size       int64
+	pos        int64
+	reader     io.ReadCloser
+	readerPos  int64
+}
+
+func (irs *indexedReadSeeker) Read(output []byte) (n int, err error) {
+	defer recoverPanic("indexed range Read", &err)
+
+	if irs.pos >= irs.size {
+		return 0, io.EOF
+	}
+
+	if irs.reader == nil || irs.readerPos != irs.pos {
+		irs.Close()
+
+		reader, err := OpenAt(irs.compressed, irs.index, uint64(irs.pos), rangeHandlerBufferSize)
+		if err != nil {
+			return 0, err
+		}
+		irs.reader = reader
+		irs.readerPos = irs.pos
+	}
+
+	readLen, err := irs.reader.Read(output)
+	irs.pos += int64(readLen)
+	irs.readerPos = irs.pos
+
+	return readLen, err
+}
+
+func (irs *indexedReadSeeker) Seek(offset int64, whence int) (position int64, err error) {
+	defer recoverPanic("indexed range Seek", &err)
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += irs.pos
+	case io.SeekEnd:
+		offset += irs.size
+	default:
+		return irs.pos, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if offset < 0 {
+		return irs.pos, SeekOffsetError
+	}
+
+	irs.pos = offset
+	return offset, nil
+}
+
+func (irs *indexedReadSeeker) Close() (err error) {
+	defer recoverPanic("indexed range Close", &err)
+
+	if irs.reader != nil {
+		irs.reader.Close()
+		irs.reader = nil
+	}
+
+	return nil
+}
+
+// uncompressedSize combines the size in the gzip trailer, which is modulo 2^32, with the offset of the last flush point
+func uncompressedSize(compressed io.ReaderAt, compressedSize int64, index *CompressedIndex) (int64, error) {
+	if len(index.Points) == 0 || compressedSize < defaultGZipHeaderLen+gzipTrailerSizeLen {
+		return 0, fmt.Errorf("%w: empty index or compressed data", IndexFormatError)
+	}
+
+	var trailer [gzipTrailerSizeLen]byte
+	_, err := compressed.ReadAt(trailer[:], compressedSize-gzipTrailerSizeLen)
+	if err != nil {
+		return 0, err
+	}
+
+	lastOffset := index.Points[len(index.Points)-1].UncompressedOffset
+	tailSize := binary.LittleEndian.Uint32(trailer[:]) - uint32(lastOffset)
+
+	return int64(lastOffset + uint64(tailSize)), nil
+}
+
+type indexedRangeHandler struct {
+	compressed io.ReaderAt
+	index      *CompressedIndex
+	size       int64
+	name       string
+	modTime    time.Time
+}
+
+// NewIndexedRangeHandler creates an http.Handler serving the uncompressed representation of an indexed gzip stream, such as a
+// file written by IndexedCompressor, with support for byte range requests.
+// Only the data between the closest flush point and the end of each requested range is uncompressed.
+// name is used to detect the content type from its extension and modTime for conditional requests, as in http.ServeContent.
+func NewIndexedRangeHandler(compressed io.ReaderAt, compressedSize int64, index *CompressedIndex, name string, modTime time.Time) (handler http.Handler, err error) {
+	defer recoverPanic("NewIndexedRangeHandler", &err)
+
+	size, err := uncompressedSize(compressed, compressedSize, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &indexedRangeHandler{
+		compressed: compressed,
+		index:      index,
+		size:       size,
+		name:       name,
+		modTime:    modTime,
+	}, nil
+}
+
+func (irh *indexedRangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	content := &indexedReadSeeker{
+		compressed: irh.compressed,
+		index:      irh.index,
+		size:       irh.size,
+	}
+	defer content.Close()
+
+	http.ServeContent(w, r, irh.name, irh.modTime, content)
+}
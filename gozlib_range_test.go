@@ -0,0 +1,44 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexedRangeHandler(t *testing.T) {
+	data := makeTestData(100000)
+	compressed := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewIndexedCompressor(compressed, CompressionLevelBestSpeed, 4096, 4096)
+	assert.NoError(t, err)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	handler, err := NewIndexedRangeHandler(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()), compressor.Index(), "app.log", time.Now())
+	assert.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, "/app.log", nil)
+	request.Header.Set("Range", "bytes=50000-50099")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, "bytes 50000-50099/100000", recorder.Header().Get("Content-Range"))
+	assert.Equal(t, data[50000:50100], recorder.Body.Bytes())
+
+	request = httptest.NewRequest(http.MethodGet, "/app.log", nil)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body, err := io.ReadAll(recorder.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, data, body)
+}
@@ -0,0 +1,32 @@
+package gozlib
+
+import "io"
+
+// Raw deflate
+// Raw deflate streams have no zlib or gzip header and trailer, and so no checksum. They're used where the framing
+// is provided by the container or protocol, like zip archive entries and websocket permessage-deflate messages.
+
+// NewGoRawDeflateCompressor creates a compressor producing a raw deflate stream, without zlib or gzip framing
+// The level and bufferSize parameters are the same as the ones of NewGoGZipCompressor. Protocols sending one message
+// at a time, like permessage-deflate, can use SyncFlush to complete each message without ending the stream.
+func NewGoRawDeflateCompressor(output io.Writer, level CompressionLevel, bufferSize uint32) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewGoRawDeflateCompressor", &err)
+
+	goComp, err := newGoCompressor(output, TransformModeRawDeflate, level, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return goComp, nil
+}
+
+// NewGoRawInflateUncompressor creates an uncompressor consuming a raw deflate stream, without zlib or gzip framing
+// As raw streams have no trailer, the uncompressed data can't be verified against a checksum.
+func NewGoRawInflateUncompressor(input io.Reader, bufferSize uint32) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewGoRawInflateUncompressor", &err)
+
+	goUncomp, err := newGoUncompressor(input, TransformModeRawUncompress, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return goUncomp, nil
+}
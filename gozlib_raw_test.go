@@ -0,0 +1,70 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawDeflateCompressorInteroperatesWithStdLib(t *testing.T) {
+	data := makeTestData(50000)
+
+	compressed := &bytes.Buffer{}
+	compressor, err := NewGoRawDeflateCompressor(compressed, CompressionLevelDefault, 1024)
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	// no gzip or zlib header
+	assert.NotEqual(t, []byte{0x1f, 0x8b}, compressed.Bytes()[:2])
+	assert.False(t, isZLibHeader(compressed.Bytes()[:2]))
+
+	uncompressed, err := io.ReadAll(flate.NewReader(compressed))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestRawInflateUncompressorInteroperatesWithStdLib(t *testing.T) {
+	data := makeTestData(50000)
+
+	compressed := &bytes.Buffer{}
+	writer, err := flate.NewWriter(compressed, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	uncompressor, err := NewGoRawInflateUncompressor(compressed, 1024)
+	require.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestRawDeflateSyncFlushedMessages(t *testing.T) {
+	messages := [][]byte{[]byte("first message"), makeTestData(3000), []byte("last")}
+
+	compressed := &bytes.Buffer{}
+	compressor, err := NewGoRawDeflateCompressor(compressed, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	reader := flate.NewReader(compressed)
+	for _, message := range messages {
+		_, err = compressor.Write(message)
+		require.NoError(t, err)
+		require.NoError(t, SyncFlush(compressor))
+
+		received := make([]byte, len(message))
+		_, err = io.ReadFull(reader, received)
+		assert.NoError(t, err)
+		assert.Equal(t, message, received)
+	}
+}
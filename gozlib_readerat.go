@@ -0,0 +1,61 @@
+package gozlib
+
+import (
+	"io"
+)
+
+// offsetReader reads sequentially from an io.ReaderAt starting at an offset
+type offsetReader struct {
+	r      io.ReaderAt
+	offset int64
+}
+
+func (or *offsetReader) Read(p []byte) (int, error) {
+	readLen, err := or.r.ReadAt(p, or.offset)
+	or.offset += int64(readLen)
+
+	// ReadAt may return io.EOF along with the last bytes, which would hide them from the uncompressor
+	if err == io.EOF && readLen > 0 {
+		err = nil
+	}
+
+	return readLen, err
+}
+
+// NewUncompressorAt creates a zlib or gzip uncompressor reading compressed data from r, starting at offset
+// This allows uncompressing a member embedded in a larger file without wrapping r in a section reader.
+// The uncompressor stops reading at the end of the compressed stream, using TrailingDataExpose so the data after it,
+// usually the rest of the file, isn't read. SetTrailingDataMode can change this before the first Read.
+func NewUncompressorAt(r io.ReaderAt, offset int64, bufferSize uint32) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewUncompressorAt", &err)
+
+	if offset < 0 {
+		return nil, SeekOffsetError
+	}
+
+	goUncomp, err := newGoUncompressor(nil, TransformModeUncompress, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	goUncomp.trailingMode = TrailingDataExpose
+	goUncomp.atInput = offsetReader{r: r, offset: offset}
+	goUncomp.input = &goUncomp.atInput
+	return goUncomp, nil
+}
+
+// ResetUncompressorAt is like ResetUncompressor, making the uncompressor read from r starting at offset
+// It works with any uncompressor from NewGoZLibUncompressor or NewUncompressorAt and doesn't allocate.
+// The trailing data mode of the uncompressor is kept, so uncompressors not using TrailingDataExpose read r to its end.
+func ResetUncompressorAt(r io.ReaderAt, offset int64, uncompressor io.ReadCloser) (err error) {
+	defer recoverPanic("ResetUncompressorAt", &err)
+
+	if offset < 0 {
+		return SeekOffsetError
+	}
+
+	goUncomp := uncompressor.(*goUncompressor)
+	goUncomp.atInput = offsetReader{r: r, offset: offset}
+	ResetUncompressor(&goUncomp.atInput, uncompressor)
+	return nil
+}
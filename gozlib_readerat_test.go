@@ -0,0 +1,87 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUncompressorAtMembers(t *testing.T) {
+	first := makeTestData(3000)
+	second := makeTestData(5000)
+	firstCompressed, err := stdLibGZipCompressSlice(first)
+	assert.NoError(t, err)
+	secondCompressed, err := stdLibGZipCompressSlice(second)
+	assert.NoError(t, err)
+
+	// a container with a header and two gzip members
+	container := append([]byte("HEADER"), firstCompressed...)
+	secondOffset := int64(len(container))
+	container = append(container, secondCompressed...)
+	reader := bytes.NewReader(container)
+
+	uncompressor, err := NewUncompressorAt(reader, 6, 1024)
+	assert.NoError(t, err)
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, first, uncompressed)
+
+	assert.NoError(t, ResetUncompressorAt(reader, secondOffset, uncompressor))
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, second, uncompressed)
+
+	assert.ErrorIs(t, ResetUncompressorAt(reader, -1, uncompressor), SeekOffsetError)
+	assert.NoError(t, uncompressor.Close())
+
+	_, err = NewUncompressorAt(reader, -1, 1024)
+	assert.ErrorIs(t, err, SeekOffsetError)
+}
+
+func TestUncompressorAtTruncatedMember(t *testing.T) {
+	data := makeTestData(3000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	uncompressor, err := NewUncompressorAt(bytes.NewReader(compressed[:len(compressed)/2]), 0, 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	// reading stops where the input ends
+	uncompressed, _ := io.ReadAll(uncompressor)
+	assert.Less(t, len(uncompressed), len(data))
+	assert.Equal(t, data[:len(uncompressed)], uncompressed)
+}
+
+type countingReaderAt struct {
+	reader io.ReaderAt
+	count  int64
+}
+
+func (cra *countingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	readLen, err := cra.reader.ReadAt(p, offset)
+	cra.count += int64(readLen)
+	return readLen, err
+}
+
+func TestUncompressorAtStopsAtEndOfMember(t *testing.T) {
+	const bufferSize = 1024
+	data := makeTestData(3000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	// a member followed by much more data, as in a larger file
+	container := append(compressed, make([]byte, 1<<20)...)
+	reader := &countingReaderAt{reader: bytes.NewReader(container)}
+
+	uncompressor, err := NewUncompressorAt(reader, 0, bufferSize)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+	assert.LessOrEqual(t, reader.count, int64(len(compressed)+bufferSize))
+}
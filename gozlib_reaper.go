@@ -0,0 +1,85 @@
+package gozlib
+
+import (
+	"io"
+	"time"
+)
+
+// Idle transformer reaper
+// A pool keeps up to maxIdle transformers regardless of load, so its native memory follows the historical peak.
+// The reaper periodically closes transformers that stayed idle longer than a TTL, down to a minimum number of idle
+// transformers kept around to absorb bursts.
+
+// SetIdleReaper closes idle transformers released more than ttl ago, keeping at least minIdle idle transformers
+// The pool is checked every half ttl. A ttl of zero or less stops the reaper.
+func (tp *TransformerPool) SetIdleReaper(ttl time.Duration, minIdle int) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	tp.stopReaper()
+	if ttl <= 0 || tp.closed {
+		return
+	}
+
+	stop := make(chan struct{})
+	tp.reaperStop = stop
+	go tp.runReaper(ttl, minIdle, stop)
+}
+
+func (tp *TransformerPool) runReaper(ttl time.Duration, minIdle int, stop chan struct{}) {
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			tp.reapIdle(ttl, minIdle)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// stopReaper stops the reaper goroutine, if any. Must be called with the mutex locked
+func (tp *TransformerPool) stopReaper() {
+	if tp.reaperStop != nil {
+		close(tp.reaperStop)
+		tp.reaperStop = nil
+	}
+}
+
+// reapIdle closes transformers idle for longer than ttl, oldest first, while more than minIdle are idle
+func (tp *TransformerPool) reapIdle(ttl time.Duration, minIdle int) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	deadline := tp.now().Add(-ttl)
+	for tp.idleCount() > minIdle {
+		// released transformers are appended, so the oldest of each idle list is the first one
+		var oldest io.Closer
+		var oldestLevel CompressionLevel
+		for level, idle := range tp.compressors {
+			if len(idle) > 0 && (oldest == nil || tp.idleSince[idle[0]].Before(tp.idleSince[oldest])) {
+				oldest = idle[0]
+				oldestLevel = level
+			}
+		}
+		oldestIsUncompressor := false
+		if len(tp.uncompressors) > 0 && (oldest == nil || tp.idleSince[tp.uncompressors[0]].Before(tp.idleSince[oldest])) {
+			oldest = tp.uncompressors[0]
+			oldestIsUncompressor = true
+		}
+
+		if oldest == nil || !tp.idleSince[oldest].Before(deadline) {
+			return
+		}
+
+		if oldestIsUncompressor {
+			tp.uncompressors = tp.uncompressors[1:]
+		} else {
+			tp.compressors[oldestLevel] = tp.compressors[oldestLevel][1:]
+		}
+		delete(tp.idleSince, oldest)
+		oldest.Close()
+	}
+}
@@ -0,0 +1,102 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReapIdleClosesExpiredTransformersOldestFirst(t *testing.T) {
+	pool := NewTransformerPool(1024, 10)
+	defer pool.Close()
+
+	start := time.Now()
+	clock := start
+	pool.now = func() time.Time { return clock }
+
+	var compressors []io.WriteCloser
+	for _, level := range []CompressionLevel{CompressionLevelBestSpeed, CompressionLevelBestSpeed, CompressionLevelBestCompression} {
+		compressor, err := pool.AcquireCompressor(io.Discard, level)
+		require.NoError(t, err)
+		compressors = append(compressors, compressor)
+	}
+	uncompressor, err := pool.AcquireUncompressor(bytes.NewReader(nil))
+	require.NoError(t, err)
+
+	// released one minute apart, the uncompressor last
+	for _, compressor := range compressors {
+		pool.ReleaseCompressor(compressor)
+		clock = clock.Add(time.Minute)
+	}
+	pool.ReleaseUncompressor(uncompressor)
+
+	clock = start.Add(5 * time.Minute)
+	pool.reapIdle(10*time.Minute, 0)
+	assert.Equal(t, 4, pool.idleCount())
+
+	// the first two compressors expired but only one can be closed
+	clock = start.Add(11*time.Minute + time.Second)
+	pool.reapIdle(10*time.Minute, 3)
+	assert.Equal(t, 3, pool.idleCount())
+	assert.Len(t, pool.compressors[CompressionLevelBestSpeed], 1)
+	assert.Same(t, compressors[1], pool.compressors[CompressionLevelBestSpeed][0])
+
+	pool.reapIdle(10*time.Minute, 0)
+	assert.Equal(t, 2, pool.idleCount())
+	assert.Len(t, pool.idleSince, 2)
+
+	clock = start.Add(time.Hour)
+	pool.reapIdle(10*time.Minute, 0)
+	assert.Equal(t, 0, pool.idleCount())
+	assert.Len(t, pool.idleSince, 0)
+}
+
+func TestIdleReaperRunsInBackground(t *testing.T) {
+	pool := NewTransformerPool(1024, 10)
+	defer pool.Close()
+
+	var acquired []io.WriteCloser
+	for i := 0; i < 3; i++ {
+		compressor, err := pool.AcquireCompressor(io.Discard, CompressionLevelBestSpeed)
+		require.NoError(t, err)
+		acquired = append(acquired, compressor)
+	}
+	for _, compressor := range acquired {
+		pool.ReleaseCompressor(compressor)
+	}
+
+	pool.SetIdleReaper(20*time.Millisecond, 1)
+	idle := func() int {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		return pool.idleCount()
+	}
+	assert.Eventually(t, func() bool { return idle() == 1 }, time.Second, 5*time.Millisecond)
+
+	pool.SetIdleReaper(0, 0)
+	assert.Nil(t, pool.reaperStop)
+}
+
+func TestIdleReaperStopsWhenPoolCloses(t *testing.T) {
+	pool := NewTransformerPool(1024, 10)
+	pool.SetIdleReaper(time.Hour, 0)
+
+	var wg sync.WaitGroup
+	stop := pool.reaperStop
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-stop
+	}()
+
+	assert.NoError(t, pool.Close())
+	wg.Wait()
+
+	pool.SetIdleReaper(time.Hour, 0)
+	assert.Nil(t, pool.reaperStop)
+}
@@ -0,0 +1,141 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// Damaged stream recovery
+// When uncompression fails, the input is scanned for the next full flush point, where uncompression can restart without
+// the data that came before it. Streams written with regular full flushes, like the ones produced by IndexedCompressor,
+// recover best. Data after a restart point that references data before it can't be recovered and causes another skip.
+
+// RecoveryGap is a region of compressed data that had to be skipped
+type RecoveryGap struct {
+	// CompressedOffset is where the damaged region starts in the compressed stream
+	CompressedOffset int64
+	// CompressedLength is the number of compressed bytes skipped
+	CompressedLength int64
+	// UncompressedOffset is the position in the recovered data where the gap is, data from the skipped region is missing there
+	UncompressedOffset uint64
+}
+
+// RecoveryReport describes the data recovered by RecoverData
+type RecoveryReport struct {
+	// RecoveredBytes is the number of uncompressed bytes written to the destination
+	RecoveredBytes uint64
+	// Gaps lists the damaged regions skipped, in stream order
+	Gaps []RecoveryGap
+	// ChecksumMismatch is true if the trailer checksum or length didn't match, the trailer isn't verified after a gap
+	ChecksumMismatch bool
+	// Truncated is true if the input ended before the end of the compressed stream
+	Truncated bool
+}
+
+// RecoverData uncompresses as much data as possible from a gzip or zlib stream read from src, writing it to dst
+// Damaged regions are skipped, resuming at the next full flush point, and checksum mismatches are ignored.
+// The returned error is only set for failures reading from src or writing to dst.
+func RecoverData(dst io.Writer, src io.Reader) (report *RecoveryReport, err error) {
+	defer recoverPanic("RecoverData", &err)
+
+	stream, err := newInflateStream(C.MAX_WBITS + 32)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.close()
+
+	inputPtr := C.pool_alloc(diagnoseBufferSize)
+	defer C.pool_free(inputPtr)
+	outputPtr := C.pool_alloc(diagnoseBufferSize)
+	defer C.pool_free(outputPtr)
+
+	inputBuffer := nativeSlice(inputPtr, diagnoseBufferSize, diagnoseBufferSize)
+	output := nativeSlice(outputPtr, diagnoseBufferSize, diagnoseBufferSize)
+
+	report = &RecoveryReport{Gaps: []RecoveryGap{}}
+	var offset int64
+	syncing := false
+	gap := RecoveryGap{}
+
+	for {
+		readLen, rerr := io.ReadFull(src, inputBuffer)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return report, rerr
+		}
+		input := inputBuffer[:readLen]
+
+		for {
+			if syncing {
+				consumed, resultCode := stream.sync(input)
+				input = input[consumed:]
+				offset += int64(consumed)
+
+				if resultCode != C.Z_OK {
+					// no flush point in the remaining input
+					break
+				}
+
+				syncing = false
+				gap.CompressedLength = offset - gap.CompressedOffset
+				report.Gaps = append(report.Gaps, gap)
+			}
+
+			consumed, produced, resultCode := stream.step(input, output, C.Z_NO_FLUSH)
+			input = input[consumed:]
+			offset += int64(consumed)
+
+			if produced > 0 {
+				_, werr := dst.Write(output[:produced])
+				if werr != nil {
+					return report, werr
+				}
+				report.RecoveredBytes += uint64(produced)
+			}
+
+			if resultCode == C.Z_STREAM_END {
+				return report, nil
+			}
+
+			if resultCode == C.Z_DATA_ERROR {
+				if trailerErrorMessages[streamMessage(stream)] {
+					report.ChecksumMismatch = true
+					return report, nil
+				}
+
+				syncing = true
+				gap = RecoveryGap{CompressedOffset: offset, UncompressedOffset: report.RecoveredBytes}
+				continue
+			}
+
+			if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+				return report, fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, resultCode)
+			}
+
+			if len(input) == 0 && produced < len(output) {
+				break
+			}
+		}
+
+		if readLen < len(inputBuffer) {
+			if syncing {
+				gap.CompressedLength = offset - gap.CompressedOffset
+				report.Gaps = append(report.Gaps, gap)
+			}
+			report.Truncated = true
+			return report, nil
+		}
+	}
+}
+
+func streamMessage(stream *nativeStream) string {
+	if stream.zs.msg == nil {
+		return ""
+	}
+
+	return C.GoString((*C.char)(unsafe.Pointer(stream.zs.msg)))
+}
@@ -0,0 +1,66 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverDataSkipsDamagedRegion(t *testing.T) {
+	data := makeTestData(100000)
+	compressed := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewIndexedCompressor(compressed, CompressionLevelBestSpeed, 8192, 4096)
+	assert.NoError(t, err)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	// an invalid block type right after a flush point always fails uncompression
+	points := compressor.Index().Points
+	damaged := compressed.Bytes()
+	damagePoint := points[len(points)/2]
+	damaged[damagePoint.CompressedOffset] = 0xff
+
+	recovered := bytes.NewBuffer([]byte{})
+	report, err := RecoverData(recovered, bytes.NewReader(damaged))
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint64(recovered.Len()), report.RecoveredBytes)
+	assert.Equal(t, 1, len(report.Gaps))
+	assert.False(t, report.Truncated)
+
+	gap := report.Gaps[0]
+	assert.GreaterOrEqual(t, gap.CompressedOffset, int64(damagePoint.CompressedOffset))
+	assert.LessOrEqual(t, gap.CompressedOffset, int64(damagePoint.CompressedOffset)+1)
+	assert.Equal(t, damagePoint.UncompressedOffset, gap.UncompressedOffset)
+	assert.Greater(t, gap.CompressedLength, int64(0))
+
+	// data before the gap and data after the restart point are intact
+	output := recovered.Bytes()
+	assert.Equal(t, data[:gap.UncompressedOffset], output[:gap.UncompressedOffset])
+	tailLen := len(output) - int(gap.UncompressedOffset)
+	assert.Greater(t, tailLen, 0)
+	assert.Equal(t, data[len(data)-tailLen:], output[gap.UncompressedOffset:])
+	assert.Greater(t, recovered.Len(), len(data)/2)
+}
+
+func TestRecoverDataIntactStream(t *testing.T) {
+	data := makeTestData(10000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	recovered := bytes.NewBuffer([]byte{})
+	report, err := RecoverData(recovered, bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	assert.Empty(t, report.Gaps)
+	assert.False(t, report.ChecksumMismatch)
+	assert.Equal(t, data, recovered.Bytes())
+
+	recovered.Reset()
+	report, err = RecoverData(recovered, bytes.NewReader(compressed[:len(compressed)-20]))
+	assert.NoError(t, err)
+	assert.True(t, report.Truncated)
+	assert.Equal(t, data[:recovered.Len()], recovered.Bytes())
+}
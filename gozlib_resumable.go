@@ -0,0 +1,282 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"unsafe"
+)
+
+// Resumable gzip compression
+// The compressor produces a gzip stream with raw deflate data and writes the gzip header and trailer itself, so that
+// its state can be captured as the stream position, checksum and sliding window. A snapshot sync flushes the stream
+// so it ends on a byte boundary, and resuming primes a new deflate stream with the saved window, continuing the same
+// gzip member as if the process had never stopped.
+
+var gzipHeader = []byte{0x1f, 0x8b, C.Z_DEFLATED, 0, 0, 0, 0, 0, 0, 0xff}
+
+var snapshotMagic = []byte("GZRS")
+
+const snapshotVersion = 1
+
+var (
+	SnapshotFormatError = errors.New("invalid compressor snapshot")
+)
+
+// CompressorSnapshot holds the state needed to resume a compressed stream
+type CompressorSnapshot struct {
+	// Level is the compression level of the stream
+	Level CompressionLevel
+	// CompressedSize is the number of compressed bytes written up to the snapshot, including the gzip header.
+	// Any data written to the output past this offset must be discarded before resuming.
+	CompressedSize uint64
+	// UncompressedSize is the number of uncompressed bytes written up to the snapshot
+	UncompressedSize uint64
+	// CRC32 is the checksum of the uncompressed data written up to the snapshot
+	CRC32 uint32
+	// Window is the compression sliding window, the last MaxDictionarySize bytes of uncompressed data at most
+	Window []byte
+}
+
+// MarshalBinary serializes the snapshot
+func (cs *CompressorSnapshot) MarshalBinary() (data []byte, err error) {
+	defer recoverPanic("CompressorSnapshot.MarshalBinary", &err)
+
+	data = make([]byte, 0, len(snapshotMagic)+1+4*binary.MaxVarintLen64+4+len(cs.Window))
+	data = append(data, snapshotMagic...)
+	data = append(data, snapshotVersion)
+	data = binary.AppendVarint(data, int64(cs.Level))
+	data = binary.AppendUvarint(data, cs.CompressedSize)
+	data = binary.AppendUvarint(data, cs.UncompressedSize)
+	data = binary.LittleEndian.AppendUint32(data, cs.CRC32)
+	data = binary.AppendUvarint(data, uint64(len(cs.Window)))
+	data = append(data, cs.Window...)
+
+	return data, nil
+}
+
+// UnmarshalBinary restores a snapshot serialized by MarshalBinary
+func (cs *CompressorSnapshot) UnmarshalBinary(data []byte) (err error) {
+	defer recoverPanic("CompressorSnapshot.UnmarshalBinary", &err)
+
+	headerLen := len(snapshotMagic) + 1
+	if len(data) < headerLen || string(data[:len(snapshotMagic)]) != string(snapshotMagic) || data[len(snapshotMagic)] != snapshotVersion {
+		return SnapshotFormatError
+	}
+	data = data[headerLen:]
+
+	level, levelLen := binary.Varint(data)
+	if levelLen <= 0 {
+		return SnapshotFormatError
+	}
+	data = data[levelLen:]
+
+	values := [2]uint64{}
+	for pos := range values {
+		value, valueLen := binary.Uvarint(data)
+		if valueLen <= 0 {
+			return SnapshotFormatError
+		}
+		values[pos] = value
+		data = data[valueLen:]
+	}
+
+	if len(data) < 4 {
+		return SnapshotFormatError
+	}
+	checksum := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	windowLen, windowLenLen := binary.Uvarint(data)
+	if windowLenLen <= 0 || windowLen > MaxDictionarySize || uint64(len(data)-windowLenLen) != windowLen {
+		return SnapshotFormatError
+	}
+
+	cs.Level = CompressionLevel(level)
+	cs.CompressedSize = values[0]
+	cs.UncompressedSize = values[1]
+	cs.CRC32 = checksum
+	cs.Window = append([]byte{}, data[windowLenLen:]...)
+
+	return nil
+}
+
+// ResumableCompressor is a gzip compressor whose state can be saved with Snapshot and restored with ResumeCompressor
+type ResumableCompressor struct {
+	output           io.Writer
+	stream           *nativeStream
+	level            CompressionLevel
+	work             []byte
+	workPtr          unsafe.Pointer
+	compressedSize   uint64
+	uncompressedSize uint64
+	checksum         uint32
+}
+
+// NewResumableCompressor creates a new gzip compressor writing to output whose state can be snapshotted
+// bufferSize is the size of the native buffer holding compressed data before it's written to output, zero means the default
+// compressor buffer size, see Defaults. Sizes above 4MB are rejected with BufferSizeError.
+// Close must be called to end the stream and release the native resources.
+func NewResumableCompressor(output io.Writer, level CompressionLevel, bufferSize uint32) (compressor *ResumableCompressor, err error) {
+	defer recoverPanic("NewResumableCompressor", &err)
+
+	return newResumableCompressor(output, &CompressorSnapshot{Level: level}, bufferSize)
+}
+
+// ResumeCompressor creates a compressor continuing the stream captured by snapshot
+// output must be positioned right after the first snapshot.CompressedSize bytes of the original output, for example
+// by truncating the original file to that size and appending to it. bufferSize is used as in NewResumableCompressor.
+func ResumeCompressor(output io.Writer, snapshot *CompressorSnapshot, bufferSize uint32) (compressor *ResumableCompressor, err error) {
+	defer recoverPanic("ResumeCompressor", &err)
+
+	if snapshot.CompressedSize < uint64(len(gzipHeader)) {
+		return nil, fmt.Errorf("%w: snapshot taken before the gzip header", SnapshotFormatError)
+	}
+
+	return newResumableCompressor(output, snapshot, bufferSize)
+}
+
+func newResumableCompressor(output io.Writer, snapshot *CompressorSnapshot, bufferSize uint32) (*ResumableCompressor, error) {
+	if len(snapshot.Window) > MaxDictionarySize {
+		return nil, fmt.Errorf("%w: window too large", SnapshotFormatError)
+	}
+	// deflate can't make progress without room for its output
+	if bufferSize == 0 {
+		bufferSize = GetDefaults().CompressorBufferSize
+	}
+
+	stream, err := newDeflateStream(snapshot.Level, -C.MAX_WBITS, C.Z_DEFAULT_STRATEGY)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshot.Window) > 0 {
+		resultCode := C.deflateSetDictionary(stream.zs, (*C.Bytef)(unsafe.Pointer(&snapshot.Window[0])), C.uInt(len(snapshot.Window)))
+		if resultCode != C.Z_OK {
+			stream.close()
+			return nil, fmt.Errorf(wrapErrorFormat, TransformerInitializationError, resultCode)
+		}
+	}
+
+	workPtr, err := allocNativeBuffer(uint64(bufferSize))
+	if err != nil {
+		stream.close()
+		return nil, err
+	}
+
+	return &ResumableCompressor{
+		output:           output,
+		stream:           stream,
+		level:            snapshot.Level,
+		work:             nativeSlice(workPtr, int(bufferSize), int(bufferSize)),
+		workPtr:          workPtr,
+		compressedSize:   snapshot.CompressedSize,
+		uncompressedSize: snapshot.UncompressedSize,
+		checksum:         snapshot.CRC32,
+	}, nil
+}
+
+func (rc *ResumableCompressor) writeOutput(data []byte) error {
+	written, err := rc.output.Write(data)
+	rc.compressedSize += uint64(written)
+	return err
+}
+
+func (rc *ResumableCompressor) ensureHeader() error {
+	if rc.compressedSize > 0 {
+		return nil
+	}
+
+	return rc.writeOutput(gzipHeader)
+}
+
+// deflate compresses data with the given flush mode, writing all output produced
+func (rc *ResumableCompressor) deflate(data []byte, flush C.int) error {
+	herr := rc.ensureHeader()
+	if herr != nil {
+		return herr
+	}
+
+	for {
+		consumed, produced, resultCode := rc.stream.step(data, rc.work, flush)
+		data = data[consumed:]
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR && resultCode != C.Z_STREAM_END {
+			return fmt.Errorf(wrapErrorFormat, TransformerCompressionError, resultCode)
+		}
+
+		if produced > 0 {
+			werr := rc.writeOutput(rc.work[:produced])
+			if werr != nil {
+				return werr
+			}
+		}
+
+		if resultCode == C.Z_STREAM_END || (flush != C.Z_FINISH && len(data) == 0 && produced < len(rc.work)) {
+			return nil
+		}
+	}
+}
+
+// Write compresses data, returning the number of uncompressed bytes written
+func (rc *ResumableCompressor) Write(data []byte) (n int, err error) {
+	defer recoverPanic("ResumableCompressor.Write", &err)
+
+	err = rc.deflate(data, C.Z_NO_FLUSH)
+	if err != nil {
+		return 0, err
+	}
+
+	rc.checksum = crc32.Update(rc.checksum, crc32.IEEETable, data)
+	rc.uncompressedSize += uint64(len(data))
+
+	return len(data), nil
+}
+
+// Snapshot flushes all data written so far to the output and returns the state needed to resume the stream from this point
+func (rc *ResumableCompressor) Snapshot() (snapshot *CompressorSnapshot, err error) {
+	defer recoverPanic("ResumableCompressor.Snapshot", &err)
+
+	ferr := rc.deflate(nil, C.Z_SYNC_FLUSH)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	window, derr := appendDictionary(rc.stream.zs, getCompressionDictionary, nil)
+	if derr != nil {
+		return nil, derr
+	}
+
+	return &CompressorSnapshot{
+		Level:            rc.level,
+		CompressedSize:   rc.compressedSize,
+		UncompressedSize: rc.uncompressedSize,
+		CRC32:            rc.checksum,
+		Window:           window,
+	}, nil
+}
+
+// Close ends the gzip stream, writing its trailer, and releases the native resources
+func (rc *ResumableCompressor) Close() (err error) {
+	defer recoverPanic("ResumableCompressor.Close", &err)
+
+	err = rc.deflate(nil, C.Z_FINISH)
+	if err == nil {
+		var trailer [8]byte
+		binary.LittleEndian.PutUint32(trailer[:4], rc.checksum)
+		// gzip stores the size modulo 2^32
+		binary.LittleEndian.PutUint32(trailer[4:], uint32(rc.uncompressedSize))
+		err = rc.writeOutput(trailer[:])
+	}
+
+	rc.stream.close()
+	C.pool_free(rc.workPtr)
+
+	return err
+}
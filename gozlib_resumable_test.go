@@ -0,0 +1,86 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumableCompressorSurvivesRestarts(t *testing.T) {
+	data := makeTestData(300000)
+	wal := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewResumableCompressor(wal, CompressionLevelBestSpeed, 4096)
+	assert.NoError(t, err)
+
+	pieces := [][]byte{data[:1000], data[1000:100000], data[100000:250000], data[250000:]}
+	for _, piece := range pieces[:len(pieces)-1] {
+		_, err = compressor.Write(piece)
+		assert.NoError(t, err)
+
+		snapshot, err := compressor.Snapshot()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(wal.Len()), snapshot.CompressedSize)
+
+		serialized, err := snapshot.MarshalBinary()
+		assert.NoError(t, err)
+
+		// data written after the snapshot is lost in the crash
+		_, err = compressor.Write([]byte("lost in the crash"))
+		assert.NoError(t, err)
+		// release the native resources of the crashed compressor, anything it writes is truncated
+		assert.NoError(t, compressor.Close())
+		wal.Truncate(int(snapshot.CompressedSize))
+
+		restored := &CompressorSnapshot{}
+		assert.NoError(t, restored.UnmarshalBinary(serialized))
+		assert.Equal(t, snapshot, restored)
+
+		compressor, err = ResumeCompressor(wal, restored, 4096)
+		assert.NoError(t, err)
+	}
+
+	_, err = compressor.Write(pieces[len(pieces)-1])
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	uncompressed, err := stdLibGZipUncompress(wal, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestResumableCompressorDefaultBufferSize(t *testing.T) {
+	data := makeTestData(50000)
+	output := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewResumableCompressor(output, CompressionLevelBestSpeed, 0)
+	assert.NoError(t, err)
+
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+}
+
+func TestResumableCompressorBufferSizeTooLarge(t *testing.T) {
+	compressor, err := NewResumableCompressor(bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed, nativePoolMaxSize+1)
+	assert.ErrorIs(t, err, BufferSizeError)
+	assert.Nil(t, compressor)
+
+	compressor, err = NewResumableCompressor(bytes.NewBuffer([]byte{}), CompressionLevelBestSpeed, nativePoolMaxSize)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+}
+
+func TestCompressorSnapshotInvalid(t *testing.T) {
+	snapshot := &CompressorSnapshot{}
+	assert.ErrorIs(t, snapshot.UnmarshalBinary([]byte("GZRS")), SnapshotFormatError)
+	assert.ErrorIs(t, snapshot.UnmarshalBinary([]byte("not a snapshot")), SnapshotFormatError)
+
+	_, err := ResumeCompressor(bytes.NewBuffer([]byte{}), snapshot, 1024)
+	assert.ErrorIs(t, err, SnapshotFormatError)
+}
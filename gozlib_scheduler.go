@@ -0,0 +1,146 @@
+package gozlib
+
+import (
+	"container/heap"
+)
+
+// Scheduler decides the order queued jobs are executed
+// Schedulers are called by the queue while holding its lock, implementations don't need to be safe for concurrent use.
+// Pop is only called when Len is greater than zero.
+type Scheduler interface {
+	Push(job Job)
+	Pop() Job
+	Len() int
+}
+
+type fifoScheduler struct {
+	jobs []Job
+}
+
+// NewFIFOScheduler creates a scheduler executing jobs in the order they were enqueued
+func NewFIFOScheduler() Scheduler {
+	return &fifoScheduler{jobs: []Job{}}
+}
+
+func (fs *fifoScheduler) Push(job Job) {
+	fs.jobs = append(fs.jobs, job)
+}
+
+func (fs *fifoScheduler) Pop() Job {
+	job := fs.jobs[0]
+	fs.jobs[0] = Job{}
+	fs.jobs = fs.jobs[1:]
+	return job
+}
+
+func (fs *fifoScheduler) Len() int {
+	return len(fs.jobs)
+}
+
+type priorityEntry struct {
+	job      Job
+	sequence uint64
+}
+
+// priorityHeap implements heap.Interface, jobs with the same priority keep their enqueue order
+type priorityHeap []priorityEntry
+
+func (ph priorityHeap) Len() int { return len(ph) }
+
+func (ph priorityHeap) Less(i, j int) bool {
+	if ph[i].job.Priority != ph[j].job.Priority {
+		return ph[i].job.Priority > ph[j].job.Priority
+	}
+	return ph[i].sequence < ph[j].sequence
+}
+
+func (ph priorityHeap) Swap(i, j int) { ph[i], ph[j] = ph[j], ph[i] }
+
+func (ph *priorityHeap) Push(x any) { *ph = append(*ph, x.(priorityEntry)) }
+
+func (ph *priorityHeap) Pop() any {
+	old := *ph
+	entry := old[len(old)-1]
+	old[len(old)-1] = priorityEntry{}
+	*ph = old[:len(old)-1]
+	return entry
+}
+
+type priorityScheduler struct {
+	entries  priorityHeap
+	sequence uint64
+}
+
+// NewPriorityScheduler creates a scheduler executing jobs with higher Priority first
+// Jobs with the same priority are executed in the order they were enqueued.
+func NewPriorityScheduler() Scheduler {
+	return &priorityScheduler{entries: priorityHeap{}}
+}
+
+func (ps *priorityScheduler) Push(job Job) {
+	heap.Push(&ps.entries, priorityEntry{job: job, sequence: ps.sequence})
+	ps.sequence++
+}
+
+func (ps *priorityScheduler) Pop() Job {
+	return heap.Pop(&ps.entries).(priorityEntry).job
+}
+
+func (ps *priorityScheduler) Len() int {
+	return ps.entries.Len()
+}
+
+type fairShareScheduler struct {
+	tenants map[string]Scheduler
+	// order has the tenants with pending jobs, in the order they will be served
+	order   []string
+	newLane func() Scheduler
+	count   int
+}
+
+// NewFairShareScheduler creates a scheduler taking turns between tenants, so a tenant with many pending jobs can't
+// delay the jobs of other tenants
+// Jobs of the same tenant are ordered by the scheduler returned by newLane, FIFO if nil.
+func NewFairShareScheduler(newLane func() Scheduler) Scheduler {
+	if newLane == nil {
+		newLane = NewFIFOScheduler
+	}
+
+	return &fairShareScheduler{tenants: map[string]Scheduler{}, order: []string{}, newLane: newLane}
+}
+
+func (fss *fairShareScheduler) Push(job Job) {
+	lane, found := fss.tenants[job.Tenant]
+	if !found {
+		lane = fss.newLane()
+		fss.tenants[job.Tenant] = lane
+	}
+
+	if lane.Len() == 0 {
+		fss.order = append(fss.order, job.Tenant)
+	}
+
+	lane.Push(job)
+	fss.count++
+}
+
+func (fss *fairShareScheduler) Pop() Job {
+	tenant := fss.order[0]
+	fss.order = fss.order[1:]
+
+	lane := fss.tenants[tenant]
+	job := lane.Pop()
+	fss.count--
+
+	if lane.Len() > 0 {
+		fss.order = append(fss.order, tenant)
+	} else {
+		delete(fss.tenants, tenant)
+	}
+
+	return job
+}
+
+func (fss *fairShareScheduler) Len() int {
+	return fss.count
+}
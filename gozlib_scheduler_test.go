@@ -0,0 +1,96 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func drainScheduler(scheduler Scheduler) []string {
+	ids := []string{}
+	for scheduler.Len() > 0 {
+		ids = append(ids, scheduler.Pop().ID)
+	}
+	return ids
+}
+
+func TestFIFOScheduler(t *testing.T) {
+	scheduler := NewFIFOScheduler()
+	scheduler.Push(Job{ID: "a", Priority: 1})
+	scheduler.Push(Job{ID: "b", Priority: 5})
+	scheduler.Push(Job{ID: "c"})
+
+	assert.Equal(t, []string{"a", "b", "c"}, drainScheduler(scheduler))
+}
+
+func TestPriorityScheduler(t *testing.T) {
+	scheduler := NewPriorityScheduler()
+	scheduler.Push(Job{ID: "low", Priority: -1})
+	scheduler.Push(Job{ID: "a", Priority: 1})
+	scheduler.Push(Job{ID: "high", Priority: 10})
+	scheduler.Push(Job{ID: "b", Priority: 1})
+
+	assert.Equal(t, []string{"high", "a", "b", "low"}, drainScheduler(scheduler))
+}
+
+func TestFairShareScheduler(t *testing.T) {
+	scheduler := NewFairShareScheduler(nil)
+	for _, id := range []string{"b1", "b2", "b3", "b4"} {
+		scheduler.Push(Job{ID: id, Tenant: "batch"})
+	}
+	scheduler.Push(Job{ID: "i1", Tenant: "interactive"})
+	scheduler.Push(Job{ID: "i2", Tenant: "interactive"})
+
+	assert.Equal(t, 6, scheduler.Len())
+	assert.Equal(t, []string{"b1", "i1", "b2", "i2", "b3", "b4"}, drainScheduler(scheduler))
+
+	// tenants without pending jobs rejoin at the end of the rotation
+	scheduler.Push(Job{ID: "b5", Tenant: "batch"})
+	scheduler.Push(Job{ID: "i3", Tenant: "interactive"})
+	assert.Equal(t, []string{"b5", "i3"}, drainScheduler(scheduler))
+}
+
+func TestFairShareSchedulerWithPriorityLanes(t *testing.T) {
+	scheduler := NewFairShareScheduler(NewPriorityScheduler)
+	scheduler.Push(Job{ID: "a1", Tenant: "a"})
+	scheduler.Push(Job{ID: "a2", Tenant: "a", Priority: 3})
+	scheduler.Push(Job{ID: "b1", Tenant: "b"})
+
+	assert.Equal(t, []string{"a2", "b1", "a1"}, drainScheduler(scheduler))
+}
+
+func TestQueueWithScheduler(t *testing.T) {
+	results := make(chan JobResult, 3)
+	started := make(chan struct{})
+	blocker := make(chan struct{})
+	queue, err := NewQueue(QueueOptions{
+		Workers:   1,
+		Scheduler: NewPriorityScheduler(),
+		OnComplete: func(result JobResult) {
+			if result.Job.ID == "first" {
+				close(started)
+				<-blocker
+			}
+			results <- result
+		},
+	})
+	assert.NoError(t, err)
+
+	newJob := func(id string, priority int) Job {
+		return Job{ID: id, Priority: priority, Kind: JobCompress, Level: CompressionLevelBestSpeed,
+			Source: bytes.NewReader(makeTestData(100)), Destination: bytes.NewBuffer([]byte{})}
+	}
+
+	// the single worker is busy with the first job while the others are enqueued
+	assert.NoError(t, queue.Enqueue(newJob("first", 0)))
+	<-started
+	assert.NoError(t, queue.Enqueue(newJob("low", 1)))
+	assert.NoError(t, queue.Enqueue(newJob("high", 2)))
+	close(blocker)
+
+	assert.Equal(t, "first", (<-results).Job.ID)
+	assert.Equal(t, "high", (<-results).Job.ID)
+	assert.Equal(t, "low", (<-results).Job.ID)
+	assert.NoError(t, queue.Close())
+}
@@ -0,0 +1,159 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Parallel section compression
+// A large input available through io.ReaderAt, like a file, is split into sections of the same size that are read and
+// compressed concurrently, each one into its own gzip member. The members are concatenated in order into a multi-member
+// gzip stream, which any gzip reader uncompresses back to the whole input and whose members can be uncompressed on their own.
+
+var (
+	CompressSectionsOptionsError = errors.New("invalid section compression options")
+)
+
+// compressedSection is the gzip member of a section, or the error reading or compressing it
+type compressedSection struct {
+	member []byte
+	err    error
+}
+
+// sectionsReader returns the members of the compressed sections in order, while the following sections are compressed
+type sectionsReader struct {
+	members <-chan chan compressedSection
+	done    chan struct{}
+	closed  bool
+	current []byte
+	err     error
+}
+
+// CompressSections compresses the first size bytes of r as a multi-member gzip stream, one member per chunk bytes,
+// returned by the reader. Sections are read from r and compressed by up to workers goroutines, ahead of the reader,
+// with the compression level of the package defaults. The last section may be shorter than chunk and an empty input
+// produces a single empty member.
+// Closing the reader stops the compression of the remaining sections.
+func CompressSections(r io.ReaderAt, size int64, chunk int64, workers int) (reader io.ReadCloser, err error) {
+	defer recoverPanic("CompressSections", &err)
+
+	if size < 0 {
+		return nil, fmt.Errorf("%w: size must not be negative", CompressSectionsOptionsError)
+	}
+	if chunk <= 0 || chunk > MaxMessageSize {
+		return nil, fmt.Errorf("%w: chunk must be greater than zero and up to %d", CompressSectionsOptionsError, MaxMessageSize)
+	}
+	if workers <= 0 {
+		return nil, fmt.Errorf("%w: workers must be greater than zero", CompressSectionsOptionsError)
+	}
+
+	level := GetDefaults().CompressionLevel
+	// sections waiting to be read are bounded by workers, so are the sections held in memory
+	members := make(chan chan compressedSection, workers)
+	done := make(chan struct{})
+
+	go dispatchSections(r, size, chunk, level, workers, members, done)
+
+	return &sectionsReader{members: members, done: done}, nil
+}
+
+func dispatchSections(r io.ReaderAt, size int64, chunk int64, level CompressionLevel, workers int,
+	members chan<- chan compressedSection, done <-chan struct{}) {
+	defer close(members)
+
+	running := make(chan struct{}, workers)
+	offset := int64(0)
+	for {
+		sectionLen := size - offset
+		if sectionLen > chunk {
+			sectionLen = chunk
+		}
+
+		select {
+		case running <- struct{}{}:
+		case <-done:
+			return
+		}
+
+		member := make(chan compressedSection, 1)
+		go func(offset int64, sectionLen int64) {
+			member <- compressSection(r, offset, sectionLen, level)
+			<-running
+		}(offset, sectionLen)
+
+		select {
+		case members <- member:
+		case <-done:
+			return
+		}
+
+		offset += sectionLen
+		if offset >= size {
+			return
+		}
+	}
+}
+
+func compressSection(r io.ReaderAt, offset int64, sectionLen int64, level CompressionLevel) compressedSection {
+	section := make([]byte, sectionLen)
+	readLen, err := r.ReadAt(section, offset)
+	if readLen < len(section) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return compressedSection{err: fmt.Errorf("reading section at offset %d: %w", offset, err)}
+	}
+
+	compressBound := int(C.compressBound(C.uLong(sectionLen))) + gzipWrapperExtraLen
+	member := make([]byte, 0, compressBound)
+	memberLen, err := GoGZipCompressBuffer(level, section, member)
+	if err != nil {
+		return compressedSection{err: err}
+	}
+
+	return compressedSection{member: member[:memberLen]}
+}
+
+func (sr *sectionsReader) Read(output []byte) (n int, err error) {
+	defer recoverPanic("sections reader Read", &err)
+
+	if sr.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	for len(sr.current) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+
+		member, more := <-sr.members
+		if !more {
+			sr.err = io.EOF
+			continue
+		}
+
+		section := <-member
+		sr.current = section.member
+		sr.err = section.err
+	}
+
+	copied := copy(output, sr.current)
+	sr.current = sr.current[copied:]
+	return copied, nil
+}
+
+// Close stops the compression of the sections not yet started. Sections being compressed complete in the background
+func (sr *sectionsReader) Close() (err error) {
+	defer recoverPanic("sections reader Close", &err)
+
+	if !sr.closed {
+		sr.closed = true
+		close(sr.done)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipMembers(t *testing.T, compressed []byte) [][]byte {
+	// bytes.Reader is an io.ByteReader, so gzip.Reader doesn't read past the end of each member
+	input := bytes.NewReader(compressed)
+	reader, err := gzip.NewReader(input)
+	require.NoError(t, err)
+
+	var members [][]byte
+	for {
+		reader.Multistream(false)
+		member, rerr := io.ReadAll(reader)
+		require.NoError(t, rerr)
+		members = append(members, member)
+
+		rerr = reader.Reset(input)
+		if rerr == io.EOF {
+			return members
+		}
+		require.NoError(t, rerr)
+	}
+}
+
+func TestCompressSections(t *testing.T) {
+	data := makeTestData(100000)
+
+	for _, chunk := range []int64{1000, 4096, 33333, 100000, 200000} {
+		for _, workers := range []int{1, 3, 16} {
+			sections, err := CompressSections(bytes.NewReader(data), int64(len(data)), chunk, workers)
+			require.NoError(t, err)
+
+			compressed, err := io.ReadAll(sections)
+			require.NoError(t, err)
+			assert.NoError(t, sections.Close())
+
+			uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed), int64(len(data)))
+			assert.NoError(t, err)
+			assert.Equal(t, data, uncompressed, chunk)
+
+			members := gzipMembers(t, compressed)
+			assert.Len(t, members, int((int64(len(data))+chunk-1)/chunk), chunk)
+			for pos, member := range members {
+				start := int64(pos) * chunk
+				assert.Equal(t, data[start:start+int64(len(member))], member)
+			}
+		}
+	}
+}
+
+func TestCompressSectionsOfPrefix(t *testing.T) {
+	data := makeTestData(10000)
+
+	sections, err := CompressSections(bytes.NewReader(data), 2500, 1000, 2)
+	require.NoError(t, err)
+	defer sections.Close()
+
+	uncompressed, err := io.ReadAll(gzipReader(t, sections))
+	assert.NoError(t, err)
+	assert.Equal(t, data[:2500], uncompressed)
+}
+
+func TestCompressSectionsEmptyInput(t *testing.T) {
+	sections, err := CompressSections(bytes.NewReader(nil), 0, 1000, 2)
+	require.NoError(t, err)
+	defer sections.Close()
+
+	compressed, err := io.ReadAll(sections)
+	assert.NoError(t, err)
+	assert.Len(t, gzipMembers(t, compressed), 1)
+}
+
+type failingReaderAt struct {
+	data     []byte
+	failFrom int64
+}
+
+var sectionReadError = errors.New("section read error")
+
+func (fra *failingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset >= fra.failFrom {
+		return 0, sectionReadError
+	}
+	return bytes.NewReader(fra.data).ReadAt(p, offset)
+}
+
+func TestCompressSectionsErrors(t *testing.T) {
+	data := makeTestData(10000)
+
+	sections, err := CompressSections(&failingReaderAt{data: data, failFrom: 5000}, int64(len(data)), 1000, 4)
+	require.NoError(t, err)
+	compressed, err := io.ReadAll(sections)
+	assert.ErrorIs(t, err, sectionReadError)
+	assert.NoError(t, sections.Close())
+
+	// the sections before the failure are complete members
+	assert.Len(t, gzipMembers(t, compressed), 5)
+
+	// a size larger than the input is a truncated input
+	sections, err = CompressSections(bytes.NewReader(data), int64(len(data))+1, 1000, 4)
+	require.NoError(t, err)
+	_, err = io.ReadAll(sections)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NoError(t, sections.Close())
+
+	for _, args := range [][3]int64{{-1, 1000, 1}, {100, 0, 1}, {100, MaxMessageSize + 1, 1}, {100, 1000, 0}} {
+		_, err = CompressSections(bytes.NewReader(data), args[0], args[1], int(args[2]))
+		assert.ErrorIs(t, err, CompressSectionsOptionsError, args)
+	}
+}
+
+func TestCompressSectionsCloseBeforeEnd(t *testing.T) {
+	data := makeTestData(100000)
+
+	sections, err := CompressSections(bytes.NewReader(data), int64(len(data)), 100, 2)
+	require.NoError(t, err)
+
+	_, err = io.ReadFull(sections, make([]byte, 10))
+	assert.NoError(t, err)
+	assert.NoError(t, sections.Close())
+
+	_, err = sections.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func gzipReader(t *testing.T, compressed io.Reader) *gzip.Reader {
+	reader, err := gzip.NewReader(compressed)
+	require.NoError(t, err)
+	return reader
+}
@@ -0,0 +1,351 @@
+package gozlib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Write-ahead log segments
+// A segment is a sequence of records, each one framed as
+//   uvarint compressed length | uvarint uncompressed length | CRC-32 of the uncompressed record, little endian | compressed record
+// All records of a segment are part of a single raw deflate stream, so records benefit from the data written before them.
+// Each record ends with a sync flush and every SyncPointInterval records with a full flush, after which the following
+// record doesn't reference any earlier data. A reader can start at the first record or at any sync point.
+// Since the stream is never finished, a new writer can append to a segment truncated at its last valid record.
+
+// MaxSegmentRecordSize is the maximum size of a segment record, compressed or uncompressed
+const MaxSegmentRecordSize = 1 << 30
+
+const (
+	defaultSyncPointInterval = 64
+	// segmentFlushOverhead is the space needed for the empty stored block emitted by a flush
+	segmentFlushOverhead = 16
+)
+
+var (
+	SegmentWriterOptionsError = errors.New("invalid segment writer options")
+	SegmentRecordSizeError    = errors.New("segment record exceeds the maximum record size")
+	SegmentCorruptedError     = errors.New("segment record is truncated or corrupted")
+)
+
+// Syncer is implemented by outputs that can commit written data to stable storage, like *os.File
+type Syncer interface {
+	Sync() error
+}
+
+// SegmentWriterOptions configures a SegmentWriter
+type SegmentWriterOptions struct {
+	Level CompressionLevel
+	// SyncPointInterval is the number of records between sync points, zero means 64
+	SyncPointInterval int
+	// FsyncInterval is the number of records after which the output is synced if it implements Syncer,
+	// zero means the output is only synced by Sync calls
+	FsyncInterval int
+	// StartOffset is the size of the segment the writer appends to, so the offsets returned by Append are positions
+	// in the segment
+	StartOffset int64
+}
+
+// SegmentWriter appends compressed records to a write-ahead log segment. It is not safe for concurrent use.
+type SegmentWriter struct {
+	output  io.Writer
+	engine  *Engine
+	options SegmentWriterOptions
+	offset  int64
+	records int
+	// unsynced is the number of records written since the output was last synced
+	unsynced int
+	frame    []byte
+	// failed is the first error that left the deflate stream ahead of the output
+	failed error
+}
+
+// NewSegmentWriter creates a writer appending records to output
+// The first record appended is a sync point. Close must be called to release the native resources.
+func NewSegmentWriter(output io.Writer, options SegmentWriterOptions) (writer *SegmentWriter, err error) {
+	defer recoverPanic("NewSegmentWriter", &err)
+
+	if options.SyncPointInterval < 0 || options.FsyncInterval < 0 || options.StartOffset < 0 {
+		return nil, SegmentWriterOptionsError
+	}
+	if options.SyncPointInterval == 0 {
+		options.SyncPointInterval = defaultSyncPointInterval
+	}
+
+	engine, err := NewEngine(TransformModeRawDeflate, options.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SegmentWriter{output: output, engine: engine, options: options, offset: options.StartOffset}, nil
+}
+
+// Append compresses record and writes it to the output with a single Write call, returning the offset of the record
+// in the segment and whether it's a sync point a reader can start from
+// Once compressing a record or writing it to the output fails, later records would reference data missing from the segment,
+// so the writer stays failed and every following Append returns the same error. A new writer must be created to continue
+// the segment from its last valid record.
+func (sw *SegmentWriter) Append(record []byte) (offset int64, syncPoint bool, err error) {
+	defer recoverPanic("SegmentWriter.Append", &err)
+
+	if sw.failed != nil {
+		return sw.offset, false, sw.failed
+	}
+
+	if len(record) > MaxSegmentRecordSize {
+		return sw.offset, false, SegmentRecordSizeError
+	}
+
+	syncPoint = sw.records%sw.options.SyncPointInterval == 0
+	flush := FlushModeSync
+	if (sw.records+1)%sw.options.SyncPointInterval == 0 {
+		flush = FlushModeFull
+	}
+
+	bound, err := sw.engine.DeflateBound(len(record))
+	if err != nil {
+		return sw.offset, false, err
+	}
+
+	headerLen := 2*binary.MaxVarintLen64 + crc32.Size
+	frameCap := headerLen + bound + segmentFlushOverhead
+	sw.frame = ensureSpareCapacity(sw.frame[:0], frameCap)[:frameCap]
+	compressed := sw.frame[headerLen:]
+
+	consumed, produced, err := sw.engine.Deflate(record, compressed, flush)
+	if err == nil && (consumed != len(record) || produced == len(compressed)) {
+		err = fmt.Errorf("%w: record not flushed", BufferCompressError)
+	}
+	if err != nil {
+		sw.failed = err
+		return sw.offset, false, err
+	}
+
+	// write the header right before the compressed record
+	var header [2*binary.MaxVarintLen64 + crc32.Size]byte
+	prefixLen := binary.PutUvarint(header[:], uint64(produced))
+	prefixLen += binary.PutUvarint(header[prefixLen:], uint64(len(record)))
+	binary.LittleEndian.PutUint32(header[prefixLen:], crc32.ChecksumIEEE(record))
+	prefixLen += crc32.Size
+
+	frameStart := headerLen - prefixLen
+	copy(sw.frame[frameStart:], header[:prefixLen])
+	frame := sw.frame[frameStart : headerLen+produced]
+
+	written, err := sw.output.Write(frame)
+	recordOffset := sw.offset
+	sw.offset += int64(written)
+	if err == nil && written != len(frame) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		sw.failed = err
+		return recordOffset, false, err
+	}
+
+	sw.records++
+	sw.unsynced++
+	if sw.options.FsyncInterval > 0 && sw.unsynced >= sw.options.FsyncInterval {
+		return recordOffset, syncPoint, sw.Sync()
+	}
+
+	return recordOffset, syncPoint, nil
+}
+
+// Offset returns the size of the segment, which is where the next record will be written
+func (sw *SegmentWriter) Offset() int64 {
+	return sw.offset
+}
+
+// Sync commits the records written so far to stable storage if the output implements Syncer
+func (sw *SegmentWriter) Sync() (err error) {
+	defer recoverPanic("SegmentWriter.Sync", &err)
+
+	sw.unsynced = 0
+	syncer, ok := sw.output.(Syncer)
+	if !ok {
+		return nil
+	}
+
+	return syncer.Sync()
+}
+
+// SetBackend makes the writer run on the given backend instead of the default one
+// It must be called before the first Append, BackendError is returned otherwise or if the backend is unknown.
+func (sw *SegmentWriter) SetBackend(backend Backend) (err error) {
+	defer recoverPanic("SegmentWriter.SetBackend", &err)
+
+	return sw.engine.SetBackend(backend)
+}
+
+// Close releases the native resources. The output is neither synced nor closed.
+func (sw *SegmentWriter) Close() (err error) {
+	defer recoverPanic("SegmentWriter.Close", &err)
+
+	return sw.engine.Close()
+}
+
+// SegmentReader reads the records of a write-ahead log segment. It is not safe for concurrent use.
+type SegmentReader struct {
+	input  *bufio.Reader
+	engine *Engine
+	// offset is the position after the last valid record
+	offset     int64
+	compressed []byte
+	failed     error
+}
+
+// NewSegmentReader creates a reader of the records read from input, which must start at the beginning of a segment
+// or at a sync point. startOffset is the position of input in the segment. Close must be called to release the native resources.
+func NewSegmentReader(input io.Reader, startOffset int64) (reader *SegmentReader, err error) {
+	defer recoverPanic("NewSegmentReader", &err)
+
+	engine, err := NewEngine(TransformModeRawDeflate, CompressionLevelBestSpeed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SegmentReader{input: bufio.NewReader(input), engine: engine, offset: startOffset}, nil
+}
+
+// Next reads the next record, appending it to dst and returning the extended slice
+// io.EOF is returned at the end of the segment and SegmentCorruptedError if the record is truncated, as left by a crash
+// while it was written, or corrupted. Once a record fails, all following calls fail the same way.
+func (sr *SegmentReader) Next(dst []byte) (result []byte, err error) {
+	defer recoverPanic("SegmentReader.Next", &err)
+
+	if sr.failed != nil {
+		return dst, sr.failed
+	}
+
+	record, frameLen, err := sr.readRecord(dst)
+	if err != nil {
+		sr.failed = err
+		return dst, err
+	}
+
+	sr.offset += frameLen
+	return record, nil
+}
+
+// ValidOffset returns the position in the segment after the last valid record read, where a crashed segment can be
+// truncated so new records can be appended
+func (sr *SegmentReader) ValidOffset() int64 {
+	return sr.offset
+}
+
+func (sr *SegmentReader) readRecord(dst []byte) ([]byte, int64, error) {
+	counter := &countingByteReader{reader: sr.input}
+	compressedLen, err := binary.ReadUvarint(counter)
+	if err == io.EOF {
+		return dst, 0, io.EOF
+	}
+	if err != nil {
+		return dst, 0, fmt.Errorf("%w: %v", SegmentCorruptedError, err)
+	}
+
+	uncompressedLen, err := binary.ReadUvarint(counter)
+	if err != nil || compressedLen > MaxSegmentRecordSize || uncompressedLen > MaxSegmentRecordSize {
+		return dst, 0, fmt.Errorf("%w: invalid record header at offset %d", SegmentCorruptedError, sr.offset)
+	}
+
+	var checksum [crc32.Size]byte
+	_, err = io.ReadFull(sr.input, checksum[:])
+	if err == nil {
+		// the recorded length isn't trusted, the buffer only grows with the data actually read
+		sr.compressed, err = readAppend(sr.compressed[:0], sr.input, int64(compressedLen))
+	}
+	if err != nil {
+		return dst, 0, fmt.Errorf("%w: record at offset %d truncated", SegmentCorruptedError, sr.offset)
+	}
+
+	dstLen := len(dst)
+	// one extra byte detects records uncompressing to more data than recorded
+	outputLimit := int(uncompressedLen) + 1
+	compressed := sr.compressed
+	for {
+		dst = ensureSpareCapacity(dst, 2*len(compressed)+segmentFlushOverhead)
+		output := dst[len(dst):cap(dst)]
+		if left := outputLimit - (len(dst) - dstLen); len(output) > left {
+			output = output[:left]
+		}
+
+		consumed, produced, ierr := sr.engine.Inflate(compressed, output, FlushModeSync)
+		dst = dst[:len(dst)+produced]
+		compressed = compressed[consumed:]
+		if ierr != nil || (len(compressed) > 0 && consumed == 0 && produced == 0) || len(dst)-dstLen == outputLimit {
+			return dst[:dstLen], 0, fmt.Errorf("%w: record at offset %d can't be uncompressed", SegmentCorruptedError, sr.offset)
+		}
+
+		// a full output may leave uncompressed data pending even after all input is consumed
+		if len(compressed) == 0 && produced < len(output) {
+			break
+		}
+	}
+
+	record := dst[dstLen:]
+	if uint64(len(record)) != uncompressedLen || crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(checksum[:]) {
+		return dst[:dstLen], 0, fmt.Errorf("%w: record at offset %d doesn't match its checksum", SegmentCorruptedError, sr.offset)
+	}
+
+	return dst, counter.count + crc32.Size + int64(compressedLen), nil
+}
+
+// SetBackend makes the reader run on the given backend instead of the default one
+// It must be called before the first Next, BackendError is returned otherwise or if the backend is unknown.
+func (sr *SegmentReader) SetBackend(backend Backend) (err error) {
+	defer recoverPanic("SegmentReader.SetBackend", &err)
+
+	return sr.engine.SetBackend(backend)
+}
+
+// Close releases the native resources. The input isn't closed.
+func (sr *SegmentReader) Close() (err error) {
+	defer recoverPanic("SegmentReader.Close", &err)
+
+	return sr.engine.Close()
+}
+
+// countingByteReader counts the bytes read from reader
+type countingByteReader struct {
+	reader io.ByteReader
+	count  int64
+}
+
+func (cbr *countingByteReader) ReadByte() (byte, error) {
+	b, err := cbr.reader.ReadByte()
+	if err == nil {
+		cbr.count++
+	}
+	return b, err
+}
+
+// RecoverSegment reads all valid records of a segment from input, returning the number of records and the offset after
+// the last valid one, where the segment should be truncated before appending new records
+// A truncated or corrupted record ends the recovery and is reported as the error, which is nil if the whole segment is valid.
+func RecoverSegment(input io.Reader) (count int, validOffset int64, err error) {
+	defer recoverPanic("RecoverSegment", &err)
+
+	reader, err := NewSegmentReader(input, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	records := 0
+	var record []byte
+	for {
+		record, err = reader.Next(record[:0])
+		if err == io.EOF {
+			return records, reader.ValidOffset(), nil
+		}
+		if err != nil {
+			return records, reader.ValidOffset(), err
+		}
+		records++
+	}
+}
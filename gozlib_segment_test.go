@@ -0,0 +1,258 @@
+package gozlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncCountingBuffer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (scb *syncCountingBuffer) Sync() error {
+	scb.syncs++
+	return nil
+}
+
+func makeSegmentRecords(count int) [][]byte {
+	records := make([][]byte, count)
+	for pos := range records {
+		records[pos] = []byte(fmt.Sprintf(`{"op":"put","key":"user/%d","value":"%s"}`, pos, bytes.Repeat([]byte{byte('a' + pos%26)}, pos*7)))
+	}
+	return records
+}
+
+func writeSegment(t *testing.T, output io.Writer, options SegmentWriterOptions, records [][]byte) ([]int64, []bool) {
+	writer, err := NewSegmentWriter(output, options)
+	require.NoError(t, err)
+	defer writer.Close()
+
+	offsets := []int64{}
+	syncPoints := []bool{}
+	for _, record := range records {
+		offset, syncPoint, err := writer.Append(record)
+		require.NoError(t, err)
+		offsets = append(offsets, offset)
+		syncPoints = append(syncPoints, syncPoint)
+	}
+	return offsets, syncPoints
+}
+
+func readSegment(t *testing.T, input io.Reader, startOffset int64) ([][]byte, *SegmentReader, error) {
+	reader, err := NewSegmentReader(input, startOffset)
+	require.NoError(t, err)
+	t.Cleanup(func() { reader.Close() })
+
+	records := [][]byte{}
+	for {
+		record, err := reader.Next(nil)
+		if err != nil {
+			return records, reader, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestSegmentWriteRead(t *testing.T) {
+	records := makeSegmentRecords(50)
+	records = append(records, []byte{})
+
+	output := &syncCountingBuffer{}
+	offsets, syncPoints := writeSegment(t, output, SegmentWriterOptions{Level: CompressionLevelBestSpeed, SyncPointInterval: 8, FsyncInterval: 10}, records)
+	assert.Equal(t, 5, output.syncs)
+	assert.Equal(t, int64(0), offsets[0])
+
+	read, reader, err := readSegment(t, bytes.NewReader(output.Bytes()), 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, records, read)
+	assert.Equal(t, int64(output.Len()), reader.ValidOffset())
+
+	// readers can start at any sync point
+	for pos, syncPoint := range syncPoints {
+		assert.Equal(t, pos%8 == 0, syncPoint)
+		if !syncPoint {
+			continue
+		}
+
+		read, _, err = readSegment(t, bytes.NewReader(output.Bytes()[offsets[pos]:]), offsets[pos])
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, records[pos:], read)
+	}
+}
+
+func TestSegmentRecoverAfterCrash(t *testing.T) {
+	records := makeSegmentRecords(20)
+	output := &bytes.Buffer{}
+	offsets, _ := writeSegment(t, output, SegmentWriterOptions{Level: CompressionLevelBestCompression}, records)
+	segment := output.Bytes()
+
+	// cut the segment in the middle of the last record, like a crash while writing it
+	for cut := offsets[19] + 1; cut < int64(len(segment)); cut += 7 {
+		count, validOffset, err := RecoverSegment(bytes.NewReader(segment[:cut]))
+		assert.ErrorIs(t, err, SegmentCorruptedError)
+		assert.Equal(t, 19, count)
+		assert.Equal(t, offsets[19], validOffset)
+	}
+
+	count, validOffset, err := RecoverSegment(bytes.NewReader(segment))
+	assert.NoError(t, err)
+	assert.Equal(t, 20, count)
+	assert.Equal(t, int64(len(segment)), validOffset)
+
+	// truncate at the last valid record and append to the segment with a new writer
+	recovered := bytes.NewBuffer(append([]byte{}, segment[:offsets[19]]...))
+	more := makeSegmentRecords(25)[19:]
+	appendedOffsets, syncPoints := writeSegment(t, recovered, SegmentWriterOptions{Level: CompressionLevelBestSpeed, StartOffset: offsets[19]}, more)
+	assert.Equal(t, offsets[19], appendedOffsets[0])
+	assert.True(t, syncPoints[0])
+
+	read, _, err := readSegment(t, recovered, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, append(records[:19], more...), read)
+}
+
+// failAfterWriter accepts a number of writes and fails all the following ones
+type failAfterWriter struct {
+	bytes.Buffer
+	writes int
+	err    error
+}
+
+func (faw *failAfterWriter) Write(p []byte) (int, error) {
+	if faw.writes == 0 {
+		return 0, faw.err
+	}
+	faw.writes--
+	return faw.Buffer.Write(p)
+}
+
+func TestSegmentWriterStaysFailed(t *testing.T) {
+	records := makeSegmentRecords(4)
+	writeErr := errors.New("disk full")
+	output := &failAfterWriter{writes: 1, err: writeErr}
+
+	writer, err := NewSegmentWriter(output, SegmentWriterOptions{Level: CompressionLevelBestSpeed})
+	require.NoError(t, err)
+	defer writer.Close()
+
+	_, _, err = writer.Append(records[0])
+	assert.NoError(t, err)
+	validOffset := writer.Offset()
+
+	_, _, err = writer.Append(records[1])
+	assert.ErrorIs(t, err, writeErr)
+
+	// the output recovered but the records already lost are referenced by the following ones
+	output.writes = 10
+	for _, record := range records[2:] {
+		offset, _, err := writer.Append(record)
+		assert.ErrorIs(t, err, writeErr)
+		assert.Equal(t, validOffset, offset)
+	}
+
+	count, recoveredOffset, err := RecoverSegment(bytes.NewReader(output.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, validOffset, recoveredOffset)
+}
+
+func TestSegmentCorruptedRecord(t *testing.T) {
+	records := makeSegmentRecords(10)
+	output := &bytes.Buffer{}
+	offsets, _ := writeSegment(t, output, SegmentWriterOptions{Level: CompressionLevelBestSpeed}, records)
+
+	segment := output.Bytes()
+	segment[offsets[6]+10] ^= 0x55
+
+	read, reader, err := readSegment(t, bytes.NewReader(segment), 0)
+	assert.ErrorIs(t, err, SegmentCorruptedError)
+	assert.Equal(t, records[:6], read)
+	assert.Equal(t, offsets[6], reader.ValidOffset())
+
+	// the failure is sticky
+	_, err = reader.Next(nil)
+	assert.ErrorIs(t, err, SegmentCorruptedError)
+
+	// a header with an impossible length
+	_, _, err = readSegment(t, bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x7f, 0x01}), 0)
+	assert.ErrorIs(t, err, SegmentCorruptedError)
+}
+
+func TestSegmentRecordLengthsNotTrusted(t *testing.T) {
+	// record header claiming the maximum sizes, followed by a few bytes only
+	header := binary.AppendUvarint(nil, MaxSegmentRecordSize)
+	header = binary.AppendUvarint(header, MaxSegmentRecordSize)
+	segment := append(header, make([]byte, crc32.Size+100)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := readSegment(t, bytes.NewReader(segment), 0)
+	runtime.ReadMemStats(&after)
+
+	assert.ErrorIs(t, err, SegmentCorruptedError)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+}
+
+func TestSegmentWriterOptions(t *testing.T) {
+	_, err := NewSegmentWriter(&bytes.Buffer{}, SegmentWriterOptions{SyncPointInterval: -1})
+	assert.ErrorIs(t, err, SegmentWriterOptionsError)
+
+	_, err = NewSegmentWriter(&bytes.Buffer{}, SegmentWriterOptions{StartOffset: -1})
+	assert.ErrorIs(t, err, SegmentWriterOptionsError)
+}
+
+func TestSegmentBackendsInteroperate(t *testing.T) {
+	records := makeSegmentRecords(30)
+
+	for _, writing := range testBackends() {
+		output := &bytes.Buffer{}
+		writer, err := NewSegmentWriter(output, SegmentWriterOptions{Level: CompressionLevelDefault, SyncPointInterval: 4})
+		require.NoError(t, err)
+		require.NoError(t, writer.SetBackend(writing))
+
+		offsets := []int64{}
+		for _, record := range records {
+			offset, _, aerr := writer.Append(record)
+			require.NoError(t, aerr)
+			offsets = append(offsets, offset)
+		}
+		assert.ErrorIs(t, writer.SetBackend(BackendZLib), BackendError)
+		require.NoError(t, writer.Close())
+
+		// recovery finds the sync points with zlib whatever backend wrote the segment
+		count, validOffset, err := RecoverSegment(bytes.NewReader(output.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, len(records), count)
+		assert.Equal(t, int64(output.Len()), validOffset)
+
+		for _, reading := range testBackends() {
+			for _, start := range []int{0, 8} {
+				reader, rerr := NewSegmentReader(bytes.NewReader(output.Bytes()[offsets[start]:]), offsets[start])
+				require.NoError(t, rerr)
+				require.NoError(t, reader.SetBackend(reading))
+
+				read := [][]byte{}
+				for {
+					record, nerr := reader.Next(nil)
+					if nerr != nil {
+						assert.Equal(t, io.EOF, nerr, "%s to %s", writing, reading)
+						break
+					}
+					read = append(read, record)
+				}
+				assert.Equal(t, records[start:], read, "%s to %s from record %d", writing, reading, start)
+				assert.NoError(t, reader.Close())
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const shutdownPollInterval = 5 * time.Millisecond
+
+var (
+	ShutdownError = errors.New("gozlib is shut down")
+)
+
+// nativeWorkTracker tracks the native operations running, so Shutdown can wait for them
+type nativeWorkTracker struct {
+	running  atomic.Int64
+	shutdown atomic.Bool
+}
+
+var nativeWork nativeWorkTracker
+
+// start registers a new native operation, such as creating a transformer or a buffer or stream operation
+// It returns ShutdownError once Shutdown started. end must be called when the operation returns.
+func (nwt *nativeWorkTracker) start() error {
+	if nwt.shutdown.Load() {
+		return ShutdownError
+	}
+
+	nwt.running.Add(1)
+	// Shutdown may have started concurrently without seeing this operation
+	if nwt.shutdown.Load() {
+		nwt.running.Add(-1)
+		return ShutdownError
+	}
+
+	return nil
+}
+
+// enter registers a native operation of work already started, such as a Write of a live compressor, which is never refused
+func (nwt *nativeWorkTracker) enter() {
+	nwt.running.Add(1)
+}
+
+func (nwt *nativeWorkTracker) end() {
+	nwt.running.Add(-1)
+}
+
+// Shutdown stops gozlib, waits for the native operations running to return and frees the idle memory of the global native pools,
+// so services can exit cleanly under leak detectors.
+// Once Shutdown starts, new work fails with ShutdownError: creating compressors and uncompressors, starting buffer or stream
+// operations and the first native call of an Engine. Transformers created before keep working and must still be closed
+// to return their memory, which then stays idle in the pools.
+// The idle transformers of the default pool and the idle streams used by WriteMessage are closed. TransformerPools other than the default one must be closed
+// beforehand for their idle memory to be freed.
+// If ctx ends before the running operations return, Shutdown returns an error wrapping the context error and nothing is freed.
+// gozlib stays shut down either way.
+func Shutdown(ctx context.Context) (err error) {
+	defer recoverPanic("Shutdown", &err)
+
+	nativeWork.shutdown.Store(true)
+
+	pool := defaultPool.Load()
+	if pool != nil {
+		pool.mutex.Lock()
+		pool.closeIdle()
+		pool.mutex.Unlock()
+	}
+	messageStreams.closeIdle()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		running := nativeWork.running.Load()
+		if running == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %d native operations still running", ctx.Err(), running)
+		case <-ticker.C:
+		}
+	}
+
+	// operations of live transformers may still start, the pools wait for them while idle memory is freed
+	C.native_pool_release_idle()
+	return nil
+}
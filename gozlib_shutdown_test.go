@@ -0,0 +1,99 @@
+package gozlib
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resumeAfterShutdown lets the tests that follow use gozlib again
+func resumeAfterShutdown(t *testing.T) {
+	t.Cleanup(func() {
+		nativeWork.shutdown.Store(false)
+	})
+}
+
+func idleNativeBlocks() int64 {
+	var idle int64
+	for _, class := range NativeMemStats().Classes {
+		idle += class.Held - class.Acquired
+	}
+	return idle
+}
+
+func TestShutdownRefusesNewWork(t *testing.T) {
+	resumeAfterShutdown(t)
+
+	compressed := bytes.NewBuffer(nil)
+	compressor, err := NewGoGZipCompressor(compressed, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+
+	// the live compressor doesn't hold Shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, Shutdown(ctx))
+	assert.Equal(t, int64(0), idleNativeBlocks())
+
+	_, err = NewGoGZipCompressor(bytes.NewBuffer(nil), CompressionLevelBestSpeed, 1024)
+	assert.ErrorIs(t, err, ShutdownError)
+	_, err = NewGoZLibUncompressor(bytes.NewReader(nil), 1024)
+	assert.ErrorIs(t, err, ShutdownError)
+	_, err = GoGZipCompressBuffer(CompressionLevelBestSpeed, []byte("data"), make([]byte, 100))
+	assert.ErrorIs(t, err, ShutdownError)
+	engine, err := NewEngine(TransformModeRawDeflate, CompressionLevelBestSpeed)
+	require.NoError(t, err)
+	_, _, err = engine.Deflate([]byte("data"), make([]byte, 100), FlushModeFinish)
+	assert.ErrorIs(t, err, ShutdownError)
+	assert.NoError(t, engine.Close())
+
+	// transformers created before keep working until closed
+	data := makeTestData(10000)
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, compressor.Close())
+
+	output := make([]byte, len(data))
+	nativeWork.shutdown.Store(false)
+	uncompressedLen, err := GoUncompressBuffer(compressed.Bytes(), output)
+	assert.NoError(t, err)
+	assert.Equal(t, data, output[:uncompressedLen])
+}
+
+func TestShutdownWaitsForRunningOperations(t *testing.T) {
+	resumeAfterShutdown(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		first := true
+		_, serr := GoGZipCompressStream(CompressionLevelBestSpeed, 1024, 1024, func(data []byte) uint32 {
+			if !first {
+				return 0
+			}
+			first = false
+			close(started)
+			<-release
+			return uint32(copy(data, "still running"))
+		}, func(data []byte) uint32 {
+			return uint32(len(data))
+		})
+		done <- serr
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Shutdown(ctx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	assert.NoError(t, Shutdown(context.Background()))
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,140 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+var (
+	SizedCompressorOptionsError = errors.New("invalid sized compressor options")
+	SizedCompressorClosedError  = errors.New("sized compressor is closed")
+)
+
+// SizedCompressor compresses into a native buffer so the compressed size is known before anything is written to the
+// output, for instance to set the Content-Length of an HTTP response
+// If the compressed data grows past the cutoff, the compressor switches to streaming: the onStreaming callback is
+// invoked, the buffered data is written to the output and the rest follows as it's compressed.
+type SizedCompressor struct {
+	compressor io.WriteCloser
+	sink       sizedSink
+	finished   bool
+	closed     bool
+}
+
+// sizedSink receives the compressed data, keeping it in the native buffer until it overflows
+type sizedSink struct {
+	output      io.Writer
+	buffer      []byte
+	bufferPtr   unsafe.Pointer
+	streaming   bool
+	onStreaming func()
+}
+
+func (ss *sizedSink) Write(compressed []byte) (int, error) {
+	if !ss.streaming && len(ss.buffer)+len(compressed) <= cap(ss.buffer) {
+		ss.buffer = append(ss.buffer, compressed...)
+		return len(compressed), nil
+	}
+
+	if !ss.streaming {
+		ss.streaming = true
+		if ss.onStreaming != nil {
+			ss.onStreaming()
+		}
+
+		err := ss.flushBuffer()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return ss.output.Write(compressed)
+}
+
+func (ss *sizedSink) flushBuffer() error {
+	_, err := ss.output.Write(ss.buffer)
+	ss.buffer = ss.buffer[:0]
+	return err
+}
+
+// NewSizedCompressor creates a gzip compressor writing to output that buffers up to cutoff compressed bytes
+// onStreaming, if not nil, is called once before the first write to output if the cutoff is exceeded.
+func NewSizedCompressor(output io.Writer, level CompressionLevel, cutoff int, onStreaming func()) (sized *SizedCompressor, err error) {
+	defer recoverPanic("NewSizedCompressor", &err)
+
+	if cutoff <= 0 {
+		return nil, SizedCompressorOptionsError
+	}
+
+	sc := &SizedCompressor{}
+	compressor, err := defaultTransformerPool().AcquireCompressor(&sc.sink, level)
+	if err != nil {
+		return nil, err
+	}
+
+	bufferPtr := C.pool_alloc(C.size_t(cutoff))
+	sc.compressor = compressor
+	sc.sink = sizedSink{
+		output:      output,
+		buffer:      nativeSlice(bufferPtr, 0, cutoff),
+		bufferPtr:   bufferPtr,
+		onStreaming: onStreaming,
+	}
+
+	return sc, nil
+}
+
+// Write compresses data
+func (sc *SizedCompressor) Write(data []byte) (n int, err error) {
+	defer recoverPanic("SizedCompressor.Write", &err)
+
+	if sc.finished {
+		return 0, SizedCompressorClosedError
+	}
+
+	return sc.compressor.Write(data)
+}
+
+// Finish ends the compressed stream and returns its total size and true if it's still buffered, in which case nothing
+// was written to the output yet and the size can be announced before calling Close
+func (sc *SizedCompressor) Finish() (compressedLen uint64, buffered bool, err error) {
+	defer recoverPanic("SizedCompressor.Finish", &err)
+
+	if sc.closed {
+		return 0, false, SizedCompressorClosedError
+	}
+
+	if !sc.finished {
+		sc.finished = true
+		_, err := Finish(sc.compressor)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	return uint64(sc.compressor.(*goGZipCompressor).transformer.zs.total_out), !sc.sink.streaming, nil
+}
+
+// Close finishes the stream if needed, writes any buffered data to the output and releases the resources
+func (sc *SizedCompressor) Close() (err error) {
+	defer recoverPanic("SizedCompressor.Close", &err)
+
+	if sc.closed {
+		return SizedCompressorClosedError
+	}
+
+	_, _, err = sc.Finish()
+	if err == nil && !sc.sink.streaming {
+		err = sc.sink.flushBuffer()
+	}
+
+	sc.closed = true
+	defaultTransformerPool().ReleaseCompressor(sc.compressor)
+	C.pool_free(sc.sink.bufferPtr)
+	return err
+}
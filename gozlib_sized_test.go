@@ -0,0 +1,66 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizedCompressorBuffered(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible content "), 1000)
+	output := bytes.NewBuffer([]byte{})
+	streamed := false
+
+	compressor, err := NewSizedCompressor(output, CompressionLevelBestSpeed, 64*1024, func() { streamed = true })
+	assert.NoError(t, err)
+
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+
+	size, buffered, err := compressor.Finish()
+	assert.NoError(t, err)
+	assert.True(t, buffered)
+	assert.False(t, streamed)
+	assert.Equal(t, 0, output.Len())
+
+	_, err = compressor.Write(data)
+	assert.ErrorIs(t, err, SizedCompressorClosedError)
+
+	assert.NoError(t, compressor.Close())
+	assert.Equal(t, size, uint64(output.Len()))
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+	assert.ErrorIs(t, compressor.Close(), SizedCompressorClosedError)
+}
+
+func TestSizedCompressorStreaming(t *testing.T) {
+	data := makeTestData(200000)
+	output := bytes.NewBuffer([]byte{})
+	streamed := 0
+
+	compressor, err := NewSizedCompressor(output, CompressionLevelBestSpeed, 1024, func() {
+		streamed++
+		assert.Equal(t, 0, output.Len())
+	})
+	assert.NoError(t, err)
+
+	_, err = compressor.Write(data)
+	assert.NoError(t, err)
+
+	size, buffered, err := compressor.Finish()
+	assert.NoError(t, err)
+	assert.False(t, buffered)
+	assert.Equal(t, 1, streamed)
+	assert.NoError(t, compressor.Close())
+	assert.Equal(t, size, uint64(output.Len()))
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	_, err = NewSizedCompressor(output, CompressionLevelBestSpeed, 0, nil)
+	assert.ErrorIs(t, err, SizedCompressorOptionsError)
+}
@@ -0,0 +1,47 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"unsafe"
+)
+
+// CompressSmallest compresses input in gzip format with each of the given levels, or the default level if none,
+// and returns the smallest result and true, or input itself and false if no compressed form is smaller than it
+// The compressed data is limited to one byte less than input, so compressing incompressible data stops early.
+// It's meant for small payloads, where storing compressed data larger than the original is a common waste.
+func CompressSmallest(input []byte, levels ...CompressionLevel) ([]byte, bool) {
+	if len(levels) == 0 {
+		levels = []CompressionLevel{GetDefaults().CompressionLevel}
+	}
+
+	best := input
+	compressed := false
+	for _, level := range levels {
+		limit := len(best) - 1
+		if limit <= 0 {
+			break
+		}
+
+		output := make([]byte, limit)
+		var inputPtr unsafe.Pointer
+		if len(input) > 0 {
+			inputPtr = unsafe.Pointer(&input[0])
+		}
+
+		var errorCode C.int = C.Z_OK
+		nativeWork.enter()
+		outputLen := C.gzip_compress_buffer(C.int(level), inputPtr, C.uInt(len(input)), unsafe.Pointer(&output[0]), C.uInt(limit), &errorCode)
+		nativeWork.end()
+
+		// any failure means the compressed data doesn't fit, in which case the current best is kept
+		if errorCode == C.Z_OK {
+			best = output[:outputLen]
+			compressed = true
+		}
+	}
+
+	return best, compressed
+}
@@ -0,0 +1,36 @@
+package gozlib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressSmallest(t *testing.T) {
+	data := bytes.Repeat([]byte("repetitive data "), 500)
+
+	output, compressed := CompressSmallest(data, CompressionLevelBestSpeed, CompressionLevelBestCompression)
+	assert.True(t, compressed)
+	assert.Less(t, len(output), len(data))
+
+	uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(output), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	bestSpeed, _ := CompressSmallest(data, CompressionLevelBestSpeed)
+	assert.LessOrEqual(t, len(output), len(bestSpeed))
+}
+
+func TestCompressSmallestIdentity(t *testing.T) {
+	random := make([]byte, 500)
+	_, err := rand.Read(random)
+	assert.NoError(t, err)
+
+	for _, input := range [][]byte{random, []byte("tiny"), {}} {
+		output, compressed := CompressSmallest(input)
+		assert.False(t, compressed)
+		assert.Equal(t, input, output)
+	}
+}
@@ -0,0 +1,42 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+)
+
+// Compression strategies
+// The strategy tunes the deflate algorithm for the kind of data compressed without affecting the format of the
+// output, which uncompresses the same regardless of the strategy used.
+
+// CompressionStrategy is a zlib deflate strategy, as accepted by deflateInit2
+type CompressionStrategy int
+
+const (
+	// CompressionStrategyDefault is suitable for most data
+	CompressionStrategyDefault CompressionStrategy = C.Z_DEFAULT_STRATEGY
+	// CompressionStrategyFiltered favours Huffman coding over string matching, for data produced by a filter or
+	// predictor made of small values with a somewhat random distribution, like PNG image rows
+	CompressionStrategyFiltered CompressionStrategy = C.Z_FILTERED
+	// CompressionStrategyHuffmanOnly only uses Huffman coding, without any string matching
+	CompressionStrategyHuffmanOnly CompressionStrategy = C.Z_HUFFMAN_ONLY
+	// CompressionStrategyRLE limits string matching to runs of the same byte, almost as fast as Huffman only
+	// while compressing run heavy data, like telemetry samples, much better
+	CompressionStrategyRLE CompressionStrategy = C.Z_RLE
+	// CompressionStrategyFixed only uses the fixed Huffman codes, avoiding the overhead of dynamic codes for small inputs
+	CompressionStrategyFixed CompressionStrategy = C.Z_FIXED
+)
+
+var CompressionStrategyError = errors.New("invalid compression strategy")
+
+// validate returns CompressionStrategyError if the strategy isn't supported by zlib
+func (cs CompressionStrategy) validate() error {
+	if cs < CompressionStrategyDefault || cs > CompressionStrategyFixed {
+		return fmt.Errorf("%w: %d", CompressionStrategyError, cs)
+	}
+	return nil
+}
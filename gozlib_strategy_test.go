@@ -0,0 +1,50 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compressWithStrategy(t *testing.T, data []byte, strategy CompressionStrategy) []byte {
+	compressed := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressorWithOptions(compressed, CompressionLevelBestCompression, 4096, TransformerOptions{Strategy: strategy})
+	require.NoError(t, err)
+	_, err = compressor.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, compressor.Close())
+
+	return compressed.Bytes()
+}
+
+func TestCompressorStrategies(t *testing.T) {
+	// runs of repeated samples
+	data := make([]byte, 0, 60000)
+	for sample := 0; len(data) < cap(data); sample++ {
+		data = append(data, bytes.Repeat([]byte{byte(sample * 7)}, sample%50+1)...)
+	}
+
+	sizes := map[CompressionStrategy]int{}
+	strategies := []CompressionStrategy{CompressionStrategyDefault, CompressionStrategyFiltered, CompressionStrategyHuffmanOnly,
+		CompressionStrategyRLE, CompressionStrategyFixed}
+	for _, strategy := range strategies {
+		compressed := compressWithStrategy(t, data, strategy)
+		sizes[strategy] = len(compressed)
+
+		uncompressed, err := stdLibGZipUncompress(bytes.NewBuffer(compressed), int64(len(data)))
+		assert.NoError(t, err)
+		assert.Equal(t, data, uncompressed, strategy)
+	}
+
+	assert.Less(t, sizes[CompressionStrategyRLE], sizes[CompressionStrategyHuffmanOnly])
+}
+
+func TestCompressorInvalidStrategy(t *testing.T) {
+	for _, strategy := range []CompressionStrategy{-1, 5} {
+		_, err := NewGoGZipCompressorWithOptions(io.Discard, CompressionLevelBestSpeed, 1024, TransformerOptions{Strategy: strategy})
+		assert.ErrorIs(t, err, CompressionStrategyError)
+	}
+}
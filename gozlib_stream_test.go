@@ -2,7 +2,9 @@ package gozlib
 
 import (
 	"bytes"
+	"io"
 	"testing"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -57,6 +59,31 @@ func TestGZipCompressStreamFailToWrite(t *testing.T) {
 	assert.Equal(t, total, uint64(0))
 }
 
+func TestGZipCompressStreamHandlerPanics(t *testing.T) {
+	inputReader := func(data []byte) uint32 {
+		return uint32(len(data))
+	}
+
+	outputWriter := func(data []byte) uint32 {
+		panic("output failed")
+	}
+
+	total, err := GoGZipCompressStream(CompressionLevelBestCompression, 100, 100, inputReader, outputWriter)
+
+	assert.ErrorIs(t, err, CallbackPanicError)
+	assert.Contains(t, err.Error(), "output failed")
+	assert.Equal(t, total, uint64(0))
+}
+
+func TestStreamDataHandlersUnknownId(t *testing.T) {
+	buffer := make([]byte, 16)
+	unknownId := unsafe.Pointer(&buffer[0])
+
+	assert.Equal(t, uint32(0), GoStreamDataInputHandler(unknownId, unsafe.Pointer(&buffer[0]), uint32(len(buffer))))
+	assert.Equal(t, uint32(0), GoStreamDataOutputHandler(unknownId, unsafe.Pointer(&buffer[0]), uint32(len(buffer))))
+	assert.Equal(t, uint32(0), GoStreamDataOutputHandler(nil, unsafe.Pointer(&buffer[0]), uint32(len(buffer))))
+}
+
 func TestUncompressStream(t *testing.T) {
 	const originalLen = 2048 * 7
 	const inputBufferSize = 1024
@@ -65,6 +92,32 @@ func TestUncompressStream(t *testing.T) {
 	verifyUncompressStream(originalLen, inputBufferSize, outputBufferSize, t)
 }
 
+func TestValidateStream(t *testing.T) {
+	original := makeTestData(50000)
+	compressed, err := stdLibGZipCompressSlice(original)
+	assert.NoError(t, err)
+
+	readerFor := func(input []byte) DataStreamEventHandler {
+		reader := bytes.NewReader(input)
+		return func(data []byte) uint32 {
+			read, _ := reader.Read(data)
+			return uint32(read)
+		}
+	}
+
+	total, err := GoValidateStream(1024, readerFor(compressed))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(original)), total)
+
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)-8] ^= 0xff
+	_, err = GoValidateStream(1024, readerFor(corrupted))
+	assert.ErrorIs(t, err, StreamUncompressError)
+
+	_, err = GoValidateStream(1024, readerFor(compressed[:len(compressed)/2]))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
 func TestUncompressStreamOutputBufferSmallerThanInput(t *testing.T) {
 	const originalLen = 2048
 	const inputBufferSize = 1024
@@ -0,0 +1,322 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stress harness
+// RunStress exercises the buffer, stream, transformer, pool and native slice paths concurrently and then checks
+// all native memory acquired during the run was returned, so upgrades of the underlying zlib can be verified for
+// leaks in staging before reaching production.
+
+var (
+	StressConfigError   = errors.New("invalid stress configuration")
+	StressMismatchError = errors.New("round trip produced different data")
+	StressLeakError     = errors.New("native memory was not returned after the stress run")
+)
+
+// StressPayload is the kind of data used by RunStress
+type StressPayload int
+
+const (
+	// StressPayloadMixed alternates between all the other payloads. This is the default
+	StressPayloadMixed StressPayload = iota
+	// StressPayloadRandom is incompressible random data
+	StressPayloadRandom
+	// StressPayloadText is repetitive text-like data
+	StressPayloadText
+	// StressPayloadZeros is highly compressible data
+	StressPayloadZeros
+)
+
+const stressPathCount = 5
+
+// StressConfig configures RunStress, zero values use the defaults
+type StressConfig struct {
+	// Iterations is the total number of round trips, 1000 by default
+	Iterations int
+	// Concurrency is the number of goroutines running round trips, 4 by default
+	Concurrency int
+	// PayloadSize is the size of the uncompressed data of each round trip, 64Kb by default
+	PayloadSize int
+	// Payload is the kind of data compressed
+	Payload StressPayload
+	// BufferSize is the buffer size of the transformers used, 16Kb by default
+	BufferSize uint32
+}
+
+// StressReport holds the results of RunStress
+type StressReport struct {
+	// Operations is the number of round trips completed
+	Operations int64
+	// Duration is how long the round trips took
+	Duration time.Duration
+	// BaselineBytes and FinalBytes are the native memory in use before and after the run, as reported by NativeMemStats
+	BaselineBytes int64
+	FinalBytes    int64
+}
+
+func (cfg *StressConfig) withDefaults() (StressConfig, error) {
+	result := *cfg
+	if result.Iterations < 0 || result.Concurrency < 0 || result.PayloadSize < 0 {
+		return result, fmt.Errorf("%w: negative values", StressConfigError)
+	}
+	if result.Payload < StressPayloadMixed || result.Payload > StressPayloadZeros {
+		return result, fmt.Errorf("%w: unknown payload %d", StressConfigError, result.Payload)
+	}
+
+	if result.Iterations == 0 {
+		result.Iterations = 1000
+	}
+	if result.Concurrency == 0 {
+		result.Concurrency = 4
+	}
+	if result.PayloadSize == 0 {
+		result.PayloadSize = 1024 * 64
+	}
+	if result.BufferSize == 0 {
+		result.BufferSize = defaultPoolBufferSize
+	}
+
+	return result, nil
+}
+
+func nativeMemoryInUse() int64 {
+	var total int64
+	for _, class := range NativeMemStats().Classes {
+		total += class.AcquiredBytes()
+	}
+	return total
+}
+
+// RunStress runs round trips through every compression path with cfg and reports an error wrapping StressLeakError
+// if native memory in use doesn't return to its level before the run.
+// Other compression work running in the process while RunStress runs can cause false reports, so it's meant to be
+// run on its own, for example in a staging job.
+func RunStress(cfg StressConfig) (report *StressReport, err error) {
+	defer recoverPanic("RunStress", &err)
+
+	cfg, err = cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	report = &StressReport{BaselineBytes: nativeMemoryInUse()}
+	pool := NewTransformerPool(cfg.BufferSize, cfg.Concurrency)
+	slicePool := NewNativeSlicePool()
+
+	var next atomic.Int64
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for worker := 0; worker < cfg.Concurrency; worker++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+
+			for {
+				iteration := next.Add(1) - 1
+				if iteration >= int64(cfg.Iterations) {
+					return
+				}
+
+				payload := stressPayload(cfg, random, iteration)
+				rerr := stressRoundTrip(cfg, pool, slicePool, payload, iteration%stressPathCount)
+				if rerr != nil {
+					errOnce.Do(func() { firstErr = rerr })
+					return
+				}
+				atomic.AddInt64(&report.Operations, 1)
+			}
+		}(int64(worker))
+	}
+	wg.Wait()
+	report.Duration = time.Since(start)
+
+	pool.Close()
+	slicePoolStats := slicePool.Stats()
+	slicePool.Free()
+	report.FinalBytes = nativeMemoryInUse()
+
+	if firstErr != nil {
+		return report, firstErr
+	}
+
+	if report.FinalBytes > report.BaselineBytes {
+		return report, fmt.Errorf("%w: %d bytes still in use", StressLeakError, report.FinalBytes-report.BaselineBytes)
+	}
+
+	if slicePoolStats.RequestedBytes() != 0 {
+		return report, fmt.Errorf("%w: %d native slice pool bytes still acquired", StressLeakError, slicePoolStats.RequestedBytes())
+	}
+
+	return report, nil
+}
+
+func stressPayload(cfg StressConfig, random *rand.Rand, iteration int64) []byte {
+	kind := cfg.Payload
+	if kind == StressPayloadMixed {
+		kind = StressPayloadRandom + StressPayload(iteration%3)
+	}
+
+	payload := make([]byte, cfg.PayloadSize)
+	switch kind {
+	case StressPayloadRandom:
+		random.Read(payload)
+	case StressPayloadText:
+		words := []string{"gzip ", "stream ", "native ", "buffer ", "window ", "deflate "}
+		for pos := 0; pos < len(payload); {
+			pos += copy(payload[pos:], words[random.Intn(len(words))])
+		}
+	case StressPayloadZeros, StressPayloadMixed:
+	}
+
+	return payload
+}
+
+// stressRoundTrip compresses and uncompresses payload through the path selected by path
+func stressRoundTrip(cfg StressConfig, pool *TransformerPool, slicePool *NativeSlicePool, payload []byte, path int64) error {
+	var uncompressed []byte
+	var err error
+
+	switch path {
+	case 0:
+		uncompressed, err = stressBuffers(payload)
+	case 1:
+		uncompressed, err = stressTransformers(cfg, payload)
+	case 2:
+		uncompressed, err = stressTransformerPool(pool, payload)
+	case 3:
+		uncompressed, err = stressStreams(cfg, payload)
+	default:
+		uncompressed, err = stressNativeSlices(slicePool, payload)
+	}
+
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(payload, uncompressed) {
+		return fmt.Errorf("%w: path %d", StressMismatchError, path)
+	}
+
+	return nil
+}
+
+func stressBuffers(payload []byte) ([]byte, error) {
+	// gzip stored blocks add 5 bytes every 16Kb plus the header and trailer
+	compressed := make([]byte, len(payload)+len(payload)/1024+64)
+	compressedLen, err := GoGZipCompressBuffer(CompressionLevelBestSpeed, payload, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressed := make([]byte, len(payload))
+	uncompressedLen, err := GoUncompressBuffer(compressed[:compressedLen], uncompressed)
+	return uncompressed[:uncompressedLen], err
+}
+
+func stressCompress(compressor io.WriteCloser, payload []byte) error {
+	_, err := compressor.Write(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = Finish(compressor)
+	return err
+}
+
+func stressTransformers(cfg StressConfig, payload []byte) ([]byte, error) {
+	compressed := bytes.NewBuffer(nil)
+	compressor, err := NewGoGZipCompressor(compressed, CompressionLevelBestSpeed, cfg.BufferSize)
+	if err != nil {
+		return nil, err
+	}
+	err = stressCompress(compressor, payload)
+	compressor.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressor, err := NewGoZLibUncompressor(compressed, cfg.BufferSize)
+	if err != nil {
+		return nil, err
+	}
+	defer uncompressor.Close()
+
+	return io.ReadAll(uncompressor)
+}
+
+func stressTransformerPool(pool *TransformerPool, payload []byte) ([]byte, error) {
+	compressed := bytes.NewBuffer(nil)
+	compressor, err := pool.AcquireCompressor(compressed, CompressionLevelBestCompression)
+	if err != nil {
+		return nil, err
+	}
+	err = stressCompress(compressor, payload)
+	pool.ReleaseCompressor(compressor)
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressor, err := pool.AcquireUncompressor(compressed)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.ReleaseUncompressor(uncompressor)
+
+	return io.ReadAll(uncompressor)
+}
+
+func stressStreams(cfg StressConfig, payload []byte) ([]byte, error) {
+	reader := func(source io.Reader) DataStreamEventHandler {
+		return func(data []byte) uint32 {
+			read, _ := io.ReadFull(source, data)
+			return uint32(read)
+		}
+	}
+	writer := func(destination *bytes.Buffer) DataStreamEventHandler {
+		return func(data []byte) uint32 {
+			written, _ := destination.Write(data)
+			return uint32(written)
+		}
+	}
+
+	compressed := bytes.NewBuffer(nil)
+	_, err := GoGZipCompressStream(CompressionLevelBestSpeed, cfg.BufferSize, cfg.BufferSize, reader(bytes.NewReader(payload)), writer(compressed))
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressed := bytes.NewBuffer(nil)
+	_, err = GoUncompressStream(cfg.BufferSize, cfg.BufferSize, reader(compressed), writer(uncompressed))
+	return uncompressed.Bytes(), err
+}
+
+func stressNativeSlices(slicePool *NativeSlicePool, payload []byte) ([]byte, error) {
+	compressed := slicePool.Acquire(len(payload) + len(payload)/1024 + 64)
+	defer slicePool.Return(compressed)
+
+	compressedLen, err := GoGZipCompressBuffer(CompressionLevelBestSpeed, payload, compressed[:cap(compressed)])
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressed := slicePool.Acquire(len(payload))
+	uncompressedLen, err := GoUncompressBuffer(compressed[:compressedLen], uncompressed[:cap(uncompressed)])
+	if err != nil {
+		slicePool.Return(uncompressed)
+		return nil, err
+	}
+
+	return slicePool.ToHeap(uncompressed[:uncompressedLen]), nil
+}
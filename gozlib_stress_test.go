@@ -0,0 +1,37 @@
+package gozlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStressReturnsNativeMemory(t *testing.T) {
+	for _, payload := range []StressPayload{StressPayloadMixed, StressPayloadRandom, StressPayloadText, StressPayloadZeros} {
+		report, err := RunStress(StressConfig{Iterations: 40, Concurrency: 3, PayloadSize: 50000, Payload: payload, BufferSize: 4096})
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(40), report.Operations)
+		assert.Positive(t, report.Duration)
+		assert.LessOrEqual(t, report.FinalBytes, report.BaselineBytes)
+	}
+}
+
+func TestRunStressDefaults(t *testing.T) {
+	cfg, err := (&StressConfig{}).withDefaults()
+	require.NoError(t, err)
+
+	assert.Equal(t, 1000, cfg.Iterations)
+	assert.Equal(t, 4, cfg.Concurrency)
+	assert.Equal(t, 1024*64, cfg.PayloadSize)
+	assert.Equal(t, uint32(defaultPoolBufferSize), cfg.BufferSize)
+}
+
+func TestRunStressInvalidConfig(t *testing.T) {
+	_, err := RunStress(StressConfig{Iterations: -1})
+	assert.ErrorIs(t, err, StressConfigError)
+
+	_, err = RunStress(StressConfig{Payload: StressPayload(10)})
+	assert.ErrorIs(t, err, StressConfigError)
+}
@@ -0,0 +1,135 @@
+package gozlib
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	TelemetrySampleRateError = errors.New("telemetry sample rate must be greater than 0 and at most 1")
+)
+
+// TelemetryRecord describes a sampled Compress or Decompress call
+type TelemetryRecord struct {
+	// Operation is NativeCompress for Compress and NativeUncompress for Decompress
+	Operation NativeOperation
+	// InputSize is the number of bytes read from src and OutputSize the number of bytes written to dst
+	InputSize  int64
+	OutputSize int64
+	// Level is the compression level, only set for NativeCompress
+	Level    CompressionLevel
+	Duration time.Duration
+	// BufferSize is the work buffer size of the transformer and CopyBufferSize the size of the buffer used to copy
+	// between src and the transformer
+	BufferSize     uint32
+	CopyBufferSize int
+	Err            error
+}
+
+// TelemetryCallback receives the records of sampled operations, on the goroutine that made the call
+// Callbacks must be safe for concurrent use.
+type TelemetryCallback func(record TelemetryRecord)
+
+type telemetrySampler struct {
+	rate       float64
+	callback   TelemetryCallback
+	operations atomic.Uint64
+}
+
+var telemetry atomic.Pointer[telemetrySampler]
+
+// SetTelemetrySampling records the details of a fraction of the Compress and Decompress calls, given by rate, to callback,
+// replacing the previous sampling settings. A nil callback disables sampling.
+// Operations are sampled evenly, for instance a rate of 0.01 samples one in every 100 calls.
+func SetTelemetrySampling(rate float64, callback TelemetryCallback) (err error) {
+	defer recoverPanic("SetTelemetrySampling", &err)
+
+	if callback == nil {
+		telemetry.Store(nil)
+		return nil
+	}
+
+	if !(rate > 0 && rate <= 1) {
+		return TelemetrySampleRateError
+	}
+
+	telemetry.Store(&telemetrySampler{rate: rate, callback: callback})
+	return nil
+}
+
+// sampleTelemetry returns the sampler if the current operation is sampled, nil otherwise
+func sampleTelemetry() *telemetrySampler {
+	sampler := telemetry.Load()
+	if sampler == nil {
+		return nil
+	}
+
+	// sample whenever the count scaled by the rate crosses an integer
+	count := sampler.operations.Add(1)
+	if uint64(float64(count)*sampler.rate) == uint64(float64(count-1)*sampler.rate) {
+		return nil
+	}
+
+	return sampler
+}
+
+func (ts *telemetrySampler) compress(dst io.Writer, src io.Reader, level CompressionLevel) (int64, error) {
+	output := &countingWriter{Writer: dst}
+	start := time.Now()
+	read, err := compressPooled(output, src, level)
+
+	ts.callback(TelemetryRecord{
+		Operation:      NativeCompress,
+		InputSize:      read,
+		OutputSize:     output.count,
+		Level:          level,
+		Duration:       time.Since(start),
+		BufferSize:     defaultTransformerPool().compressorBufferSize,
+		CopyBufferSize: copyBufferSize,
+		Err:            err,
+	})
+
+	return read, err
+}
+
+func (ts *telemetrySampler) decompress(dst io.Writer, src io.Reader) (int64, error) {
+	input := &countingReader{Reader: src}
+	start := time.Now()
+	written, err := decompressPooled(dst, input)
+
+	ts.callback(TelemetryRecord{
+		Operation:      NativeUncompress,
+		InputSize:      input.count,
+		OutputSize:     written,
+		Duration:       time.Since(start),
+		BufferSize:     defaultTransformerPool().uncompressorBufferSize,
+		CopyBufferSize: copyBufferSize,
+		Err:            err,
+	})
+
+	return written, err
+}
+
+type countingWriter struct {
+	io.Writer
+	count int64
+}
+
+func (cw *countingWriter) Write(data []byte) (int, error) {
+	written, err := cw.Writer.Write(data)
+	cw.count += int64(written)
+	return written, err
+}
+
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+func (cr *countingReader) Read(data []byte) (int, error) {
+	read, err := cr.Reader.Read(data)
+	cr.count += int64(read)
+	return read, err
+}
@@ -0,0 +1,66 @@
+package gozlib
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetrySamplesFraction(t *testing.T) {
+	var mutex sync.Mutex
+	records := []TelemetryRecord{}
+	require.NoError(t, SetTelemetrySampling(0.25, func(record TelemetryRecord) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		records = append(records, record)
+	}))
+	defer SetTelemetrySampling(0, nil)
+
+	data := makeTestData(10000)
+	for i := 0; i < 8; i++ {
+		compressed := &bytes.Buffer{}
+		_, err := Compress(compressed, bytes.NewReader(data), CompressionLevelBestSpeed)
+		require.NoError(t, err)
+
+		_, err = Decompress(&bytes.Buffer{}, bytes.NewReader(compressed.Bytes()))
+		require.NoError(t, err)
+	}
+
+	// one in every 4 of the 16 operations
+	require.Len(t, records, 4)
+	for _, record := range records {
+		assert.NoError(t, record.Err)
+		assert.Greater(t, record.Duration.Nanoseconds(), int64(0))
+		assert.Equal(t, copyBufferSize, record.CopyBufferSize)
+
+		if record.Operation == NativeCompress {
+			assert.Equal(t, int64(len(data)), record.InputSize)
+			assert.Less(t, record.OutputSize, record.InputSize)
+			assert.Equal(t, CompressionLevelBestSpeed, record.Level)
+			assert.Equal(t, defaultTransformerPool().compressorBufferSize, record.BufferSize)
+		} else {
+			assert.Equal(t, NativeUncompress, record.Operation)
+			assert.Equal(t, int64(len(data)), record.OutputSize)
+			assert.Less(t, record.InputSize, record.OutputSize)
+			assert.Equal(t, defaultTransformerPool().uncompressorBufferSize, record.BufferSize)
+		}
+	}
+}
+
+func TestTelemetrySamplingRate(t *testing.T) {
+	callback := func(record TelemetryRecord) {}
+
+	assert.ErrorIs(t, SetTelemetrySampling(0, callback), TelemetrySampleRateError)
+	assert.ErrorIs(t, SetTelemetrySampling(1.5, callback), TelemetrySampleRateError)
+	assert.Nil(t, telemetry.Load())
+
+	require.NoError(t, SetTelemetrySampling(1, callback))
+	assert.NotNil(t, sampleTelemetry())
+	assert.NotNil(t, sampleTelemetry())
+
+	require.NoError(t, SetTelemetrySampling(0, nil))
+	assert.Nil(t, sampleTelemetry())
+}
@@ -0,0 +1,41 @@
+package gozlib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	TrailingDataError = errors.New("unexpected data after the end of the compressed stream")
+)
+
+// TrailingDataMode controls how uncompressors handle input after the end of the compressed stream, like padding
+// or concatenated gzip members, which are not uncompressed
+type TrailingDataMode int
+
+const (
+	// TrailingDataIgnore reads and discards the remaining input. This is the default
+	TrailingDataIgnore TrailingDataMode = iota
+	// TrailingDataReject fails with TrailingDataError if there is any input after the end of the stream
+	TrailingDataReject
+	// TrailingDataExpose stops reading at the end of the stream, the remaining input is available with TrailingData
+	TrailingDataExpose
+)
+
+// SetTrailingDataMode is a helper function to set how an uncompressor handles input after the end of the compressed stream
+// The mode is kept when the uncompressor is reset.
+func SetTrailingDataMode(uncompressor io.ReadCloser, mode TrailingDataMode) {
+	uncompressor.(*goUncompressor).trailingMode = mode
+}
+
+// TrailingData returns a reader with the input after the end of the compressed stream for uncompressors using
+// TrailingDataExpose. The boolean is false if the end of the stream wasn't reached yet or trailing data isn't exposed.
+func TrailingData(uncompressor io.ReadCloser) (io.Reader, bool) {
+	goUncomp := uncompressor.(*goUncompressor)
+	if !goUncomp.ended || goUncomp.trailingMode != TrailingDataExpose {
+		return nil, false
+	}
+
+	return io.MultiReader(bytes.NewReader(goUncomp.trailing), goUncomp.input), true
+}
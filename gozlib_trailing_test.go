@@ -0,0 +1,66 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUncompressorTrailingDataModes(t *testing.T) {
+	data := makeTestData(10000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+	padding := bytes.Repeat([]byte{0}, 3000)
+	padded := append(append([]byte{}, compressed...), padding...)
+
+	// small work buffers leave trailing data in the work buffer and in the input
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(padded), 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+	_, exposed := TrailingData(uncompressor)
+	assert.False(t, exposed)
+
+	SetTrailingDataMode(uncompressor, TrailingDataReject)
+	ResetUncompressor(bytes.NewReader(padded), uncompressor)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.ErrorIs(t, err, TrailingDataError)
+	assert.Equal(t, data, uncompressed)
+
+	ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	SetTrailingDataMode(uncompressor, TrailingDataExpose)
+	ResetUncompressor(bytes.NewReader(padded), uncompressor)
+	uncompressed, err = io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	trailing, exposed := TrailingData(uncompressor)
+	assert.True(t, exposed)
+	trailingData, err := io.ReadAll(trailing)
+	assert.NoError(t, err)
+	assert.Equal(t, padding, trailingData)
+}
+
+func TestUncompressorTrailingDataSkip(t *testing.T) {
+	data := makeTestData(2000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	assert.NoError(t, err)
+
+	uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(append(compressed, "garbage"...)), 1024)
+	assert.NoError(t, err)
+	defer uncompressor.Close()
+	SetTrailingDataMode(uncompressor, TrailingDataReject)
+
+	skipped, err := Skip(uncompressor, 5000)
+	assert.ErrorIs(t, err, TrailingDataError)
+	assert.Equal(t, int64(len(data)), skipped)
+}
@@ -0,0 +1,203 @@
+package gozlib
+
+/*
+#include "zwrapper/gozlib.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// Transcoding
+// A transcoder uncompresses a zlib or gzip stream and compresses it again, for example to change the format or level
+// of proxied content. It uses a single native buffer pair: one buffer holds uncompressed data and the other holds both
+// the compressed input not yet consumed, compacted to its start, and the compressed output, produced in the space left
+// after it. Compared to an uncompressor and a compressor with their own work buffers plus a copy buffer between them,
+// this saves one buffer per transcode in flight.
+
+// the buffers must be larger than the longest match inflate can produce without consuming input,
+// so that inflating always frees space for the output
+const transcoderMinBufferSize = 1024
+
+// both buffers of the pair come from a single native pool block
+const transcoderMaxBufferSize = nativePoolMaxSize / 2
+
+var (
+	TranscoderBufferSizeError = errors.New("invalid transcoder buffer size")
+	TranscoderClosedError     = errors.New("transcoder is closed")
+)
+
+// Transcoder uncompresses zlib or gzip streams and compresses them in another format or level
+// A Transcoder can be reused for any number of streams but is not safe for concurrent use.
+type Transcoder struct {
+	inflater   *Engine
+	deflater   *Engine
+	buffers    []byte
+	buffersPtr unsafe.Pointer
+	bufferSize int
+}
+
+// NewTranscoder creates a transcoder producing data in the format given by mode, which can be TransformModeZLib,
+// TransformModeGZip or TransformModeRawDeflate, with the given level. bufferSize is the size of each buffer of the pair,
+// from 1Kb to 2MB. Close must be called to release the native resources.
+func NewTranscoder(mode TransformMode, level CompressionLevel, bufferSize uint32) (transcoder *Transcoder, err error) {
+	defer recoverPanic("NewTranscoder", &err)
+
+	if bufferSize < transcoderMinBufferSize {
+		return nil, fmt.Errorf("%w: %d bytes, at least %d required", TranscoderBufferSizeError, bufferSize, transcoderMinBufferSize)
+	}
+	if bufferSize > transcoderMaxBufferSize {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d supported", TranscoderBufferSizeError, bufferSize, transcoderMaxBufferSize)
+	}
+
+	deflater, err := NewEngine(mode, level)
+	if err != nil {
+		return nil, err
+	}
+
+	// gzip engines inflate zlib and gzip streams
+	inflater, err := NewEngine(TransformModeGZip, level)
+	if err != nil {
+		deflater.Close()
+		return nil, err
+	}
+
+	buffersLen := 2 * int(bufferSize)
+	buffersPtr, err := allocNativeBuffer(uint64(buffersLen))
+	if err != nil {
+		inflater.Close()
+		deflater.Close()
+		return nil, err
+	}
+
+	return &Transcoder{
+		inflater:   inflater,
+		deflater:   deflater,
+		buffers:    nativeSlice(buffersPtr, buffersLen, buffersLen),
+		buffersPtr: buffersPtr,
+		bufferSize: int(bufferSize),
+	}, nil
+}
+
+// Transcode uncompresses the stream read from input and writes it compressed to output, returning the number of
+// compressed bytes written. Input after the end of the stream may be consumed and is ignored.
+// If input ends before the stream does, io.ErrUnexpectedEOF is returned.
+func (tc *Transcoder) Transcode(output io.Writer, input io.Reader) (n int64, err error) {
+	defer recoverPanic("Transcoder.Transcode", &err)
+
+	if tc.buffersPtr == nil {
+		return 0, TranscoderClosedError
+	}
+
+	tc.inflater.ResetInflate()
+	tc.deflater.ResetDeflate()
+
+	compressed := tc.buffers[:tc.bufferSize]
+	uncompressed := tc.buffers[tc.bufferSize:]
+	in := compressed[:0]
+	inputEnded := false
+	moreOutput := false
+	var written int64
+
+	for {
+		// the inflater may still hold output for the input already consumed
+		if len(in) == 0 && !moreOutput {
+			if inputEnded {
+				return written, io.ErrUnexpectedEOF
+			}
+
+			readLen, readErr := input.Read(compressed)
+			in = compressed[:readLen]
+			if readErr == io.EOF {
+				inputEnded = true
+			} else if readErr != nil {
+				return written, readErr
+			}
+			continue
+		}
+
+		consumed, produced, inflateErr := tc.inflater.Inflate(in, uncompressed, FlushModeNone)
+		if inflateErr != nil && inflateErr != io.EOF {
+			return written, inflateErr
+		}
+		moreOutput = produced == len(uncompressed)
+
+		// compacting the input leaves the rest of the buffer for the output
+		in = compressed[:copy(compressed, in[consumed:])]
+		flush := FlushModeNone
+		if inflateErr == io.EOF {
+			flush = FlushModeFinish
+		}
+
+		deflated, deflateErr := tc.deflate(output, uncompressed[:produced], compressed[len(in):], flush)
+		written += deflated
+		if deflateErr != nil || inflateErr == io.EOF {
+			return written, deflateErr
+		}
+	}
+}
+
+// deflate compresses data into out, writing out to output every time it's filled
+func (tc *Transcoder) deflate(output io.Writer, data []byte, out []byte, flush FlushMode) (int64, error) {
+	if len(out) == 0 {
+		return 0, fmt.Errorf("%w: no space left for the output", TranscoderBufferSizeError)
+	}
+
+	var written int64
+	for {
+		consumed, produced, err := tc.deflater.Deflate(data, out, flush)
+		data = data[consumed:]
+		if err != nil && err != io.EOF {
+			return written, err
+		}
+
+		if produced > 0 {
+			outputLen, werr := output.Write(out[:produced])
+			written += int64(outputLen)
+			if werr != nil {
+				return written, werr
+			}
+		}
+
+		if err == io.EOF || (flush != FlushModeFinish && len(data) == 0 && produced < len(out)) {
+			return written, nil
+		}
+	}
+}
+
+// SetBackend makes the transcoder run on the given backend instead of the default one
+// It must be called before the first Transcode, BackendError is returned otherwise or if the backend is unknown.
+func (tc *Transcoder) SetBackend(backend Backend) (err error) {
+	defer recoverPanic("Transcoder.SetBackend", &err)
+
+	if tc.buffersPtr == nil {
+		return TranscoderClosedError
+	}
+
+	err = tc.inflater.SetBackend(backend)
+	if err != nil {
+		return err
+	}
+
+	return tc.deflater.SetBackend(backend)
+}
+
+// Close releases the native resources used by the transcoder
+func (tc *Transcoder) Close() (err error) {
+	defer recoverPanic("Transcoder.Close", &err)
+
+	if tc.buffersPtr == nil {
+		return nil
+	}
+
+	tc.inflater.Close()
+	tc.deflater.Close()
+	C.pool_free(tc.buffersPtr)
+	tc.buffersPtr = nil
+	tc.buffers = nil
+
+	return nil
+}
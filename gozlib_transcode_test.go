@@ -0,0 +1,83 @@
+package gozlib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscoderGZipToZLib(t *testing.T) {
+	for _, backend := range testBackends() {
+		transcoder, err := NewTranscoder(TransformModeZLib, CompressionLevelBestCompression, 1024)
+		require.NoError(t, err)
+		require.NoError(t, transcoder.SetBackend(backend))
+
+		// highly compressible data leaves little room for the output next to the input
+		payloads := [][]byte{makeTestData(100000), make([]byte, 300000), {}}
+		for _, data := range payloads {
+			compressed, cerr := stdLibGZipCompressSlice(data)
+			require.NoError(t, cerr)
+
+			output := &bytes.Buffer{}
+			written, terr := transcoder.Transcode(output, bytes.NewReader(compressed))
+			require.NoError(t, terr, "backend %s", backend)
+			assert.Equal(t, int64(output.Len()), written)
+
+			reader, rerr := zlib.NewReader(output)
+			require.NoError(t, rerr)
+			uncompressed, rerr := io.ReadAll(reader)
+			assert.NoError(t, rerr)
+			assert.Equal(t, data, uncompressed, "backend %s", backend)
+		}
+
+		assert.ErrorIs(t, transcoder.SetBackend(BackendZLib), BackendError)
+		assert.NoError(t, transcoder.Close())
+	}
+}
+
+func TestTranscoderTruncatedInput(t *testing.T) {
+	transcoder, err := NewTranscoder(TransformModeGZip, CompressionLevelBestSpeed, 4096)
+	require.NoError(t, err)
+	defer transcoder.Close()
+
+	compressed, err := stdLibGZipCompressSlice(makeTestData(10000))
+	require.NoError(t, err)
+
+	_, err = transcoder.Transcode(io.Discard, bytes.NewReader(compressed[:len(compressed)/2]))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = transcoder.Transcode(io.Discard, bytes.NewReader([]byte("not compressed data")))
+	assert.ErrorIs(t, err, TransformerUncompressionError)
+}
+
+func TestTranscoderInvalid(t *testing.T) {
+	_, err := NewTranscoder(TransformModeGZip, CompressionLevelBestSpeed, 512)
+	assert.ErrorIs(t, err, TranscoderBufferSizeError)
+	_, err = NewTranscoder(TransformModeGZip, CompressionLevelBestSpeed, transcoderMaxBufferSize+1)
+	assert.ErrorIs(t, err, TranscoderBufferSizeError)
+	// twice the size doesn't fit in 32 bits
+	_, err = NewTranscoder(TransformModeGZip, CompressionLevelBestSpeed, 1<<31)
+	assert.ErrorIs(t, err, TranscoderBufferSizeError)
+
+	transcoder, err := NewTranscoder(TransformModeGZip, CompressionLevelBestSpeed, transcoderMaxBufferSize)
+	require.NoError(t, err)
+	assert.NoError(t, transcoder.Close())
+
+	_, err = NewTranscoder(TransformModeUncompress, CompressionLevelBestSpeed, 4096)
+	assert.ErrorIs(t, err, EngineModeError)
+}
+
+func TestTranscoderDoubleClose(t *testing.T) {
+	transcoder, err := NewTranscoder(TransformModeZLib, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+
+	assert.NoError(t, transcoder.Close())
+	assert.NoError(t, transcoder.Close())
+
+	_, err = transcoder.Transcode(io.Discard, bytes.NewReader(nil))
+	assert.ErrorIs(t, err, TranscoderClosedError)
+}
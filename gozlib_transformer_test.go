@@ -2,6 +2,9 @@ package gozlib
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
@@ -38,6 +41,32 @@ func TestTransformerCompressGZip(t *testing.T) {
 	assert.NoError(t, compressor.Close())
 }
 
+func TestTransformerCompressZLib(t *testing.T) {
+	original := makeTestData(5985)
+
+	for _, level := range compressionLevels() {
+		output := &bytes.Buffer{}
+		compressor, err := NewGoZLibCompressor(output, level.(CompressionLevel), 1024)
+		assert.NoError(t, err)
+
+		_, err = compressor.Write(original)
+		assert.NoError(t, err)
+		assert.NoError(t, compressor.Close())
+
+		assert.True(t, isZLibHeader(output.Bytes()[:2]), level)
+
+		// use the standard lib zlib code to decompress the data, which also verifies the Adler-32 trailer
+		reader, err := zlib.NewReader(output)
+		assert.NoError(t, err)
+		uncompressed, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, original, uncompressed, level)
+	}
+
+	_, err := NewGoZLibCompressor(io.Discard, CompressionLevel(10), 1024)
+	assert.ErrorIs(t, err, CompressionLevelError)
+}
+
 func TestTransformerCompressGZipFlushOnClose(t *testing.T) {
 	const bufferSize = 1024 * 8
 	const originalLen = 1422
@@ -55,6 +84,39 @@ func TestTransformerCompressGZipFlushOnClose(t *testing.T) {
 	assert.Equal(t, original, uncompressed)
 }
 
+func TestTransformerCompressFinishReturnsCompressedLength(t *testing.T) {
+	const bufferSize = 512
+	const originalLen = 4711
+
+	output := bytes.NewBuffer([]byte{})
+
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestCompression, bufferSize)
+	assert.NoError(t, err)
+	defer compressor.Close()
+
+	original := makeTestData(originalLen)
+	_, compError := io.Copy(compressor, bytes.NewBuffer(original))
+	assert.NoError(t, compError)
+
+	compLen, finishErr := Finish(compressor)
+	assert.NoError(t, finishErr)
+	assert.Equal(t, uint64(output.Len()), compLen)
+
+	// the length is tracked per stream and starts over after a reset
+	reusedOutput := bytes.NewBuffer([]byte{})
+	ResetCompressor(reusedOutput, compressor)
+	_, compError = io.Copy(compressor, bytes.NewBuffer(original[:originalLen/2]))
+	assert.NoError(t, compError)
+
+	compLen, finishErr = Finish(compressor)
+	assert.NoError(t, finishErr)
+	assert.Equal(t, uint64(reusedOutput.Len()), compLen)
+
+	uncompressed, uncompError := stdLibGZipUncompress(reusedOutput, originalLen/2)
+	assert.NoError(t, uncompError)
+	assert.Equal(t, original[:originalLen/2], uncompressed)
+}
+
 func TestTransformerCompressEmptyInput(t *testing.T) {
 	result := transformerCompressEmptyBuffer(t)
 
@@ -176,6 +238,7 @@ func TestTransformerUncompressReadEOFWithData(t *testing.T) {
 	eofReader := &eofAwareReader{data: compressed}
 	uncompressor, uncompInitErr := NewGoZLibUncompressor(eofReader, 512)
 	assert.NoError(t, uncompInitErr)
+	defer uncompressor.Close()
 
 	uncompressed := bytes.NewBuffer([]byte{})
 	uncompLen, uncompErr := io.Copy(uncompressed, uncompressor)
@@ -337,3 +400,261 @@ func verifyTransformerUncompress(t *testing.T, copyFn copyDataFn, workBufferSize
 		}
 	}
 }
+
+func TestTransformerCompressSmallWritesAndBytes(t *testing.T) {
+	const bufferSize = 256
+	const originalLen = 3001
+
+	output := bytes.NewBuffer([]byte{})
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, bufferSize)
+	assert.NoError(t, err)
+
+	byteWriter, isByteWriter := compressor.(io.ByteWriter)
+	assert.True(t, isByteWriter)
+
+	original := makeTestData(originalLen)
+	// mix single bytes, small writes and writes larger than the internal coalescing buffer
+	for pos := 0; pos < originalLen; {
+		chunkLen := pos%7 + 1
+		if pos%5 == 0 {
+			chunkLen = smallWriteBufferSize + pos%3
+		}
+		if pos+chunkLen > originalLen {
+			chunkLen = originalLen - pos
+		}
+
+		if chunkLen == 1 {
+			assert.NoError(t, byteWriter.WriteByte(original[pos]))
+		} else {
+			written, werr := compressor.Write(original[pos : pos+chunkLen])
+			assert.NoError(t, werr)
+			assert.Equal(t, chunkLen, written)
+		}
+		pos += chunkLen
+	}
+
+	assert.NoError(t, compressor.Close())
+
+	uncompressed, uncompError := stdLibGZipUncompress(output, originalLen)
+	assert.NoError(t, uncompError)
+	assert.Equal(t, original, uncompressed)
+}
+
+func TestTransformerUncompressReadByte(t *testing.T) {
+	const valueCount = 3000
+
+	encoded := []byte{}
+	for i := uint64(0); i < valueCount; i++ {
+		encoded = binary.AppendUvarint(encoded, i*i*31)
+	}
+
+	compressed, compErr := stdLibGZipCompress(encoded)
+	assert.NoError(t, compErr)
+
+	uncompressor, initErr := NewGoZLibUncompressor(compressed, 64)
+	assert.NoError(t, initErr)
+	defer uncompressor.Close()
+
+	byteReader, isByteReader := uncompressor.(io.ByteReader)
+	assert.True(t, isByteReader)
+
+	for i := uint64(0); i < valueCount; i++ {
+		value, rerr := binary.ReadUvarint(byteReader)
+		assert.NoError(t, rerr)
+		assert.Equal(t, i*i*31, value)
+	}
+
+	_, eofErr := byteReader.ReadByte()
+	assert.ErrorIs(t, eofErr, io.EOF)
+}
+
+func TestTransformerUncompressMixedTinyAndLargeReads(t *testing.T) {
+	const originalLen = 9000
+
+	original := makeTestData(originalLen)
+	compressed, compErr := stdLibGZipCompress(original)
+	assert.NoError(t, compErr)
+
+	uncompressor, initErr := NewGoZLibUncompressor(compressed, 128)
+	assert.NoError(t, initErr)
+	defer uncompressor.Close()
+
+	uncompressed := []byte{}
+	readSizes := []int{1, 3, 700, 2, 1024, 5}
+	for readCount := 0; ; readCount++ {
+		chunk := make([]byte, readSizes[readCount%len(readSizes)])
+		readLen, rerr := uncompressor.Read(chunk)
+		uncompressed = append(uncompressed, chunk[:readLen]...)
+
+		if rerr == io.EOF {
+			break
+		}
+		assert.NoError(t, rerr)
+		assert.Greater(t, readLen, 0)
+	}
+
+	assert.Equal(t, original, uncompressed)
+}
+
+func TestTransformerUncompressPeek(t *testing.T) {
+	const originalLen = 5000
+	const peekLen = 512
+
+	original := makeTestData(originalLen)
+	compressed, compErr := stdLibGZipCompress(original)
+	assert.NoError(t, compErr)
+
+	// a work buffer smaller than the peek size still allows peeking the first 512 bytes
+	uncompressor, initErr := NewGoZLibUncompressor(compressed, 64)
+	assert.NoError(t, initErr)
+	defer uncompressor.Close()
+
+	peeked, peekErr := Peek(uncompressor, peekLen)
+	assert.NoError(t, peekErr)
+	assert.Equal(t, original[:peekLen], peeked)
+
+	// peeking doesn't consume data
+	peeked, peekErr = Peek(uncompressor, 10)
+	assert.NoError(t, peekErr)
+	assert.Equal(t, original[:10], peeked)
+
+	_, tooLargeErr := Peek(uncompressor, originalLen)
+	assert.ErrorIs(t, tooLargeErr, PeekSizeError)
+
+	uncompressed, readErr := io.ReadAll(uncompressor)
+	assert.NoError(t, readErr)
+	assert.Equal(t, original, uncompressed)
+
+	peeked, peekErr = Peek(uncompressor, 1)
+	assert.ErrorIs(t, peekErr, io.EOF)
+	assert.Empty(t, peeked)
+}
+
+func TestTransformerUncompressPeekShortInput(t *testing.T) {
+	const originalLen = 100
+
+	original := makeTestData(originalLen)
+	compressed, compErr := stdLibGZipCompress(original)
+	assert.NoError(t, compErr)
+
+	uncompressor, initErr := NewGoZLibUncompressor(compressed, 1024)
+	assert.NoError(t, initErr)
+	defer uncompressor.Close()
+
+	peeked, peekErr := Peek(uncompressor, 512)
+	assert.ErrorIs(t, peekErr, io.EOF)
+	assert.Equal(t, original, peeked)
+}
+
+func TestTransformerUncompressSkip(t *testing.T) {
+	const originalLen = 20000
+
+	original := makeTestData(originalLen)
+	compressed, compErr := stdLibGZipCompress(original)
+	assert.NoError(t, compErr)
+
+	uncompressor, initErr := NewGoZLibUncompressor(compressed, 256)
+	assert.NoError(t, initErr)
+	defer uncompressor.Close()
+
+	position := 0
+	// skip data already in the read ahead buffer and data that wasn't uncompressed yet
+	_, peekErr := Peek(uncompressor, 100)
+	assert.NoError(t, peekErr)
+	for _, skipLen := range []int{10, 3000, 1, 7777} {
+		skipped, skipErr := Skip(uncompressor, int64(skipLen))
+		assert.NoError(t, skipErr)
+		assert.Equal(t, int64(skipLen), skipped)
+		position += skipLen
+
+		next := make([]byte, 50)
+		_, readErr := io.ReadFull(uncompressor, next)
+		assert.NoError(t, readErr)
+		assert.Equal(t, original[position:position+len(next)], next)
+		position += len(next)
+	}
+
+	skipped, skipErr := Skip(uncompressor, originalLen)
+	assert.ErrorIs(t, skipErr, io.EOF)
+	assert.Equal(t, int64(originalLen-position), skipped)
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	return 0, fw.err
+}
+
+type shortWriter struct{}
+
+func (sw *shortWriter) Write(p []byte) (int, error) {
+	return len(p) / 2, nil
+}
+
+func TestTransformerCompressReturnsWriterError(t *testing.T) {
+	writeErr := errors.New("disk full")
+	compressor, err := NewGoGZipCompressor(&failingWriter{err: writeErr}, CompressionLevelBestSpeed, 1024)
+	assert.NoError(t, err)
+
+	_, err = compressor.Write(makeTestData(10000))
+	assert.ErrorIs(t, err, writeErr)
+	assert.ErrorIs(t, LastCallbackError(compressor), writeErr)
+
+	ResetCompressor(&shortWriter{}, compressor)
+	assert.NoError(t, LastCallbackError(compressor))
+	_, err = compressor.Write(makeTestData(10000))
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+
+	ResetCompressor(bytes.NewBuffer([]byte{}), compressor)
+	assert.NoError(t, compressor.Close())
+	assert.NoError(t, LastCallbackError(compressor))
+}
+
+func TestTransformerCompressAvailableBuffer(t *testing.T) {
+	output := bytes.NewBuffer(nil)
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	assert.NoError(t, err)
+
+	bufferWriter := compressor.(interface{ AvailableBuffer() []byte })
+	expected := []byte{}
+	for i := uint64(0); i < 3000; i++ {
+		// records are serialized directly into the compressor's buffer when they fit
+		record := binary.AppendUvarint(bufferWriter.AvailableBuffer(), i*i*31)
+		record = append(record, '\n')
+		expected = append(expected, record...)
+
+		written, werr := compressor.Write(record)
+		assert.NoError(t, werr)
+		assert.Equal(t, len(record), written)
+	}
+
+	assert.NoError(t, compressor.Close())
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(expected)))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, uncompressed)
+}
+
+func TestTransformerCompressAllLevels(t *testing.T) {
+	data := makeTestData(20000)
+
+	for _, level := range compressionLevels() {
+		compressed := &bytes.Buffer{}
+		compressor, err := NewGoGZipCompressor(compressed, level.(CompressionLevel), 1024)
+		assert.NoError(t, err)
+		_, err = compressor.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, compressor.Close())
+
+		uncompressed, err := stdLibGZipUncompress(compressed, int64(len(data)))
+		assert.NoError(t, err)
+		assert.Equal(t, data, uncompressed, level)
+	}
+
+	for _, level := range []CompressionLevel{-2, 10} {
+		_, err := NewGoGZipCompressor(io.Discard, level, 1024)
+		assert.ErrorIs(t, err, CompressionLevelError)
+	}
+}
@@ -0,0 +1,100 @@
+package gozlib
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Unpooled transformers
+// The native memory of transformers, including everything zlib allocates for them, comes from internal pools that
+// never shrink on their own. Short lived programs that create few transformers can bypass the pools, either per
+// transformer or for the whole package, so the memory is returned to the system as soon as a transformer is closed.
+
+// TransformerOptions holds the settings of compressors and uncompressors that can only be chosen on creation
+type TransformerOptions struct {
+	// BypassNativePool allocates the native memory of the transformer directly instead of from the internal pools
+	BypassNativePool bool
+	// Strategy is the deflate strategy used by compressors, ignored by uncompressors
+	Strategy CompressionStrategy
+	// Header is the gzip header metadata written by compressors, ignored by uncompressors. When nil, the header
+	// written is zlib's default one, without name, comment, modification time or extra field.
+	Header *GZipHeader
+	// Backend is the compression library the transformer runs on, the cgo zlib transformers when empty whichever backend
+	// SelectFastestBackend picked. Transformers on other backends don't support Strategy and Header and, of the helper
+	// functions, only support Flush, SyncFlush, FullFlush, Finish, ResetCompressor and ResetUncompressor.
+	Backend Backend
+}
+
+var nativePoolBypass atomic.Bool
+
+// SetNativePoolBypass sets whether compressors and uncompressors created from now on bypass the internal pools for
+// their native memory, as if created with TransformerOptions.BypassNativePool. Transformers already created aren't affected.
+func SetNativePoolBypass(bypass bool) {
+	nativePoolBypass.Store(bypass)
+}
+
+// NewGoGZipCompressorWithOptions creates a new gzip compressor like NewGoGZipCompressor, set up with options
+func NewGoGZipCompressorWithOptions(output io.Writer, level CompressionLevel, bufferSize uint32, options TransformerOptions) (compressor io.WriteCloser, err error) {
+	defer recoverPanic("NewGoGZipCompressorWithOptions", &err)
+
+	provider, err := options.backendProvider()
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		verr := validateBackendOptions(options)
+		if verr != nil {
+			return nil, verr
+		}
+		return newBackendCompressor(output, TransformModeGZip, level, bufferSize, provider)
+	}
+
+	serr := options.Strategy.validate()
+	if serr != nil {
+		return nil, serr
+	}
+
+	if options.Header != nil {
+		herr := validateGZipHeader(options.Header)
+		if herr != nil {
+			return nil, herr
+		}
+	}
+
+	goComp, err := newGoCompressorWithInit(output, level, func(goTransformer *goZLibTransformer) error {
+		goTransformer.unpooled = goTransformer.unpooled || options.BypassNativePool
+		goTransformer.strategy = options.Strategy
+		return initTransformer(goTransformer, TransformModeGZip, level, bufferSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Header != nil {
+		herr := goComp.setNativeGZipHeader(options.Header)
+		if herr != nil {
+			goComp.Close()
+			return nil, herr
+		}
+	}
+	return goComp, nil
+}
+
+// NewGoZLibUncompressorWithOptions creates a new zlib or gzip uncompressor like NewGoZLibUncompressor, set up with options
+func NewGoZLibUncompressorWithOptions(input io.Reader, bufferSize uint32, options TransformerOptions) (uncompressor io.ReadCloser, err error) {
+	defer recoverPanic("NewGoZLibUncompressorWithOptions", &err)
+
+	provider, err := options.backendProvider()
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		return newBackendUncompressor(input, bufferSize, provider), nil
+	}
+
+	goUncomp, err := newGoUncompressorWithOptions(input, TransformModeUncompress, bufferSize, options)
+	if err != nil {
+		return nil, err
+	}
+	return goUncomp, nil
+}
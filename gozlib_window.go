@@ -0,0 +1,23 @@
+package gozlib
+
+import "io"
+
+// Inflate window release
+// An uncompressor keeps its 32Kb inflate window between streams, which adds up for servers holding many idle
+// uncompressors. Releasing the window on reset trades a new allocation, served by the native pool, on the next
+// stream for memory that's only held while data is actually being uncompressed.
+
+// SetReleaseWindowOnReset is a helper function to set whether an uncompressor releases its inflate window when reset
+// The setting is kept when the uncompressor is reset.
+func SetReleaseWindowOnReset(uncompressor io.ReadCloser, release bool) {
+	uncompressor.(*goUncompressor).releaseWindow = release
+}
+
+// SetReleaseIdleWindows sets whether uncompressors created by the pool release their inflate window when released
+// to the pool, so idle uncompressors only hold their zlib state. It applies to uncompressors created after the call.
+func (tp *TransformerPool) SetReleaseIdleWindows(release bool) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+
+	tp.releaseWindows = release
+}
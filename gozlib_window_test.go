@@ -0,0 +1,74 @@
+package gozlib
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// windowsInUse returns the number of acquired native blocks of the inflate window size
+func windowsInUse() int64 {
+	for _, class := range NativeMemStats().Classes {
+		if class.ClassSize == MaxDictionarySize {
+			return class.Acquired
+		}
+	}
+	return 0
+}
+
+func TestReleaseWindowOnReset(t *testing.T) {
+	data := makeTestData(100000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	for _, release := range []bool{false, true} {
+		uncompressor, err := NewGoZLibUncompressor(bytes.NewReader(compressed), 1024)
+		require.NoError(t, err)
+		SetReleaseWindowOnReset(uncompressor, release)
+
+		before := windowsInUse()
+		uncompressed, err := io.ReadAll(uncompressor)
+		assert.NoError(t, err)
+		assert.Equal(t, data, uncompressed)
+		assert.Equal(t, before+1, windowsInUse())
+
+		ResetUncompressor(bytes.NewReader(compressed), uncompressor)
+		if release {
+			assert.Equal(t, before, windowsInUse())
+		} else {
+			assert.Equal(t, before+1, windowsInUse())
+		}
+
+		// the window is allocated again as needed
+		uncompressed, err = io.ReadAll(uncompressor)
+		assert.NoError(t, err)
+		assert.Equal(t, data, uncompressed)
+
+		assert.NoError(t, uncompressor.Close())
+		assert.Equal(t, before, windowsInUse())
+	}
+}
+
+func TestTransformerPoolReleaseIdleWindows(t *testing.T) {
+	data := makeTestData(100000)
+	compressed, err := stdLibGZipCompressSlice(data)
+	require.NoError(t, err)
+
+	pool := NewTransformerPool(1024, 1)
+	defer pool.Close()
+	pool.SetReleaseIdleWindows(true)
+
+	before := windowsInUse()
+	uncompressor, err := pool.AcquireUncompressor(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	uncompressed, err := io.ReadAll(uncompressor)
+	assert.NoError(t, err)
+	assert.Equal(t, data, uncompressed)
+
+	pool.ReleaseUncompressor(uncompressor)
+	assert.Equal(t, 1, pool.idleCount())
+	assert.Equal(t, before, windowsInUse())
+}
@@ -0,0 +1,149 @@
+package gozlib
+
+/*
+#include <zlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+)
+
+// Database wire protocol compression
+// Database protocols with compression negotiated for the whole session keep a single zlib stream per direction and
+// sync flush it at every packet boundary, so each compressed packet can be uncompressed as soon as it's received while
+// still referencing data from previous packets.
+
+// MaxWirePacketSize is the largest payload representable by the 3 byte length fields used by database wire protocols
+const MaxWirePacketSize = 1<<24 - 1
+
+// room reserved for the sync flush marker and block headers when growing the output
+const wireFlushReserve = 64
+
+var (
+	WirePacketTooLargeError = errors.New("wire packet larger than the maximum wire packet size")
+)
+
+// WireLengthHook is called with the compressed and uncompressed lengths of every packet compressed by a WireCodec,
+// before the packet is returned. Returning an error fails the compression of the packet, and since the packet is already part of
+// the compression stream, the session can't continue. It can be used to enforce protocol length limits or to collect statistics.
+type WireLengthHook func(compressedLen int, uncompressedLen int) error
+
+// WireCodec compresses and uncompresses the packets of a database wire protocol session
+// Compression and uncompression use separate persistent streams, one per direction, for the lifetime of the codec.
+// A codec can compress and uncompress concurrently but neither operation is safe for concurrent use on its own.
+type WireCodec struct {
+	deflater   *nativeStream
+	inflater   *nativeStream
+	lengthHook WireLengthHook
+}
+
+// NewWireCodec creates a codec compressing with the given level in zlib format
+// By default, compressed packets larger than MaxWirePacketSize are rejected with WirePacketTooLargeError, see SetLengthHook
+// to replace this check.
+func NewWireCodec(level CompressionLevel) (codec *WireCodec, err error) {
+	defer recoverPanic("NewWireCodec", &err)
+
+	deflater, err := newDeflateStream(level, C.MAX_WBITS, C.Z_DEFAULT_STRATEGY)
+	if err != nil {
+		return nil, err
+	}
+
+	inflater, err := newInflateStream(C.MAX_WBITS)
+	if err != nil {
+		deflater.close()
+		return nil, err
+	}
+
+	return &WireCodec{
+		deflater:   deflater,
+		inflater:   inflater,
+		lengthHook: checkWirePacketLength,
+	}, nil
+}
+
+func checkWirePacketLength(compressedLen int, uncompressedLen int) error {
+	if compressedLen > MaxWirePacketSize {
+		return WirePacketTooLargeError
+	}
+	return nil
+}
+
+// SetLengthHook replaces the function called with the lengths of each compressed packet. A nil hook disables length checks.
+func (wc *WireCodec) SetLengthHook(hook WireLengthHook) {
+	wc.lengthHook = hook
+}
+
+// CompressPacket compresses packet, appending it to dst and returning the extended slice
+// The compressed data ends at a sync flush point so the peer can uncompress the whole packet without waiting for more data.
+func (wc *WireCodec) CompressPacket(dst []byte, packet []byte) (result []byte, err error) {
+	defer recoverPanic("WireCodec.CompressPacket", &err)
+
+	dstLen := len(dst)
+	input := packet
+
+	for {
+		dst = ensureSpareCapacity(dst, wireFlushReserve+len(input))
+		spare := cap(dst) - len(dst)
+
+		consumed, produced, resultCode := wc.deflater.step(input, dst[len(dst):cap(dst)], C.Z_SYNC_FLUSH)
+		dst = dst[:len(dst)+produced]
+		input = input[consumed:]
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+			return dst[:dstLen], fmt.Errorf(wrapErrorFormat, TransformerCompressionError, resultCode)
+		}
+
+		// the flush is complete once all input is consumed and there's output space left
+		if len(input) == 0 && produced < spare {
+			break
+		}
+	}
+
+	if wc.lengthHook != nil {
+		herr := wc.lengthHook(len(dst)-dstLen, len(packet))
+		if herr != nil {
+			return dst[:dstLen], herr
+		}
+	}
+
+	return dst, nil
+}
+
+// UncompressPacket uncompresses a packet produced by the peer's codec, appending it to dst and returning the extended slice
+func (wc *WireCodec) UncompressPacket(dst []byte, compressed []byte) (result []byte, err error) {
+	defer recoverPanic("WireCodec.UncompressPacket", &err)
+
+	dstLen := len(dst)
+	input := compressed
+
+	for {
+		dst = ensureSpareCapacity(dst, 2*len(input)+wireFlushReserve)
+		spare := cap(dst) - len(dst)
+
+		consumed, produced, resultCode := wc.inflater.step(input, dst[len(dst):cap(dst)], C.Z_SYNC_FLUSH)
+		dst = dst[:len(dst)+produced]
+		input = input[consumed:]
+
+		if resultCode == C.Z_STREAM_END {
+			return dst, nil
+		}
+
+		if resultCode != C.Z_OK && resultCode != C.Z_BUF_ERROR {
+			return dst[:dstLen], fmt.Errorf(wrapErrorFormat, TransformerUncompressionError, resultCode)
+		}
+
+		if len(input) == 0 && produced < spare {
+			return dst, nil
+		}
+	}
+}
+
+// Close releases the native resources used by the codec
+func (wc *WireCodec) Close() (err error) {
+	defer recoverPanic("WireCodec.Close", &err)
+
+	wc.deflater.close()
+	wc.inflater.close()
+	return nil
+}
@@ -0,0 +1,61 @@
+package gozlib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWireCodecPackets(t *testing.T) {
+	client, err := NewWireCodec(CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	server, err := NewWireCodec(CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer server.Close()
+
+	query := []byte("SELECT id, name, created_at FROM accounts WHERE id = 42")
+	packets := [][]byte{query, {}, makeTestData(200000), query}
+
+	compressedLens := []int{}
+	for _, packet := range packets {
+		compressed, err := client.CompressPacket(nil, packet)
+		assert.NoError(t, err)
+		compressedLens = append(compressedLens, len(compressed))
+
+		// each packet can be uncompressed on its own, as soon as it's received
+		uncompressed, err := server.UncompressPacket([]byte("hdr"), compressed)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(append([]byte("hdr"), packet...), uncompressed))
+	}
+
+	// the stream state persists across packets so repeated content is cheaper
+	assert.Less(t, compressedLens[3], compressedLens[0])
+}
+
+func TestWireCodecLengthHook(t *testing.T) {
+	codec, err := NewWireCodec(CompressionLevelBestSpeed)
+	assert.NoError(t, err)
+	defer codec.Close()
+
+	var hookCompressedLen, hookUncompressedLen int
+	codec.SetLengthHook(func(compressedLen int, uncompressedLen int) error {
+		hookCompressedLen = compressedLen
+		hookUncompressedLen = uncompressedLen
+		if uncompressedLen > 100 {
+			return WirePacketTooLargeError
+		}
+		return nil
+	})
+
+	compressed, err := codec.CompressPacket([]byte{1, 2, 3}, makeTestData(50))
+	assert.NoError(t, err)
+	assert.Equal(t, len(compressed)-3, hookCompressedLen)
+	assert.Equal(t, 50, hookUncompressedLen)
+
+	compressed, err = codec.CompressPacket([]byte{1, 2, 3}, makeTestData(150))
+	assert.ErrorIs(t, err, WirePacketTooLargeError)
+	assert.Equal(t, []byte{1, 2, 3}, compressed)
+}
@@ -0,0 +1,78 @@
+package gozlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Write chunking
+// A large Write is normally compressed by a single native call, which can't be interrupted and keeps its goroutine
+// busy until all the data is compressed. Compressors with write chunking compress large writes in bounded chunks
+// instead, yielding the processor between them so cancellation and progress reporting can happen mid-write.
+
+var (
+	WriteChunkOptionsError = errors.New("invalid write chunk options")
+)
+
+// WriteChunkOptions controls how large writes are split, see SetWriteChunking
+type WriteChunkOptions struct {
+	// ChunkSize is the largest amount of data compressed by a single native call, zero disables chunking
+	ChunkSize int
+	// Context, when set, is checked before each chunk. Once it's done, Write stops with the context error,
+	// reporting the data compressed so far.
+	Context context.Context
+	// Progress, when set, is called after each chunk with the number of bytes of the current write compressed so far
+	Progress func(written int)
+}
+
+// SetWriteChunking is a helper function to make a compressor split writes larger than options.ChunkSize
+// The options are kept when the compressor is reset.
+func SetWriteChunking(compressor io.WriteCloser, options WriteChunkOptions) (err error) {
+	defer recoverPanic("SetWriteChunking", &err)
+
+	if options.ChunkSize < 0 {
+		return fmt.Errorf("%w: negative chunk size %d", WriteChunkOptionsError, options.ChunkSize)
+	}
+
+	goCompressorOf(compressor).writeChunking = options
+	return nil
+}
+
+// compressChunks compresses data one chunk at a time, yielding between chunks
+func (comp *goGZipCompressor) compressChunks(data []byte) (int, error) {
+	options := comp.writeChunking
+	written := 0
+
+	for written < len(data) {
+		if written > 0 {
+			runtime.Gosched()
+		}
+
+		if options.Context != nil {
+			cerr := options.Context.Err()
+			if cerr != nil {
+				return written, cerr
+			}
+		}
+
+		chunk := data[written:]
+		if len(chunk) > options.ChunkSize {
+			chunk = chunk[:options.ChunkSize]
+		}
+
+		_, cerr := comp.compress(chunk)
+		if cerr != nil {
+			return written, cerr
+		}
+		written += len(chunk)
+
+		if options.Progress != nil {
+			options.Progress(written)
+		}
+	}
+
+	return written, nil
+}
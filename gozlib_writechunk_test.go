@@ -0,0 +1,77 @@
+package gozlib
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressorWriteChunkingProgress(t *testing.T) {
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	progress := []int{}
+	require.NoError(t, SetWriteChunking(compressor, WriteChunkOptions{
+		ChunkSize: 4000,
+		Progress:  func(written int) { progress = append(progress, written) },
+	}))
+
+	data := makeTestData(10000)
+	written, err := compressor.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), written)
+	assert.Equal(t, []int{4000, 8000, 10000}, progress)
+
+	// writes up to the chunk size are compressed at once
+	progress = progress[:0]
+	_, err = compressor.Write(data[:4000])
+	assert.NoError(t, err)
+	assert.Empty(t, progress)
+	require.NoError(t, Flush(compressor))
+
+	uncompressed, err := stdLibGZipUncompress(output, int64(len(data)+4000))
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte{}, data...), data[:4000]...), uncompressed)
+}
+
+func TestCompressorWriteChunkingCancel(t *testing.T) {
+	output := &bytes.Buffer{}
+	compressor, err := NewGoGZipCompressor(output, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, SetWriteChunking(compressor, WriteChunkOptions{
+		ChunkSize: 1000,
+		Context:   ctx,
+		Progress: func(written int) {
+			if written == 3000 {
+				cancel()
+			}
+		},
+	}))
+
+	data := makeTestData(10000)
+	written, err := compressor.Write(data)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 3000, written)
+
+	// the data reported as written is in the stream
+	require.NoError(t, Flush(compressor))
+	uncompressed, err := stdLibGZipUncompress(output, 3000)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:3000], uncompressed)
+}
+
+func TestCompressorWriteChunkingInvalid(t *testing.T) {
+	compressor, err := NewGoGZipCompressor(&bytes.Buffer{}, CompressionLevelBestSpeed, 1024)
+	require.NoError(t, err)
+	defer compressor.Close()
+
+	assert.ErrorIs(t, SetWriteChunking(compressor, WriteChunkOptions{ChunkSize: -1}), WriteChunkOptionsError)
+}
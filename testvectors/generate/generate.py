@@ -0,0 +1,54 @@
+# Writes the vectors produced by Python's zlib module and the corrupted vectors to the directory given as argument
+import os
+import struct
+import sys
+import zlib
+
+data_dir = sys.argv[1]
+
+
+def read(name):
+    with open(os.path.join(data_dir, name), "rb") as f:
+        return f.read()
+
+
+def write(name, data):
+    with open(os.path.join(data_dir, name), "wb") as f:
+        f.write(data)
+
+
+def compress(data, level, wbits):
+    compressor = zlib.compressobj(level, zlib.DEFLATED, wbits)
+    return compressor.compress(data) + compressor.flush()
+
+
+def flip(data, pos, mask):
+    corrupted = bytearray(data)
+    corrupted[pos] ^= mask
+    return bytes(corrupted)
+
+
+text = read("text.txt")
+
+write("zlib-6-text.zz", compress(text, 6, zlib.MAX_WBITS))
+write("zlib-0-text.zz", compress(text, 0, zlib.MAX_WBITS))
+write("deflate-9-text.deflate", compress(text, 9, -zlib.MAX_WBITS))
+
+# gzip header with FEXTRA, FNAME and FCOMMENT, built around a raw deflate stream
+extra = b"GZ" + struct.pack("<H", 4) + b"test"
+header = b"\x1f\x8b\x08\x1c" + struct.pack("<I", 0) + b"\x00\x03"
+header += struct.pack("<H", len(extra)) + extra + b"text.txt\x00" + b"interop test vector\x00"
+trailer = struct.pack("<II", zlib.crc32(text), len(text))
+write("gzip-header-fields-text.gz", header + compress(text, 6, -zlib.MAX_WBITS) + trailer)
+
+zlib_stream = read("zlib-6-text.zz")
+write("corrupt-zlib-bad-adler.zz", flip(zlib_stream, len(zlib_stream) - 1, 0xff))
+
+gzip_stream = read("gzip-9-text.gz")
+write("corrupt-gzip-truncated.gz", gzip_stream[: len(gzip_stream) // 2])
+write("corrupt-gzip-bad-crc.gz", flip(gzip_stream, len(gzip_stream) - 8, 0xff))
+write("corrupt-gzip-bad-length.gz", flip(gzip_stream, len(gzip_stream) - 4, 0x01))
+write("corrupt-gzip-bad-magic.gz", flip(gzip_stream, 1, 0x07))
+
+# a final block using the reserved block type 3
+write("corrupt-deflate-reserved-block.deflate", b"\x07\x00")
@@ -0,0 +1,25 @@
+#!/bin/sh
+# Regenerates the vectors in testvectors/data with the producers recorded in vectors.json, from text.txt, zeros.bin and
+# empty.txt. Requires GNU gzip, Python 3 and Go.
+# GNU gzip and Python's zlib share the same deflate lineage, the Go standard library has its own deflate implementation.
+set -e
+
+generate_dir=$(cd "$(dirname "$0")" && pwd)
+data_dir="$generate_dir/../data"
+cd "$data_dir"
+
+# GNU gzip, without file name and modification time so the output is reproducible
+gzip -n -1 -c < text.txt > gzip-1-text.gz
+gzip -n -9 -c < text.txt > gzip-9-text.gz
+gzip -n -6 -c < zeros.bin > gzip-6-zeros.gz
+gzip -n -c < empty.txt > gzip-empty.gz
+{
+	head -c 9107 text.txt | gzip -n -c
+	tail -c +9108 text.txt | gzip -n -c
+} > gzip-multimember-text.gz
+
+# Python zlib, including the corrupted streams derived from the vectors above
+python3 "$generate_dir/generate.py" "$data_dir"
+
+# Go standard library
+(cd "$generate_dir" && go run ./gostdlib "$data_dir")
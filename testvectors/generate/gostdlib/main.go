@@ -0,0 +1,64 @@
+// Command gostdlib writes the vectors produced by the Go standard library compress packages, an implementation of
+// deflate independent from zlib, to the directory given as argument
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: gostdlib <data dir>")
+	}
+	dataDir := os.Args[1]
+
+	text := read(dataDir, "text.txt")
+	zeros := read(dataDir, "zeros.bin")
+
+	write(dataDir, "go-gzip-9-text.gz", text, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	})
+	write(dataDir, "go-gzip-1-zeros.gz", zeros, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestSpeed)
+	})
+	write(dataDir, "go-zlib-6-text.zz", text, func(w io.Writer) (io.WriteCloser, error) {
+		return zlib.NewWriterLevel(w, zlib.DefaultCompression)
+	})
+	write(dataDir, "go-deflate-huffman-text.deflate", text, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.HuffmanOnly)
+	})
+}
+
+func read(dataDir string, name string) []byte {
+	data, err := os.ReadFile(filepath.Join(dataDir, name))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data
+}
+
+func write(dataDir string, name string, data []byte, newWriter func(w io.Writer) (io.WriteCloser, error)) {
+	compressed := bytes.NewBuffer(nil)
+	writer, err := newWriter(compressed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = writer.Write(data)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dataDir, name), compressed.Bytes(), 0o644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
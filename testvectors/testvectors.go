@@ -0,0 +1,171 @@
+// Package testvectors embeds compressed streams produced by other implementations, along with corrupted and edge case
+// streams, and helpers to run them through gozlib so interoperability can be verified against the same corpus anywhere
+// The vectortest package runs them all as subtests.
+package testvectors
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/bignacio/gozlib"
+)
+
+// Format is the compressed data format of a vector
+type Format string
+
+const (
+	FormatGZip    Format = "gzip"
+	FormatZLib    Format = "zlib"
+	FormatDeflate Format = "deflate"
+)
+
+var (
+	VectorMismatchError  = errors.New("uncompressed data doesn't match the vector")
+	CorruptAcceptedError = errors.New("corrupted stream was uncompressed without errors")
+	UnknownFormatError   = errors.New("unknown vector format")
+	uncompressBufferSize = uint32(16 * 1024)
+	vectorsManifest      = "vectors.json"
+	vectorsDir           = "data"
+)
+
+//go:embed data
+var vectorsFS embed.FS
+
+// Vector is a compressed stream and the data it uncompresses to
+type Vector struct {
+	Name        string
+	Description string
+	// Producer is the implementation that produced the stream
+	Producer string
+	Format   Format
+	// Compressed is the compressed stream
+	Compressed []byte
+	// Uncompressed is the data the stream uncompresses to, nil for corrupted streams
+	Uncompressed []byte
+	// Corrupted is set for streams that must be rejected
+	Corrupted bool
+}
+
+type manifestEntry struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Producer     string `json:"producer"`
+	Format       Format `json:"format"`
+	Compressed   string `json:"compressed"`
+	Uncompressed string `json:"uncompressed"`
+	Corrupted    bool   `json:"corrupted"`
+}
+
+// Vectors returns all embedded vectors
+func Vectors() ([]Vector, error) {
+	manifest, err := vectorsFS.ReadFile(path.Join(vectorsDir, vectorsManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manifestEntry
+	err = json.Unmarshal(manifest, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([]Vector, 0, len(entries))
+	for _, entry := range entries {
+		vector := Vector{
+			Name:        entry.Name,
+			Description: entry.Description,
+			Producer:    entry.Producer,
+			Format:      entry.Format,
+			Corrupted:   entry.Corrupted,
+		}
+
+		vector.Compressed, err = vectorsFS.ReadFile(path.Join(vectorsDir, entry.Compressed))
+		if err != nil {
+			return nil, err
+		}
+
+		if !entry.Corrupted {
+			vector.Uncompressed, err = vectorsFS.ReadFile(path.Join(vectorsDir, entry.Uncompressed))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		vectors = append(vectors, vector)
+	}
+
+	return vectors, nil
+}
+
+// Uncompress uncompresses the vector stream with gozlib, failing on truncated streams and uncompressing all members
+// of gzip streams
+func Uncompress(vector Vector) ([]byte, error) {
+	var uncompressor io.ReadCloser
+	var err error
+
+	switch vector.Format {
+	case FormatGZip, FormatZLib:
+		uncompressor, err = gozlib.NewGoZLibUncompressor(bytes.NewReader(vector.Compressed), uncompressBufferSize)
+	case FormatDeflate:
+		uncompressor, err = gozlib.NewDeflateUncompressor(bytes.NewReader(vector.Compressed), uncompressBufferSize)
+	default:
+		return nil, fmt.Errorf("%w: %s", UnknownFormatError, vector.Format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer uncompressor.Close()
+
+	// truncated streams must fail instead of ending the data early
+	gozlib.SetIntegrityMode(uncompressor, gozlib.IntegrityStrict)
+	if vector.Format != FormatGZip {
+		return io.ReadAll(uncompressor)
+	}
+
+	// gzip streams can have multiple members, each one is uncompressed from the input left by the previous one
+	gozlib.SetTrailingDataMode(uncompressor, gozlib.TrailingDataExpose)
+	uncompressed := []byte{}
+	for {
+		member, rerr := io.ReadAll(uncompressor)
+		uncompressed = append(uncompressed, member...)
+		if rerr != nil {
+			return uncompressed, rerr
+		}
+
+		trailing, _ := gozlib.TrailingData(uncompressor)
+		remaining, rerr := io.ReadAll(trailing)
+		if rerr != nil || len(remaining) == 0 {
+			return uncompressed, rerr
+		}
+
+		gozlib.ResetUncompressor(bytes.NewReader(remaining), uncompressor)
+	}
+}
+
+// Verify uncompresses the vector stream with gozlib, checking that valid streams produce the expected data and
+// corrupted streams fail
+func Verify(vector Vector) error {
+	uncompressed, err := Uncompress(vector)
+	if vector.Corrupted {
+		if err == nil {
+			return fmt.Errorf("%w: %s", CorruptAcceptedError, vector.Name)
+		}
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", vector.Name, err)
+	}
+
+	if !bytes.Equal(vector.Uncompressed, uncompressed) {
+		return fmt.Errorf("%w: %s, expected %d bytes, got %d", VectorMismatchError, vector.Name, len(vector.Uncompressed), len(uncompressed))
+	}
+
+	return nil
+}
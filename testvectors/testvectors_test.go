@@ -0,0 +1,37 @@
+package testvectors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorsLoad(t *testing.T) {
+	vectors, err := Vectors()
+	require.NoError(t, err)
+	require.NotEmpty(t, vectors)
+
+	for _, vector := range vectors {
+		assert.NotEmpty(t, vector.Compressed, vector.Name)
+		assert.NotEmpty(t, vector.Producer, vector.Name)
+		assert.Equal(t, vector.Corrupted, vector.Uncompressed == nil, vector.Name)
+	}
+}
+
+func TestVerifyDetectsMismatch(t *testing.T) {
+	vectors, err := Vectors()
+	require.NoError(t, err)
+
+	vector := vectors[0]
+	vector.Uncompressed = append([]byte("x"), vector.Uncompressed...)
+	assert.ErrorIs(t, Verify(vector), VectorMismatchError)
+
+	vector = vectors[0]
+	vector.Corrupted = true
+	assert.ErrorIs(t, Verify(vector), CorruptAcceptedError)
+
+	vector.Format = "lz4"
+	_, err = Uncompress(vector)
+	assert.ErrorIs(t, err, UnknownFormatError)
+}
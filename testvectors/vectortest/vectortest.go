@@ -0,0 +1,27 @@
+// Package vectortest runs the test vectors of the testvectors package as subtests, kept apart so that importing
+// testvectors doesn't link the testing package
+package vectortest
+
+import (
+	"testing"
+
+	"github.com/bignacio/gozlib/testvectors"
+)
+
+// Run verifies every vector in its own subtest
+func Run(t *testing.T) {
+	vectors, err := testvectors.Vectors()
+	if err != nil {
+		t.Fatalf("loading vectors: %v", err)
+	}
+
+	for _, vector := range vectors {
+		vector := vector
+		t.Run(vector.Name, func(t *testing.T) {
+			verr := testvectors.Verify(vector)
+			if verr != nil {
+				t.Error(verr)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package vectortest
+
+import "testing"
+
+func TestVectors(t *testing.T) {
+	Run(t)
+}
@@ -0,0 +1,4 @@
+// cgo only builds the C files in the package directory, so the wrapper in zwrapper is compiled here as a single
+// unit, separately from the Go files, which only include its headers. zwrapper also builds on its own with CMake.
+#include "zwrapper/gozlib.c"
+#include "zwrapper/gozlib_interop.c"
@@ -1,13 +1,26 @@
+// syscall, for membarrier, isn't declared in strict ISO C modes
+#if defined(__linux__) && !defined(_DEFAULT_SOURCE)
+#define _DEFAULT_SOURCE
+#endif
+
 #include "gozlib.h"
+// pool usage counters back native_pool_usage
+#define TRACK_POOL_USAGE
 #include "dyn_mem_pool.h"
-#include "gozlib_interop.h"
 
+#include <sched.h>
 #include <stdbool.h>
 #include <stdlib.h>
 #include <string.h>
 #include <zconf.h>
 #include <zlib.h>
 
+#ifdef __linux__
+#include <linux/membarrier.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+#endif
+
 #ifdef __GNUC__
 #define LIKELY(x) __builtin_expect(!!(x), 1)
 #define UNLIKELY(x) __builtin_expect(!!(x), 0)
@@ -16,9 +29,6 @@
 #define UNLIKELY(x) (x)
 #endif
 
-#define UNCOMPRESS_ANY_WINDOW_BITS (MAX_WBITS + 32)
-#define COMPRESS_GZIP_WINDOW_BITS (MAX_WBITS + 16)
-
 struct MemPool *_zstreamstate_pool = NULL;
 struct MemPool *_z_stream_pool = NULL;
 struct MemPool *_gozlib_transformer_pool = NULL;
@@ -39,15 +49,176 @@ __attribute__((destructor)) void free_mem_pools(void) {
   free_mem_pool(_gozlib_transformer_pool);
 }
 
+// The lock-free pools can't free idle blocks while other threads acquire or return blocks, so every access to the internal
+// pools passes through this gate, which native_pool_release_idle closes while it frees idle blocks.
+// Accesses are counted in shards, each one on its own cache line and assigned to threads in turn, so that threads don't
+// contend on a single counter. The gate flag is only written by native_pool_release_idle and stays shared by all caches.
+#define POOL_GATE_SHARD_COUNT 64
+#define POOL_GATE_CACHE_LINE 64
+
+struct PoolGateShard {
+  uint32_t users;
+  char padding[POOL_GATE_CACHE_LINE - sizeof(uint32_t)];
+};
+
+static struct PoolGateShard pool_gate_shards[POOL_GATE_SHARD_COUNT] __attribute__((aligned(POOL_GATE_CACHE_LINE)));
+static uint32_t pool_gate_next_shard = 0;
+static __thread uint32_t *pool_gate_thread_users = NULL;
+static bool pool_gate_closed __attribute__((aligned(POOL_GATE_CACHE_LINE))) = false;
+// set when native_pool_release_idle can fence all threads with membarrier, sparing the accesses a full fence of their own
+static bool pool_gate_asymmetric = false;
+
+#if defined(__linux__) && defined(__NR_membarrier)
+__attribute__((constructor)) static void pool_gate_init(void) {
+  pool_gate_asymmetric = syscall(__NR_membarrier, MEMBARRIER_CMD_REGISTER_PRIVATE_EXPEDITED, 0, 0) == 0;
+}
+
+static inline void pool_gate_fence_all(void) {
+  if (pool_gate_asymmetric) {
+    syscall(__NR_membarrier, MEMBARRIER_CMD_PRIVATE_EXPEDITED, 0, 0);
+  }
+}
+#else
+static inline void pool_gate_fence_all(void) {
+}
+#endif
+
+// pool_gate_enter returns the counter pool_gate_exit must be called with
+static inline uint32_t *pool_gate_enter(void) {
+  uint32_t *users = pool_gate_thread_users;
+  if (UNLIKELY(users == NULL)) {
+    uint32_t shard = __atomic_fetch_add(&pool_gate_next_shard, 1, __ATOMIC_RELAXED) % POOL_GATE_SHARD_COUNT;
+    users = &pool_gate_shards[shard].users;
+    pool_gate_thread_users = users;
+  }
+
+  while (true) {
+    __atomic_add_fetch(users, 1, __ATOMIC_RELAXED);
+    // the counter must be visible before the gate is read, which pairs with native_pool_release_idle closing the gate
+    // before it reads the counters, so either the access is seen or the gate is. With membarrier the fence is only
+    // needed against the compiler, native_pool_release_idle fences the running threads.
+    if (LIKELY(pool_gate_asymmetric)) {
+      __atomic_signal_fence(__ATOMIC_SEQ_CST);
+    } else {
+      __atomic_thread_fence(__ATOMIC_SEQ_CST);
+    }
+    if (LIKELY(!__atomic_load_n(&pool_gate_closed, __ATOMIC_ACQUIRE))) {
+      return users;
+    }
+    __atomic_sub_fetch(users, 1, __ATOMIC_RELEASE);
+
+    while (__atomic_load_n(&pool_gate_closed, __ATOMIC_ACQUIRE)) {
+      sched_yield();
+    }
+  }
+}
+
+static inline void pool_gate_exit(uint32_t *users) {
+  __atomic_sub_fetch(users, 1, __ATOMIC_RELEASE);
+}
+
+static inline void *gated_pool_acquire(struct MemPool *pool) {
+  uint32_t *users = pool_gate_enter();
+  void *data = pool_mem_acquire(pool);
+  pool_gate_exit(users);
+  return data;
+}
+
+static inline void gated_pool_return(void *data) {
+  uint32_t *users = pool_gate_enter();
+  pool_mem_return(data);
+  pool_gate_exit(users);
+}
+
 void *pool_alloc(size_t size) {
-  return global_multipool_mem_acquire((uint32_t)size);
+  uint32_t *users = pool_gate_enter();
+  void *data = global_multipool_mem_acquire((uint32_t)size);
+  pool_gate_exit(users);
+  return data;
+}
+
+void *unpooled_alloc(size_t size) {
+  // same layout as pool blocks, with no owning node, so pool_free can tell them apart
+  ptrdiff_t *ptr_data = malloc(size + sizeof(ptrdiff_t));
+  if (ptr_data == NULL) {
+    return NULL;
+  }
+  ptr_data[0] = 0;
+  return ptr_data + 1;
 }
 
 void pool_free(void *data) {
-  pool_mem_return(data);
+  ptrdiff_t *ptr_data = ((ptrdiff_t *)data) - 1;
+  if (ptr_data[0] == 0) {
+    free(ptr_data);
+    return;
+  }
+  gated_pool_return(data);
+}
+
+_Static_assert(GOZLIB_NATIVE_POOL_COUNT == MULTIPOOL_ENTRY_COUNT + 3, "GOZLIB_NATIVE_POOL_COUNT must cover all internal pools");
+
+uint32_t native_pool_usage(uint32_t *sizes, uint32_t *held, uint32_t *idle, uint32_t count) {
+  struct MemPool *pools[GOZLIB_NATIVE_POOL_COUNT];
+  for (uint32_t i = 0; i < MULTIPOOL_ENTRY_COUNT; i++) {
+    pools[i] = _global_multipool->pools[i];
+  }
+  pools[MULTIPOOL_ENTRY_COUNT] = _zstreamstate_pool;
+  pools[MULTIPOOL_ENTRY_COUNT + 1] = _z_stream_pool;
+  pools[MULTIPOOL_ENTRY_COUNT + 2] = _gozlib_transformer_pool;
+
+  uint32_t filled = count < GOZLIB_NATIVE_POOL_COUNT ? count : GOZLIB_NATIVE_POOL_COUNT;
+  for (uint32_t i = 0; i < filled; i++) {
+    sizes[i] = pools[i]->mem_size;
+    held[i] = __atomic_load_n(&pools[i]->num_allocs, __ATOMIC_ACQUIRE);
+    idle[i] = __atomic_load_n(&pools[i]->num_available, __ATOMIC_ACQUIRE);
+  }
+
+  return filled;
+}
+
+static uint32_t pool_release_idle(struct MemPool *pool) {
+  uint32_t idle = __atomic_load_n(&pool->num_available, __ATOMIC_ACQUIRE);
+  pool_mem_free_all(pool);
+  // freed blocks are no longer held by the pool
+  __atomic_sub_fetch(&pool->num_allocs, idle, __ATOMIC_RELEASE);
+  return idle;
+}
+
+uint32_t native_pool_release_idle(void) {
+  bool open = false;
+  while (!__atomic_compare_exchange_n(&pool_gate_closed, &open, true, false, __ATOMIC_SEQ_CST, __ATOMIC_SEQ_CST)) {
+    open = false;
+    sched_yield();
+  }
+  __atomic_thread_fence(__ATOMIC_SEQ_CST);
+  pool_gate_fence_all();
+
+  for (int shard = 0; shard < POOL_GATE_SHARD_COUNT; shard++) {
+    while (__atomic_load_n(&pool_gate_shards[shard].users, __ATOMIC_ACQUIRE) != 0) {
+      sched_yield();
+    }
+  }
+
+  uint32_t released = 0;
+  for (uint32_t i = 0; i < MULTIPOOL_ENTRY_COUNT; i++) {
+    released += pool_release_idle(_global_multipool->pools[i]);
+  }
+  released += pool_release_idle(_zstreamstate_pool);
+  released += pool_release_idle(_z_stream_pool);
+  released += pool_release_idle(_gozlib_transformer_pool);
+
+  __atomic_store_n(&pool_gate_closed, false, __ATOMIC_RELEASE);
+  return released;
 }
 
-static inline void *zlib_custom_alloc(__attribute__((unused)) void *q, unsigned int nmembers, unsigned int msize) {
+// streams of unpooled transformers point their opaque value to this marker
+static char unpooled_zstream_marker;
+
+static inline void *zlib_custom_alloc(void *q, unsigned int nmembers, unsigned int msize) {
+  if (q == &unpooled_zstream_marker) {
+    return unpooled_alloc((size_t)nmembers * msize);
+  }
   return pool_alloc(nmembers * msize);
 }
 
@@ -69,14 +240,15 @@ static inline z_stream make_zstream(void) {
 }
 
 ZStreamState *pool_acquire_zstream_state(void) {
-  return pool_mem_acquire(_zstreamstate_pool);
+  return gated_pool_acquire(_zstreamstate_pool);
 }
 
 void pool_release_zstream_state(ZStreamState *state) {
-  pool_mem_return(state);
+  gated_pool_return(state);
 }
 
-static inline uLong compress_buffer(int level, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int window_bits, int *error_code) {
+static inline uLong compress_buffer(int level, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int window_bits, void *restrict dictionary,
+                                    uInt dictionary_len, int *error_code) {
   z_stream zs = make_zstream();
   int init_res = deflateInit2(&zs, level, Z_DEFLATED, window_bits, MAX_MEM_LEVEL, Z_DEFAULT_STRATEGY);
 
@@ -85,6 +257,15 @@ static inline uLong compress_buffer(int level, void *restrict input, uInt input_
     return 0;
   }
 
+  if (dictionary_len > 0) {
+    int dict_res = deflateSetDictionary(&zs, dictionary, dictionary_len);
+    if (dict_res != Z_OK) {
+      *error_code = dict_res;
+      deflateEnd(&zs);
+      return 0;
+    }
+  }
+
   zs.next_in = input;
   zs.avail_in = input_len;
   zs.next_out = output;
@@ -108,16 +289,22 @@ static inline uLong compress_buffer(int level, void *restrict input, uInt input_
 }
 
 uLong zlib_compress_buffer(int level, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int *error_code) {
-  return compress_buffer(level, input, input_len, output, output_len, MAX_WBITS, error_code);
+  return compress_buffer(level, input, input_len, output, output_len, MAX_WBITS, NULL, 0, error_code);
 }
 
 uLong gzip_compress_buffer(int level, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int *restrict error_code) {
-  return compress_buffer(level, input, input_len, output, output_len, COMPRESS_GZIP_WINDOW_BITS, error_code);
+  return compress_buffer(level, input, input_len, output, output_len, COMPRESS_GZIP_WINDOW_BITS, NULL, 0, error_code);
 }
 
-uLong uncompress_buffer_any(void *restrict input, uInt input_len, void *restrict output, uInt output_len, int *restrict error_code) {
+uLong zlib_compress_buffer_with_dictionary(int level, void *restrict dictionary, uInt dictionary_len, void *restrict input, uInt input_len, void *restrict output, uInt output_len,
+                                           int *error_code) {
+  return compress_buffer(level, input, input_len, output, output_len, MAX_WBITS, dictionary, dictionary_len, error_code);
+}
+
+static inline uLong uncompress_buffer(void *restrict input, uInt input_len, void *restrict output, uInt output_len, int window_bits, void *restrict dictionary, uInt dictionary_len,
+                                      int *restrict error_code) {
   z_stream zs = make_zstream();
-  int init_res = inflateInit2(&zs, UNCOMPRESS_ANY_WINDOW_BITS);
+  int init_res = inflateInit2(&zs, window_bits);
 
   if (init_res != Z_OK) {
     *error_code = init_res;
@@ -129,7 +316,15 @@ uLong uncompress_buffer_any(void *restrict input, uInt input_len, void *restrict
   zs.next_out = output;
   zs.avail_out = output_len;
 
-  const int inf_code = inflate(&zs, Z_FINISH);
+  int inf_code = inflate(&zs, Z_FINISH);
+
+  // zlib streams compressed with a preset dictionary ask for it before any data is uncompressed
+  if (inf_code == Z_NEED_DICT && dictionary_len > 0) {
+    inf_code = inflateSetDictionary(&zs, dictionary, dictionary_len);
+    if (inf_code == Z_OK) {
+      inf_code = inflate(&zs, Z_FINISH);
+    }
+  }
 
   uLong out_len = zs.total_out;
   if (UNLIKELY(inf_code != Z_STREAM_END)) {
@@ -149,6 +344,15 @@ uLong uncompress_buffer_any(void *restrict input, uInt input_len, void *restrict
   return out_len;
 }
 
+uLong uncompress_buffer_any(void *restrict input, uInt input_len, void *restrict output, uInt output_len, int *restrict error_code) {
+  return uncompress_buffer(input, input_len, output, output_len, UNCOMPRESS_ANY_WINDOW_BITS, NULL, 0, error_code);
+}
+
+uLong zlib_uncompress_buffer_with_dictionary(void *restrict dictionary, uInt dictionary_len, void *restrict input, uInt input_len, void *restrict output, uInt output_len,
+                                             int *restrict error_code) {
+  return uncompress_buffer(input, input_len, output, output_len, MAX_WBITS, dictionary, dictionary_len, error_code);
+}
+
 int compress_to_outstream(ZStreamState *state, z_streamp zs, int flush, StreamDataHandler output_handler, void *restrict output_buf, uInt output_len) {
   while (true) {
     zs->avail_out = output_len;
@@ -231,10 +435,8 @@ int uncompress_to_outstream_step(ZStreamState *state, z_streamp zs, StreamDataHa
   zs->next_out = output_buf;
   int inf_code = inflate(zs, Z_NO_FLUSH);
 
+  // the caller can set the preset dictionary and continue
   if (UNLIKELY(is_inflate_result_fatal(inf_code))) {
-    if (inf_code == Z_NEED_DICT) { // consider the need for dictionary an error too
-      return Z_DATA_ERROR;
-    }
     return inf_code;
   }
 
@@ -246,6 +448,10 @@ int uncompress_to_outstream_step(ZStreamState *state, z_streamp zs, StreamDataHa
     }
   }
 
+  if (inf_code == Z_STREAM_END) {
+    return Z_STREAM_END;
+  }
+
   // there's room in the buffer but it's not end of the stream yet
   if (zs->avail_out > 0) {
     return Z_OK;
@@ -254,11 +460,46 @@ int uncompress_to_outstream_step(ZStreamState *state, z_streamp zs, StreamDataHa
   return GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA;
 }
 
+int uncompress_discard_step(z_streamp zs, void *restrict scratch_buf, uInt scratch_len, uLong max_discard, uLong *discarded) {
+  *discarded = 0;
+
+  while (*discarded < max_discard) {
+    uLong remaining = max_discard - *discarded;
+    uInt discard_len = remaining < scratch_len ? (uInt)remaining : scratch_len;
+
+    zs->avail_out = discard_len;
+    zs->next_out = scratch_buf;
+    int inf_code = inflate(zs, Z_NO_FLUSH);
+    // count data produced before an error too, like data preceding a failed trailer check
+    *discarded += discard_len - zs->avail_out;
+
+    if (UNLIKELY(is_inflate_result_fatal(inf_code))) {
+      return inf_code;
+    }
+
+    if (inf_code == Z_STREAM_END) {
+      return Z_STREAM_END;
+    }
+
+    // there's room in the buffer so all the input was consumed
+    if (zs->avail_out > 0) {
+      return Z_OK;
+    }
+  }
+
+  return GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA;
+}
+
 int uncompress_to_outstream(ZStreamState *state, z_streamp zs, StreamDataHandler output_handler, void *restrict output_buf, uInt output_len) {
   int output_code = GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA;
   while (output_code == GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA) {
     output_code = uncompress_to_outstream_step(state, zs, output_handler, output_buf, output_len);
   }
+
+  // there's no way to provide a preset dictionary to whole stream operations
+  if (output_code == Z_NEED_DICT) {
+    return Z_DATA_ERROR;
+  }
   return output_code;
 }
 
@@ -301,15 +542,65 @@ uLong uncompress_stream_any(ZStreamState *state, StreamDataHandler input_handler
   return uncompressed_len;
 }
 
+#define VALIDATE_SCRATCH_CAP 4096
+
+uLong validate_stream_any(ZStreamState *state, StreamDataHandler input_handler, uInt work_input_buffer_cap, int *error_code) {
+  z_stream zs = make_zstream();
+
+  int init_code = inflateInit2(&zs, UNCOMPRESS_ANY_WINDOW_BITS);
+  if (init_code != Z_OK) {
+    *error_code = init_code;
+    return 0;
+  }
+
+  void *input_buf = pool_alloc((size_t)work_input_buffer_cap);
+  void *scratch_buf = pool_alloc(VALIDATE_SCRATCH_CAP);
+  int inf_code = Z_OK;
+
+  zs.avail_in = input_handler(state, input_buf, work_input_buffer_cap);
+  zs.next_in = input_buf;
+
+  while (zs.avail_in > 0 && inf_code != Z_STREAM_END) {
+    do {
+      zs.avail_out = VALIDATE_SCRATCH_CAP;
+      zs.next_out = scratch_buf;
+      inf_code = inflate(&zs, Z_NO_FLUSH);
+    } while (inf_code == Z_OK && zs.avail_out == 0);
+
+    if (UNLIKELY(is_inflate_result_fatal(inf_code))) {
+      *error_code = inf_code == Z_NEED_DICT ? Z_DATA_ERROR : inf_code;
+      break;
+    }
+
+    if (inf_code != Z_STREAM_END) {
+      zs.avail_in = input_handler(state, input_buf, work_input_buffer_cap);
+      zs.next_in = input_buf;
+    }
+  }
+
+  // the input ended before the end of the stream
+  if (*error_code == Z_OK && inf_code != Z_STREAM_END) {
+    *error_code = Z_BUF_ERROR;
+  }
+
+  uLong uncompressed_len = zs.total_out;
+  inflateEnd(&zs);
+
+  pool_free(input_buf);
+  pool_free(scratch_buf);
+
+  return uncompressed_len;
+}
+
 // transformers
 
 static inline z_streamp pool_alloc_zstream(void) {
-  return pool_mem_acquire(_z_stream_pool);
+  return gated_pool_acquire(_z_stream_pool);
 }
 
 static inline GoZLibTransformer *pool_alloc_transformer(uInt work_buffer_cap) {
   // this should come from a pool
-  GoZLibTransformer *transformer = pool_mem_acquire(_gozlib_transformer_pool);
+  GoZLibTransformer *transformer = gated_pool_acquire(_gozlib_transformer_pool);
   transformer->work_buffer = pool_alloc(work_buffer_cap);
   transformer->work_buffer_cap = work_buffer_cap;
   transformer->state = pool_acquire_zstream_state();
@@ -319,23 +610,47 @@ static inline GoZLibTransformer *pool_alloc_transformer(uInt work_buffer_cap) {
   return transformer;
 }
 
+GoZLibTransformer *alloc_transformer(uInt work_buffer_cap, bool pooled) {
+  if (pooled) {
+    return pool_alloc_transformer(work_buffer_cap);
+  }
+
+  GoZLibTransformer *transformer = unpooled_alloc(sizeof(GoZLibTransformer));
+  transformer->work_buffer = unpooled_alloc(work_buffer_cap);
+  transformer->work_buffer_cap = work_buffer_cap;
+  transformer->state = unpooled_alloc(sizeof(ZStreamState));
+  transformer->zs = unpooled_alloc(sizeof(z_stream));
+  init_default_zstream(transformer->zs);
+  transformer->zs->opaque = &unpooled_zstream_marker;
+
+  return transformer;
+}
+
 static inline void pool_release_zstream(z_streamp zs) {
-  pool_mem_return(zs);
+  gated_pool_return(zs);
 }
 
 static inline void pool_release_transformer(GoZLibTransformer *transformer) {
-  // this will return the transformer to the pool
-  pool_release_zstream(transformer->zs);
-  pool_release_zstream_state(transformer->state);
+  // pooled memory is returned to its pool and unpooled memory is freed
+  pool_free(transformer->zs);
+  pool_free(transformer->state);
   pool_free(transformer->work_buffer);
 
-  pool_mem_return(transformer);
+  pool_free(transformer);
 }
 
-GoZLibTransformer *acquire_gzip_compression_transformer(int level, uInt work_buffer_cap, int *error_code) {
+int init_compression_transformer(GoZLibTransformer *transformer, int level, int window_bits, int strategy) {
+  return deflateInit2(transformer->zs, level, Z_DEFLATED, window_bits, MAX_MEM_LEVEL, strategy);
+}
+
+int init_uncompression_transformer(GoZLibTransformer *transformer, int window_bits) {
+  return inflateInit2(transformer->zs, window_bits);
+}
+
+GoZLibTransformer *acquire_compression_transformer(int level, int window_bits, int strategy, uInt work_buffer_cap, int *error_code) {
   GoZLibTransformer *transformer = pool_alloc_transformer(work_buffer_cap);
 
-  int init_code = deflateInit2(transformer->zs, level, Z_DEFLATED, COMPRESS_GZIP_WINDOW_BITS, MAX_MEM_LEVEL, Z_DEFAULT_STRATEGY);
+  int init_code = init_compression_transformer(transformer, level, window_bits, strategy);
   if (init_code != Z_OK) {
     *error_code = init_code;
   }
@@ -343,12 +658,24 @@ GoZLibTransformer *acquire_gzip_compression_transformer(int level, uInt work_buf
   return transformer;
 }
 
+GoZLibTransformer *acquire_gzip_compression_transformer(int level, uInt work_buffer_cap, int *error_code) {
+  return acquire_compression_transformer(level, COMPRESS_GZIP_WINDOW_BITS, Z_DEFAULT_STRATEGY, work_buffer_cap, error_code);
+}
+
 GoZLibTransformer *acquire_zlib_compression_transformer(int level, uInt work_buffer_cap, int *error_code) {
+  return acquire_compression_transformer(level, MAX_WBITS, Z_DEFAULT_STRATEGY, work_buffer_cap, error_code);
+}
+
+GoZLibTransformer *acquire_raw_compression_transformer(int level, uInt work_buffer_cap, int *error_code) {
+  return acquire_compression_transformer(level, RAW_DEFLATE_WINDOW_BITS, Z_DEFAULT_STRATEGY, work_buffer_cap, error_code);
+}
+
+GoZLibTransformer *acquire_raw_uncompression_transformer(uInt work_buffer_cap, int *error_code) {
   GoZLibTransformer *transformer = pool_alloc_transformer(work_buffer_cap);
+  int init_res = inflateInit2(transformer->zs, RAW_DEFLATE_WINDOW_BITS);
 
-  int init_code = deflateInit2(transformer->zs, level, Z_DEFLATED, MAX_WBITS, MAX_MEM_LEVEL, Z_DEFAULT_STRATEGY);
-  if (init_code != Z_OK) {
-    *error_code = init_code;
+  if (init_res != Z_OK) {
+    *error_code = init_res;
   }
 
   return transformer;
@@ -382,3 +709,129 @@ void reset_compression_transformer(GoZLibTransformer *transformer) {
 void reset_uncompression_transformer(GoZLibTransformer *transformer) {
   inflateReset(transformer->zs);
 }
+
+int reset_uncompression_transformer_releasing_window(GoZLibTransformer *transformer, int window_bits) {
+  // zlib frees the window when the window bits change on reset, and allocates it again on first use
+  int reset_code = inflateReset2(transformer->zs, 0);
+  if (reset_code != Z_OK) {
+    return reset_code;
+  }
+  return inflateReset2(transformer->zs, window_bits);
+}
+
+int get_compression_dictionary(z_streamp zs, void *restrict dictionary, uInt *dictionary_len) {
+  return deflateGetDictionary(zs, dictionary, dictionary_len);
+}
+
+int get_uncompression_dictionary(z_streamp zs, void *restrict dictionary, uInt *dictionary_len) {
+  return inflateGetDictionary(zs, dictionary, dictionary_len);
+}
+
+int set_uncompression_dictionary(z_streamp zs, void *restrict dictionary, uInt dictionary_len) {
+  return inflateSetDictionary(zs, dictionary, dictionary_len);
+}
+
+int set_compression_dictionary(z_streamp zs, void *restrict dictionary, uInt dictionary_len) {
+  return deflateSetDictionary(zs, dictionary, dictionary_len);
+}
+
+// persistent streams
+
+z_streamp acquire_deflate_stream(int level, int window_bits, int strategy, int *error_code) {
+  z_streamp zs = pool_alloc_zstream();
+  init_default_zstream(zs);
+
+  int init_code = deflateInit2(zs, level, Z_DEFLATED, window_bits, MAX_MEM_LEVEL, strategy);
+  if (init_code != Z_OK) {
+    *error_code = init_code;
+  }
+
+  return zs;
+}
+
+z_streamp acquire_inflate_stream(int window_bits, int *error_code) {
+  z_streamp zs = pool_alloc_zstream();
+  init_default_zstream(zs);
+
+  int init_code = inflateInit2(zs, window_bits);
+  if (init_code != Z_OK) {
+    *error_code = init_code;
+  }
+
+  return zs;
+}
+
+void release_deflate_stream(z_streamp zs) {
+  deflateEnd(zs);
+  pool_release_zstream(zs);
+}
+
+void release_inflate_stream(z_streamp zs) {
+  inflateEnd(zs);
+  pool_release_zstream(zs);
+}
+
+z_streamp copy_inflate_stream(z_streamp source, int *error_code) {
+  z_streamp zs = pool_alloc_zstream();
+  init_default_zstream(zs);
+
+  int copy_code = inflateCopy(zs, source);
+  if (copy_code != Z_OK) {
+    *error_code = copy_code;
+  }
+
+  return zs;
+}
+
+int deflate_step(z_streamp zs, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int flush, uInt *consumed, uInt *produced) {
+  zs->next_in = input;
+  zs->avail_in = input_len;
+  zs->next_out = output;
+  zs->avail_out = output_len;
+
+  int def_code = deflate(zs, flush);
+
+  *consumed = input_len - zs->avail_in;
+  *produced = output_len - zs->avail_out;
+
+  // the caller owns the buffers, don't keep references to them
+  zs->next_in = Z_NULL;
+  zs->avail_in = 0;
+  zs->next_out = Z_NULL;
+  zs->avail_out = 0;
+
+  return def_code;
+}
+
+int inflate_step(z_streamp zs, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int flush, uInt *consumed, uInt *produced) {
+  zs->next_in = input;
+  zs->avail_in = input_len;
+  zs->next_out = output;
+  zs->avail_out = output_len;
+
+  int inf_code = inflate(zs, flush);
+
+  *consumed = input_len - zs->avail_in;
+  *produced = output_len - zs->avail_out;
+
+  zs->next_in = Z_NULL;
+  zs->avail_in = 0;
+  zs->next_out = Z_NULL;
+  zs->avail_out = 0;
+
+  return inf_code;
+}
+
+int inflate_sync_step(z_streamp zs, void *restrict input, uInt input_len, uInt *consumed) {
+  zs->next_in = input;
+  zs->avail_in = input_len;
+
+  int sync_code = inflateSync(zs);
+
+  *consumed = input_len - zs->avail_in;
+
+  zs->next_in = Z_NULL;
+  zs->avail_in = 0;
+
+  return sync_code;
+}
@@ -2,6 +2,7 @@
 #define GOZLIB_H
 
 #include <stdbool.h>
+#include <stdint.h>
 #include <stdio.h>
 #include <zconf.h>
 #include <zlib.h>
@@ -12,6 +13,11 @@
 #define GOZLIB_STREAM_OUTPUT_WRITE_ERROR (-(GOZLIB_CUSTOM_CODE_BASE + 1))
 #define GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA (GOZLIB_CUSTOM_CODE_BASE + 1)
 
+// zlib window bits for each stream format
+#define UNCOMPRESS_ANY_WINDOW_BITS (MAX_WBITS + 32)
+#define COMPRESS_GZIP_WINDOW_BITS (MAX_WBITS + 16)
+#define RAW_DEFLATE_WINDOW_BITS (-MAX_WBITS)
+
 
 /**
  * @brief Struct to track a zlib stream state for streaming operations
@@ -64,13 +70,89 @@ uLong uncompress_buffer_any(void* restrict input, uInt input_len, void* restrict
  */
 uLong gzip_compress_buffer(int level, void* restrict input, uInt input_len, void* restrict output, uInt output_len, int* error_code);
 
+/**
+ * @brief Compress input into the output buffer using the standard zlib format, with dictionary as the preset dictionary.
+ * If the length of output is too small, zero is returned and eror_code is set to the zlib error code
+ *
+ * @param level
+ * @param dictionary
+ * @param dictionary_len
+ * @param input
+ * @param input_len
+ * @param output
+ * @param output_len
+ * @param error_code
+ * @return uLong length of compressed output or 0 on error
+ */
+uLong zlib_compress_buffer_with_dictionary(int level, void* restrict dictionary, uInt dictionary_len, void* restrict input, uInt input_len, void* restrict output, uInt output_len, int* error_code);
+
+/**
+ * @brief Uncompress a zlib input compressed with a preset dictionary into the output buffer.
+ * If the output buffer is too small, error_code is set to the zlib error code and the returned value is the number of bytes remaining to be uncompressed.
+ *
+ * @param dictionary
+ * @param dictionary_len
+ * @param input
+ * @param input_len
+ * @param output
+ * @param output_len
+ * @param error_code
+ * @return uLong
+ */
+uLong zlib_uncompress_buffer_with_dictionary(void* restrict dictionary, uInt dictionary_len, void* restrict input, uInt input_len, void* restrict output, uInt output_len, int* error_code);
+
 ZStreamState* pool_acquire_zstream_state(void);
 void pool_release_zstream_state(ZStreamState* state);
 
 
+/**
+ * @brief Fixed size memory pools, as implemented in dyn_mem_pool.h
+ *
+ */
+struct MemPool;
+struct MemPool* alloc_mem_pool(uint32_t size);
+void free_mem_pool(struct MemPool* pool);
+void* pool_mem_acquire(struct MemPool* pool);
+void pool_mem_return(void* data);
+
 void *pool_alloc(size_t size);
+/**
+ * @brief Allocates memory that doesn't come from any pool, so it's returned to the system when freed.
+ * The memory must be released with pool_free.
+ *
+ * @param size
+ * @return pointer to the allocated memory or NULL if it cannot be allocated
+ */
+void *unpooled_alloc(size_t size);
 void pool_free(void *data);
 
+/**
+ * @brief Number of internal memory pools: the multipool size classes followed by the stream state, z_stream and transformer pools
+ *
+ */
+#define GOZLIB_NATIVE_POOL_COUNT 17
+
+/**
+ * @brief Reports the usage of the internal memory pools, including all memory allocated by zlib itself.
+ * Each array must have room for count entries and at most GOZLIB_NATIVE_POOL_COUNT entries are filled.
+ *
+ * @param sizes receives the block size of each pool
+ * @param held receives the number of blocks allocated by each pool, in use or idle
+ * @param idle receives the number of blocks available for reuse in each pool
+ * @param count the number of entries in each array
+ * @return the number of entries filled
+ */
+uint32_t native_pool_usage(uint32_t *sizes, uint32_t *held, uint32_t *idle, uint32_t count);
+
+/**
+ * @brief Frees the idle blocks of all internal memory pools, returning their memory to the system.
+ * Acquiring and returning blocks waits while idle blocks are freed, so it's safe to call while the pools are in use.
+ * Blocks in use are not affected and the pools allocate new blocks as needed.
+ *
+ * @return the number of blocks freed
+ */
+uint32_t native_pool_release_idle(void);
+
 /**
  * @brief Handler type for streaming data operations
  *
@@ -119,6 +201,20 @@ uLong gzip_compress_stream(ZStreamState* state, int level, StreamDataHandler inp
  */
 uLong uncompress_stream_any(ZStreamState* state, StreamDataHandler input_handler, StreamDataHandler output_handler, uInt work_input_buffer_cap, uInt work_output_buffer_cap, int* error_code);
 
+/**
+ * @brief Uncompress a gzip or zlib compressed stream discarding the output, only verifying its integrity
+ *
+ * The output is written to a small internal scratch buffer and no output handler is called.
+ *
+ * @param state
+ * @param input_handler
+ * @param work_input_buffer_cap
+ * @param error_code Z_OK if the stream is valid, Z_BUF_ERROR if the input ended before the end of the stream,
+ * or the zlib error otherwise
+ * @return uLong the number of uncompressed bytes
+ */
+uLong validate_stream_any(ZStreamState* state, StreamDataHandler input_handler, uInt work_input_buffer_cap, int* error_code);
+
 
 /**
  * @brief Performs one compression step writing to the given output handler
@@ -142,10 +238,164 @@ int compress_to_outstream(ZStreamState *state, z_streamp zs, int flush, StreamDa
  * @param output_buf
  * @param output_len
  * @param work_buffer_len
- * @return int
+ * @return int Z_STREAM_END once the end of the compressed stream is reached, GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA if the
+ * output buffer was filled, Z_OK if more input is needed, Z_NEED_DICT if the stream needs a preset dictionary before
+ * continuing or a negative error code
  */
 int uncompress_to_outstream_step(ZStreamState *state, z_streamp zs, StreamDataHandler output_handler, void *restrict output_buf, uInt output_len);
 
+/**
+ * @brief Uncompresses and discards up to max_discard bytes using scratch_buf as the output buffer.
+ * Returns Z_OK if more input is needed, Z_STREAM_END at the end of the stream, GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA
+ * if max_discard bytes were discarded and there might be more output available from the current input or Z_NEED_DICT
+ * if the stream needs a preset dictionary before continuing
+ *
+ * @param zs
+ * @param scratch_buf
+ * @param scratch_len
+ * @param max_discard
+ * @param discarded
+ * @return int
+ */
+int uncompress_discard_step(z_streamp zs, void *restrict scratch_buf, uInt scratch_len, uLong max_discard, uLong *discarded);
+
+/**
+ * @brief Copies the current compression sliding window into dictionary, which must be able to hold 1 << MAX_WBITS bytes.
+ * Returns the zlib result code and sets dictionary_len to the number of bytes copied
+ *
+ * @param zs
+ * @param dictionary
+ * @param dictionary_len
+ * @return int
+ */
+int get_compression_dictionary(z_streamp zs, void *restrict dictionary, uInt *dictionary_len);
+
+/**
+ * @brief Copies the current uncompression sliding window into dictionary, which must be able to hold 1 << MAX_WBITS bytes.
+ * Returns the zlib result code and sets dictionary_len to the number of bytes copied
+ *
+ * @param zs
+ * @param dictionary
+ * @param dictionary_len
+ * @return int
+ */
+int get_uncompression_dictionary(z_streamp zs, void *restrict dictionary, uInt *dictionary_len);
+
+/**
+ * @brief Sets the preset dictionary of an uncompression stream after a step returned Z_NEED_DICT.
+ * Returns Z_DATA_ERROR if the dictionary doesn't match the dictionary id in the stream header
+ *
+ * @param zs
+ * @param dictionary
+ * @param dictionary_len
+ * @return int
+ */
+int set_uncompression_dictionary(z_streamp zs, void *restrict dictionary, uInt dictionary_len);
+
+/**
+ * @brief Sets the preset dictionary of a zlib or raw deflate compression stream, before any data is compressed.
+ * Returns Z_STREAM_ERROR for gzip streams, which can't carry a dictionary
+ *
+ * @param zs
+ * @param dictionary
+ * @param dictionary_len
+ * @return int
+ */
+int set_compression_dictionary(z_streamp zs, void *restrict dictionary, uInt dictionary_len);
+
+/**
+ * @brief Acquires a persistent deflate stream with the given zlib window bits and strategy, as accepted by deflateInit2.
+ * The stream is not tied to any buffers and is driven with deflate_step
+ *
+ * @param level
+ * @param window_bits
+ * @param strategy
+ * @param error_code
+ * @return z_streamp
+ */
+z_streamp acquire_deflate_stream(int level, int window_bits, int strategy, int* error_code);
+
+/**
+ * @brief Acquires a persistent inflate stream with the given zlib window bits, as accepted by inflateInit2.
+ * The stream is not tied to any buffers and is driven with inflate_step
+ *
+ * @param window_bits
+ * @param error_code
+ * @return z_streamp
+ */
+z_streamp acquire_inflate_stream(int window_bits, int* error_code);
+
+/**
+ * @brief Releases a stream acquired with acquire_deflate_stream
+ *
+ * @param zs
+ */
+void release_deflate_stream(z_streamp zs);
+
+/**
+ * @brief Releases a stream acquired with acquire_inflate_stream
+ *
+ * @param zs
+ */
+void release_inflate_stream(z_streamp zs);
+
+/**
+ * @brief Acquires a copy of an inflate stream, including its sliding window and any input it still references.
+ * The copy is independent from source, driven with inflate_step and released with release_inflate_stream
+ *
+ * @param source
+ * @param error_code
+ * @return z_streamp
+ */
+z_streamp copy_inflate_stream(z_streamp source, int* error_code);
+
+/**
+ * @brief Performs a single deflate call over the given buffers with the given flush mode.
+ * Returns the deflate result code and sets consumed and produced to the number of input bytes read and output bytes written.
+ * No reference to the buffers is kept once the function returns
+ *
+ * @param zs
+ * @param input
+ * @param input_len
+ * @param output
+ * @param output_len
+ * @param flush
+ * @param consumed
+ * @param produced
+ * @return int
+ */
+int deflate_step(z_streamp zs, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int flush, uInt *consumed, uInt *produced);
+
+/**
+ * @brief Performs a single inflate call over the given buffers with the given flush mode.
+ * Returns the inflate result code and sets consumed and produced to the number of input bytes read and output bytes written.
+ * No reference to the buffers is kept once the function returns
+ *
+ * @param zs
+ * @param input
+ * @param input_len
+ * @param output
+ * @param output_len
+ * @param flush
+ * @param consumed
+ * @param produced
+ * @return int
+ */
+int inflate_step(z_streamp zs, void *restrict input, uInt input_len, void *restrict output, uInt output_len, int flush, uInt *consumed, uInt *produced);
+
+/**
+ * @brief Skips input until the next full flush point of an inflate stream, using inflateSync.
+ * Returns Z_OK when a flush point is found, Z_DATA_ERROR if the input was consumed without finding one or Z_BUF_ERROR if there's no input.
+ * consumed is set to the number of input bytes skipped
+ *
+ * @param zs
+ * @param input
+ * @param input_len
+ * @param consumed
+ * @return int
+ */
+int inflate_sync_step(z_streamp zs, void *restrict input, uInt input_len, uInt *consumed);
+
 /**
  * @brief Generic struct for IO Go io.Reader/Writer transformations
  *
@@ -157,6 +407,49 @@ typedef struct {
     uInt work_buffer_cap;
 } GoZLibTransformer;
 
+/**
+ * @brief Allocates a transformer, including its work buffer and zlib stream, without initializing the stream.
+ * When pooled is false, the memory of the transformer and all memory allocated by zlib for it bypass the internal
+ * pools and are returned to the system once the transformer is released.
+ *
+ * @param work_buffer_cap
+ * @param pooled
+ * @return GoZLibTransformer
+ */
+GoZLibTransformer* alloc_transformer(uInt work_buffer_cap, bool pooled);
+
+/**
+ * @brief Initializes the stream of a transformer from alloc_transformer for compression, as deflateInit2 does
+ *
+ * @param transformer
+ * @param level
+ * @param window_bits
+ * @param strategy
+ * @return Z_OK on success or the zlib error code
+ */
+int init_compression_transformer(GoZLibTransformer* transformer, int level, int window_bits, int strategy);
+
+/**
+ * @brief Initializes the stream of a transformer from alloc_transformer for uncompression, as inflateInit2 does
+ *
+ * @param transformer
+ * @param window_bits
+ * @return Z_OK on success or the zlib error code
+ */
+int init_uncompression_transformer(GoZLibTransformer* transformer, int window_bits);
+
+/**
+ * @brief Acquires a compression transformer with the given zlib window bits and strategy, as accepted by deflateInit2
+ *
+ * @param level
+ * @param window_bits
+ * @param strategy
+ * @param work_buffer_cap
+ * @param error_code
+ * @return GoZLibTransformer
+ */
+GoZLibTransformer* acquire_compression_transformer(int level, int window_bits, int strategy, uInt work_buffer_cap, int* error_code);
+
 /**
  * @brief Acquires a gzip compression transformer
  *
@@ -189,6 +482,16 @@ void reset_compression_transformer(GoZLibTransformer* transformer);
  */
 void reset_uncompression_transformer(GoZLibTransformer* transformer);
 
+/**
+ * @brief Resets an uncompressor transformer so that it can be reused, also releasing its inflate window.
+ * The window is allocated again once the transformer uncompresses data, trading setup cost for idle memory.
+ *
+ * @param transformer
+ * @param window_bits the window bits the transformer was initialized with
+ * @return Z_OK on success or the zlib error code
+ */
+int reset_uncompression_transformer_releasing_window(GoZLibTransformer* transformer, int window_bits);
+
 /**
  * @brief Acquires a zlib compression transformer
  *
@@ -209,6 +512,25 @@ GoZLibTransformer* acquire_zlib_compression_transformer(int level, uInt work_buf
  */
 GoZLibTransformer* acquire_uncompression_transformer(uInt work_buffer_cap, int* error_code);
 
+/**
+ * @brief Acquires a raw deflate compression transformer, producing data without any zlib or gzip wrapper
+ *
+ * @param level
+ * @param work_buffer_cap
+ * @param error_code
+ * @return GoZLibTransformer
+ */
+GoZLibTransformer* acquire_raw_compression_transformer(int level, uInt work_buffer_cap, int* error_code);
+
+/**
+ * @brief Acquires a raw deflate uncompression transformer, for data without any zlib or gzip wrapper
+ *
+ * @param work_buffer_cap
+ * @param error_code
+ * @return GoZLibTransformer
+ */
+GoZLibTransformer* acquire_raw_uncompression_transformer(uInt work_buffer_cap, int* error_code);
+
 /**
  * @brief Releases an uncompression transformer
  *
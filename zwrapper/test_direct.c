@@ -1,6 +1,7 @@
 #include "gozlib.h"
 #include "test_only_utils.h"
 #include <assert.h>
+#include <pthread.h>
 #include <stdint.h>
 #include <stdio.h>
 #include <string.h>
@@ -138,6 +139,324 @@ void test_fail_transform_uncompress_invalid_input(void) {
   ASSERT_MSG(uncompressed_len == 0, "uncompressing invalid data should return zero");
 }
 
+void test_zlib_compress_uncompress_with_dictionary(void) {
+  PRINT_TEST_NAME;
+
+  const uInt length = 1024;
+  const uInt output_length = length + 100;
+  char dictionary[length];
+  char input[length];
+  char compressed[output_length];
+  char uncompressed[length];
+
+  init_input_buffer_rand(dictionary, length);
+  // the input is mostly the same as the dictionary so it should compress to a fraction of its size
+  memcpy(input, dictionary, length);
+  input[length / 2] = 'x';
+
+  int ec = Z_OK;
+  uLong compressed_len = zlib_compress_buffer_with_dictionary(Z_BEST_COMPRESSION, dictionary, length, input, length, compressed, output_length, &ec);
+  ASSERT_MSG(ec == Z_OK, "compressing with a dictionary should return error code Z_OK");
+  ASSERT_MSG(compressed_len < length / 10, "compressing data present in the dictionary should be efficient");
+
+  uLong uncompressed_len = zlib_uncompress_buffer_with_dictionary(dictionary, length, compressed, (uInt)compressed_len, uncompressed, length, &ec);
+  ASSERT_MSG(ec == Z_OK, "uncompressing with a dictionary should return error code Z_OK");
+  ASSERT_MSG(uncompressed_len == length, "uncompressed length should be equal to input length");
+  ASSERT_MSG(memcmp(input, uncompressed, length) == 0, "uncompressed data should be equal to input");
+
+  uncompress_buffer_any(compressed, (uInt)compressed_len, uncompressed, length, &ec);
+  ASSERT_MSG(ec == Z_NEED_DICT, "uncompressing without the dictionary should fail");
+}
+
+void test_deflate_inflate_step_consecutive_streams(void) {
+  PRINT_TEST_NAME;
+
+  const uInt length = 700;
+  const uInt output_length = length + 100;
+  char input[length];
+  // two compressed streams back to back
+  char compressed[output_length * 2];
+  char uncompressed[length];
+
+  init_input_buffer_rand(input, length);
+
+  int ec = Z_OK;
+  z_streamp dzs = acquire_deflate_stream(Z_BEST_SPEED, MAX_WBITS, Z_DEFAULT_STRATEGY, &ec);
+  ASSERT_MSG(ec == Z_OK, "acquiring a deflate stream should succeed");
+
+  uInt consumed = 0;
+  uInt first_len = 0;
+  int code = deflate_step(dzs, input, length, compressed, output_length, Z_FINISH, &consumed, &first_len);
+  ASSERT_MSG(code == Z_STREAM_END, "deflating with enough output should end the stream");
+  ASSERT_MSG(consumed == length, "deflating should consume all input");
+
+  deflateReset(dzs);
+  uInt second_len = 0;
+  code = deflate_step(dzs, input, length, compressed + first_len, output_length, Z_FINISH, &consumed, &second_len);
+  ASSERT_MSG(code == Z_STREAM_END, "deflating after a reset should end the stream");
+  release_deflate_stream(dzs);
+
+  z_streamp izs = acquire_inflate_stream(MAX_WBITS, &ec);
+  ASSERT_MSG(ec == Z_OK, "acquiring an inflate stream should succeed");
+
+  for (uInt offset = 0, stream = 0; stream < 2; stream++) {
+    uInt produced = 0;
+    inflateReset(izs);
+    code = inflate_step(izs, compressed + offset, first_len + second_len - offset, uncompressed, length, Z_NO_FLUSH, &consumed, &produced);
+    ASSERT_MSG(code == Z_STREAM_END, "inflating should end the stream");
+    ASSERT_MSG(consumed == (stream == 0 ? first_len : second_len), "inflating should consume exactly one stream");
+    ASSERT_MSG(produced == length, "inflating should produce the original length");
+    ASSERT_MSG(memcmp(input, uncompressed, length) == 0, "inflated data should be equal to input");
+    offset += consumed;
+  }
+
+  release_inflate_stream(izs);
+}
+
+void test_deflate_step_with_dictionary_after_reset(void) {
+  PRINT_TEST_NAME;
+
+  const uInt length = 1024;
+  const uInt output_length = length + 100;
+  char dictionary[length];
+  char input[length];
+  char compressed[output_length];
+  char uncompressed[length];
+
+  init_input_buffer_rand(dictionary, length);
+  memcpy(input, dictionary, length);
+
+  int ec = Z_OK;
+  z_streamp gzs = acquire_deflate_stream(Z_BEST_COMPRESSION, COMPRESS_GZIP_WINDOW_BITS, Z_DEFAULT_STRATEGY, &ec);
+  ASSERT_MSG(set_compression_dictionary(gzs, dictionary, length) == Z_STREAM_ERROR, "gzip streams should not accept a dictionary");
+  release_deflate_stream(gzs);
+
+  z_streamp dzs = acquire_deflate_stream(Z_BEST_COMPRESSION, MAX_WBITS, Z_DEFAULT_STRATEGY, &ec);
+  ASSERT_MSG(ec == Z_OK, "acquiring a deflate stream should succeed");
+
+  uInt consumed = 0;
+  uInt compressed_len = 0;
+  for (int stream = 0; stream < 2; stream++) {
+    // the dictionary is discarded by the reset and must be set again for each stream
+    deflateReset(dzs);
+    ASSERT_MSG(set_compression_dictionary(dzs, dictionary, length) == Z_OK, "setting the dictionary should succeed");
+    int code = deflate_step(dzs, input, length, compressed, output_length, Z_FINISH, &consumed, &compressed_len);
+    ASSERT_MSG(code == Z_STREAM_END, "deflating with enough output should end the stream");
+    ASSERT_MSG(compressed_len < length / 10, "compressing data present in the dictionary should be efficient");
+  }
+  release_deflate_stream(dzs);
+
+  uLong uncompressed_len = zlib_uncompress_buffer_with_dictionary(dictionary, length, compressed, compressed_len, uncompressed, length, &ec);
+  ASSERT_MSG(ec == Z_OK, "uncompressing with the dictionary should return error code Z_OK");
+  ASSERT_MSG(uncompressed_len == length, "uncompressed length should be equal to input length");
+  ASSERT_MSG(memcmp(input, uncompressed, length) == 0, "uncompressed data should be equal to input");
+}
+
+void test_copy_inflate_stream(void) {
+  PRINT_TEST_NAME;
+
+  const uInt length = 4000;
+  const uInt half = length / 2;
+  char input[length];
+  char compressed[length + 100];
+  char uncompressed[length];
+  char copy_uncompressed[length];
+
+  init_input_buffer_rand(input, length);
+
+  int ec = Z_OK;
+  z_streamp dzs = acquire_deflate_stream(Z_BEST_SPEED, MAX_WBITS, Z_DEFAULT_STRATEGY, &ec);
+  uInt consumed = 0;
+  uInt compressed_len = 0;
+  deflate_step(dzs, input, length, compressed, length + 100, Z_FINISH, &consumed, &compressed_len);
+  release_deflate_stream(dzs);
+
+  z_streamp izs = acquire_inflate_stream(MAX_WBITS, &ec);
+  uInt produced = 0;
+  int code = inflate_step(izs, compressed, compressed_len, uncompressed, half, Z_NO_FLUSH, &consumed, &produced);
+  ASSERT_MSG(code == Z_OK, "inflating the first half should succeed");
+  ASSERT_MSG(produced == half, "inflating should fill the output");
+
+  z_streamp czs = copy_inflate_stream(izs, &ec);
+  ASSERT_MSG(ec == Z_OK, "copying an inflate stream should succeed");
+  memcpy(copy_uncompressed, uncompressed, half);
+
+  uInt copy_consumed = 0;
+  code = inflate_step(czs, compressed + consumed, compressed_len - consumed, copy_uncompressed + half, length - half, Z_NO_FLUSH, &copy_consumed, &produced);
+  ASSERT_MSG(code == Z_STREAM_END, "the copy should inflate the rest of the stream");
+  ASSERT_MSG(memcmp(input, copy_uncompressed, length) == 0, "the copy should produce the original data");
+
+  code = inflate_step(izs, compressed + consumed, compressed_len - consumed, uncompressed + half, length - half, Z_NO_FLUSH, &consumed, &produced);
+  ASSERT_MSG(code == Z_STREAM_END, "the source should be unaffected by the copy");
+  ASSERT_MSG(memcmp(input, uncompressed, length) == 0, "the source should produce the original data");
+
+  release_inflate_stream(czs);
+  release_inflate_stream(izs);
+}
+
+void test_native_pool_usage_tracks_allocations(void) {
+  PRINT_TEST_NAME;
+
+  uint32_t sizes[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t held[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t idle[GOZLIB_NATIVE_POOL_COUNT];
+
+  uint32_t filled = native_pool_usage(sizes, held, idle, GOZLIB_NATIVE_POOL_COUNT);
+  ASSERT_MSG(filled == GOZLIB_NATIVE_POOL_COUNT, "all pools should be reported");
+  ASSERT_MSG(sizes[0] == 512, "the first pool should be the smallest multipool class");
+  uint32_t in_use = held[1] - idle[1];
+
+  void *data = pool_alloc(1000);
+  native_pool_usage(sizes, held, idle, GOZLIB_NATIVE_POOL_COUNT);
+  ASSERT_MSG(sizes[1] == 1024, "a 1000 bytes block should come from the 1024 bytes class");
+  ASSERT_MSG(held[1] - idle[1] == in_use + 1, "an allocated block should be reported in use");
+
+  pool_free(data);
+  native_pool_usage(sizes, held, idle, GOZLIB_NATIVE_POOL_COUNT);
+  ASSERT_MSG(held[1] - idle[1] == in_use, "a freed block should be reported idle");
+
+  ASSERT_MSG(native_pool_usage(sizes, held, idle, 2) == 2, "no more entries than requested should be filled");
+}
+
+static uint32_t native_pool_in_use(uint32_t index) {
+  uint32_t sizes[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t held[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t idle[GOZLIB_NATIVE_POOL_COUNT];
+
+  native_pool_usage(sizes, held, idle, GOZLIB_NATIVE_POOL_COUNT);
+  return held[index] - idle[index];
+}
+
+void test_reset_uncompression_transformer_releasing_window(void) {
+  PRINT_TEST_NAME;
+
+  // the 32Kb inflate window comes from the 32768 bytes multipool class
+  const uint32_t window_class = 6;
+  const uInt length = 1000;
+  const uInt output_length = length + 100;
+  char input[length];
+  char compressed[output_length];
+  char uncompressed[length];
+
+  init_input_buffer_rand(input, length);
+  int ec = Z_OK;
+  uLong compressed_len = zlib_compress_buffer(Z_BEST_SPEED, input, length, compressed, output_length, &ec);
+  ASSERT_MSG(ec == Z_OK, "compressing should succeed");
+
+  GoZLibTransformer *transformer = acquire_uncompression_transformer(1024, &ec);
+  ASSERT_MSG(ec == Z_OK, "acquiring an uncompression transformer should succeed");
+
+  for (int round = 0; round < 2; round++) {
+    uint32_t in_use = native_pool_in_use(window_class);
+
+    transformer->zs->next_in = (Bytef *)compressed;
+    transformer->zs->avail_in = (uInt)compressed_len;
+    transformer->zs->next_out = (Bytef *)uncompressed;
+    // zlib only needs the window when the stream doesn't complete in a single call
+    transformer->zs->avail_out = length / 2;
+    int code = inflate(transformer->zs, Z_NO_FLUSH);
+    ASSERT_MSG(code == Z_OK, "uncompressing half the data should succeed");
+    transformer->zs->avail_out = length - length / 2;
+    code = inflate(transformer->zs, Z_NO_FLUSH);
+    ASSERT_MSG(code == Z_STREAM_END, "uncompressing should end the stream");
+    ASSERT_MSG(memcmp(input, uncompressed, length) == 0, "uncompressed data should be equal to input");
+    ASSERT_MSG(native_pool_in_use(window_class) == in_use + 1, "uncompressing should allocate the window");
+
+    code = reset_uncompression_transformer_releasing_window(transformer, MAX_WBITS + 32);
+    ASSERT_MSG(code == Z_OK, "resetting should succeed");
+    ASSERT_MSG(native_pool_in_use(window_class) == in_use, "resetting should release the window");
+  }
+
+  release_uncompression_transformer(transformer);
+}
+
+void test_native_pool_release_idle(void) {
+  PRINT_TEST_NAME;
+
+  void *data = pool_alloc(1000);
+  pool_free(data);
+
+  uint32_t sizes[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t held[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t idle[GOZLIB_NATIVE_POOL_COUNT];
+  native_pool_usage(sizes, held, idle, GOZLIB_NATIVE_POOL_COUNT);
+  uint32_t in_use = held[1] - idle[1];
+  ASSERT_MSG(idle[1] > 0, "a freed block should be idle");
+
+  ASSERT_MSG(native_pool_release_idle() > 0, "idle blocks should be released");
+  native_pool_usage(sizes, held, idle, GOZLIB_NATIVE_POOL_COUNT);
+  ASSERT_MSG(idle[1] == 0, "no block should be idle after releasing");
+  ASSERT_MSG(held[1] == in_use, "released blocks should not be held");
+
+  data = pool_alloc(1000);
+  ASSERT_MSG(data != NULL, "pools should remain usable after releasing idle blocks");
+  pool_free(data);
+}
+
+#define RELEASE_IDLE_THREAD_COUNT 4
+#define RELEASE_IDLE_ITERATIONS 20000
+
+static void *alloc_free_blocks(void *arg) {
+  uint32_t size = *(uint32_t *)arg;
+  for (int i = 0; i < RELEASE_IDLE_ITERATIONS; i++) {
+    char *data = pool_alloc(size);
+    ASSERT_MSG(data != NULL, "allocating while releasing idle blocks should succeed");
+    memset(data, i, size);
+    pool_free(data);
+  }
+  return NULL;
+}
+
+void test_native_pool_release_idle_concurrent(void) {
+  PRINT_TEST_NAME;
+
+  pthread_t threads[RELEASE_IDLE_THREAD_COUNT];
+  uint32_t sizes[RELEASE_IDLE_THREAD_COUNT];
+  for (uint32_t i = 0; i < RELEASE_IDLE_THREAD_COUNT; i++) {
+    sizes[i] = 1000 * (i + 1);
+    ASSERT_MSG(pthread_create(&threads[i], NULL, alloc_free_blocks, &sizes[i]) == 0, "creating a thread should succeed");
+  }
+
+  for (int i = 0; i < 1000; i++) {
+    native_pool_release_idle();
+  }
+
+  for (int i = 0; i < RELEASE_IDLE_THREAD_COUNT; i++) {
+    pthread_join(threads[i], NULL);
+  }
+}
+
+void test_unpooled_transformer_bypasses_pools(void) {
+  PRINT_TEST_NAME;
+
+  const uInt length = 5000;
+  const uInt output_length = length + 100;
+  char input[length];
+  char compressed[output_length];
+
+  init_input_buffer_rand(input, length);
+  uint32_t held_before[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t held_after[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t sizes[GOZLIB_NATIVE_POOL_COUNT];
+  uint32_t idle[GOZLIB_NATIVE_POOL_COUNT];
+  native_pool_usage(sizes, held_before, idle, GOZLIB_NATIVE_POOL_COUNT);
+
+  GoZLibTransformer *transformer = alloc_transformer(1024, false);
+  int code = init_compression_transformer(transformer, Z_BEST_SPEED, MAX_WBITS + 16, Z_DEFAULT_STRATEGY);
+  ASSERT_MSG(code == Z_OK, "initializing an unpooled transformer should succeed");
+
+  transformer->zs->next_in = (Bytef *)input;
+  transformer->zs->avail_in = length;
+  transformer->zs->next_out = (Bytef *)compressed;
+  transformer->zs->avail_out = output_length;
+  code = deflate(transformer->zs, Z_FINISH);
+  ASSERT_MSG(code == Z_STREAM_END, "compressing with an unpooled transformer should succeed");
+  release_compression_transformer(transformer);
+
+  native_pool_usage(sizes, held_after, idle, GOZLIB_NATIVE_POOL_COUNT);
+  ASSERT_MSG(memcmp(held_before, held_after, sizeof(held_before)) == 0, "no pool should allocate blocks for an unpooled transformer");
+}
+
 int main(void) {
   test_zlib_compress();
   test_gzip_compress();
@@ -152,5 +471,17 @@ int main(void) {
 
   test_fail_transform_uncompress_invalid_input();
 
+  test_zlib_compress_uncompress_with_dictionary();
+
+  test_deflate_inflate_step_consecutive_streams();
+  test_deflate_step_with_dictionary_after_reset();
+  test_copy_inflate_stream();
+
+  test_native_pool_usage_tracks_allocations();
+  test_reset_uncompression_transformer_releasing_window();
+  test_native_pool_release_idle();
+  test_native_pool_release_idle_concurrent();
+  test_unpooled_transformer_bypasses_pools();
+
   return 0;
 }
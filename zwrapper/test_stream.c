@@ -283,6 +283,126 @@ void test_zlib_compress_stream_compressed_larger_than_input(void) {
   verify_uncompress_stream(zlib_compress_buffer, init_input_buffer_high_entropy);
 }
 
+void test_uncompress_discard_step(void) {
+  PRINT_TEST_NAME;
+
+  const uInt len = 4096;
+  const uInt scratch_len = 100;
+  const uLong discard_len = 1500;
+  char original_input[len];
+  char compressed_input[len + 100];
+  char scratch[scratch_len];
+  char output[len];
+
+  init_input_buffer_rand(original_input, len);
+
+  int ec = Z_OK;
+  uLong compressed_len = gzip_compress_buffer(Z_BEST_COMPRESSION, original_input, len, compressed_input, len + 100, &ec);
+  ASSERT_MSG(ec == Z_OK, "compression error code should be Z_OK");
+
+  z_stream zs;
+  memset(&zs, 0, sizeof(z_stream));
+  ASSERT_MSG(inflateInit2(&zs, MAX_WBITS + 32) == Z_OK, "inflate initialization should succeed");
+  zs.next_in = (Bytef *)compressed_input;
+  zs.avail_in = (uInt)compressed_len;
+
+  uLong discarded = 0;
+  int discard_code = uncompress_discard_step(&zs, scratch, scratch_len, discard_len, &discarded);
+  ASSERT_MSG(discard_code == GOZLIB_STREAM_OUTPUT_HAS_MORE_DATA, "discarding should stop once the requested length is reached");
+  ASSERT_MSG(discarded == discard_len, "discarded length should be the requested length");
+
+  zs.next_out = (Bytef *)output;
+  zs.avail_out = len;
+  ASSERT_MSG(inflate(&zs, Z_FINISH) == Z_STREAM_END, "the remaining data should be uncompressed");
+  ASSERT_MSG(zs.total_out == len, "the total uncompressed length should include discarded data");
+  ASSERT_MSG(memcmp(original_input + discard_len, output, len - discard_len) == 0, "data after the discarded bytes should be the same as original input");
+
+  inflateEnd(&zs);
+}
+
+void test_uncompress_discard_step_needs_dictionary(void) {
+  PRINT_TEST_NAME;
+
+  const uInt len = 1024;
+  const uInt scratch_len = 4096;
+  char dictionary[len];
+  char original_input[len];
+  char compressed_input[len + 100];
+  char scratch[scratch_len];
+
+  init_input_buffer_rand(dictionary, len);
+  memcpy(original_input, dictionary, len);
+
+  int ec = Z_OK;
+  uLong compressed_len = zlib_compress_buffer_with_dictionary(Z_BEST_COMPRESSION, dictionary, len, original_input, len, compressed_input, len + 100, &ec);
+  ASSERT_MSG(ec == Z_OK, "compression error code should be Z_OK");
+
+  z_stream zs;
+  memset(&zs, 0, sizeof(z_stream));
+  ASSERT_MSG(inflateInit2(&zs, MAX_WBITS) == Z_OK, "inflate initialization should succeed");
+  zs.next_in = (Bytef *)compressed_input;
+  zs.avail_in = (uInt)compressed_len;
+
+  uLong discarded = 0;
+  int discard_code = uncompress_discard_step(&zs, scratch, scratch_len, len, &discarded);
+  ASSERT_MSG(discard_code == Z_NEED_DICT, "discarding should stop when the dictionary is needed");
+  ASSERT_MSG(discarded == 0, "nothing should be discarded before the dictionary is set");
+
+  ASSERT_MSG(set_uncompression_dictionary(&zs, scratch, len) == Z_DATA_ERROR, "setting the wrong dictionary should fail");
+  ASSERT_MSG(set_uncompression_dictionary(&zs, dictionary, len) == Z_OK, "setting the dictionary should succeed");
+
+  discard_code = uncompress_discard_step(&zs, scratch, scratch_len, len + 1, &discarded);
+  ASSERT_MSG(discard_code == Z_STREAM_END, "the stream should end once the dictionary is set");
+  ASSERT_MSG(discarded == len, "discarded length should be the uncompressed length");
+  ASSERT_MSG(memcmp(original_input, scratch, len) == 0, "uncompressed data should be the same as the original input");
+
+  inflateEnd(&zs);
+}
+
+void test_validate_stream(void) {
+  PRINT_TEST_NAME;
+
+  const uInt len = 20000;
+  const uInt compressed_cap = len + 100;
+  char original_input[len];
+  char compressed_input[compressed_cap];
+
+  init_input_buffer_rand(original_input, len);
+
+  int ec = Z_OK;
+  uLong compressed_len = gzip_compress_buffer(Z_BEST_COMPRESSION, original_input, len, compressed_input, compressed_cap, &ec);
+  ASSERT_MSG(ec == Z_OK, "compression error code should be Z_OK");
+
+  ZStreamState zss;
+  DataStreamer streamer = make_data_streamer();
+  streamer.input = compressed_input;
+  streamer.in_len = (uInt)compressed_len;
+  zss.data_handler = &streamer;
+
+  uLong uncompressed_len = validate_stream_any(&zss, in_handler, 512, &ec);
+  ASSERT_MSG(ec == Z_OK, "validating a valid stream should have error code Z_OK");
+  ASSERT_MSG(uncompressed_len == len, "validated length should be the same as the original input length");
+
+  // corrupt the checksum
+  compressed_input[compressed_len - 8] = (char)~compressed_input[compressed_len - 8];
+  streamer = make_data_streamer();
+  streamer.input = compressed_input;
+  streamer.in_len = (uInt)compressed_len;
+  zss.data_handler = &streamer;
+
+  validate_stream_any(&zss, in_handler, 512, &ec);
+  ASSERT_MSG(ec == Z_DATA_ERROR, "validating a stream with a bad checksum should fail");
+
+  streamer = make_data_streamer();
+  streamer.input = compressed_input;
+  streamer.in_len = (uInt)compressed_len / 2;
+  zss.data_handler = &streamer;
+
+  ec = Z_OK;
+  validate_stream_any(&zss, in_handler, 512, &ec);
+  ASSERT_MSG(ec == Z_BUF_ERROR, "validating a truncated stream should fail");
+}
+
 int main(void) {
   test_gzip_compress_stream();
   test_gzip_compress_stream_zero_input();
@@ -302,5 +422,9 @@ int main(void) {
   test_gzip_compress_stream_compressed_larger_than_input();
   test_zlib_compress_stream_compressed_larger_than_input();
 
+  test_uncompress_discard_step();
+  test_uncompress_discard_step_needs_dictionary();
+  test_validate_stream();
+
   return 0;
 }